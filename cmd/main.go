@@ -5,17 +5,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/labstack/echo/v4"
 	log "github.com/sirupsen/logrus"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/api"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/handler"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/jobs"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/regions"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/secretstore"
 )
 
+// SHUTDOWN_TIMEOUT is the time the running requests are given to finish on shutdown
+const SHUTDOWN_TIMEOUT = 30 * time.Second
+
 func main() {
 	// setup database connection
 	db := repository.NewPostgresConnector()
@@ -56,12 +66,28 @@ func main() {
 	log.Infof("Connected to database: %s/%s", params.Host, params.DBName)
 
 	// init search index
-	searchIndex, err := repository.NewOSClient(secStore)
+	searchIndex, err := initSearchIndex(secStore)
 	if err != nil {
 		log.Fatal(fmt.Errorf("can not connect to search index: %w", err))
 	}
 
-	handler := handler.NewHandler(db, *searchIndex, nil)
+	// load the named regions usable as spatial filters
+	regionsDir := os.Getenv("REGIONS_DIR")
+	if regionsDir != "" {
+		err = regions.LoadDir(regionsDir)
+		if err != nil {
+			log.Fatal(fmt.Errorf("can not load regions: %w", err))
+		}
+		log.Infof("Loaded %d regions from %s", len(regions.List()), regionsDir)
+	}
+
+	// start the workers of the download jobs
+	jobManager, err := initJobs()
+	if err != nil {
+		log.Fatal(fmt.Errorf("can not start download jobs: %w", err))
+	}
+
+	handler := handler.NewHandler(db, searchIndex, jobManager, nil)
 	echoAPI := api.InitializeAPI(handler, secStore)
 
 	// start api server
@@ -69,7 +95,72 @@ func main() {
 	if port == "" {
 		port = "80"
 	}
-	log.Fatal(echoAPI.Start(":" + port))
+	err = serve(echoAPI, ":"+port)
+	// cancel the running download jobs and wait for their workers before the database is closed
+	jobManager.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve runs the api server until it fails or SIGINT or SIGTERM is received
+// On a signal the server stops accepting connections and waits up to SHUTDOWN_TIMEOUT for the running requests
+func serve(e *echo.Echo, address string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- e.Start(address)
+	}()
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+		log.Info("Shutting down api server")
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	err := e.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("can not shut down api server: %w", err)
+	}
+	return nil
+}
+
+// initSearchIndex returns the search index to query sample documents
+// if env-var SEARCH_INDEX_FIXTURE is set, the documents are loaded from that JSON file into memory instead of connecting to opensearch
+func initSearchIndex(secStore secretstore.SecretStore) (repository.SearchIndex, error) {
+	fixture := os.Getenv("SEARCH_INDEX_FIXTURE")
+	if fixture != "" {
+		return repository.NewMemoryIndex(fixture)
+	}
+	return repository.NewOSClient(secStore)
+}
+
+// initJobs returns the manager of the download jobs configured by the env-vars
+// DOWNLOAD_DIR (storage directory), DOWNLOAD_WORKERS (concurrent jobs), DOWNLOAD_QUEUE (queued jobs) and DOWNLOAD_EXPIRY (duration a file is kept, e.g. 24h)
+func initJobs() (*jobs.Manager, error) {
+	config := jobs.Config{Dir: os.Getenv("DOWNLOAD_DIR")}
+	var err error
+	if workers := os.Getenv("DOWNLOAD_WORKERS"); workers != "" {
+		config.Workers, err = strconv.Atoi(workers)
+		if err != nil {
+			return nil, fmt.Errorf("Can not cast env-var DOWNLOAD_WORKERS to int: %+v", workers)
+		}
+	}
+	if queue := os.Getenv("DOWNLOAD_QUEUE"); queue != "" {
+		config.Queue, err = strconv.Atoi(queue)
+		if err != nil {
+			return nil, fmt.Errorf("Can not cast env-var DOWNLOAD_QUEUE to int: %+v", queue)
+		}
+	}
+	if expiry := os.Getenv("DOWNLOAD_EXPIRY"); expiry != "" {
+		config.Expiry, err = time.ParseDuration(expiry)
+		if err != nil {
+			return nil, fmt.Errorf("Can not parse env-var DOWNLOAD_EXPIRY as duration: %+v", expiry)
+		}
+	}
+	return jobs.NewManager(config)
 }
 
 // buildConnectionString builds the database connection string from vault- and env-vars
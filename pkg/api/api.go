@@ -37,7 +37,7 @@ import (
 //	@securityDefinitions.apikey	ApiKeyAuth
 //	@in							header
 //	@name						DIGIS-API-ACCESSKEY
-//	@description				Accesskey based security scheme to secure api groups "/queries/*" and "/geodata/*"
+//	@description				Accesskey based security scheme to secure api groups "/queries/*", "/geodata/*", "/download/*" and the v2 groups "/downloads/*" and "/ogc/*"
 
 // @host		api-test.georoc.eu
 // @schemes	https http
@@ -51,7 +51,7 @@ func InitializeAPI(h *handler.Handler, secStore secretstore.SecretStore) *echo.E
 	e.Use(emw.CORSWithConfig(
 		emw.CORSConfig{
 			AllowOrigins: []string{"*"},
-			AllowMethods: []string{http.MethodGet, http.MethodHead},
+			AllowMethods: []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodDelete},
 			AllowHeaders: []string{"*"},
 		},
 	))
@@ -148,8 +148,39 @@ func InitializeAPI(h *handler.Handler, secStore secretstore.SecretStore) *echo.E
 	v2_queries.Use(middleware.GetAccessKeyMiddleware(secStore))
 	// Sample filtering
 	v2_queries.GET("/samples", h.GetSampleIDStreamed_v2)
-	// Clustering
+	v2_queries.POST("/samples/search", h.PostSamplesSearch_v2)
+	v2_queries.GET("/samples/facets", h.GetSampleFacets_v2)
+	// Vocabularies
+	v2_queries.GET("/suggest", h.GetSuggestions_v2)
+	// Accesskey geodata
 	v2_geoData := v2.Group("/geodata")
+	v2_geoData.Use(middleware.GetAccessKeyMiddleware(secStore))
+	// Clustering
 	v2_geoData.GET("/samplesclustered", h.GetSamplesClustered_v2)
+	v2_geoData.POST("/samplesclustered/search", h.PostSamplesClustered_v2)
+	v2_geoData.GET("/clusters/:tileKey/samples", h.GetClusterSamples_v2)
+	// Vector tiles
+	v2_geoData.GET("/tiles/:z/:x/:y", h.GetTile_v2)
+	// Density grids
+	v2_geoData.GET("/density", h.GetDensity_v2)
+	// Named regions
+	v2_geoData.GET("/regions", h.GetRegions_v2)
+	// Download jobs
+	v2_downloads := v2.Group("/downloads")
+	v2_downloads.Use(middleware.GetAccessKeyMiddleware(secStore))
+	v2_downloads.POST("", h.PostDownload_v2)
+	v2_downloads.GET("/:jobID", h.GetDownload_v2)
+	v2_downloads.GET("/:jobID/file", h.GetDownloadFile_v2)
+	v2_downloads.DELETE("/:jobID", h.DeleteDownload_v2)
+	// OGC API Features
+	ogc := v2.Group("/ogc")
+	ogc.Use(middleware.GetAccessKeyMiddleware(secStore))
+	ogc.GET("", h.GetOGCLandingPage_v2)
+	ogc.GET("/conformance", h.GetOGCConformance_v2)
+	ogc.GET("/collections", h.GetOGCCollections_v2)
+	ogc.GET("/collections/:collectionId", h.GetOGCCollection_v2)
+	ogc.GET("/collections/:collectionId/queryables", h.GetOGCQueryables_v2)
+	ogc.GET("/collections/:collectionId/items", h.GetOGCItems_v2)
+	ogc.GET("/collections/:collectionId/items/:featureId", h.GetOGCItem_v2)
 	return e
 }
@@ -17,7 +17,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/middleware"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/download"
-	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/sql"
@@ -26,6 +26,8 @@ import (
 const (
 	PARAM_FORMAT   = "format"
 	QP_SAMPLE_LIST = "sampleids"
+	// QP_KML_STYLE selects the attribute the placemarks of kml and kmz files are styled by
+	QP_KML_STYLE = "styleby"
 
 	CONCURRENT_TASKS = 10
 	BATCH_SIZE       = 100
@@ -34,13 +36,14 @@ const (
 // GetDataDownloadByIDs godoc
 //
 //	@Summary		Retrieve download data for the given sample IDs
-//	@Description	get the full data for a list of sample IDs as a csv or xlsx file
+//	@Description	get the full data for a list of sample IDs as a csv, xlsx, kml or kmz file
 //	@Security		ApiKeyAuth
 //	@Tags			download
 //	@Accept			json
 //	@Produce		plain
 //	@Param			sampleids	query		string	true	"List of Sample identifiers"
-//	@Param			format		query		string	true	"Desired output format: csv (default) or xlsx"
+//	@Param			format		query		string	true	"Desired output format: csv (default), xlsx, kml or kmz"
+//	@Param			styleby		query		string	false	"Attribute the kml and kmz placemarks are styled by: rockclass (default) or setting"
 //	@Success		200			{file}		file
 //	@Failure		401			{object}	string
 //	@Failure		404			{object}	string
@@ -79,7 +82,7 @@ func (h *Handler) GetDataDownloadByIDs(c echo.Context) error {
 		return c.File(fileName)
 	}
 	c.Response().Header().Set("Content-Disposition", "attachment; filename="+fileName)
-	c.Response().Header().Set("Content-Type", "text/csv")
+	c.Response().Header().Set("Content-Type", download.ContentType(targetFormat))
 	// query the full data for each given identifier
 	samples, err := repository.Query[model.FullData](c.Request().Context(), h.db, sql.FullDataByMultiIdQuery, identifierList)
 	if err != nil {
@@ -87,10 +90,10 @@ func (h *Handler) GetDataDownloadByIDs(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "Can not retrieve full data")
 	}
 
-	data, err := formatData(samples, targetFormat)
+	data, err := formatData(samples, targetFormat, c.QueryParam(QP_KML_STYLE))
 	if err != nil {
 		logger.Errorf("Can not format given data as %s: %s", targetFormat, err.Error())
-		return c.String(http.StatusInternalServerError, "Data formatting failed (supported formats are 'csv' and 'xlsx')")
+		return c.String(http.StatusInternalServerError, "Data formatting failed (supported formats are 'csv', 'xlsx', 'kml' and 'kmz')")
 	}
 
 	// write the formatted data to the download file and set the response headers
@@ -108,23 +111,27 @@ func (h *Handler) GetDataDownloadByIDs(c echo.Context) error {
 // GetDataDownloadByFilter godoc
 //
 //	@Summary		Retrieve download data for the given filters
-//	@Description	get the full data for the given filters as a csv or xlsx file
+//	@Description	get the full data for the given filters as a csv, xlsx, kml or kmz file
+//	@Description	Large downloads should be requested as download job by POST /v2/downloads to avoid timeouts
 //	@Description	Filter DSL syntax:
 //	@Description	FIELD=OPERATOR:VALUE
-//	@Description	where FIELD is one of the accepted query params; OPERATOR is one of "lt" (<), "gt" (>), "eq" (=), "in" (IN), "lk" (LIKE), "btw" (BETWEEN)
+//	@Description	where FIELD is one of the accepted query params; OPERATOR is one of "lt" (<), "lte" (<=), "gt" (>), "gte" (>=), "eq" (=), "ne" (!=), "in" (IN), "nin" (NOT IN), "lk" (LIKE), "btw" (BETWEEN), "exists", "missing"
 //	@Description	and VALUE is an unquoted string, integer or decimal
 //	@Description	Multiple VALUEs for an "in"-filter must be comma-separated and will be interpreted as a discunctive filter.
-//	@Description	The OPERATORs "lt", "gt" and "btw" are only applicable to numerical values.
+//	@Description	The OPERATORs "lt", "lte", "gt", "gte" and "btw" are only applicable to numerical values.
 //	@Description	The OPERATOR "lk" is only applicable to string values and supports wildcards `*`(0 or more chars) and `?`(one char).
 //	@Description	The OPERATOR "btw" accepts two comma-separated values as the inclusive lower and upper bound. Missing values are assumed as 0 and 9999999 respectively.
+//	@Description	The OPERATORs "exists" and "missing" take no VALUE (e.g. doi=exists:) and match if the FIELD has any value or no value respectively.
 //	@Description	If no OPERATOR is specified, "eq" is assumed as the default OPERATOR.
 //	@Description	The filters are evaluated conjunctively.
+//	@Description	Disjunctions are given as or=FIELD=OPERATOR:VALUE|FIELD=OPERATOR:VALUE where at least one of the filters has to match. All FIELDs of a disjunction must be filtered in the same table, e.g. setting and location1.
 //	@Description	Note that applying more filters can slow down the query as more tables have to be considered in the evaluation.
 //	@Security		ApiKeyAuth
 //	@Tags			download
 //	@Accept			json
 //	@Produce		plain
-//	@Param			format				query		string	true	"Desired output format: csv (default) or xlsx"
+//	@Param			format				query		string	true	"Desired output format: csv (default), xlsx, kml or kmz"
+//	@Param			styleby				query		string	false	"Attribute the kml and kmz placemarks are styled by: rockclass (default) or setting"
 //	@Param			limit				query		int		false	"limit"
 //	@Param			offset				query		int		false	"offset"
 //	@Param			setting				query		string	false	"tectonic setting - see /queries/sites/settings (supports Filter DSL)"
@@ -142,7 +149,7 @@ func (h *Handler) GetDataDownloadByIDs(c echo.Context) error {
 //	@Param			inclusionmaterial	query		string	false	"inclusion material - see /queries/samples/inclusionmaterials (supports Filter DSL)"
 //	@Param			sampletech			query		string	false	"sampling technique - see /queries/samples/samplingtechniques (supports Filter DSL)"
 //	@Param			rimorcore			query		string	false	"rim or core - R = Rim, C = Core, I = Intermediate (supports Filter DSL)"
-//	@Param			chemistry			query		string	false	"chemical filter using the form `(TYPE,ELEMENT,MIN,MAX),...` where the filter tuples are evaluated conjunctively"
+//	@Param			chemistry			query		string	false	"chemical filter using tuples `(TYPE,ELEMENT,MIN,MAX[,UNIT[,METHOD]])` or comparisons `ELEMENT>=VALUE` (>, >=, <, <=, =) joined by `,`, `AND` or `OR` and evaluated from left to right; ELEMENT can be a ratio like `La/Yb`"
 //	@Param			title				query		string	false	"title of publication (supports Filter DSL)"
 //	@Param			publicationyear		query		string	false	"publication year (supports Filter DSL)"
 //	@Param			doi					query		string	false	"DOI (supports Filter DSL)"
@@ -153,7 +160,8 @@ func (h *Handler) GetDataDownloadByIDs(c echo.Context) error {
 //	@Param			geoage				query		string	false	"Specimen geological age - see /queries/samples/geoages (supports Filter DSL)"
 //	@Param			geoageprefix		query		string	false	"Specimen geological age prefix - see /queries/samples/geoageprefixes (supports Filter DSL)"
 //	@Param			lab					query		string	false	"Laboratory name - see /queries/samples/organizationnames (supports Filter DSL)"
-//	@Param			polygon				query		string	false	"Coordinate-Polygon formatted as 2-dimensional json array: [[LONG,LAT],[2.4,6.3]]"
+//	@Param			or					query		string	false	"disjunction of filters formatted as FIELD=OPERATOR:VALUE|FIELD=OPERATOR:VALUE"
+//	@Param			polygon				query		string	false	"Coordinate-Polygon formatted as 2-dimensional json array: [[LONG,LAT],[2.4,6.3]] or as GeoJSON Polygon, MultiPolygon, Feature or FeatureCollection - holes are excluded"
 //	@Param			addcoordinates		query		bool	false	"Add coordinates to each sample"
 //	@Success		200					{file}		file
 //	@Failure		401					{object}	string
@@ -165,26 +173,13 @@ func (h *Handler) GetDataDownloadByFilter(c echo.Context) error {
 	if !ok {
 		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
 	}
-	// get polygon filter
-	coordData := map[string]interface{}{}
-	polygonString, _, err := parseParam(c.QueryParam(QP_POLY))
+	// parse filters
+	filters, err := filter.Parse(c.QueryParams(), QP_LIMIT, QP_OFFSET, QP_ADD_COORDINATES, PARAM_FORMAT, QP_KML_STYLE)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "Can not parse polygon")
+		logger.Errorf("can not parse filters: %s", err.Error())
+		return invalidFilters(c, err)
 	}
-	if polygonString != "" {
-		polygon, err := geometry.ParsePointArray(polygonString)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "Can not parse polygon")
-		}
-		boundaryPoly, translationFactorPoly, err := geometry.CalcTranslation(polygon)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "Can not calculate polygon translation - polygon too big")
-		}
-		coordData[KEY_POLYGON] = polygon
-		coordData[KEY_TRANSLATION_FACTOR_POLY] = translationFactorPoly
-		coordData[KEY_BOUNDARY_POLY] = boundaryPoly
-	}
-	query, err := buildSampleFilterQuery(c, coordData, nil)
+	query, err := filter.ToSQL(filters)
 	if err != nil {
 		return c.String(http.StatusUnprocessableEntity, err.Error())
 	}
@@ -206,7 +201,7 @@ func (h *Handler) GetDataDownloadByFilter(c echo.Context) error {
 	}
 	fileName := fmt.Sprintf("GEOROC_data_download_%s_%s.%s", c.Request().Header.Get("requestID"), time.Now().Format("20060102"), targetFormat)
 	c.Response().Header().Set("Content-Disposition", "attachment; filename="+fileName)
-	c.Response().Header().Set("Content-Type", "text/csv")
+	c.Response().Header().Set("Content-Type", download.ContentType(targetFormat))
 
 	results, err := repository.Query[model.SampleByFilters](c.Request().Context(), h.db, query.GetQueryString(), query.GetFilterValues()...)
 	if err != nil {
@@ -261,10 +256,10 @@ Listener:
 			}
 		}
 	}
-	data, err := formatData(samples, targetFormat)
+	data, err := formatData(samples, targetFormat, c.QueryParam(QP_KML_STYLE))
 	if err != nil {
 		logger.Errorf("Can not format given data as %s: %s", targetFormat, err.Error())
-		return c.String(http.StatusInternalServerError, "Data formatting failed (supported formats are 'csv' and 'xlsx')")
+		return c.String(http.StatusInternalServerError, "Data formatting failed (supported formats are 'csv', 'xlsx', 'kml' and 'kmz')")
 	}
 
 	// write the formatted data to the download file and set the response headers
@@ -302,12 +297,16 @@ func startWorker(context context.Context, errChan chan error, resultChan chan mo
 
 // formatData takes a list of full sample data
 // and formats it according to the current GEOROC output format in the specified data format
-func formatData(samples []model.FullData, targetFormat string) ([]byte, error) {
+// kml and kmz placemarks are styled by the attribute styleBy
+func formatData(samples []model.FullData, targetFormat string, styleBy string) ([]byte, error) {
 	if targetFormat == download.CSV || targetFormat == download.XLSX {
 		formatter := download.GetFormatter(targetFormat)
 		return formatter.FormatData(samples)
 	}
-	return nil, fmt.Errorf("Invalid format '%s': must be one of 'csv' or 'xlsx'", targetFormat)
+	if targetFormat == download.KML || targetFormat == download.KMZ {
+		return download.NewKMLFormatter(styleBy, targetFormat == download.KMZ).FormatData(samples)
+	}
+	return nil, fmt.Errorf("Invalid format '%s': must be one of 'csv', 'xlsx', 'kml' or 'kmz'", targetFormat)
 }
 
 // cleanupDownloadFile deletes the download file and closes it
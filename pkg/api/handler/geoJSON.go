@@ -5,26 +5,50 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/middleware"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/download"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/sql"
 )
 
+const (
+	// STREAM_FLUSH_SIZE is the number of streamed features after which the response is flushed
+	STREAM_FLUSH_SIZE = 500
+
+	FORMAT_GEOJSON = "geojson"
+)
+
 // GetGeoJSONSites godoc
 //	@Summary		Retrieve site data as GeoJSON
-//	@Description	get site data in GeoJSON format
+//	@Description	get the sites of the samples matching the filters as GeoJSON FeatureCollection
+//	@Description	Each feature is the point of a site identified by its locationID with the number of matching samples per material as property materials
+//	@Description	The foreign members numberMatched, numberReturned, timeStamp, bbox and links hold the totals and the links to this and the next page
+//	@Description	The response is streamed, so all sites can be exported by omitting the limit
+//	@Description	With format kml or kmz the sites are returned as Google Earth file with placemarks styled by tectonic setting in folders of location1 and location2
+//	@Description	All other query params are applied as filters of the Filter DSL of GET /queries/samples
 //	@Security		ApiKeyAuth
 //	@Tags			geodata
 //	@Accept			json
-//	@Produce		json
-//	@Param			limit	query		int	false	"limit"
-//	@Param			offset	query		int	false	"offset"
+//	@Produce		application/geo+json
+//	@Produce		application/vnd.google-earth.kml+xml
+//	@Produce		application/vnd.google-earth.kmz
+//	@Param			format	query		string	false	"Output format: geojson (default), kml or kmz"
+//	@Param			bbox	query		string	false	"Bounding box formatted as 2-dimensional json array: [[SW_Long,SW_Lat],[SE_Long,SE_Lat],[NE_Long,NE_Lat],[NW_Long,NW_Lat]]"
+//	@Param			limit	query		int		false	"limit"
+//	@Param			offset	query		int		false	"offset"
 //	@Success		200		{object}	model.GeoJSONFeatureCollection
+//	@Failure		400		{object}	string
 //	@Failure		401		{object}	string
 //	@Failure		404		{object}	string
 //	@Failure		422		{object}	string
@@ -35,53 +59,259 @@ func (h *Handler) GetGeoJSONSites(c echo.Context) error {
 	if !ok {
 		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
 	}
-
-	query := sql.NewQuery(sql.GeoJSONQuery)
+	targetFormat := c.QueryParam(PARAM_FORMAT)
+	if targetFormat != "" && targetFormat != FORMAT_GEOJSON && targetFormat != download.KML && targetFormat != download.KMZ {
+		return c.String(http.StatusBadRequest, "Invalid format - must be one of 'geojson', 'kml' or 'kmz'")
+	}
+	f, err := filter.Parse(c.QueryParams(), QP_BBOX, QP_LIMIT, QP_OFFSET, PARAM_FORMAT)
+	if err != nil {
+		logger.Errorf("can not parse filters: %s", err.Error())
+		return invalidFilters(c, err)
+	}
+	var bbox []model.SimplePoint
+	if bboxS := c.QueryParam(QP_BBOX); bboxS != "" {
+		bbox, err = geometry.ParsePointArray(bboxS)
+		if err != nil || len(bbox) != 4 {
+			logger.Errorf("Invalid bbox: %v", err)
+			return c.String(http.StatusBadRequest, "Invalid bbox")
+		}
+		bbox = geometry.NormalizeBBox(geometry.TruncateBBox(bbox))
+	}
 	limit, offset, err := handlePaginationParams(c)
 	if err != nil {
 		logger.Errorf("Invalid pagination params: %v", err)
 		return c.String(http.StatusUnprocessableEntity, "Invalid pagination parameters")
 	}
+
+	query, err := filteredSitesQuery(f, bbox)
+	if err != nil {
+		return c.String(http.StatusUnprocessableEntity, err.Error())
+	}
 	query.AddLimit(limit)
 	query.AddOffset(offset)
-	sites, err := repository.Query[model.GeoJSONSite](c.Request().Context(), h.db, query.GetQueryString())
+
+	if targetFormat == download.KML || targetFormat == download.KMZ {
+		// the placemarks are grouped in folders, so the sites can not be streamed
+		sites, err := repository.Query[model.GeoJSONSiteSummary](c.Request().Context(), h.db, query.GetQueryString(), query.GetFilterValues()...)
+		if err != nil {
+			logger.Errorf("Can not GeoJSONSites: %v", err)
+			return c.String(http.StatusInternalServerError, "Can not retrieve site data")
+		}
+		data, err := download.FormatSites(sites, targetFormat == download.KMZ)
+		if err != nil {
+			logger.Errorf("Can not format sites as %s: %v", targetFormat, err)
+			return c.String(http.StatusInternalServerError, "Data formatting failed")
+		}
+		fileName := fmt.Sprintf("GEOROC_sites_%s.%s", time.Now().Format("20060102"), targetFormat)
+		c.Response().Header().Set("Content-Disposition", "attachment; filename="+fileName)
+		return c.Blob(http.StatusOK, download.ContentType(targetFormat), data)
+	}
+
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	resultChan := make(chan model.GeoJSONSiteSummary)
+	errChan := make(chan error)
+	// stop the query and release the channels if the response is aborted
+	defer drainStream(resultChan, errChan)
+	defer cancel()
+	go repository.QueryStream(ctx, resultChan, errChan, h.db, query.GetQueryString(), query.GetFilterValues()...)
+
+	stream := newSiteStream(c)
+Listener:
+	for {
+		select {
+		case site, ok := <-resultChan:
+			if !ok {
+				// errChan is closed after resultChan
+				resultChan = nil
+				continue
+			}
+			if err := stream.write(site); err != nil {
+				logger.Errorf("Can not write GeoJSONSites: %v", err)
+				return nil
+			}
+		case err, ok := <-errChan:
+			if !ok {
+				break Listener
+			}
+			logger.Errorf("Can not GeoJSONSites: %v", err)
+			if !stream.started {
+				return c.String(http.StatusInternalServerError, "Can not retrieve geoJSON site data")
+			}
+			// the status is already sent, so the truncated FeatureCollection is the only sign of the error
+			return nil
+		}
+	}
+	if stream.numberReturned == 0 && offset > 0 {
+		// numberMatched is read from the sites of the page, so it is counted separately for an offset past the last site
+		countQuery, err := filteredSitesQuery(f, bbox)
+		if err != nil {
+			return c.String(http.StatusUnprocessableEntity, err.Error())
+		}
+		countQuery.WrapInSQL(sql.GeoJSONSitesCountPrefix, sql.GeoJSONSitesPostfix)
+		counts, err := repository.Query[model.GeoJSONSiteCount](c.Request().Context(), h.db, countQuery.GetQueryString(), countQuery.GetFilterValues()...)
+		if err != nil || len(counts) != 1 {
+			logger.Errorf("Can not count GeoJSONSites: %v", err)
+			return c.String(http.StatusInternalServerError, "Can not retrieve geoJSON site data")
+		}
+		stream.numberMatched = counts[0].NumSites
+	}
+	next := ""
+	if limit > 0 && offset+stream.numberReturned < stream.numberMatched {
+		next = QP_OFFSET + "=" + strconv.Itoa(offset+stream.numberReturned)
+	}
+	if err := stream.close(pageLinks(c, next)); err != nil {
+		logger.Errorf("Can not write GeoJSONSites: %v", err)
+	}
+	return nil
+}
+
+// filteredSitesQuery returns the query of the sites of the samples matching the filters inside the bbox; bbox may be nil
+func filteredSitesQuery(f filter.Filter, bbox []model.SimplePoint) (*sql.Query, error) {
+	query, err := filter.ToSQL(f)
 	if err != nil {
-		logger.Errorf("Can not GeoJSONSites: %v", err)
-		return c.String(http.StatusInternalServerError, "Can not retrieve geoJSON site data")
+		return nil, err
 	}
-	response := model.GeoJSONFeatureCollection{
-		Type:           model.GEOJSONTYPE_FEATURECOLLECTION,
-		NumberMatched:  len(sites),
-		NumberReturned: len(sites),
-		Features:       buildFeatures(sites),
+	query.WrapInSQL(sql.GeoJSONFilteredSitesPrefix, sql.GeoJSONFilteredSitesSamples)
+	if bbox != nil {
+		addSitesBBox(query, sql.GeoJSONFilteredSitesBBoxFilter, bbox)
 	}
-	return c.JSON(http.StatusOK, response)
+	query.AddSQLBlock(sql.GeoJSONFilteredSitesPostfix)
+	return query, nil
+}
+
+// siteStream encodes the sites as GeoJSON FeatureCollection directly into the response
+type siteStream struct {
+	c              echo.Context
+	started        bool
+	numberMatched  int
+	numberReturned int
+	// bbox holds the bounds [WEST, SOUTH, EAST, NORTH] of the written sites
+	bbox []float64
 }
 
-// buildFeatures takes a list of query results and populates GeoJSONFeatures with the data
-func buildFeatures(sites []model.GeoJSONSite) []model.GeoJSONFeature {
-	featureList := []model.GeoJSONFeature{}
-	for i, result := range sites {
-		feature := model.GeoJSONFeature{
-			Type: model.GEOJSONTYPE_FEATURE,
-			ID:   fmt.Sprintf("%d", i),
-			Geometry: model.Geometry{
-				Type:        model.GEOJSON_GEOMETRY_POINT,
-				Coordinates: []interface{}{result.Longitude, result.Latitude},
-			},
-			Properties: map[string]interface{}{
-				"latitude":               result.Latitude,
-				"longitude":              result.Longitude,
-				"num_samplingfeatureids": result.NumSamplingFeatureIDs,
-				"samplingfeatureids":     result.SamplingFeatureIDs,
-				"setting":                result.Setting,
-				"loc1":                   result.Loc1,
-				"loc2":                   result.Loc2,
-				"loc3":                   result.Loc3,
-				"land_or_sea":            result.LandOrSea,
-			},
+// siteStreamMembers holds the foreign members written after the features
+type siteStreamMembers struct {
+	NumberMatched  int             `json:"numberMatched"`
+	NumberReturned int             `json:"numberReturned"`
+	TimeStamp      string          `json:"timeStamp"`
+	BBox           []float64       `json:"bbox,omitempty"`
+	Links          []model.OGCLink `json:"links"`
+}
+
+func newSiteStream(c echo.Context) *siteStream {
+	return &siteStream{c: c}
+}
+
+// start sends the headers and the opening of the FeatureCollection
+func (s *siteStream) start() error {
+	s.started = true
+	s.c.Response().Header().Set(echo.HeaderContentType, MIME_GEOJSON)
+	s.c.Response().WriteHeader(http.StatusOK)
+	_, err := s.c.Response().Write([]byte(`{"type":"FeatureCollection","features":[`))
+	return err
+}
+
+// write encodes the site as feature of the FeatureCollection
+func (s *siteStream) write(site model.GeoJSONSiteSummary) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	feature := siteFeature(site.GeoJSONSite)
+	feature.Properties["materials"] = site.Materials
+	data, err := json.Marshal(feature)
+	if err != nil {
+		return err
+	}
+	if s.numberReturned > 0 {
+		data = append([]byte(","), data...)
+	}
+	if _, err := s.c.Response().Write(data); err != nil {
+		return err
+	}
+	s.numberMatched = site.NumMatched
+	s.numberReturned++
+	if site.Latitude != nil && site.Longitude != nil {
+		lon, lat := *site.Longitude, *site.Latitude
+		if s.bbox == nil {
+			s.bbox = []float64{lon, lat, lon, lat}
+		}
+		s.bbox = []float64{min(s.bbox[0], lon), min(s.bbox[1], lat), max(s.bbox[2], lon), max(s.bbox[3], lat)}
+	}
+	// send the sites in chunks instead of buffering the whole export
+	if s.numberReturned%STREAM_FLUSH_SIZE == 0 {
+		s.c.Response().Flush()
+	}
+	return nil
+}
+
+// close writes the foreign members and closes the FeatureCollection
+func (s *siteStream) close(links []model.OGCLink) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	members, err := json.Marshal(siteStreamMembers{
+		NumberMatched:  s.numberMatched,
+		NumberReturned: s.numberReturned,
+		TimeStamp:      time.Now().UTC().Format(time.RFC3339),
+		BBox:           s.bbox,
+		Links:          links,
+	})
+	if err != nil {
+		return err
+	}
+	// continue the FeatureCollection object with the members of the encoded object
+	members[0] = ','
+	if _, err := s.c.Response().Write(append([]byte("]"), members...)); err != nil {
+		return err
+	}
+	s.c.Response().Flush()
+	return nil
+}
+
+// drainStream receives the remaining results of repository.QueryStream until both channels are closed
+func drainStream[T any](resultChan chan T, errChan chan error) {
+	for {
+		select {
+		case _, ok := <-resultChan:
+			if !ok {
+				resultChan = nil
+			}
+		case _, ok := <-errChan:
+			if !ok {
+				return
+			}
 		}
-		featureList = append(featureList, feature)
 	}
-	return featureList
+}
+
+// siteFeature returns the site as point feature identified by its locationID
+func siteFeature(site model.GeoJSONSite) model.GeoJSONFeature {
+	id := ""
+	if site.LocationID != nil {
+		id = strconv.Itoa(*site.LocationID)
+	}
+	return model.GeoJSONFeature{
+		Type: model.GEOJSONTYPE_FEATURE,
+		ID:   id,
+		Geometry: model.Geometry{
+			Type:        model.GEOJSON_GEOMETRY_POINT,
+			Coordinates: []interface{}{site.Longitude, site.Latitude},
+		},
+		Properties: map[string]interface{}{
+			"latitude":               site.Latitude,
+			"longitude":              site.Longitude,
+			"locationID":             site.LocationID,
+			"num_samplingfeatureids": site.NumSamplingFeatureIDs,
+			"samplingfeatureids":     site.SamplingFeatureIDs,
+			"setting":                site.Setting,
+			"loc1":                   site.Loc1,
+			"loc2":                   site.Loc2,
+			"loc3":                   site.Loc3,
+			"land_or_sea":            site.LandOrSea,
+		},
+	}
 }
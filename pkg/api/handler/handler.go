@@ -5,6 +5,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -12,6 +13,8 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/middleware"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/jobs"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/sql"
 )
@@ -25,14 +28,17 @@ const (
 type Handler struct {
 	db          repository.PostgresConnector
 	config      *middleware.KeycloakConfig
-	searchIndex repository.OSClient
+	searchIndex repository.SearchIndex
+	// jobs runs the download jobs; nil if download jobs are not available
+	jobs *jobs.Manager
 }
 
 // NewHandler returns a pointer to a new Handler instance
-func NewHandler(db repository.PostgresConnector, searchIndex repository.OSClient, config *middleware.KeycloakConfig) *Handler {
+func NewHandler(db repository.PostgresConnector, searchIndex repository.SearchIndex, jobs *jobs.Manager, config *middleware.KeycloakConfig) *Handler {
 	return &Handler{
 		db:          db,
 		searchIndex: searchIndex,
+		jobs:        jobs,
 		config:      config,
 	}
 }
@@ -106,6 +112,15 @@ func handlePaginationParams(c echo.Context) (int, int, error) {
 	return limVal, offVal, nil
 }
 
+// invalidFilters returns the response for filters that can not be parsed
+// Invalid polygons are described, since they can not be corrected by the user otherwise
+func invalidFilters(c echo.Context, err error) error {
+	if errors.Is(err, geometry.ErrInvalidPolygon) {
+		return c.String(http.StatusUnprocessableEntity, fmt.Sprintf("Invalid filters: %s", err.Error()))
+	}
+	return c.String(http.StatusUnprocessableEntity, "Invalid filters")
+}
+
 // parseParam parses a given query parameter and validates the contents
 func parseParam(queryParam string) (string, string, error) {
 	if queryParam == "" {
@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/handler"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/middleware"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/jobs"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/regions"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
+)
+
+const (
+	FIXTURE         = "fixtures/samples.json"
+	REGION_FIXTURES = "fixtures/regions"
+)
+
+func newHandler(t *testing.T) *handler.Handler {
+	index, err := repository.NewMemoryIndex(FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler.NewHandler(nil, index, nil, nil)
+}
+
+// get runs the handler function on a GET request with the query params and returns the recorded response
+func get(t *testing.T, h echo.HandlerFunc, params url.Values, pathParams ...string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/?"+params.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	// path params are given as name value pairs
+	names, values := []string{}, []string{}
+	for i := 0; i+1 < len(pathParams); i += 2 {
+		names = append(names, pathParams[i])
+		values = append(values, pathParams[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	err := middleware.Logger(h)(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// TestSamplesDocumentedParams requests GET /v2/queries/samples with each query param of its godoc
+func TestSamplesDocumentedParams(t *testing.T) {
+	h := newHandler(t)
+	err := regions.LoadDir(REGION_FIXTURES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := url.Values{
+		"limit":             {"10"},
+		"offset":            {"0"},
+		"sort":              {"publicationyear:desc"},
+		"fields":            {"sampleID,latitude"},
+		"measurements":      {"SiO2"},
+		"setting":           {"RIFT VOLCANICS"},
+		"location1":         {"ICELAND"},
+		"location2":         {"lk:REYK*"},
+		"location3":         {"missing:"},
+		"latitude":          {"gt:60"},
+		"longitude":         {"btw:-30,-10"},
+		"rocktype":          {"VOLCANIC ROCK"},
+		"rockclassID":       {"1"},
+		"mineral":           {"OLIVINE"},
+		"material":          {"ne:GLASS"},
+		"inclusiontype":     {"missing:"},
+		"hostmaterial":      {"missing:"},
+		"hostmineral":       {"missing:"},
+		"inclusionmaterial": {"missing:"},
+		"inclusionmineral":  {"missing:"},
+		"sampletech":        {"missing:"},
+		"rimorcore":         {"missing:"},
+		"chemistry":         {"SiO2>=40"},
+		"title":             {"lk:*basalts"},
+		"publicationyear":   {"gte:2000"},
+		"doi":               {"missing:"},
+		"firstname":         {"missing:"},
+		"lastname":          {"missing:"},
+		"agemin":            {"missing:"},
+		"agemax":            {"missing:"},
+		"geoage":            {"missing:"},
+		"geoageprefix":      {"missing:"},
+		"lab":               {"missing:"},
+		"or":                {"setting=RIFT VOLCANICS|mineral=QUARTZ"},
+		"q":                 {"basalt"},
+		"near":              {"-21.9,64.1,50"},
+		"region":            {"iceland"},
+		"geotile":           {"0/0/0"},
+		"polygon":           {"[[-30,60],[-10,60],[-10,70],[-30,70]]"},
+		"polygon_geojson":   {`{"type":"Polygon","coordinates":[[[-30,60],[-10,60],[-10,70],[-30,70],[-30,60]]]}`},
+		"addcoordinates":    {"true"},
+	}
+	// the cursor of a full page continues after its last sample
+	rec := get(t, h.GetSampleIDStreamed_v2, url.Values{"limit": {"1"}})
+	page := model.SampleByFilterResponse{}
+	err = json.Unmarshal(rec.Body.Bytes(), &page)
+	if err != nil || page.NextCursor == "" {
+		t.Fatalf("Expected a next cursor but got %s", rec.Body.String())
+	}
+	tests.Set("cursor", page.NextCursor)
+	for param, values := range tests {
+		rec := get(t, h.GetSampleIDStreamed_v2, url.Values{param: values})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Param %s=%s: expected status 200 but got %d: %s", param, values[0], rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	dir := t.TempDir()
+	m, err := jobs.NewManager(jobs.Config{Dir: dir, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	h := handler.NewHandler(nil, nil, m, nil)
+	job, err := m.Submit("export.csv", func(ctx context.Context, w io.Writer, progress func(int, int)) error {
+		_, err := w.Write([]byte("sampleID\n1\n"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		status, err := m.Get(job.ID)
+		if err == nil && status.Status == model.JOB_DONE {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish: %+v %v", status, err)
+		}
+	}
+
+	rec := get(t, h.GetDownloadFile_v2, url.Values{}, "jobID", job.ID)
+	if rec.Code != http.StatusOK || rec.Body.String() != "sampleID\n1\n" || !strings.Contains(rec.Header().Get(echo.HeaderContentDisposition), "export.csv") {
+		t.Fatalf("Expected the file as attachment but got %d %v: %s", rec.Code, rec.Header(), rec.Body.String())
+	}
+	// a file removed from the storage directory is gone while the job is known
+	err = os.Remove(filepath.Join(dir, jobs.FILE_PREFIX+job.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := get(t, h.GetDownloadFile_v2, url.Values{}, "jobID", job.ID); rec.Code != http.StatusGone {
+		t.Fatalf("Expected status 410 but got %d", rec.Code)
+	}
+	if rec := get(t, h.GetDownloadFile_v2, url.Values{}, "jobID", "unknown"); rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 but got %d", rec.Code)
+	}
+}
+
+func TestDensityH3(t *testing.T) {
+	h := newHandler(t)
+	rec := get(t, h.GetDensity_v2, url.Values{"grid": {"h3"}, "resolution": {"2"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d: %s", rec.Code, rec.Body.String())
+	}
+	collection := model.GeoJSONFeatureCollection{}
+	err := json.Unmarshal(rec.Body.Bytes(), &collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collection.Features) == 0 || collection.Truncated {
+		t.Fatalf("Expected the hexagons of the samples but got %s", rec.Body.String())
+	}
+	for _, feature := range collection.Features {
+		ring, ok := feature.Geometry.Coordinates[0].([]any)
+		if feature.Geometry.Type != model.GEOJSON_GEOMETRY_POLYGON || !ok || len(ring) != 7 {
+			t.Errorf("Expected a closed hexagon for cell %s but got %+v", feature.ID, feature.Geometry)
+		}
+	}
+	if rec := get(t, h.GetDensity_v2, url.Values{"grid": {"h3"}, "resolution": {"16"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for resolution 16 but got %d", rec.Code)
+	}
+}
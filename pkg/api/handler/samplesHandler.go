@@ -14,6 +14,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/middleware"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
@@ -72,13 +73,6 @@ const (
 	CLUSTER_THRESHOLD_BBOX   = 7  // if bbox width is smaller than this threshold, do not cluster at all
 	CLUSTER_ID_NO_CLUSTERING = -1 // use this ID for cluster-query without actual clustering (to keep the same result shape)
 
-	KEY_BBOX                    = "key_bbox"
-	KEY_TRANSLATION_FACTOR      = "key_translation_factor"
-	KEY_BOUNDARY                = "key_boundary"
-	KEY_POLYGON                 = "key_polygon"
-	KEY_TRANSLATION_FACTOR_POLY = "key_translation_factor_poly"
-	KEY_BOUNDARY_POLY           = "key_boundary_poly"
-
 	RESPONSE_BUFFER_SIZE = 10
 )
 
@@ -121,14 +115,16 @@ func (h *Handler) GetSampleByID(c echo.Context) error {
 //	@Description	Get all samplingfeatureIDs matching the current filters
 //	@Description	Filter DSL syntax:
 //	@Description	FIELD=OPERATOR:VALUE
-//	@Description	where FIELD is one of the accepted query params; OPERATOR is one of "lt" (<), "gt" (>), "eq" (=), "in" (IN), "lk" (LIKE), "btw" (BETWEEN)
+//	@Description	where FIELD is one of the accepted query params; OPERATOR is one of "lt" (<), "lte" (<=), "gt" (>), "gte" (>=), "eq" (=), "ne" (!=), "in" (IN), "nin" (NOT IN), "lk" (LIKE), "btw" (BETWEEN), "exists", "missing"
 //	@Description	and VALUE is an unquoted string, integer or decimal
 //	@Description	Multiple VALUEs for an "in"-filter must be comma-separated and will be interpreted as a discunctive filter.
-//	@Description	The OPERATORs "lt", "gt" and "btw" are only applicable to numerical values.
+//	@Description	The OPERATORs "lt", "lte", "gt", "gte" and "btw" are only applicable to numerical values.
 //	@Description	The OPERATOR "lk" is only applicable to string values and supports wildcards `*`(0 or more chars) and `?`(one char).
 //	@Description	The OPERATOR "btw" accepts two comma-separated values as the inclusive lower and upper bound. Missing values are assumed as 0 and 9999999 respectively.
+//	@Description	The OPERATORs "exists" and "missing" take no VALUE (e.g. doi=exists:) and match if the FIELD has any value or no value respectively.
 //	@Description	If no OPERATOR is specified, "eq" is assumed as the default OPERATOR.
 //	@Description	The filters are evaluated conjunctively.
+//	@Description	Disjunctions are given as or=FIELD=OPERATOR:VALUE|FIELD=OPERATOR:VALUE where at least one of the filters has to match. All FIELDs of a disjunction must be filtered in the same table, e.g. setting and location1.
 //	@Description	Note that applying more filters can slow down the query as more tables have to be considered in the evaluation.
 //	@Security		ApiKeyAuth
 //	@Tags			samples
@@ -151,7 +147,7 @@ func (h *Handler) GetSampleByID(c echo.Context) error {
 //	@Param			inclusionmaterial	query		string	false	"inclusion material - see /queries/samples/inclusionmaterials (supports Filter DSL)"
 //	@Param			sampletech			query		string	false	"sampling technique - see /queries/samples/samplingtechniques (supports Filter DSL)"
 //	@Param			rimorcore			query		string	false	"rim or core - R = Rim, C = Core, I = Intermediate (supports Filter DSL)"
-//	@Param			chemistry			query		string	false	"chemical filter using the form `(TYPE,ELEMENT,MIN,MAX),...` where the filter tuples are evaluated conjunctively"
+//	@Param			chemistry			query		string	false	"chemical filter using tuples `(TYPE,ELEMENT,MIN,MAX[,UNIT[,METHOD]])` or comparisons `ELEMENT>=VALUE` (>, >=, <, <=, =) joined by `,`, `AND` or `OR` and evaluated from left to right; ELEMENT can be a ratio like `La/Yb`"
 //	@Param			title				query		string	false	"title of publication (supports Filter DSL)"
 //	@Param			publicationyear		query		string	false	"publication year (supports Filter DSL)"
 //	@Param			doi					query		string	false	"DOI (supports Filter DSL)"
@@ -162,7 +158,10 @@ func (h *Handler) GetSampleByID(c echo.Context) error {
 //	@Param			geoage				query		string	false	"Specimen geological age - see /queries/samples/geoages (supports Filter DSL)"
 //	@Param			geoageprefix		query		string	false	"Specimen geological age prefix - see /queries/samples/geoageprefixes (supports Filter DSL)"
 //	@Param			lab					query		string	false	"Laboratory name - see /queries/samples/organizationnames (supports Filter DSL)"
-//	@Param			polygon				query		string	false	"Coordinate-Polygon formatted as 2-dimensional json array: [[LONG,LAT],[2.4,6.3]]"
+//	@Param			or					query		string	false	"disjunction of filters formatted as FIELD=OPERATOR:VALUE|FIELD=OPERATOR:VALUE"
+//	@Param			polygon				query		string	false	"Coordinate-Polygon formatted as 2-dimensional json array: [[LONG,LAT],[2.4,6.3]] or as GeoJSON Polygon, MultiPolygon, Feature or FeatureCollection - holes are excluded"
+//	@Param			near				query		string	false	"Radius around a point formatted as LONG,LAT,RADIUS_KM, e.g. 14.99,37.75,50"
+//	@Param			region				query		string	false	"Named region id as listed by GET /v2/geodata/regions, e.g. aleutian_arc"
 //	@Param			addcoordinates		query		bool	false	"Add coordinates to each sample"
 //	@Success		200					{object}	model.SampleByFilterResponse
 //	@Failure		401					{object}	string
@@ -175,26 +174,13 @@ func (h *Handler) GetSamplesFiltered(c echo.Context) error {
 	if !ok {
 		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
 	}
-	// get polygon filter
-	coordData := map[string]interface{}{}
-	polygonString, _, err := parseParam(c.QueryParam(QP_POLY))
+	// parse filters
+	f, err := filter.Parse(c.QueryParams(), QP_LIMIT, QP_OFFSET, QP_ADD_COORDINATES)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "Can not parse polygon")
+		logger.Errorf("can not parse filters: %s", err.Error())
+		return invalidFilters(c, err)
 	}
-	if polygonString != "" {
-		polygon, err := geometry.ParsePointArray(polygonString)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "Can not parse polygon")
-		}
-		boundaryPoly, translationFactorPoly, err := geometry.CalcTranslation(polygon)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "Can not calculate polygon translation - polygon too big")
-		}
-		coordData[KEY_POLYGON] = polygon
-		coordData[KEY_TRANSLATION_FACTOR_POLY] = translationFactorPoly
-		coordData[KEY_BOUNDARY_POLY] = boundaryPoly
-	}
-	query, err := buildSampleFilterQuery(c, coordData, nil)
+	query, err := filter.ToSQL(f)
 	if err != nil {
 		return c.String(http.StatusUnprocessableEntity, err.Error())
 	}
@@ -260,14 +246,16 @@ func (h *Handler) GetSamplesFiltered(c echo.Context) error {
 //	@Description	Get all samplingfeatureIDs matching the current filters clustered
 //	@Description	Filter DSL syntax:
 //	@Description	FIELD=OPERATOR:VALUE
-//	@Description	where FIELD is one of the accepted query params; OPERATOR is one of "lt" (<), "gt" (>), "eq" (=), "in" (IN), "lk" (LIKE), "btw" (BETWEEN)
+//	@Description	where FIELD is one of the accepted query params; OPERATOR is one of "lt" (<), "lte" (<=), "gt" (>), "gte" (>=), "eq" (=), "ne" (!=), "in" (IN), "nin" (NOT IN), "lk" (LIKE), "btw" (BETWEEN), "exists", "missing"
 //	@Description	and VALUE is an unquoted string, integer or decimal
 //	@Description	Multiple VALUEs for an "in"-filter must be comma-separated and will be interpreted as a discunctive filter.
-//	@Description	The OPERATORs "lt", "gt" and "btw" are only applicable to numerical values.
+//	@Description	The OPERATORs "lt", "lte", "gt", "gte" and "btw" are only applicable to numerical values.
 //	@Description	The OPERATOR "lk" is only applicable to string values and supports wildcards `*`(0 or more chars) and `?`(one char).
 //	@Description	The OPERATOR "btw" accepts two comma-separated values as the inclusive lower and upper bound. Missing values are assumed as 0 and 9999999 respectively.
+//	@Description	The OPERATORs "exists" and "missing" take no VALUE (e.g. doi=exists:) and match if the FIELD has any value or no value respectively.
 //	@Description	If no OPERATOR is specified, "eq" is assumed as the default OPERATOR.
 //	@Description	The filters are evaluated conjunctively.
+//	@Description	Disjunctions are given as or=FIELD=OPERATOR:VALUE|FIELD=OPERATOR:VALUE where at least one of the filters has to match. All FIELDs of a disjunction must be filtered in the same table, e.g. setting and location1.
 //	@Description	Note that applying more filters can slow down the query as more tables have to be considered in the evaluation.
 //	@Security		ApiKeyAuth
 //	@Tags			geodata
@@ -290,7 +278,7 @@ func (h *Handler) GetSamplesFiltered(c echo.Context) error {
 //	@Param			inclusionmineral	query		string	false	"inclusion mineral - see /queries/samples/inclusionmaterials (supports 'eq', 'in')"
 //	@Param			sampletech			query		string	false	"sampling technique - see /queries/samples/samplingtechniques (supports Filter DSL)"
 //	@Param			rimorcore			query		string	false	"rim or core - R = Rim, C = Core, I = Intermediate (supports Filter DSL)"
-//	@Param			chemistry			query		string	false	"chemical filter using the form `(TYPE,ELEMENT,MIN,MAX),...` where the filter tuples are evaluated conjunctively"
+//	@Param			chemistry			query		string	false	"chemical filter using tuples `(TYPE,ELEMENT,MIN,MAX[,UNIT[,METHOD]])` or comparisons `ELEMENT>=VALUE` (>, >=, <, <=, =) joined by `,`, `AND` or `OR` and evaluated from left to right; ELEMENT can be a ratio like `La/Yb`"
 //	@Param			title				query		string	false	"title of publication (supports Filter DSL)"
 //	@Param			publicationyear		query		string	false	"publication year (supports Filter DSL)"
 //	@Param			doi					query		string	false	"DOI (supports Filter DSL)"
@@ -301,7 +289,10 @@ func (h *Handler) GetSamplesFiltered(c echo.Context) error {
 //	@Param			geoage				query		string	false	"Specimen geological age - see /queries/samples/geoages (supports Filter DSL)"
 //	@Param			geoageprefix		query		string	false	"Specimen geological age prefix - see /queries/samples/geoageprefixes (supports Filter DSL)"
 //	@Param			lab					query		string	false	"Laboratory name - see /queries/samples/organizationnames (supports Filter DSL)"
-//	@Param			polygon				query		string	false	"Coordinate-Polygon formatted as 2-dimensional json array: [[LONG,LAT],[2.4,6.3]]"
+//	@Param			or					query		string	false	"disjunction of filters formatted as FIELD=OPERATOR:VALUE|FIELD=OPERATOR:VALUE"
+//	@Param			polygon				query		string	false	"Coordinate-Polygon formatted as 2-dimensional json array: [[LONG,LAT],[2.4,6.3]] or as GeoJSON Polygon, MultiPolygon, Feature or FeatureCollection - holes are excluded"
+//	@Param			near				query		string	false	"Radius around a point formatted as LONG,LAT,RADIUS_KM, e.g. 14.99,37.75,50"
+//	@Param			region				query		string	false	"Named region id as listed by GET /v2/geodata/regions, e.g. aleutian_arc"
 //	@Param			bbox				query		string	true	"BoundingBox formatted as 2-dimensional json array: [[SW_Long,SW_Lat],[SE_Long,SE_Lat],[NE_Long,NE_Lat],[NW_Long,NW_Lat]]"
 //	@Param			numClusters			query		int		false	"Number of clusters for k-means clustering. Default is 7. Can be more depending on maxDistance"
 //	@Param			maxDistance			query		int		false	"Max size of cluster. Recommended values per zoom-level: Z0: 50, Z1: 50, Z2: 25, Z4: 12 -> Zi = 50/i"
@@ -317,7 +308,6 @@ func (h *Handler) GetSamplesFilteredClustered(c echo.Context) error {
 	if !ok {
 		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
 	}
-	coordData := map[string]interface{}{}
 	// get the bbox
 	bboxString, _, err := parseParam(c.QueryParam(QP_BBOX))
 	if err != nil {
@@ -343,35 +333,17 @@ func (h *Handler) GetSamplesFilteredClustered(c echo.Context) error {
 	bbox = geometry.TruncateBBox(bbox)
 	// add first point again to make closed polygon shape
 	bbox = append(bbox, bbox[0])
-	boundary, translationFactor, err := geometry.CalcTranslation(bbox)
-	if err != nil {
-		return c.String(http.StatusInternalServerError, "Can not calculate bbox translation")
-	}
-	coordData[KEY_BBOX] = bbox
-	coordData[KEY_TRANSLATION_FACTOR] = translationFactor
-	coordData[KEY_BOUNDARY] = boundary
 
-	// get polygon filter
-	polygonString, _, err := parseParam(c.QueryParam(QP_POLY))
+	// parse filters
+	f, err := filter.Parse(c.QueryParams(), QP_BBOX, QP_NUM_CLUSTERS, QP_MAX_DISTANCE, QP_LIMIT, QP_OFFSET)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "Can not parse polygon")
-	}
-	if polygonString != "" {
-		polygon, err := geometry.ParsePointArray(polygonString)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "Can not parse polygon")
-		}
-		boundaryPoly, translationFactorPoly, err := geometry.CalcTranslation(polygon)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "Can not calculate polygon translation - polygon too big")
-		}
-		coordData[KEY_POLYGON] = polygon
-		coordData[KEY_TRANSLATION_FACTOR_POLY] = translationFactorPoly
-		coordData[KEY_BOUNDARY_POLY] = boundaryPoly
+		logger.Errorf("can not parse filters: %s", err.Error())
+		return invalidFilters(c, err)
 	}
+	f.BBox = filter.ShapeFromPoints(bbox)
 
 	// build query string
-	query, err := buildSampleFilterQuery(c, coordData, nil)
+	query, err := filter.ToSQL(f)
 	if err != nil {
 		return c.String(http.StatusUnprocessableEntity, err.Error())
 	}
@@ -1012,410 +984,6 @@ func (h *Handler) GetOrganizationNames(c echo.Context) error {
 	return c.JSON(http.StatusOK, response)
 }
 
-// buildSampleFilterQuery constructs a query using filter params from the request
-func buildSampleFilterQuery(c echo.Context, coordData map[string]interface{}, kwargs map[string]interface{}) (*sql.Query, error) {
-	query := sql.NewQuery(sql.GetSamplingfeatureIdsByFilterBaseQuery)
-	bbox := coordData[KEY_BBOX]
-	if bbox != nil {
-		query = sql.NewQuery("")
-		factor := coordData[KEY_TRANSLATION_FACTOR].(float64)
-		params := map[string]interface{}{
-			"translationFactor": -factor,
-		}
-		query.AddSQLBlockParametrized(sql.GetSamplingFeatureIdsByFilteBaseQueryTranslated, params)
-	}
-
-	// add optional search filters
-	junctor := sql.OpWhere // junctor to connect a new filter clause to the query: can be "WHERE" or "AND/OR"
-
-	// annotations
-	junctor = sql.OpWhere // reset junctor for new subquery
-	material, opMat, err := parseParam(c.QueryParam(QP_MATERIAL))
-	if err != nil {
-		return nil, err
-	}
-	incType, opIncType, err := parseParam(c.QueryParam(QP_INCTYPE))
-	if err != nil {
-		return nil, err
-	}
-	sampTech, opSampTech, err := parseParam(c.QueryParam(QP_SAMPTECH))
-	if err != nil {
-		return nil, err
-	}
-	rimOrCore, opRimOrCore, err := parseParam(c.QueryParam(QP_RIM_OR_CORE))
-	if err != nil {
-		return nil, err
-	}
-	if material != "" || incType != "" || sampTech != "" || rimOrCore != "" {
-		// add query module annotations
-		query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterAnnotationsStart)
-		// add sub-modules
-		if material != "" {
-			query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterAnnotationsMaterial)
-		}
-		if incType != "" {
-			query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterAnnotationsIncType)
-		}
-		if sampTech != "" {
-			query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterAnnotationsSampTech)
-		}
-		if rimOrCore != "" {
-			query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterAnnotationsRimOrCore)
-		}
-		// add annotation filters
-		if material != "" {
-			query.AddFilter("ann_mat.annotationtext", material, opMat, junctor)
-			junctor = sql.OpAnd
-		}
-		if incType != "" {
-			query.AddFilter("ann_inc_type.annotationtext", incType, opIncType, junctor)
-			junctor = sql.OpAnd
-		}
-		if sampTech != "" {
-			query.AddFilter("ann_stech.annotationtext", sampTech, opSampTech, junctor)
-			junctor = sql.OpAnd
-		}
-		if rimOrCore != "" {
-			query.AddFilter("ann_roc.annotationtext", rimOrCore, opRimOrCore, junctor)
-		}
-		query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterAnnotationsEnd)
-	}
-
-	// taxonomic classifiers
-	junctor = sql.OpWhere // reset junctor for new subquery
-	rockType, opRType, err := parseParam(c.QueryParam(QP_ROCKTYPE))
-	if err != nil {
-		return nil, err
-	}
-	rockClassID, opRClass, err := parseParam(c.QueryParam(QP_ROCKCLASS))
-	if err != nil {
-		return nil, err
-	}
-	mineral, opMin, err := parseParam(c.QueryParam(QP_MINERAL))
-	if err != nil {
-		return nil, err
-	}
-	hostMineral, opHostMineral, err := parseParam(c.QueryParam(QP_HOSTMAT))
-	if err != nil {
-		return nil, err
-	}
-	incMineral, opIncMineral, err := parseParam(c.QueryParam(QP_INCLUSIONMAT))
-	if err != nil {
-		return nil, err
-	}
-	if rockType != "" || rockClassID != "" || mineral != "" || hostMineral != "" || incMineral != "" {
-		// add query module taxonomic classifiers
-		query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterTaxonomicClassifiersStart)
-		// add taxonomic classifiers filters
-		junctor = sql.OpWhere
-		// we compare to arrays here, so we need to adapt the filters
-		if rockType != "" {
-			arrayOp, err := sql.MapArrayOperators(opRType)
-			if err != nil {
-				return nil, err
-			}
-			query.AddFilter("st.rocktypes", rockType, arrayOp, junctor)
-			junctor = sql.OpAnd
-		}
-		if rockClassID != "" {
-			arrayOp, err := sql.MapArrayOperators(opRClass)
-			if err != nil {
-				return nil, err
-			}
-			query.AddFilter("st.rockclassids::varchar[]", rockClassID, arrayOp, junctor)
-			junctor = sql.OpAnd
-		}
-		if mineral != "" {
-			arrayOp, err := sql.MapArrayOperators(opMin)
-			if err != nil {
-				return nil, err
-			}
-			query.AddFilter("st.minerals", mineral, arrayOp, junctor)
-			junctor = sql.OpAnd
-		}
-		if hostMineral != "" {
-			arrayOp, err := sql.MapArrayOperators(opHostMineral)
-			if err != nil {
-				return nil, err
-			}
-			query.AddFilter("st.hostMinerals", hostMineral, arrayOp, junctor)
-			junctor = sql.OpAnd
-		}
-		if incMineral != "" {
-			arrayOp, err := sql.MapArrayOperators(opIncMineral)
-			if err != nil {
-				return nil, err
-			}
-			query.AddFilter("st.incMinerals", incMineral, arrayOp, junctor)
-		}
-		query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterTaxonomicClassifiersEnd)
-	}
-
-	// location filters
-	junctor = sql.OpWhere // reset junctor for new subquery
-	setting, opSetting, err := parseParam(c.QueryParam(QP_SETTING))
-	if err != nil {
-		return nil, err
-	}
-	location1, opLoc1, err := parseParam(c.QueryParam(QP_LOC1))
-	if err != nil {
-		return nil, err
-	}
-	location2, opLoc2, err := parseParam(c.QueryParam(QP_LOC2))
-	if err != nil {
-		return nil, err
-	}
-	location3, opLoc3, err := parseParam(c.QueryParam(QP_LOC3))
-	if err != nil {
-		return nil, err
-	}
-	lat, opLat, err := parseParam(c.QueryParam(QP_LAT))
-	if err != nil {
-		return nil, err
-	}
-	long, opLong, err := parseParam(c.QueryParam(QP_LONG))
-	if err != nil {
-		return nil, err
-	}
-	if setting != "" || location1 != "" || location2 != "" || location3 != "" || lat != "" || long != "" {
-		// add query module Location
-		query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterLocationsStart)
-		// add location filters
-		if setting != "" {
-			query.AddFilter("gs.settingname", setting, opSetting, junctor)
-			junctor = sql.OpAnd // after first filter is added with "WHERE", change to "AND" for following filters
-		}
-		if location1 != "" {
-			query.AddFilter("toplevelloc.locationname", location1, opLoc1, junctor)
-			junctor = sql.OpAnd
-		}
-		if location2 != "" {
-			query.AddFilter("secondlevelloc.locationname", location2, opLoc2, junctor)
-			junctor = sql.OpAnd
-		}
-		if location3 != "" {
-			query.AddFilter("thirdlevelloc.locationname", location3, opLoc3, junctor)
-			junctor = sql.OpAnd
-		}
-		if lat != "" {
-			query.AddFilter("s.latitude", lat, opLat, junctor)
-			junctor = sql.OpAnd
-		}
-		if long != "" {
-			query.AddFilter("s.longitude", long, opLong, junctor)
-		}
-		query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterLocationsEnd)
-	}
-
-	// results
-	junctor = sql.OpWhere // reset junctor for new subquery
-	qryString := c.QueryParam(QP_CHEMISTRY)
-	if qryString != "" {
-		chemQry, err := model.ParseChemQuery(qryString)
-		if err != nil {
-			return nil, err
-		}
-		// add query module results
-		mvIDList := ""
-		for i := range chemQry.Expressions {
-			if i > 0 {
-				mvIDList += ","
-			}
-			mvIDList += fmt.Sprintf("m%d.sampleid", i+1)
-		}
-		query.AddSQLBlock(fmt.Sprintf("%s%s%s", sql.GetSamplingfeatureIdsByFilterResultsStartPre, mvIDList, sql.GetSamplingfeatureIdsByFilterResultsStartPost))
-		// add ResultFilterExpression for each expression in the chemQry
-		for i, expr := range chemQry.Expressions {
-			// interpret missing minValue as 0 to enable "element exists"-queries
-			if expr.MinValue == "" {
-				expr.MinValue = "0"
-			}
-			junctor = sql.OpWhere // reset junctor for new expression
-			exprJunctor, exists := model.CQSQLMap[expr.Junctor]
-			if !exists {
-				return nil, fmt.Errorf("Invalid junctor in chemical query")
-			}
-			query.AddSQLBlock(exprJunctor + sql.GetSamplingfeatureIdsByFilterResultsExpression)
-			if expr.Type != "" {
-				query.AddFilter("n.variabletypecode", expr.Type, sql.OpEq, junctor)
-				junctor = sql.OpAnd
-			}
-			if expr.Element != "" {
-				query.AddFilter("upper(n.variablecode)", expr.Element, sql.OpEq, junctor)
-				junctor = sql.OpAnd
-			}
-			if expr.MinValue != "" {
-				query.AddFilter("n.datavalue", expr.MinValue, sql.OpGte, junctor)
-				junctor = sql.OpAnd
-			}
-			if expr.MaxValue != "" {
-				query.AddFilter("n.datavalue", expr.MaxValue, sql.OpLte, junctor)
-			}
-			if i == 0 {
-				query.AddSQLBlock(fmt.Sprintf(") m%d", i+1))
-			} else {
-				query.AddSQLBlock(fmt.Sprintf(") m%d on m%d.samplingfeatureid = m%d.samplingfeatureid", i+1, i+1, i))
-			}
-		}
-		// add closing block for results
-		query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterResultsEnd)
-	}
-
-	// citation
-	junctor = sql.OpWhere // reset junctor for new subquery
-	title, opTitle, err := parseParam(c.QueryParam(QP_TITLE))
-	if err != nil {
-		return nil, err
-	}
-	pubYear, opPubYear, err := parseParam(c.QueryParam(QP_PUBYEAR))
-	if err != nil {
-		return nil, err
-	}
-	doi, opDOI, err := parseParam(c.QueryParam(QP_DOI))
-	if err != nil {
-		return nil, err
-	}
-	authorFirst, opAuthorFirst, err := parseParam(c.QueryParam(QP_AUTHOR_FIRST))
-	if err != nil {
-		return nil, err
-	}
-	authorLast, opAuthorLast, err := parseParam(c.QueryParam(QP_AUTHOR_LAST))
-	if err != nil {
-		return nil, err
-	}
-	if title != "" || pubYear != "" || doi != "" || authorFirst != "" || authorLast != "" {
-		// add query module citations
-		query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterCitationsStart)
-		if title != "" {
-			query.AddFilter("scd.title", title, opTitle, junctor)
-			junctor = sql.OpAnd
-		}
-		if pubYear != "" {
-			query.AddFilter("scd.publicationyear", pubYear, opPubYear, junctor)
-			junctor = sql.OpAnd
-		}
-		if doi != "" {
-			query.AddFilter("scd.externalidentifier", doi, opDOI, junctor)
-			junctor = sql.OpAnd
-		}
-		// we compare to arrays here, so we need to adapt the filters
-		if authorFirst != "" {
-			arrayOp, err := sql.MapArrayOperators(opAuthorFirst)
-			if err != nil {
-				return nil, err
-			}
-			query.AddFilter("scd.personfirstnames", authorFirst, arrayOp, junctor)
-			junctor = sql.OpAnd
-		}
-		if authorLast != "" {
-			arrayOp, err := sql.MapArrayOperators(opAuthorLast)
-			if err != nil {
-				return nil, err
-			}
-			query.AddFilter("scd.personlastnames", authorLast, arrayOp, junctor)
-		}
-		query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterCitationsEnd)
-	}
-
-	// Ages
-	junctor = sql.OpWhere // reset junctor for new subquery
-	ageMin, opAgeMin, err := parseParam(c.QueryParam(QP_AGE_MIN))
-	if err != nil {
-		return nil, err
-	}
-	ageMax, opAgeMax, err := parseParam(c.QueryParam(QP_AGE_MAX))
-	if err != nil {
-		return nil, err
-	}
-	geoAge, opGeoAge, err := parseParam(c.QueryParam(QP_GEO_AGE))
-	if err != nil {
-		return nil, err
-	}
-	geoPrefix, opGeoPrefix, err := parseParam(c.QueryParam(QP_GEO_AGE_PREFIX))
-	if err != nil {
-		return nil, err
-	}
-	if ageMin != "" || ageMax != "" || geoAge != "" || geoPrefix != "" {
-		// add query module age
-		query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterAgesStart)
-		if ageMin != "" {
-			query.AddFilter("sa.specimenagemin", ageMin, opAgeMin, junctor)
-			junctor = sql.OpAnd
-		}
-		if ageMax != "" {
-			query.AddFilter("sa.specimenagemax", ageMax, opAgeMax, junctor)
-			junctor = sql.OpAnd
-		}
-		if geoAge != "" {
-			query.AddFilter("sa.specimengeolage", geoAge, opGeoAge, junctor)
-			junctor = sql.OpAnd
-		}
-		if geoPrefix != "" {
-			query.AddFilter("sa.specimengeolageprefix", geoPrefix, opGeoPrefix, junctor)
-		}
-		query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterAgesEnd)
-	}
-
-	// Organizations
-	junctor = sql.OpWhere // reset junctor for new subquery
-	labName, opLabName, err := parseParam(c.QueryParam(QP_LAB))
-	if err != nil {
-		return nil, err
-	}
-	if labName != "" {
-		// add query module organizations
-		query.AddSQLBlock(sql.GestSamplingfeatureIdsByFilterOrganizationsStart)
-		if labName != "" {
-			query.AddFilter("o.organizationname", labName, opLabName, junctor)
-		}
-		query.AddSQLBlock(sql.GestSamplingfeatureIdsByFilterOrganizationsEnd)
-	}
-
-	// Geometries
-	junctor = sql.OpWhere // reset junctor for new subquery
-	polygon := coordData[KEY_POLYGON]
-	if polygon != nil || bbox != nil {
-		// add query module geometry
-		if bbox != nil {
-			bboxSlice := bbox.([]model.SimplePoint)
-			// format bbox string for postGIS/SQL syntax
-			bboxFormatted, err := geometry.FormatPolygonArray(bboxSlice)
-			if err != nil {
-				return nil, err
-			}
-			params := map[string]interface{}{
-				"bboxPolygon": fmt.Sprintf("POLYGON(%s)", bboxFormatted),
-			}
-			query.AddSQLBlockParametrized(sql.GestSamplingfeatureIdsByFilterGeometryBBOXStart, params)
-			boundary := coordData[KEY_BOUNDARY].(float64)
-			translationFactor := coordData[KEY_TRANSLATION_FACTOR].(float64)
-			query.AddInTranslatedPolygonFilter("sg.geometry", bboxFormatted, junctor, boundary, translationFactor)
-			junctor = sql.OpAnd
-		} else {
-			// if no bbox is supplied, use filter block without bbox check
-			query.AddSQLBlock(sql.GestSamplingfeatureIdsByFilterGeometryStart)
-		}
-		if polygon != nil {
-			polygonSlice := polygon.([]model.SimplePoint)
-			// format polygon for postGIS/SQL syntax
-			polygonFormatted, err := geometry.FormatPolygonArray(polygonSlice)
-			if err != nil {
-				return nil, err
-			}
-			boundary := coordData[KEY_BOUNDARY_POLY].(float64)
-			translationFactor := coordData[KEY_TRANSLATION_FACTOR_POLY].(float64)
-			query.AddInTranslatedPolygonFilter("sg.geometry", polygonFormatted, junctor, boundary, translationFactor)
-		}
-		query.AddSQLBlock(sql.GestSamplingfeatureIdsByFilterGeometryEnd)
-	}
-
-	// coordinates
-	// add query module coordinates
-	query.AddSQLBlock(sql.GetGestSamplingfeatureIdsByFilterCoordinates)
-
-	return query, nil
-}
-
 // parseClusterToGeoJSON takes an array of model.ClusteredSample and parses it into GeoJSON
 // Clusters with less than CLUSTERING_THRESHOLD points are not clustered and are parsed as points
 func parseClusterToGeoJSON(clusterData []model.ClusteredSample) ([]model.GeoJSONCluster, []model.GeoJSONFeature, error) {
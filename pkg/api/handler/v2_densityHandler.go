@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/middleware"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
+)
+
+const (
+	QP_GRID       = "grid"
+	QP_RESOLUTION = "resolution"
+	QP_ELEMENT    = "element"
+)
+
+// GetDensity_v2 godoc
+//
+//	@Summary		Retrieve sample density grid
+//	@Description	Get the number of samples matching the filters per cell of a geohash, geotile or H3 grid as GeoJSON FeatureCollection
+//	@Description	The hexagons of the H3 grid have about the same area at each resolution, whereas geohashes and geotiles shrink towards the poles
+//	@Description	Each feature is the polygon of a cell with the properties count and, if an element is given, mean holding the mean measured value of the element
+//	@Description	Cells without samples are omitted; at most 10000 cells with the most samples are returned and truncated is true if there are more, so numberMatched only counts the returned cells
+//	@Description	Geohashes and geotiles are aligned to the antimeridian; H3 cells crossing it are returned as MultiPolygon with one polygon per side
+//	@Description	All other query params are applied as filters of the Filter DSL of GET /v2/queries/samples
+//	@Security		ApiKeyAuth
+//	@Tags			geodata
+//	@Accept			json
+//	@Produce		json
+//	@Param			grid		query		string	false	"grid type geohash, geotile (default) or h3"
+//	@Param			resolution	query		int		false	"geohash precision 1-12 (default 3), geotile zoom level 0-29 (default 5) or H3 resolution 0-15 (default 3)"
+//	@Param			element		query		string	false	"element whose mean value is calculated per cell, e.g. SiO2"
+//	@Success		200			{object}	model.GeoJSONFeatureCollection
+//	@Failure		400			{object}	string
+//	@Failure		401			{object}	string
+//	@Failure		422			{object}	string
+//	@Failure		500			{object}	string
+//	@Router			/v2/geodata/density [get]
+func (h *Handler) GetDensity_v2(c echo.Context) error {
+	logger, ok := c.Get(middleware.LOGGER_KEY).(middleware.APILogger)
+	if !ok {
+		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
+	}
+	params := c.QueryParams()
+	resolution := -1
+	if resolutionS := params.Get(QP_RESOLUTION); resolutionS != "" {
+		var err error
+		resolution, err = strconv.Atoi(resolutionS)
+		if err != nil || resolution < 0 {
+			return c.String(http.StatusBadRequest, "Invalid resolution - must be a positive integer")
+		}
+	}
+	grid, err := repository.NewDensityGrid(params.Get(QP_GRID), resolution, params.Get(QP_ELEMENT))
+	if err != nil {
+		logger.Errorf("Invalid density grid: %s", err.Error())
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Invalid grid: %s", err.Error()))
+	}
+
+	f, err := parseFilters(params)
+	if err != nil {
+		logger.Errorf("can not parse filters: %s", err.Error())
+		return invalidFilters(c, err)
+	}
+
+	density, err := h.searchIndex.QueryDensity(c.Request().Context(), f, grid)
+	if err != nil {
+		logger.Errorf("Can not query density: %v", err)
+		if errors.Is(err, repository.ErrInvalidFilter) {
+			return c.String(http.StatusUnprocessableEntity, "Invalid filters")
+		}
+		return c.String(http.StatusInternalServerError, "Can not retrieve sample data")
+	}
+
+	features := make([]model.GeoJSONFeature, 0, len(density.Cells))
+	for _, cell := range density.Cells {
+		parts, err := grid.CellPolygons(cell.Key)
+		if err != nil {
+			logger.Errorf("Invalid density cell %s: %v", cell.Key, err)
+			continue
+		}
+		// close the ring of each polygon of the cell
+		polygons := make([]any, 0, len(parts))
+		for _, part := range parts {
+			ring := make([][]float64, 0, len(part)+1)
+			for _, point := range append(part, part[0]) {
+				ring = append(ring, []float64{point.X, point.Y})
+			}
+			polygons = append(polygons, []any{ring})
+		}
+		geom := model.Geometry{Type: model.GEOJSON_GEOMETRY_MULTIPOLYGON, Coordinates: polygons}
+		if len(polygons) == 1 {
+			geom = model.Geometry{Type: model.GEOJSON_GEOMETRY_POLYGON, Coordinates: polygons[0].([]any)}
+		}
+		properties := map[string]interface{}{"count": cell.DocCount}
+		if cell.Mean != nil {
+			properties["mean"] = *cell.Mean
+		}
+		features = append(features, model.GeoJSONFeature{
+			Type:       model.GEOJSONTYPE_FEATURE,
+			ID:         cell.Key,
+			Geometry:   geom,
+			Properties: properties,
+		})
+	}
+	return c.JSON(http.StatusOK, model.GeoJSONFeatureCollection{
+		Type:           model.GEOJSONTYPE_FEATURECOLLECTION,
+		Features:       features,
+		NumberMatched:  len(features),
+		NumberReturned: len(features),
+		Truncated:      density.Truncated,
+	})
+}
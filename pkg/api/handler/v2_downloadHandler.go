@@ -0,0 +1,256 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/middleware"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/download"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/jobs"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/sql"
+)
+
+// DOWNLOADS_PATH is the path of the download jobs
+const DOWNLOADS_PATH = "/api/v2/downloads"
+
+// downloadRequest is the JSON body of POST /v2/downloads
+type downloadRequest struct {
+	searchRequest
+	// Format is the output format csv (default), xlsx, kml or kmz
+	Format string `json:"format"`
+	// StyleBy is the attribute the kml and kmz placemarks are styled by: rockclass (default) or setting
+	StyleBy string `json:"styleby"`
+}
+
+// PostDownload_v2 godoc
+//
+//	@Summary		Start a download job for the given filters
+//	@Description	Start an asynchronous job collecting the full data of the samples matching the filters as csv, xlsx, kml or kmz file
+//	@Description	The filters of the body support the same Filter DSL as GET /download/filtered; limit restricts the number of samples
+//	@Description	The response holds the job ID and the link to poll the status of the job at GET /v2/downloads/{jobID}
+//	@Description	Once the status is done, the file can be downloaded from GET /v2/downloads/{jobID}/file until the job expires
+//	@Security		ApiKeyAuth
+//	@Tags			download
+//	@Accept			json
+//	@Produce		json
+//	@Param			query	body		downloadRequest	true	"filters and output format of the download"
+//	@Success		202		{object}	model.DownloadJobResponse
+//	@Failure		400		{object}	string
+//	@Failure		401		{object}	string
+//	@Failure		422		{object}	string
+//	@Failure		503		{object}	string
+//	@Router			/v2/downloads [post]
+func (h *Handler) PostDownload_v2(c echo.Context) error {
+	logger, ok := c.Get(middleware.LOGGER_KEY).(middleware.APILogger)
+	if !ok {
+		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
+	}
+	if h.jobs == nil {
+		return c.String(http.StatusServiceUnavailable, "Download jobs are not available")
+	}
+	req := downloadRequest{}
+	err := json.NewDecoder(c.Request().Body).Decode(&req)
+	if err != nil {
+		logger.Errorf("Can not bind download request: %s", err.Error())
+		return c.String(http.StatusBadRequest, "Invalid request body")
+	}
+	targetFormat := strings.ToLower(req.Format)
+	if targetFormat == "" {
+		targetFormat = download.CSV
+	}
+	if targetFormat != download.CSV && targetFormat != download.XLSX && targetFormat != download.KML && targetFormat != download.KMZ {
+		return c.String(http.StatusBadRequest, "Invalid format - must be one of 'csv', 'xlsx', 'kml' or 'kmz'")
+	}
+
+	params := req.params()
+	f, err := filter.Parse(params, QP_LIMIT, QP_BBOX)
+	if err != nil {
+		logger.Errorf("can not parse filters: %s", err.Error())
+		return invalidFilters(c, err)
+	}
+	if bboxS := params.Get(QP_BBOX); bboxS != "" {
+		bbox, err := geometry.ParsePointArray(bboxS)
+		if err != nil || len(bbox) != 4 {
+			logger.Errorf("Invalid bbox: %v", err)
+			return c.String(http.StatusBadRequest, "Invalid bbox")
+		}
+		f.BBox = filter.ShapeFromPoints(geometry.TruncateBBox(bbox))
+	}
+	query, err := filter.ToSQL(f)
+	if err != nil {
+		return c.String(http.StatusUnprocessableEntity, err.Error())
+	}
+	// wrap in rowcount sql
+	query.WrapInSQL("select *, count(*) over () as totalCount from (", ") q")
+	query.AddLimit(req.Limit)
+
+	fileName := fmt.Sprintf("GEOROC_data_download_%s.%s", time.Now().Format("20060102"), targetFormat)
+	job, err := h.jobs.Submit(fileName, h.downloadTask(query.GetQueryString(), query.GetFilterValues(), targetFormat, req.StyleBy))
+	if err != nil {
+		logger.Errorf("Can not submit download job: %v", err)
+		if errors.Is(err, jobs.ErrQueueFull) {
+			return c.String(http.StatusServiceUnavailable, "Too many downloads queued - please try again later")
+		}
+		return c.String(http.StatusInternalServerError, "Can not start download")
+	}
+	response := downloadJobResponse(c, job)
+	c.Response().Header().Set(echo.HeaderLocation, response.Links[0].Href)
+	return c.JSON(http.StatusAccepted, response)
+}
+
+// GetDownload_v2 godoc
+//
+//	@Summary		Retrieve the status of a download job
+//	@Description	Get the status and progress of a download job; done and total are the number of collected samples and the number of all samples
+//	@Description	The links hold the link to the file once the status is done
+//	@Security		ApiKeyAuth
+//	@Tags			download
+//	@Produce		json
+//	@Param			jobID	path		string	true	"ID of the download job"
+//	@Success		200		{object}	model.DownloadJobResponse
+//	@Failure		401		{object}	string
+//	@Failure		404		{object}	string
+//	@Failure		503		{object}	string
+//	@Router			/v2/downloads/{jobID} [get]
+func (h *Handler) GetDownload_v2(c echo.Context) error {
+	if h.jobs == nil {
+		return c.String(http.StatusServiceUnavailable, "Download jobs are not available")
+	}
+	job, err := h.jobs.Get(c.Param("jobID"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "Unknown download")
+	}
+	return c.JSON(http.StatusOK, downloadJobResponse(c, job))
+}
+
+// GetDownloadFile_v2 godoc
+//
+//	@Summary		Retrieve the file of a download job
+//	@Description	Get the file of a finished download job
+//	@Security		ApiKeyAuth
+//	@Tags			download
+//	@Produce		plain
+//	@Param			jobID	path		string	true	"ID of the download job"
+//	@Success		200		{file}		file
+//	@Failure		401		{object}	string
+//	@Failure		404		{object}	string
+//	@Failure		409		{object}	string
+//	@Failure		410		{object}	string
+//	@Failure		500		{object}	string
+//	@Failure		503		{object}	string
+//	@Router			/v2/downloads/{jobID}/file [get]
+func (h *Handler) GetDownloadFile_v2(c echo.Context) error {
+	if h.jobs == nil {
+		return c.String(http.StatusServiceUnavailable, "Download jobs are not available")
+	}
+	file, job, err := h.jobs.File(c.Param("jobID"))
+	if err != nil {
+		switch {
+		case errors.Is(err, jobs.ErrNotReady):
+			return c.String(http.StatusConflict, fmt.Sprintf("Download is %s", job.Status))
+		case errors.Is(err, os.ErrNotExist):
+			return c.String(http.StatusGone, "Download is no longer available")
+		case errors.Is(err, jobs.ErrNotFound):
+			return c.String(http.StatusNotFound, "Unknown download")
+		}
+		return c.String(http.StatusInternalServerError, "Can not read download")
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Can not read download")
+	}
+	c.Response().Header().Set(echo.HeaderContentType, download.ContentType(strings.TrimPrefix(filepath.Ext(job.FileName), ".")))
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", job.FileName))
+	http.ServeContent(c.Response(), c.Request(), job.FileName, info.ModTime(), file)
+	return nil
+}
+
+// DeleteDownload_v2 godoc
+//
+//	@Summary		Cancel or remove a download job
+//	@Description	Cancel a queued or running download job or remove a finished download job with its file
+//	@Security		ApiKeyAuth
+//	@Tags			download
+//	@Produce		json
+//	@Param			jobID	path		string	true	"ID of the download job"
+//	@Success		200		{object}	model.DownloadJobResponse
+//	@Failure		401		{object}	string
+//	@Failure		404		{object}	string
+//	@Failure		503		{object}	string
+//	@Router			/v2/downloads/{jobID} [delete]
+func (h *Handler) DeleteDownload_v2(c echo.Context) error {
+	if h.jobs == nil {
+		return c.String(http.StatusServiceUnavailable, "Download jobs are not available")
+	}
+	job, err := h.jobs.Cancel(c.Param("jobID"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "Unknown download")
+	}
+	return c.JSON(http.StatusOK, downloadJobResponse(c, job))
+}
+
+// downloadTask returns the task collecting the full data of the samples of the query in batches and writing them in the target format
+// Each batch is spooled by the stream formatter as it is fetched, so the full data of all samples is never held in memory
+func (h *Handler) downloadTask(query string, args []interface{}, targetFormat string, styleBy string) jobs.Task {
+	return func(ctx context.Context, w io.Writer, progress func(done int, total int)) error {
+		results, err := repository.Query[model.SampleByFilters](ctx, h.db, query, args...)
+		if err != nil {
+			return fmt.Errorf("can not query samples: %w", err)
+		}
+		formatter, err := download.NewStreamFormatter(targetFormat, styleBy)
+		if err != nil {
+			return err
+		}
+		defer formatter.Close()
+		progress(0, len(results))
+		for start := 0; start < len(results); start += BATCH_SIZE {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			batch := results[start:min(start+BATCH_SIZE, len(results))]
+			identifiers := make([]int, 0, len(batch))
+			for _, sample := range batch {
+				identifiers = append(identifiers, sample.SampleID)
+			}
+			data, err := repository.Query[model.FullData](ctx, h.db, sql.FullDataByMultiIdQuery, identifiers)
+			if err != nil {
+				return fmt.Errorf("can not query full data: %w", err)
+			}
+			err = formatter.Add(data)
+			if err != nil {
+				return err
+			}
+			progress(start+len(batch), len(results))
+		}
+		return formatter.Finish(w)
+	}
+}
+
+// downloadJobResponse returns the status of the job with the link to itself and, once it is done, to its file
+func downloadJobResponse(c echo.Context, job model.Job) model.DownloadJobResponse {
+	jobURL := hostURL(c) + DOWNLOADS_PATH + "/" + job.ID
+	links := []model.OGCLink{{Href: jobURL, Rel: "self", Type: MIME_JSON, Title: "Status of the download"}}
+	if job.Status == model.JOB_DONE {
+		fileType := download.ContentType(strings.TrimPrefix(filepath.Ext(job.FileName), "."))
+		links = append(links, model.OGCLink{Href: jobURL + "/file", Rel: "enclosure", Type: fileType, Title: job.FileName})
+	}
+	return model.DownloadJobResponse{Job: job, Links: links}
+}
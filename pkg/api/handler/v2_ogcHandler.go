@@ -0,0 +1,520 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/middleware"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/sql"
+)
+
+const (
+	// OGC_PATH is the path of the OGC API Features landing page
+	OGC_PATH = "/api/v2/ogc"
+
+	OGC_COLLECTION_SAMPLES = "samples"
+	OGC_COLLECTION_SITES   = "sites"
+
+	OGC_DEFAULT_LIMIT = 100
+	OGC_MAX_LIMIT     = 10000
+	OGC_CRS84         = "http://www.opengis.net/def/crs/OGC/1.3/CRS84"
+
+	// QP_OGC_FORMAT selects the encoding of the response; only json is supported
+	QP_OGC_FORMAT = "f"
+	OGC_FORMAT    = "json"
+
+	MIME_JSON    = "application/json"
+	MIME_GEOJSON = "application/geo+json"
+	MIME_SCHEMA  = "application/schema+json"
+	MIME_HTML    = "text/html"
+)
+
+// OGC_CONFORMANCE holds the conformance classes of OGC API Features implemented by the API
+var OGC_CONFORMANCE = []string{
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/core",
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/geojson",
+}
+
+// OGC_SAMPLE_FIELDS holds the fields of the samples returned as properties of the sample features
+var OGC_SAMPLE_FIELDS = []string{
+	"sampleID", "sampleName", "uniqueID", "latitude", "longitude", "elevationMin", "elevationMax", "landOrSea",
+	"locationNames", "tectonicSetting", "geologicalAge", "geologicalAgePrefix", "ageMin", "ageMax", "eruptionDate",
+}
+
+// ogcCollectionDescriptions holds title and description of each collection
+var ogcCollectionDescriptions = map[string][2]string{
+	OGC_COLLECTION_SAMPLES: {"GEOROC samples", "Samples with coordinates; all parameters of the Filter DSL of GET /v2/queries/samples are supported as queryables"},
+	OGC_COLLECTION_SITES:   {"GEOROC sites", "Sampling sites aggregated by their coordinates with the number of samples of each site"},
+}
+
+// GetOGCLandingPage_v2 godoc
+//
+//	@Summary		OGC API Features landing page
+//	@Description	Get the landing page of the OGC API Features (Part 1 Core) linking to the conformance declaration and the collections samples and sites
+//	@Description	GIS clients like QGIS and ArcGIS can add the collections as layers by the URL of this page with the access key set as HTTP header DIGIS-API-ACCESSKEY
+//	@Security		ApiKeyAuth
+//	@Tags			ogc
+//	@Produce		json
+//	@Success		200	{object}	model.OGCLandingPage
+//	@Failure		401	{object}	string
+//	@Router			/v2/ogc [get]
+func (h *Handler) GetOGCLandingPage_v2(c echo.Context) error {
+	base := ogcBaseURL(c)
+	return c.JSON(http.StatusOK, model.OGCLandingPage{
+		Title:       "GEOROC OGC API Features",
+		Description: "Access to the samples and sites of the GEOROC database as GeoJSON features",
+		Links: []model.OGCLink{
+			{Href: base, Rel: "self", Type: MIME_JSON, Title: "This document"},
+			{Href: hostURL(c) + "/api/v1/docs/doc.json", Rel: "service-desc", Type: MIME_JSON, Title: "API definition"},
+			{Href: hostURL(c) + "/api/v1/docs/index.html", Rel: "service-doc", Type: MIME_HTML, Title: "API documentation"},
+			{Href: base + "/conformance", Rel: "conformance", Type: MIME_JSON, Title: "Conformance classes"},
+			{Href: base + "/collections", Rel: "data", Type: MIME_JSON, Title: "Collections"},
+		},
+	})
+}
+
+// GetOGCConformance_v2 godoc
+//
+//	@Summary		OGC API Features conformance declaration
+//	@Description	Get the conformance classes of OGC API Features implemented by the API
+//	@Security		ApiKeyAuth
+//	@Tags			ogc
+//	@Produce		json
+//	@Success		200	{object}	model.OGCConformance
+//	@Failure		401	{object}	string
+//	@Router			/v2/ogc/conformance [get]
+func (h *Handler) GetOGCConformance_v2(c echo.Context) error {
+	return c.JSON(http.StatusOK, model.OGCConformance{ConformsTo: OGC_CONFORMANCE})
+}
+
+// GetOGCCollections_v2 godoc
+//
+//	@Summary		OGC API Features collections
+//	@Description	Get the feature collections samples and sites
+//	@Security		ApiKeyAuth
+//	@Tags			ogc
+//	@Produce		json
+//	@Success		200	{object}	model.OGCCollections
+//	@Failure		401	{object}	string
+//	@Router			/v2/ogc/collections [get]
+func (h *Handler) GetOGCCollections_v2(c echo.Context) error {
+	base := ogcBaseURL(c)
+	return c.JSON(http.StatusOK, model.OGCCollections{
+		Links: []model.OGCLink{{Href: base + "/collections", Rel: "self", Type: MIME_JSON, Title: "This document"}},
+		Collections: []model.OGCCollection{
+			ogcCollection(base, OGC_COLLECTION_SAMPLES),
+			ogcCollection(base, OGC_COLLECTION_SITES),
+		},
+	})
+}
+
+// GetOGCCollection_v2 godoc
+//
+//	@Summary		OGC API Features collection
+//	@Description	Get the description of the feature collection samples or sites
+//	@Security		ApiKeyAuth
+//	@Tags			ogc
+//	@Produce		json
+//	@Param			collectionId	path		string	true	"samples or sites"
+//	@Success		200				{object}	model.OGCCollection
+//	@Failure		401				{object}	string
+//	@Failure		404				{object}	string
+//	@Router			/v2/ogc/collections/{collectionId} [get]
+func (h *Handler) GetOGCCollection_v2(c echo.Context) error {
+	collectionID := c.Param("collectionId")
+	if _, ok := ogcCollectionDescriptions[collectionID]; !ok {
+		return c.String(http.StatusNotFound, "Unknown collection")
+	}
+	return c.JSON(http.StatusOK, ogcCollection(ogcBaseURL(c), collectionID))
+}
+
+// GetOGCQueryables_v2 godoc
+//
+//	@Summary		OGC API Features queryables
+//	@Description	Get the properties of the features of the collection that can be used as query params to filter the items
+//	@Description	The samples support all fields of the Filter DSL of GET /v2/queries/samples; the sites support no queryables besides bbox
+//	@Security		ApiKeyAuth
+//	@Tags			ogc
+//	@Produce		application/schema+json
+//	@Param			collectionId	path		string	true	"samples or sites"
+//	@Success		200				{object}	model.OGCQueryables
+//	@Failure		401				{object}	string
+//	@Failure		404				{object}	string
+//	@Router			/v2/ogc/collections/{collectionId}/queryables [get]
+func (h *Handler) GetOGCQueryables_v2(c echo.Context) error {
+	collectionID := c.Param("collectionId")
+	if _, ok := ogcCollectionDescriptions[collectionID]; !ok {
+		return c.String(http.StatusNotFound, "Unknown collection")
+	}
+	queryables := model.OGCQueryables{
+		Schema:     "https://json-schema.org/draft/2019-09/schema",
+		ID:         ogcBaseURL(c) + "/collections/" + collectionID + "/queryables",
+		Type:       "object",
+		Title:      ogcCollectionDescriptions[collectionID][0],
+		Properties: map[string]model.OGCQueryable{},
+	}
+	if collectionID == OGC_COLLECTION_SAMPLES {
+		for _, field := range filter.Fields() {
+			queryables.Properties[field.Name] = model.OGCQueryable{
+				Title:       field.Name,
+				Description: "Filter DSL FIELD=OPERATOR:VALUE",
+			}
+		}
+		queryables.Properties[filter.KEY_CHEMISTRY] = model.OGCQueryable{Title: filter.KEY_CHEMISTRY, Description: "chemical filter as in GET /v2/queries/samples", Type: "string"}
+		queryables.Properties[filter.KEY_TEXT] = model.OGCQueryable{Title: filter.KEY_TEXT, Description: "free text search", Type: "string"}
+		queryables.Properties[filter.KEY_NEAR] = model.OGCQueryable{Title: filter.KEY_NEAR, Description: "radius around a point formatted as LON,LAT,RADIUS_KM", Type: "string"}
+		queryables.Properties[filter.KEY_REGION] = model.OGCQueryable{Title: filter.KEY_REGION, Description: "named region id as listed by GET /v2/geodata/regions", Type: "string"}
+		queryables.Properties[filter.KEY_POLYGON_GEOJSON] = model.OGCQueryable{Title: filter.KEY_POLYGON_GEOJSON, Description: "GeoJSON Polygon or MultiPolygon of the area to search in", Type: "string"}
+	}
+	c.Response().Header().Set(echo.HeaderContentType, MIME_SCHEMA)
+	return c.JSON(http.StatusOK, queryables)
+}
+
+// GetOGCItems_v2 godoc
+//
+//	@Summary		OGC API Features items
+//	@Description	Get the features of the collection samples or sites as GeoJSON FeatureCollection
+//	@Description	The links of the response hold the link to the next page if there are more features
+//	@Description	The samples are paginated by the cursor of the next link; all other query params are applied as filters of the Filter DSL of GET /v2/queries/samples
+//	@Description	The sites are paginated by offset
+//	@Security		ApiKeyAuth
+//	@Tags			ogc
+//	@Produce		application/geo+json
+//	@Param			collectionId	path		string	true	"samples or sites"
+//	@Param			bbox			query		string	false	"bounding box formatted as MINLON,MINLAT,MAXLON,MAXLAT; MINLON greater than MAXLON crosses the antimeridian"
+//	@Param			limit			query		int		false	"number of features per page 1-10000 (default 100)"
+//	@Param			cursor			query		string	false	"opaque cursor of the next link of the samples"
+//	@Param			offset			query		int		false	"offset of the next link of the sites"
+//	@Success		200				{object}	model.GeoJSONFeatureCollection
+//	@Failure		400				{object}	string
+//	@Failure		401				{object}	string
+//	@Failure		404				{object}	string
+//	@Failure		410				{object}	string
+//	@Failure		422				{object}	string
+//	@Failure		500				{object}	string
+//	@Router			/v2/ogc/collections/{collectionId}/items [get]
+func (h *Handler) GetOGCItems_v2(c echo.Context) error {
+	logger, ok := c.Get(middleware.LOGGER_KEY).(middleware.APILogger)
+	if !ok {
+		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
+	}
+	collectionID := c.Param("collectionId")
+	if _, ok := ogcCollectionDescriptions[collectionID]; !ok {
+		return c.String(http.StatusNotFound, "Unknown collection")
+	}
+	params := maps.Clone(c.QueryParams())
+	if format := params.Get(QP_OGC_FORMAT); format != "" && format != OGC_FORMAT {
+		return c.String(http.StatusBadRequest, "Unsupported format")
+	}
+	delete(params, QP_OGC_FORMAT)
+
+	limit, err := parseOGCLimit(params.Get(QP_LIMIT))
+	if err != nil {
+		logger.Errorf("Invalid limit: %s", err.Error())
+		return c.String(http.StatusBadRequest, "Invalid limit - must be a positive integer")
+	}
+	var bbox []model.SimplePoint
+	if bboxS := params.Get(QP_BBOX); bboxS != "" {
+		bbox, err = geometry.ParseCoordinateBBox(bboxS)
+		if err != nil {
+			logger.Errorf("Invalid bbox: %s", err.Error())
+			return c.String(http.StatusBadRequest, "Invalid bbox")
+		}
+	}
+	delete(params, QP_BBOX)
+
+	if collectionID == OGC_COLLECTION_SITES {
+		return h.ogcSiteItems(c, logger, limit, bbox)
+	}
+	return h.ogcSampleItems(c, logger, params, limit, bbox)
+}
+
+// GetOGCItem_v2 godoc
+//
+//	@Summary		OGC API Features item
+//	@Description	Get a single feature of the collection samples by its sampleID or sites by its locationID as GeoJSON Feature
+//	@Security		ApiKeyAuth
+//	@Tags			ogc
+//	@Produce		application/geo+json
+//	@Param			collectionId	path		string	true	"samples or sites"
+//	@Param			featureId		path		int		true	"sampleID or locationID"
+//	@Success		200				{object}	model.GeoJSONFeature
+//	@Failure		401				{object}	string
+//	@Failure		404				{object}	string
+//	@Failure		500				{object}	string
+//	@Router			/v2/ogc/collections/{collectionId}/items/{featureId} [get]
+func (h *Handler) GetOGCItem_v2(c echo.Context) error {
+	logger, ok := c.Get(middleware.LOGGER_KEY).(middleware.APILogger)
+	if !ok {
+		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
+	}
+	collectionID := c.Param("collectionId")
+	if _, ok := ogcCollectionDescriptions[collectionID]; !ok {
+		return c.String(http.StatusNotFound, "Unknown collection")
+	}
+	// the ids of both collections are integers, so other ids can not exist
+	featureID, err := strconv.Atoi(c.Param("featureId"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "Unknown feature")
+	}
+
+	var features []model.GeoJSONFeature
+	if collectionID == OGC_COLLECTION_SITES {
+		query := sql.NewQuery(sql.GeoJSONQuery)
+		query.WrapInSQL(sql.GeoJSONSitesPrefix, sql.GeoJSONSitesPostfix)
+		query.AddSQLBlockParametrized(sql.GeoJSONSitesIDFilter, map[string]interface{}{":locationid": featureID})
+		sites, err := repository.Query[model.GeoJSONSite](c.Request().Context(), h.db, query.GetQueryString(), query.GetFilterValues()...)
+		if err != nil {
+			logger.Errorf("Can not query site %d: %v", featureID, err)
+			return c.String(http.StatusInternalServerError, "Can not retrieve site data")
+		}
+		features = ogcSiteFeatures(sites)
+	} else {
+		f, err := filter.Parse(url.Values{"sampleID": {strconv.Itoa(featureID)}})
+		if err != nil {
+			logger.Errorf("can not parse filters: %s", err.Error())
+			return c.String(http.StatusInternalServerError, "Can not retrieve sample data")
+		}
+		page, err := h.searchIndex.QueryDocuments(c.Request().Context(), OGC_SAMPLE_FIELDS, f, 1)
+		if err != nil {
+			logger.Errorf("Can not query sample %d: %v", featureID, err)
+			return c.String(http.StatusInternalServerError, "Can not retrieve sample data")
+		}
+		features = ogcSampleFeatures(page.Documents)
+	}
+	if len(features) == 0 {
+		return c.String(http.StatusNotFound, "Unknown feature")
+	}
+	c.Response().Header().Set(echo.HeaderContentType, MIME_GEOJSON)
+	return c.JSON(http.StatusOK, features[0])
+}
+
+// ogcSampleItems returns a page of the samples matching the filters in params inside the bbox
+func (h *Handler) ogcSampleItems(c echo.Context, logger middleware.APILogger, params url.Values, limit int, bbox []model.SimplePoint) error {
+	f, err := parseFilters(params)
+	if err != nil {
+		logger.Errorf("can not parse filters: %s", err.Error())
+		return invalidFilters(c, err)
+	}
+	if bbox != nil {
+		f.BBox = filter.ShapeFromPoints(bbox)
+	}
+	// features need a geometry, so samples without coordinates are not part of the collection
+	latitude, _ := filter.LookupField("latitude")
+	located, err := filter.ParseCondition(latitude, string(filter.OpExists)+":")
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Can not retrieve sample data")
+	}
+	f.Conditions = append(f.Conditions, located)
+
+	page, err := h.searchIndex.QuerySortSearchAfterPaginated(c.Request().Context(), OGC_SAMPLE_FIELDS, f, limit, c.QueryParam(QP_CURSOR))
+	if err != nil {
+		logger.Errorf("Can not query documents: %s", err.Error())
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			return c.String(http.StatusBadRequest, "Invalid cursor")
+		}
+		if errors.Is(err, repository.ErrCursorExpired) {
+			return c.String(http.StatusGone, "Cursor expired - restart paging without cursor")
+		}
+		if errors.Is(err, repository.ErrInvalidFilter) {
+			return c.String(http.StatusUnprocessableEntity, "Invalid filters")
+		}
+		return c.String(http.StatusInternalServerError, "Error querying database")
+	}
+	features := ogcSampleFeatures(page.Documents)
+	next := ""
+	if page.NextCursor != "" {
+		next = QP_CURSOR + "=" + url.QueryEscape(page.NextCursor)
+	}
+	return ogcFeatureCollection(c, features, page.TotalHits, next)
+}
+
+// ogcSiteItems returns a page of the sites inside the bbox
+func (h *Handler) ogcSiteItems(c echo.Context, logger middleware.APILogger, limit int, bbox []model.SimplePoint) error {
+	offset := 0
+	if offsetS := c.QueryParam(QP_OFFSET); offsetS != "" {
+		var err error
+		offset, err = strconv.Atoi(offsetS)
+		if err != nil || offset < 0 {
+			return c.String(http.StatusBadRequest, "Invalid offset - must be a positive integer")
+		}
+	}
+	countQuery := sql.NewQuery(sql.GeoJSONQuery)
+	countQuery.WrapInSQL(sql.GeoJSONSitesCountPrefix, sql.GeoJSONSitesPostfix)
+	query := sql.NewQuery(sql.GeoJSONQuery)
+	query.WrapInSQL(sql.GeoJSONSitesPrefix, sql.GeoJSONSitesPostfix)
+	if bbox != nil {
+		addSitesBBox(countQuery, sql.GeoJSONSitesBBoxFilter, bbox)
+		addSitesBBox(query, sql.GeoJSONSitesBBoxFilter, bbox)
+	}
+	query.AddSQLBlock(sql.GeoJSONSitesOrder)
+	query.AddLimit(limit)
+	query.AddOffset(offset)
+
+	counts, err := repository.Query[model.GeoJSONSiteCount](c.Request().Context(), h.db, countQuery.GetQueryString(), countQuery.GetFilterValues()...)
+	if err != nil || len(counts) != 1 {
+		logger.Errorf("Can not count sites: %v", err)
+		return c.String(http.StatusInternalServerError, "Can not retrieve site data")
+	}
+	sites, err := repository.Query[model.GeoJSONSite](c.Request().Context(), h.db, query.GetQueryString(), query.GetFilterValues()...)
+	if err != nil {
+		logger.Errorf("Can not query sites: %v", err)
+		return c.String(http.StatusInternalServerError, "Can not retrieve site data")
+	}
+	next := ""
+	if offset+len(sites) < counts[0].NumSites {
+		next = QP_OFFSET + "=" + strconv.Itoa(offset+len(sites))
+	}
+	return ogcFeatureCollection(c, ogcSiteFeatures(sites), counts[0].NumSites, next)
+}
+
+// addSitesBBox adds the bbox filter block of a GeoJSON sites query for the bbox formatted [SW, SE, NE, NW]
+// A bbox crossing the antimeridian is split into a western and an eastern longitude range
+func addSitesBBox(query *sql.Query, bboxFilter string, bbox []model.SimplePoint) {
+	west, east := bbox[0].X, bbox[1].X
+	west2, east2 := west, east
+	if east > geometry.LONG_MAX {
+		east = geometry.LONG_MAX
+		west2, east2 = geometry.LONG_MIN, east2-2*geometry.LONG_MAX
+	}
+	query.AddSQLBlockParametrized(bboxFilter, map[string]interface{}{
+		":south": bbox[0].Y,
+		":north": bbox[2].Y,
+		":west1": west,
+		":east1": east,
+		":west2": west2,
+		":east2": east2,
+	})
+}
+
+// ogcFeatureCollection writes the features as GeoJSON FeatureCollection with the links of the page
+// next holds the query param continuing to the next page or is empty for the last page
+func ogcFeatureCollection(c echo.Context, features []model.GeoJSONFeature, numberMatched int, next string) error {
+	links := pageLinks(c, next)
+	links = append(links, model.OGCLink{Href: ogcBaseURL(c) + "/collections/" + c.Param("collectionId"), Rel: "collection", Type: MIME_JSON, Title: "The collection"})
+	c.Response().Header().Set(echo.HeaderContentType, MIME_GEOJSON)
+	return c.JSON(http.StatusOK, model.GeoJSONFeatureCollection{
+		Type:           model.GEOJSONTYPE_FEATURECOLLECTION,
+		Features:       features,
+		NumberMatched:  numberMatched,
+		NumberReturned: len(features),
+		TimeStamp:      time.Now().UTC().Format(time.RFC3339),
+		Links:          links,
+	})
+}
+
+// pageLinks returns the self link of the requested page and the link to the next page
+// next holds the query param continuing to the next page or is empty for the last page
+func pageLinks(c echo.Context, next string) []model.OGCLink {
+	pageURL := hostURL(c) + c.Request().URL.Path
+	self := pageURL
+	if query := c.QueryString(); query != "" {
+		self += "?" + query
+	}
+	links := []model.OGCLink{{Href: self, Rel: "self", Type: MIME_GEOJSON, Title: "This document"}}
+	if next != "" {
+		// keep the filters and the limit of this page
+		params := maps.Clone(c.QueryParams())
+		delete(params, QP_CURSOR)
+		delete(params, QP_OFFSET)
+		query := params.Encode()
+		if query != "" {
+			query += "&"
+		}
+		links = append(links, model.OGCLink{Href: pageURL + "?" + query + next, Rel: "next", Type: MIME_GEOJSON, Title: "Next page"})
+	}
+	return links
+}
+
+// ogcSampleFeatures returns the sample documents as point features identified by their sampleID
+func ogcSampleFeatures(docs []map[string]any) []model.GeoJSONFeature {
+	features := make([]model.GeoJSONFeature, 0, len(docs))
+	for _, doc := range docs {
+		lat, latOk := doc["latitude"].(float64)
+		lon, lonOk := doc["longitude"].(float64)
+		if !latOk || !lonOk {
+			continue
+		}
+		id, _ := doc["sampleID"].(float64)
+		features = append(features, model.GeoJSONFeature{
+			Type: model.GEOJSONTYPE_FEATURE,
+			ID:   strconv.Itoa(int(id)),
+			Geometry: model.Geometry{
+				Type:        model.GEOJSON_GEOMETRY_POINT,
+				Coordinates: []interface{}{lon, lat},
+			},
+			Properties: doc,
+		})
+	}
+	return features
+}
+
+// ogcSiteFeatures returns the sites as point features identified by their locationID
+func ogcSiteFeatures(sites []model.GeoJSONSite) []model.GeoJSONFeature {
+	features := make([]model.GeoJSONFeature, 0, len(sites))
+	for _, site := range sites {
+		features = append(features, siteFeature(site))
+	}
+	return features
+}
+
+// ogcCollection returns the description of the collection with its links
+func ogcCollection(base string, collectionID string) model.OGCCollection {
+	collectionURL := base + "/collections/" + collectionID
+	links := []model.OGCLink{
+		{Href: collectionURL, Rel: "self", Type: MIME_JSON, Title: "This document"},
+		{Href: collectionURL + "/items", Rel: "items", Type: MIME_GEOJSON, Title: "Items"},
+		{Href: collectionURL + "/queryables", Rel: "http://www.opengis.net/def/rel/ogc/1.0/queryables", Type: MIME_SCHEMA, Title: "Queryables"},
+	}
+	return model.OGCCollection{
+		ID:          collectionID,
+		Title:       ogcCollectionDescriptions[collectionID][0],
+		Description: ogcCollectionDescriptions[collectionID][1],
+		Links:       links,
+		Extent: model.OGCExtent{Spatial: model.OGCSpatialExtent{
+			BBox: [][]float64{{geometry.LONG_MIN, geometry.LAT_MIN, geometry.LONG_MAX, geometry.LAT_MAX}},
+			Crs:  OGC_CRS84,
+		}},
+		ItemType: "feature",
+		Crs:      []string{OGC_CRS84},
+	}
+}
+
+// parseOGCLimit parses the limit of the items; limits above OGC_MAX_LIMIT are reduced to it
+func parseOGCLimit(v string) (int, error) {
+	if v == "" {
+		return OGC_DEFAULT_LIMIT, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if limit < 1 {
+		return 0, fmt.Errorf("limit %d must be positive", limit)
+	}
+	return min(limit, OGC_MAX_LIMIT), nil
+}
+
+// hostURL returns the scheme and host of the request
+func hostURL(c echo.Context) string {
+	return c.Scheme() + "://" + c.Request().Host
+}
+
+// ogcBaseURL returns the URL of the OGC API Features landing page
+func ogcBaseURL(c echo.Context) string {
+	return hostURL(c) + OGC_PATH
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/regions"
+)
+
+// GetRegions_v2 godoc
+//
+//	@Summary		Retrieve the named regions
+//	@Description	Get the named regions as GeoJSON FeatureCollection
+//	@Description	The id of a feature can be used in the region filter of the sample queries, e.g. region=aleutian_arc
+//	@Security		ApiKeyAuth
+//	@Tags			geodata
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	model.GeoJSONFeatureCollection
+//	@Failure		401	{object}	string
+//	@Router			/v2/geodata/regions [get]
+func (h *Handler) GetRegions_v2(c echo.Context) error {
+	registered := regions.List()
+	features := make([]model.GeoJSONFeature, 0, len(registered))
+	for _, region := range registered {
+		features = append(features, model.GeoJSONFeature{
+			Type:     model.GEOJSONTYPE_FEATURE,
+			ID:       region.ID,
+			Geometry: region.Feature.Geometry,
+			Properties: map[string]interface{}{
+				"name":        region.Name,
+				"description": region.Description,
+			},
+		})
+	}
+	return c.JSON(http.StatusOK, model.GeoJSONFeatureCollection{
+		Type:           model.GEOJSONTYPE_FEATURECOLLECTION,
+		Features:       features,
+		NumberMatched:  len(features),
+		NumberReturned: len(features),
+	})
+}
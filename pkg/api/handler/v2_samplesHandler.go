@@ -1,16 +1,19 @@
 package handler
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"math"
 	"net/http"
+	"net/url"
 	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/middleware"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
@@ -19,7 +22,10 @@ import (
 const (
 	ZOOM_OFFSET = 2 // increase zoom level for more fine-grained clustering
 
-	QP_POLYGON_GEOJSON = "polygon_geojson"
+	QP_CURSOR       = "cursor"
+	QP_FIELDS       = "fields"
+	QP_MEASUREMENTS = "measurements"
+	QP_CLUSTERSTATS = "clusterstats"
 )
 
 // GetSampleIDStreamed_v2 godoc
@@ -28,21 +34,29 @@ const (
 //	@Description	Get all samplingfeatureIDs matching the current filters
 //	@Description	Filter DSL syntax:
 //	@Description	FIELD=OPERATOR:VALUE
-//	@Description	where FIELD is one of the accepted query params; OPERATOR is one of "lt" (<), "gt" (>), "eq" (=), "in" (IN), "lk" (LIKE), "btw" (BETWEEN)
+//	@Description	where FIELD is one of the accepted query params; OPERATOR is one of "lt" (<), "lte" (<=), "gt" (>), "gte" (>=), "eq" (=), "ne" (!=), "in" (IN), "nin" (NOT IN), "lk" (LIKE), "btw" (BETWEEN), "exists", "missing"
 //	@Description	and VALUE is an unquoted string, integer or decimal
 //	@Description	Multiple VALUEs for an "in"-filter must be comma-separated and will be interpreted as a discunctive filter.
-//	@Description	The OPERATORs "lt", "gt" and "btw" are only applicable to numerical values.
+//	@Description	The OPERATORs "lt", "lte", "gt", "gte" and "btw" are only applicable to numerical values.
 //	@Description	The OPERATOR "lk" is only applicable to string values and supports wildcards `*`(0 or more chars) and `?`(one char).
 //	@Description	The OPERATOR "btw" accepts two comma-separated values as the inclusive lower and upper bound. Missing values are assumed as 0 and 9999999 respectively.
+//	@Description	The OPERATORs "exists" and "missing" take no VALUE (e.g. doi=exists:) and match if the FIELD has any value or no value respectively.
 //	@Description	If no OPERATOR is specified, "eq" is assumed as the default OPERATOR.
 //	@Description	The filters are evaluated conjunctively.
+//	@Description	Disjunctions are given as or=FIELD=OPERATOR:VALUE|FIELD=OPERATOR:VALUE where at least one of the filters has to match.
 //	@Description	Note that applying more filters can slow down the query as more tables have to be considered in the evaluation.
+//	@Description	A free text search with q sorts the samples by relevance instead of sampleID and returns the matching fragments as highlights of each sample.
+//	@Description	Samples without a value for a sort key are sorted last; fields with multiple values are sorted by their minimum for ascending and their maximum for descending order.
 //	@Security		ApiKeyAuth
 //	@Tags			samples
 //	@Accept			json
 //	@Produce		json
 //	@Param			limit				query		int		false	"DEPRECATED limit"
 //	@Param			offset				query		int		false	"DEPRECATED offset"
+//	@Param			cursor				query		string	false	"opaque cursor to continue paging - use nextCursor of the previous response; valid for 30 seconds after the first page and 5 minutes after later pages"
+//	@Param			sort				query		string	false	"comma-separated sort keys KEY[:asc|desc] where KEY is a field like publicationyear, agemin, agemax, latitude or longitude, distance:LON:LAT, element:ELEMENT or score - the sampleID is always added as last key"
+//	@Param			fields				query		string	false	"comma-separated fields of the sample documents to return as sparse documents instead of the default response, e.g. sampleID,latitude,longitude or minimal; the sampleID is always included"
+//	@Param			measurements		query		string	false	"comma-separated elements whose measured values are returned as selectedMeasurements of each sample, e.g. SiO2,MgO"
 //	@Param			setting				query		string	false	"tectonic setting - see /queries/sites/settings (supports Filter DSL)"
 //	@Param			location1			query		string	false	"location level 1 - see /queries/locations/l1 (supports Filter DSL)"
 //	@Param			location2			query		string	false	"location level 2 - see /queries/locations/l2 (supports Filter DSL)"
@@ -58,7 +72,7 @@ const (
 //	@Param			inclusionmaterial	query		string	false	"inclusion material - see /queries/samples/inclusionmaterials (supports Filter DSL)"
 //	@Param			sampletech			query		string	false	"sampling technique - see /queries/samples/samplingtechniques (supports Filter DSL)"
 //	@Param			rimorcore			query		string	false	"rim or core - R = Rim, C = Core, I = Intermediate (supports Filter DSL)"
-//	@Param			chemistry			query		string	false	"chemical filter using the form `(TYPE,ELEMENT,MIN,MAX),...` where the filter tuples are evaluated conjunctively"
+//	@Param			chemistry			query		string	false	"chemical filter using tuples `(TYPE,ELEMENT,MIN,MAX[,UNIT[,METHOD]])` or comparisons `ELEMENT>=VALUE` (>, >=, <, <=, =) joined by `,`, `AND` or `OR` and evaluated from left to right; ELEMENT can be a ratio like `La/Yb`"
 //	@Param			title				query		string	false	"title of publication (supports Filter DSL)"
 //	@Param			publicationyear		query		string	false	"publication year (supports Filter DSL)"
 //	@Param			doi					query		string	false	"DOI (supports Filter DSL)"
@@ -69,29 +83,41 @@ const (
 //	@Param			geoage				query		string	false	"Specimen geological age - see /queries/samples/geoages (supports Filter DSL)"
 //	@Param			geoageprefix		query		string	false	"Specimen geological age prefix - see /queries/samples/geoageprefixes (supports Filter DSL)"
 //	@Param			lab					query		string	false	"Laboratory name - see /queries/samples/organizationnames (supports Filter DSL)"
+//	@Param			or					query		string	false	"disjunction of filters formatted as FIELD=OPERATOR:VALUE|FIELD=OPERATOR:VALUE"
+//	@Param			q					query		string	false	"free text searched in sample names, location names, citation titles, journals, author last names and rock names"
+//	@Param			near				query		string	false	"radius around a point formatted as LON,LAT,RADIUS_KM, e.g. 14.99,37.75,50 - the distance of each sample is returned in km"
+//	@Param			region				query		string	false	"named region id as listed by GET /v2/geodata/regions, e.g. aleutian_arc"
+//	@Param			geotile				query		string	false	"geotile key formatted as ZOOM/X/Y, e.g. the tileKey of a cluster"
 //	@Param			polygon				query		string	false	"DEPRECATED: USE GEOJSON INSTEAD | Coordinate-Polygon formatted as 2-dimensional json array: [[LONG,LAT],[2.4,6.3]]"
-// @Param polygon_geojson query string false "GeoJSON representation of the polygon to search in"
+//	@Param			polygon_geojson		query		string	false	"GeoJSON Polygon, MultiPolygon, Feature or FeatureCollection of the area to search in - holes are excluded; rings are closed and oriented and polygons with more than 1000 vertices are simplified, self-intersecting polygons are rejected with 422"
 //	@Param			addcoordinates		query		bool	false	"Add coordinates to each sample"
 //	@Success		206					{object}	model.SampleByFilterResponse
-//	@Success		200					{object}	JSON
+//	@Success		200					{object}	model.SparseSampleResponse
+//	@Failure		400					{object}	string
 //	@Failure		401					{object}	string
 //	@Failure		404					{object}	string
+//	@Failure		410					{object}	string
 //	@Failure		422					{object}	string
 //	@Failure		500					{object}	string
 //	@Router			/v2/queries/samples [get]
 func (h *Handler) GetSampleIDStreamed_v2(c echo.Context) error {
+	return h.searchSamples(c, c.QueryParams())
+}
+
+// searchSamples returns a page of the samples matching the filters in params
+func (h *Handler) searchSamples(c echo.Context, params url.Values) error {
 	logger, ok := c.Get(middleware.LOGGER_KEY).(middleware.APILogger)
 	if !ok {
 		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
 	}
 	// parse filters
-	filters, err := parseFilters(c)
+	f, err := parseFilters(params)
 	if err != nil {
 		logger.Errorf("can not parse filters: %s", err.Error())
-		return c.String(http.StatusUnprocessableEntity, "Invalid filters")
+		return invalidFilters(c, err)
 	}
 
-	limitS := c.QueryParam(QP_LIMIT)
+	limitS := params.Get(QP_LIMIT)
 	limit, err := strconv.Atoi(limitS)
 	// if limit is not specified, fail silently, otherwise log parsing error and continue with default
 	if limitS != "" && err != nil {
@@ -99,32 +125,175 @@ func (h *Handler) GetSampleIDStreamed_v2(c echo.Context) error {
 		limit = 0
 	}
 
-	// TODO: handle offset
-	offsetS := c.QueryParam(QP_OFFSET)
+	offsetS := params.Get(QP_OFFSET)
 	if offsetS != "" {
-		logger.Warn("Offset is deprecated - use searchAfter instead")
+		logger.Warn("Offset is deprecated - use cursor instead")
 	}
-	after := "0"
-	page, err := h.searchIndex.QuerySortSearchAfterPaginated(c.Request().Context(), repository.SEARCH_FIELDS, filters, limit, after)
+	// sparse documents are returned if fields are requested
+	includeFields := repository.SEARCH_FIELDS
+	var fields []string
+	if fieldsS := params.Get(QP_FIELDS); fieldsS != "" {
+		fields, err = repository.ParseFields(fieldsS)
+		if err != nil {
+			logger.Errorf("can not parse fields: %s", err.Error())
+			return c.String(http.StatusBadRequest, "Invalid fields")
+		}
+		includeFields = fields
+	}
+	var elements []string
+	if measurementsS := params.Get(QP_MEASUREMENTS); measurementsS != "" {
+		elements = strings.Split(measurementsS, filter.DELIM)
+		// the results are needed to select the measurements but only returned if requested
+		includeFields = append(slices.Clip(includeFields), repository.FIELD_RESULTS)
+	}
+
+	cursor := params.Get(QP_CURSOR)
+	page, err := h.searchIndex.QuerySortSearchAfterPaginated(c.Request().Context(), includeFields, f, limit, cursor)
 	if err != nil {
 		logger.Errorf("Can not query documents: %s", err.Error())
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			return c.String(http.StatusBadRequest, "Invalid cursor")
+		}
+		if errors.Is(err, repository.ErrCursorExpired) {
+			return c.String(http.StatusGone, "Cursor expired - restart paging without cursor")
+		}
+		if errors.Is(err, repository.ErrInvalidFilter) {
+			return c.String(http.StatusUnprocessableEntity, "Invalid filters")
+		}
 		return c.String(http.StatusInternalServerError, "Error querying database")
 	}
 
+	if fields != nil {
+		docs := repository.ProjectDocuments(page.Documents, fields)
+		for i, doc := range docs {
+			if elements != nil {
+				doc["selectedMeasurements"] = model.SelectMeasurements(page.Documents[i], elements)
+			}
+			if i < len(page.Highlights) {
+				doc["highlights"] = page.Highlights[i]
+			}
+			if i < len(page.Distances) {
+				doc["distance"] = page.Distances[i]
+			}
+		}
+		return c.JSON(http.StatusOK, model.SparseSampleResponse{
+			NumItems:   len(docs),
+			TotalCount: page.TotalHits,
+			Data:       docs,
+			NextCursor: page.NextCursor,
+		})
+	}
+
 	// parse to old response model
 	results := make([]model.SampleByFiltersData, 0, len(page.Documents))
-	for _, d := range page.Documents {
+	for i, d := range page.Documents {
 		doc, err := model.ParseToSampleByFiltersData(d)
 		if err != nil {
 			logger.Errorf("Can not parse doc to sample: %s", err.Error())
 			return c.String(http.StatusInternalServerError, "Error parsing document")
 		}
+		if i < len(page.Highlights) {
+			doc.Highlights = page.Highlights[i]
+		}
+		if elements != nil {
+			doc.SelectedMeasurements = model.SelectMeasurements(d, elements)
+		}
+		if i < len(page.Distances) {
+			doc.Distance = &page.Distances[i]
+		}
 		results = append(results, *doc)
 	}
 	response := model.SampleByFilterResponse{
 		NumItems:   len(page.Documents),
 		TotalCount: page.TotalHits,
 		Data:       results,
+		NextCursor: page.NextCursor,
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// GetSampleFacets_v2 godoc
+//
+//	@Summary		Retrieve the number of samples per value of the facets
+//	@Description	Get the number of samples matching the current filters per rock type, rock class, mineral, tectonic setting, material, geological age, location level 1 and publication decade
+//	@Description	The filters support the same Filter DSL as GET /v2/queries/samples
+//	@Description	The values of a facet are ordered by the number of samples except for the publication decades which are ordered by decade
+//	@Description	The values can be used as filter values of the corresponding query params to narrow the search; publication decades are given by their first year
+//	@Security		ApiKeyAuth
+//	@Tags			samples
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit				query		int		false	"maximum number of values per facet - default 20, maximum 1000"
+//	@Param			setting				query		string	false	"tectonic setting - see /queries/sites/settings (supports Filter DSL)"
+//	@Param			location1			query		string	false	"location level 1 - see /queries/locations/l1 (supports Filter DSL)"
+//	@Param			location2			query		string	false	"location level 2 - see /queries/locations/l2 (supports Filter DSL)"
+//	@Param			location3			query		string	false	"location level 3 - see /queries/locations/l3 (supports Filter DSL)"
+//	@Param			latitude			query		string	false	"latitude (supports Filter DSL)"
+//	@Param			longitude			query		string	false	"longitude (supports Filter DSL)"
+//	@Param			rocktype			query		string	false	"rock type - see /queries/samples/rocktypes (supports Filter DSL)"
+//	@Param			rockclassID			query		int		false	"taxonomic classifier ID - see /queries/samples/rockclasses value (supports Filter DSL)"
+//	@Param			mineral				query		string	false	"mineral - see /queries/samples/minerals (supports Filter DSL)"
+//	@Param			material			query		string	false	"material - see /queries/samples/materials (supports Filter DSL)"
+//	@Param			inclusiontype		query		string	false	"inclusion type - see /queries/samples/inclusiontypes (supports Filter DSL)"
+//	@Param			hostmaterial		query		string	false	"host material - see /queries/samples/hostmaterials (supports Filter DSL)"
+//	@Param			inclusionmaterial	query		string	false	"inclusion material - see /queries/samples/inclusionmaterials (supports Filter DSL)"
+//	@Param			sampletech			query		string	false	"sampling technique - see /queries/samples/samplingtechniques (supports Filter DSL)"
+//	@Param			rimorcore			query		string	false	"rim or core - R = Rim, C = Core, I = Intermediate (supports Filter DSL)"
+//	@Param			chemistry			query		string	false	"chemical filter using tuples `(TYPE,ELEMENT,MIN,MAX[,UNIT[,METHOD]])` or comparisons `ELEMENT>=VALUE` (>, >=, <, <=, =) joined by `,`, `AND` or `OR` and evaluated from left to right; ELEMENT can be a ratio like `La/Yb`"
+//	@Param			title				query		string	false	"title of publication (supports Filter DSL)"
+//	@Param			publicationyear		query		string	false	"publication year (supports Filter DSL)"
+//	@Param			doi					query		string	false	"DOI (supports Filter DSL)"
+//	@Param			firstname			query		string	false	"Author first name (supports Filter DSL)"
+//	@Param			lastname			query		string	false	"Author last name (supports Filter DSL)"
+//	@Param			agemin				query		string	false	"Specimen age min (supports Filter DSL)"
+//	@Param			agemax				query		string	false	"Specimen age max (supports Filter DSL)"
+//	@Param			geoage				query		string	false	"Specimen geological age - see /queries/samples/geoages (supports Filter DSL)"
+//	@Param			geoageprefix		query		string	false	"Specimen geological age prefix - see /queries/samples/geoageprefixes (supports Filter DSL)"
+//	@Param			lab					query		string	false	"Laboratory name - see /queries/samples/organizationnames (supports Filter DSL)"
+//	@Param			or					query		string	false	"disjunction of filters formatted as FIELD=OPERATOR:VALUE|FIELD=OPERATOR:VALUE"
+//	@Param			q					query		string	false	"free text searched in sample names, location names, citation titles, journals, author last names and rock names"
+//	@Param			near				query		string	false	"radius around a point formatted as LON,LAT,RADIUS_KM, e.g. 14.99,37.75,50 - the distance of each sample is returned in km"
+//	@Param			region				query		string	false	"named region id as listed by GET /v2/geodata/regions, e.g. aleutian_arc"
+//	@Param			geotile				query		string	false	"geotile key formatted as ZOOM/X/Y, e.g. the tileKey of a cluster"
+//	@Param			polygon				query		string	false	"DEPRECATED: USE GEOJSON INSTEAD | Coordinate-Polygon formatted as 2-dimensional json array: [[LONG,LAT],[2.4,6.3]]"
+//	@Param			polygon_geojson		query		string	false	"GeoJSON Polygon, MultiPolygon, Feature or FeatureCollection of the area to search in - holes are excluded; rings are closed and oriented and polygons with more than 1000 vertices are simplified, self-intersecting polygons are rejected with 422"
+//	@Success		200					{object}	model.FacetResponse
+//	@Failure		401					{object}	string
+//	@Failure		422					{object}	string
+//	@Failure		500					{object}	string
+//	@Router			/v2/queries/samples/facets [get]
+func (h *Handler) GetSampleFacets_v2(c echo.Context) error {
+	logger, ok := c.Get(middleware.LOGGER_KEY).(middleware.APILogger)
+	if !ok {
+		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
+	}
+	params := c.QueryParams()
+	f, err := parseFilters(params)
+	if err != nil {
+		logger.Errorf("can not parse filters: %s", err.Error())
+		return invalidFilters(c, err)
+	}
+
+	limitS := params.Get(QP_LIMIT)
+	limit, err := strconv.Atoi(limitS)
+	// if limit is not specified, fail silently, otherwise log parsing error and continue with default
+	if limitS != "" && err != nil {
+		logger.Warnf("Can not parse limit %s - setting default", limitS)
+		limit = 0
+	}
+
+	page, err := h.searchIndex.QueryFacets(c.Request().Context(), f, limit)
+	if err != nil {
+		logger.Errorf("Can not query facets: %s", err.Error())
+		if errors.Is(err, repository.ErrInvalidFilter) {
+			return c.String(http.StatusUnprocessableEntity, "Invalid filters")
+		}
+		return c.String(http.StatusInternalServerError, "Error querying database")
+	}
+	response, err := model.ParseToFacetResponse(page)
+	if err != nil {
+		logger.Errorf("Can not parse facets: %s", err.Error())
+		return c.String(http.StatusInternalServerError, "Error parsing facets")
 	}
 	return c.JSON(http.StatusOK, response)
 }
@@ -133,16 +302,19 @@ func (h *Handler) GetSampleIDStreamed_v2(c echo.Context) error {
 //
 //	@Summary		Retrieve all samplingfeatureIDs filtered by a variety of fields and clustered
 //	@Description	Get all samplingfeatureIDs matching the current filters clustered
+//	@Description	Each cluster holds the bounding box of its samples as convexHull, its geotile as tileKey and tileBounds [WEST, SOUTH, EAST, NORTH] and a drillDownBBox usable as bbox param to zoom into the cluster
 //	@Description	Filter DSL syntax:
 //	@Description	FIELD=OPERATOR:VALUE
-//	@Description	where FIELD is one of the accepted query params; OPERATOR is one of "lt" (<), "gt" (>), "eq" (=), "in" (IN), "lk" (LIKE), "btw" (BETWEEN)
+//	@Description	where FIELD is one of the accepted query params; OPERATOR is one of "lt" (<), "lte" (<=), "gt" (>), "gte" (>=), "eq" (=), "ne" (!=), "in" (IN), "nin" (NOT IN), "lk" (LIKE), "btw" (BETWEEN), "exists", "missing"
 //	@Description	and VALUE is an unquoted string, integer or decimal
 //	@Description	Multiple VALUEs for an "in"-filter must be comma-separated and will be interpreted as a discunctive filter.
-//	@Description	The OPERATORs "lt", "gt" and "btw" are only applicable to numerical values.
+//	@Description	The OPERATORs "lt", "lte", "gt", "gte" and "btw" are only applicable to numerical values.
 //	@Description	The OPERATOR "lk" is only applicable to string values and supports wildcards `*`(0 or more chars) and `?`(one char).
 //	@Description	The OPERATOR "btw" accepts two comma-separated values as the inclusive lower and upper bound. Missing values are assumed as 0 and 9999999 respectively.
+//	@Description	The OPERATORs "exists" and "missing" take no VALUE (e.g. doi=exists:) and match if the FIELD has any value or no value respectively.
 //	@Description	If no OPERATOR is specified, "eq" is assumed as the default OPERATOR.
 //	@Description	The filters are evaluated conjunctively.
+//	@Description	Disjunctions are given as or=FIELD=OPERATOR:VALUE|FIELD=OPERATOR:VALUE where at least one of the filters has to match.
 //	@Description	Note that applying more filters can slow down the query as more tables have to be considered in the evaluation.
 //	@Security		ApiKeyAuth
 //	@Tags			geodata
@@ -154,47 +326,59 @@ func (h *Handler) GetSampleIDStreamed_v2(c echo.Context) error {
 //	@Param			location3			query		string	false	"location level 3 - see /queries/locations/l3 (supports Filter DSL)"
 //	@Param			latitude			query		string	false	"latitude (supports Filter DSL)"
 //	@Param			longitude			query		string	false	"longitude (supports Filter DSL)"
-//	@Param			rocktype			query		string	false	"rock type - see /queries/samples/rocktypes (supports 'eq', 'in')"
-//	@Param			rockclassID			query		int		false	"taxonomic classifier ID - see /queries/samples/rockclasses value (supports 'eq', 'in')"
-//	@Param			mineral				query		string	false	"mineral - see /queries/samples/minerals (supports 'eq', 'in')"
+//	@Param			rocktype			query		string	false	"rock type - see /queries/samples/rocktypes (supports Filter DSL)"
+//	@Param			rockclassID			query		int		false	"taxonomic classifier ID - see /queries/samples/rockclasses value (supports Filter DSL)"
+//	@Param			mineral				query		string	false	"mineral - see /queries/samples/minerals (supports Filter DSL)"
 //	@Param			material			query		string	false	"material - see /queries/samples/materials (supports Filter DSL)"
 //	@Param			inclusiontype		query		string	false	"inclusion type - see /queries/samples/inclusiontypes (supports Filter DSL)"
-//	@Param			hostmineral			query		string	false	"host mineral - see /queries/samples/hostmaterials (supports 'eq', 'in')"
-//	@Param			inclusionmineral	query		string	false	"inclusion mineral - see /queries/samples/inclusionmaterials (supports 'eq', 'in')"
+//	@Param			hostmineral			query		string	false	"host mineral - see /queries/samples/hostmaterials (supports Filter DSL)"
+//	@Param			inclusionmineral	query		string	false	"inclusion mineral - see /queries/samples/inclusionmaterials (supports Filter DSL)"
 //	@Param			sampletech			query		string	false	"sampling technique - see /queries/samples/samplingtechniques (supports Filter DSL)"
 //	@Param			rimorcore			query		string	false	"rim or core - R = Rim, C = Core, I = Intermediate (supports Filter DSL)"
-//	@Param			chemistry			query		string	false	"chemical filter using the form `(TYPE,ELEMENT,MIN,MAX),...` where the filter tuples are evaluated conjunctively"
+//	@Param			chemistry			query		string	false	"chemical filter using tuples `(TYPE,ELEMENT,MIN,MAX[,UNIT[,METHOD]])` or comparisons `ELEMENT>=VALUE` (>, >=, <, <=, =) joined by `,`, `AND` or `OR` and evaluated from left to right; ELEMENT can be a ratio like `La/Yb`"
 //	@Param			title				query		string	false	"title of publication (supports Filter DSL)"
 //	@Param			publicationyear		query		string	false	"publication year (supports Filter DSL)"
 //	@Param			doi					query		string	false	"DOI (supports Filter DSL)"
-//	@Param			firstname			query		string	false	"Author first name (supports 'eq', 'in')"
-//	@Param			lastname			query		string	false	"Author last name (supports 'eq', 'in')"
+//	@Param			firstname			query		string	false	"Author first name (supports Filter DSL)"
+//	@Param			lastname			query		string	false	"Author last name (supports Filter DSL)"
 //	@Param			agemin				query		string	false	"Specimen age min (supports Filter DSL)"
 //	@Param			agemax				query		string	false	"Specimen age max (supports Filter DSL)"
 //	@Param			geoage				query		string	false	"Specimen geological age - see /queries/samples/geoages (supports Filter DSL)"
 //	@Param			geoageprefix		query		string	false	"Specimen geological age prefix - see /queries/samples/geoageprefixes (supports Filter DSL)"
 //	@Param			lab					query		string	false	"Laboratory name - see /queries/samples/organizationnames (supports Filter DSL)"
+//	@Param			or					query		string	false	"disjunction of filters formatted as FIELD=OPERATOR:VALUE|FIELD=OPERATOR:VALUE"
+//	@Param			q					query		string	false	"free text searched in sample names, location names, citation titles, journals, author last names and rock names"
+//	@Param			near				query		string	false	"radius around a point formatted as LON,LAT,RADIUS_KM, e.g. 14.99,37.75,50 - the distance of each sample is returned in km"
+//	@Param			region				query		string	false	"named region id as listed by GET /v2/geodata/regions, e.g. aleutian_arc"
+//	@Param			geotile				query		string	false	"geotile key formatted as ZOOM/X/Y, e.g. the tileKey of a cluster"
 //	@Param			polygon				query		string	false	"DEPRECATED: USE GEOJSON INSTEAD | Coordinate-Polygon formatted as 2-dimensional json array: [[LONG,LAT],[2.4,6.3]]"
-// @Param polygon_geojson query string false "GeoJSON representation of the polygon to search in"
+//	@Param			polygon_geojson		query		string	false	"GeoJSON Polygon, MultiPolygon, Feature or FeatureCollection of the area to search in - holes are excluded; rings are closed and oriented and polygons with more than 1000 vertices are simplified, self-intersecting polygons are rejected with 422"
 //	@Param			bbox				query		string	true	"BoundingBox formatted as 2-dimensional json array: [[SW_Long,SW_Lat],[SE_Long,SE_Lat],[NE_Long,NE_Lat],[NW_Long,NW_Lat]]"
 //	@Param			zoomlevel			query		int		false	"Zoom level of the map. Must be at least 1"
+//	@Param			clusterstats		query		string	false	"comma-separated statistics of the samples of each cluster added to the centroid properties: rockclass (dominant rockClass), setting (top 3 settings), age (ageMin and ageMax) and element:ELEMENT (min, median and max of the element in elements), e.g. rockclass,age,element:SiO2"
 //	@Success		200					{object}	model.ClusterResponse
+//	@Failure		400					{object}	string
 //	@Failure		401					{object}	string
 //	@Failure		404					{object}	string
 //	@Failure		422					{object}	string
 //	@Failure		500					{object}	string
 //	@Router			/v2/geodata/samplesclustered [get]
 func (h *Handler) GetSamplesClustered_v2(c echo.Context) error {
+	return h.clusterSamples(c, c.QueryParams())
+}
+
+// clusterSamples returns the samples matching the filters in params clustered by the zoom level
+func (h *Handler) clusterSamples(c echo.Context, params url.Values) error {
 	logger, ok := c.Get(middleware.LOGGER_KEY).(middleware.APILogger)
 	if !ok {
 		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
 	}
 
 	// get zoomLevel
-	zoomLevelS := c.QueryParam(QP_ZOOMLEVEL)
+	zoomLevelS := params.Get(QP_ZOOMLEVEL)
 	if zoomLevelS == "" {
 		// calculate zoomLevel from bbox
-		bboxS := c.QueryParam(QP_BBOX)
+		bboxS := params.Get(QP_BBOX)
 		bbox, err := geometry.ParsePointArray(bboxS)
 		if err != nil {
 			return c.String(http.StatusBadRequest, "Can not parse bbox")
@@ -209,80 +393,112 @@ func (h *Handler) GetSamplesClustered_v2(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Invalid zoom level - must be an integer")
 	}
 
-	filters, err := parseFilters(c)
+	f, err := parseFilters(params)
 	if err != nil {
 		logger.Errorf("can not parse filters: %s", err.Error())
-		return c.String(http.StatusUnprocessableEntity, "Invalid filters")
+		return invalidFilters(c, err)
+	}
+	stats, err := repository.ParseClusterStats(strings.Join(params[QP_CLUSTERSTATS], filter.DELIM))
+	if err != nil {
+		logger.Errorf("can not parse cluster statistics: %s", err.Error())
+		return c.String(http.StatusBadRequest, "Invalid clusterstats")
 	}
 
 	// start the query
-	response, err := h.searchIndex.QueryClustered(repository.SEARCH_FIELDS, filters, zoomLevel)
+	response, err := h.searchIndex.QueryClustered(repository.SEARCH_FIELDS, f, zoomLevel, stats)
 	if err != nil {
 		logger.Errorf("Can not GetSamplesFilteredClustered: %v", err)
+		if errors.Is(err, repository.ErrInvalidFilter) {
+			return c.String(http.StatusUnprocessableEntity, "Invalid filters")
+		}
 		return c.String(http.StatusInternalServerError, "Can not retrieve sample data")
 	}
 
 	// add handled bbox to response
-	bboxStr, ok := filters[QP_BBOX]
-	if ok {
-		bbox, err := geometry.ParsePointArray(bboxStr)
-		if err != nil {
-			logger.Warnf("Can not parse bbox string '%s': %s", bboxStr, err.Error())
-		} else {
-			// wrap bbox points in []any for geoJSON polygon
-			coords := [][]float64{}
-			for _, point := range bbox {
-				coords = append(coords, []float64{point.X, point.Y})
-			}
-			bboxIWrap := []any{coords}
-			response.Bbox = model.GeoJSONFeature{
-				Type: model.GEOJSONTYPE_FEATURE,
-				Geometry: model.Geometry{
-					Type:        model.GEOJSON_GEOMETRY_POLYGON,
-					Coordinates: bboxIWrap,
-				},
-			}
+	if f.BBox != nil {
+		// wrap bbox points in []any for geoJSON polygon
+		coords := [][]float64{}
+		for _, point := range f.BBox.Points {
+			coords = append(coords, []float64{point.X, point.Y})
+		}
+		bboxIWrap := []any{coords}
+		response.Bbox = model.GeoJSONFeature{
+			Type: model.GEOJSONTYPE_FEATURE,
+			Geometry: model.Geometry{
+				Type:        model.GEOJSON_GEOMETRY_POLYGON,
+				Coordinates: bboxIWrap,
+			},
 		}
 	}
 	return c.JSON(http.StatusOK, response)
 }
 
-// parseFilters parses filter values from the incoming request
-func parseFilters(c echo.Context) (map[string]string, error) {
-	skip := []string{"zoomlevel", "limit", "offset", QP_POLYGON_GEOJSON}
-	filters := map[string]string{}
-	// if GeoJSON is supplied: set geojson polygon as polygon filter and skip parsing parameter "polygon"
-	geojson := c.QueryParam(QP_POLYGON_GEOJSON)
-	if geojson != "" {
-		filters[QP_POLY] = geojson
-		skip = append(skip, QP_POLY)
+// GetClusterSamples_v2 godoc
+//
+//	@Summary		Retrieve the samples of a cluster
+//	@Description	Get a page of the samples matching the current filters inside the geotile of a cluster of GET /v2/geodata/samplesclustered
+//	@Description	The tileKey is the tileKey of the cluster formatted as ZOOM/X/Y and has to be URL-encoded, e.g. 6%2F28%2F17
+//	@Description	All query params of GET /v2/queries/samples are supported, so the filters of the clustering can be passed unchanged to list the samples of a cluster
+//	@Security		ApiKeyAuth
+//	@Tags			geodata
+//	@Accept			json
+//	@Produce		json
+//	@Param			tileKey	path		string	true	"URL-encoded geotile key of the cluster formatted as ZOOM/X/Y"
+//	@Param			limit	query		int		false	"maximum number of samples per page"
+//	@Param			cursor	query		string	false	"opaque cursor to continue paging - use nextCursor of the previous response; valid for 30 seconds after the first page and 5 minutes after later pages"
+//	@Param			fields	query		string	false	"comma-separated fields of the sample documents to return as sparse documents instead of the default response"
+//	@Param			bbox	query		string	false	"BoundingBox of the clustering formatted as 2-dimensional json array: [[SW_Long,SW_Lat],[SE_Long,SE_Lat],[NE_Long,NE_Lat],[NW_Long,NW_Lat]]"
+//	@Success		200		{object}	model.SampleByFilterResponse
+//	@Failure		400		{object}	string
+//	@Failure		401		{object}	string
+//	@Failure		410		{object}	string
+//	@Failure		422		{object}	string
+//	@Failure		500		{object}	string
+//	@Router			/v2/geodata/clusters/{tileKey}/samples [get]
+func (h *Handler) GetClusterSamples_v2(c echo.Context) error {
+	logger, ok := c.Get(middleware.LOGGER_KEY).(middleware.APILogger)
+	if !ok {
+		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
+	}
+	// the slashes of the key are escaped to keep it a single path segment
+	tileKey, err := url.PathUnescape(c.Param("tileKey"))
+	if err == nil {
+		_, err = geometry.ParseGeotileKey(tileKey)
+	}
+	if err != nil {
+		logger.Errorf("Invalid tile key %s", c.Param("tileKey"))
+		return c.String(http.StatusBadRequest, "Invalid tile key")
+	}
+	params := maps.Clone(c.QueryParams())
+	params.Set(filter.KEY_GEOTILE, tileKey)
+	return h.searchSamples(c, params)
+}
+
+// parseFilters parses filter values from the parameters of the incoming request
+func parseFilters(params url.Values) (filter.Filter, error) {
+	f, err := filter.Parse(params, QP_ZOOMLEVEL, QP_LIMIT, QP_OFFSET, QP_CURSOR, QP_BBOX, QP_FIELDS, QP_MEASUREMENTS, QP_CLUSTERSTATS, QP_GRID, QP_RESOLUTION, QP_ELEMENT, QP_ADD_COORDINATES)
+	if err != nil {
+		return f, err
 	}
-	for k, v := range c.QueryParams() {
-		if slices.Contains(skip, k) {
-			continue
-		}
-		if k == QP_BBOX {
-			bboxStr, err := handleBBox(v)
-			if err != nil {
-				return nil, err
-			}
-			filters[k] = bboxStr
-		} else {
-			filters[k] = strings.Join(v, ",")
+	if bboxStr, ok := params[QP_BBOX]; ok {
+		bbox, err := handleBBox(bboxStr)
+		if err != nil {
+			return f, err
 		}
+		f.BBox = filter.ShapeFromPoints(bbox)
 	}
-	return filters, nil
+	return f, nil
 }
 
 // handleBBox handles scaling and truncating the bounding box to ensure that
 // it is at most 360*180 degrees big and provides some results outside the visible area to avoid small-panning reloads
-func handleBBox(bboxStr []string) (string, error) {
+func handleBBox(bboxStr []string) ([]model.SimplePoint, error) {
 	if len(bboxStr) == 0 {
-		return "", fmt.Errorf("empty bbox")
+		return nil, fmt.Errorf("empty bbox")
 	}
 	bbox, err := geometry.ParsePointArray(bboxStr[0])
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	// scale bbox
 	if !geometry.IsZoom0(bbox) {
@@ -291,14 +507,5 @@ func handleBBox(bboxStr []string) (string, error) {
 	}
 	// truncate bbox after scaling so it contains at most one whole world
 	bbox = geometry.TruncateBBox(bbox)
-	// parse it back to an array of arrays for compatibility with later function calls
-	bboxArray := [][]float64{}
-	for _, p := range bbox {
-		bboxArray = append(bboxArray, []float64{p.X, p.Y})
-	}
-	bboxBytes, err := json.Marshal(bboxArray)
-	if err != nil {
-		return "", err
-	}
-	return string(bboxBytes), err
+	return bbox, nil
 }
@@ -0,0 +1,215 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/middleware"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+)
+
+// searchRequest is the JSON body of the POST search endpoints
+// All members are translated into the query parameters of the corresponding GET endpoints
+type searchRequest struct {
+	// Filters maps the filter fields to one or more values of the Filter DSL, e.g. {"rocktype": "in:BASALT,ANDESITE"}
+	Filters map[string]filterValues `json:"filters"`
+	// Or holds disjunctions of filters, e.g. [{"setting": "RIFT", "location1": "ICELAND"}]
+	Or []map[string]filterValues `json:"or"`
+	// Q is the free text of the full text search
+	Q string `json:"q"`
+	// Chemistry holds chemical filters using tuples `(TYPE,ELEMENT,MIN,MAX[,UNIT[,METHOD]])` or comparisons like `SiO2>45 OR La/Yb>=10`
+	Chemistry filterValues `json:"chemistry"`
+	// Polygon is the GeoJSON Polygon, MultiPolygon, Feature or FeatureCollection of the area to search in
+	Polygon json.RawMessage `json:"polygon" swaggertype:"object"`
+	// BBox is the bounding box formatted as 2-dimensional array: [[SW_Long,SW_Lat],[SE_Long,SE_Lat],[NE_Long,NE_Lat],[NW_Long,NW_Lat]]
+	BBox json.RawMessage `json:"bbox" swaggertype:"array,number"`
+	// Near is the radius around a point formatted as "LON,LAT,RADIUS_KM", e.g. "14.99,37.75,50"
+	Near string `json:"near"`
+	// Region is the id of a named region, e.g. "aleutian_arc"
+	Region string `json:"region"`
+	// Sort holds the comma-separated sort keys, e.g. "publicationyear:desc,element:MgO:desc"
+	Sort string `json:"sort"`
+	// Fields holds the comma-separated fields of the sparse documents, e.g. "sampleID,latitude,longitude"
+	Fields string `json:"fields"`
+	// Measurements holds the comma-separated elements to return as selectedMeasurements, e.g. "SiO2,MgO"
+	Measurements string `json:"measurements"`
+	// ClusterStats holds the comma-separated statistics of each cluster, e.g. "rockclass,age,element:SiO2"
+	ClusterStats string `json:"clusterstats"`
+	ZoomLevel    int    `json:"zoomlevel"`
+	Limit        int    `json:"limit"`
+	Cursor       string `json:"cursor"`
+}
+
+// filterValues holds the values of a filter which can be given as a single value or as a list of values
+type filterValues []string
+
+// UnmarshalJSON accepts strings, numbers and lists of them
+func (v *filterValues) UnmarshalJSON(b []byte) error {
+	var raw any
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return err
+	}
+	list, ok := raw.([]any)
+	if !ok {
+		list = []any{raw}
+	}
+	values := filterValues{}
+	for _, elem := range list {
+		switch t := elem.(type) {
+		case nil:
+			continue
+		case string:
+			values = append(values, t)
+		case float64:
+			values = append(values, strconv.FormatFloat(t, 'f', -1, 64))
+		default:
+			return fmt.Errorf("filter values must be strings or numbers but got %v", elem)
+		}
+	}
+	*v = values
+	return nil
+}
+
+// params translates the request into the query parameters of the GET endpoints
+func (r searchRequest) params() url.Values {
+	params := url.Values{}
+	for k, values := range r.Filters {
+		for _, v := range values {
+			params.Add(k, v)
+		}
+	}
+	for _, disjunction := range r.Or {
+		fields := make([]string, 0, len(disjunction))
+		for k := range disjunction {
+			fields = append(fields, k)
+		}
+		slices.Sort(fields)
+		parts := []string{}
+		for _, k := range fields {
+			for _, v := range disjunction[k] {
+				parts = append(parts, fmt.Sprintf("%s=%s", k, v))
+			}
+		}
+		params.Add(filter.KEY_OR, strings.Join(parts, filter.DELIM_OR))
+	}
+	if r.Q != "" {
+		params.Set(filter.KEY_TEXT, r.Q)
+	}
+	for _, v := range r.Chemistry {
+		params.Add(filter.KEY_CHEMISTRY, v)
+	}
+	if isJSONSet(r.Polygon) {
+		params.Set(filter.KEY_POLYGON_GEOJSON, string(r.Polygon))
+	}
+	if isJSONSet(r.BBox) {
+		params.Set(QP_BBOX, string(r.BBox))
+	}
+	if r.Near != "" {
+		params.Set(filter.KEY_NEAR, r.Near)
+	}
+	if r.Region != "" {
+		params.Set(filter.KEY_REGION, r.Region)
+	}
+	if r.Sort != "" {
+		params.Set(filter.KEY_SORT, r.Sort)
+	}
+	if r.Fields != "" {
+		params.Set(QP_FIELDS, r.Fields)
+	}
+	if r.Measurements != "" {
+		params.Set(QP_MEASUREMENTS, r.Measurements)
+	}
+	if r.ClusterStats != "" {
+		params.Set(QP_CLUSTERSTATS, r.ClusterStats)
+	}
+	if r.ZoomLevel != 0 {
+		params.Set(QP_ZOOMLEVEL, strconv.Itoa(r.ZoomLevel))
+	}
+	if r.Limit != 0 {
+		params.Set(QP_LIMIT, strconv.Itoa(r.Limit))
+	}
+	if r.Cursor != "" {
+		params.Set(QP_CURSOR, r.Cursor)
+	}
+	return params
+}
+
+// isJSONSet returns whether the raw JSON holds a value other than null
+func isJSONSet(raw json.RawMessage) bool {
+	return len(raw) > 0 && string(raw) != "null"
+}
+
+// PostSamplesSearch_v2 godoc
+//
+//	@Summary		Retrieve all samplingfeatureIDs filtered by a JSON query
+//	@Description	Same as GET /v2/queries/samples but accepts the filters as JSON body to avoid the length limit of URLs, e.g. for large polygons
+//	@Description	The filters of the body support the same Filter DSL as the query params of GET /v2/queries/samples
+//	@Security		ApiKeyAuth
+//	@Tags			samples
+//	@Accept			json
+//	@Produce		json
+//	@Param			query	body		searchRequest	true	"filters, polygon, chemistry and paging of the search"
+//	@Success		200		{object}	model.SampleByFilterResponse
+//	@Failure		400		{object}	string
+//	@Failure		401		{object}	string
+//	@Failure		410		{object}	string
+//	@Failure		422		{object}	string
+//	@Failure		500		{object}	string
+//	@Router			/v2/queries/samples/search [post]
+func (h *Handler) PostSamplesSearch_v2(c echo.Context) error {
+	params, err := bindSearchRequest(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid request body")
+	}
+	return h.searchSamples(c, params)
+}
+
+// PostSamplesClustered_v2 godoc
+//
+//	@Summary		Retrieve all samplingfeatureIDs filtered by a JSON query and clustered
+//	@Description	Same as GET /v2/geodata/samplesclustered but accepts the filters as JSON body to avoid the length limit of URLs, e.g. for large polygons
+//	@Description	The filters of the body support the same Filter DSL as the query params of GET /v2/geodata/samplesclustered
+//	@Security		ApiKeyAuth
+//	@Tags			geodata
+//	@Accept			json
+//	@Produce		json
+//	@Param			query	body		searchRequest	true	"filters, polygon, chemistry, bbox and zoom level of the search"
+//	@Success		200		{object}	model.ClusterResponse
+//	@Failure		400		{object}	string
+//	@Failure		401		{object}	string
+//	@Failure		422		{object}	string
+//	@Failure		500		{object}	string
+//	@Router			/v2/geodata/samplesclustered/search [post]
+func (h *Handler) PostSamplesClustered_v2(c echo.Context) error {
+	params, err := bindSearchRequest(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid request body")
+	}
+	return h.clusterSamples(c, params)
+}
+
+// bindSearchRequest binds the JSON body of the request and translates it into query parameters
+func bindSearchRequest(c echo.Context) (url.Values, error) {
+	logger, ok := c.Get(middleware.LOGGER_KEY).(middleware.APILogger)
+	if !ok {
+		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
+	}
+	req := searchRequest{}
+	err := json.NewDecoder(c.Request().Body).Decode(&req)
+	if err != nil {
+		logger.Errorf("Can not bind search request: %s", err.Error())
+		return nil, err
+	}
+	return req.params(), nil
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/middleware"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
+)
+
+const (
+	QP_SUGGEST_FIELD  = "field"
+	QP_SUGGEST_PREFIX = "prefix"
+)
+
+// GetSuggestions_v2 godoc
+//
+//	@Summary		Suggest values of a controlled vocabulary
+//	@Description	Get the values of the field starting with the prefix ranked by the number of samples using them
+//	@Description	The prefix is matched independent of case and accents, e.g. "oliv" matches "OLIVINE"
+//	@Description	All other query params are applied as filters of the Filter DSL of GET /v2/queries/samples, so only values of samples matching the active filters are suggested
+//	@Description	Note that the suggested values of rockclass are names while the rockclass filter expects IDs - see /queries/samples/rockclasses
+//	@Security		ApiKeyAuth
+//	@Tags			samples
+//	@Accept			json
+//	@Produce		json
+//	@Param			field	query		string	true	"vocabulary to suggest from"	Enums(mineral, hostmaterial, inclusionmaterial, rocktype, rockclass, material, setting, geoage, location1, location2, location3, lab, author)
+//	@Param			prefix	query		string	false	"prefix of the suggested values"
+//	@Param			limit	query		int		false	"maximum number of suggestions - default 10, maximum 1000"
+//	@Success		200		{object}	model.SuggestResponse
+//	@Failure		400		{object}	string
+//	@Failure		401		{object}	string
+//	@Failure		422		{object}	string
+//	@Failure		500		{object}	string
+//	@Router			/v2/queries/suggest [get]
+func (h *Handler) GetSuggestions_v2(c echo.Context) error {
+	logger, ok := c.Get(middleware.LOGGER_KEY).(middleware.APILogger)
+	if !ok {
+		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
+	}
+	params := c.QueryParams()
+	facet, ok := repository.LookupSuggestion(params.Get(QP_SUGGEST_FIELD))
+	if !ok {
+		logger.Errorf("Invalid suggest field %s", params.Get(QP_SUGGEST_FIELD))
+		return c.String(http.StatusBadRequest, "Invalid field")
+	}
+	prefix := params.Get(QP_SUGGEST_PREFIX)
+
+	// the remaining params are the active filters
+	filterParams := maps.Clone(params)
+	filterParams.Del(QP_SUGGEST_FIELD)
+	filterParams.Del(QP_SUGGEST_PREFIX)
+	f, err := parseFilters(filterParams)
+	if err != nil {
+		logger.Errorf("can not parse filters: %s", err.Error())
+		return invalidFilters(c, err)
+	}
+
+	limitS := params.Get(QP_LIMIT)
+	limit, err := strconv.Atoi(limitS)
+	// if limit is not specified, fail silently, otherwise log parsing error and continue with default
+	if limitS != "" && err != nil {
+		logger.Warnf("Can not parse limit %s - setting default", limitS)
+		limit = 0
+	}
+
+	page, err := h.searchIndex.QuerySuggestions(c.Request().Context(), f, facet, prefix, limit)
+	if err != nil {
+		logger.Errorf("Can not query suggestions: %s", err.Error())
+		if errors.Is(err, repository.ErrInvalidFilter) {
+			return c.String(http.StatusUnprocessableEntity, "Invalid filters")
+		}
+		return c.String(http.StatusInternalServerError, "Error querying database")
+	}
+	facets, err := model.ParseToFacetResponse(page)
+	if err != nil {
+		logger.Errorf("Can not parse suggestions: %s", err.Error())
+		return c.String(http.StatusInternalServerError, "Error parsing suggestions")
+	}
+	suggestions := facets.Facets[facet.Name]
+	if suggestions == nil {
+		suggestions = []model.FacetValue{}
+	}
+	return c.JSON(http.StatusOK, model.SuggestResponse{
+		NumItems: len(suggestions),
+		Data:     suggestions,
+	})
+}
@@ -0,0 +1,189 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/api/middleware"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/mvt"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
+)
+
+const (
+	TILE_EXTENSION = ".mvt"
+	// TILE_CLUSTER_OFFSET is added to the zoom level of a tile for the precision of its clusters, i.e. a tile holds up to 32x32 clusters
+	TILE_CLUSTER_OFFSET = 5
+	// TILE_POINTS_ZOOM is the lowest zoom level at which tiles hold the individual samples
+	TILE_POINTS_ZOOM = 8
+	// MAX_TILE_POINTS is the maximum number of samples of a tile; tiles with more samples hold clusters
+	MAX_TILE_POINTS = 2000
+	// TILE_MAX_AGE is the number of seconds clients may cache a tile
+	TILE_MAX_AGE = 300
+
+	TILE_LAYER_CLUSTERS = "clusters"
+	TILE_LAYER_SAMPLES  = "samples"
+)
+
+// TILE_FIELDS holds the fields of the samples encoded as properties of the point features
+var TILE_FIELDS = []string{"sampleID", "sampleName", "latitude", "longitude", "tectonicSetting", "geologicalAge"}
+
+// GetTile_v2 godoc
+//
+//	@Summary		Retrieve samples as vector tile
+//	@Description	Get the samples matching the filters inside the web mercator tile z/x/y as Mapbox Vector Tile
+//	@Description	Below zoom level 8 or if a tile holds more than 2000 samples, the layer "clusters" holds one point per geotile of zoom level z+5 at the centroid of its samples with the properties clusterSize and tileKey
+//	@Description	Otherwise the layer "samples" holds one point per sample with the properties sampleID, sampleName, tectonicSetting and geologicalAge
+//	@Description	All query params are applied as filters of the Filter DSL of GET /v2/queries/samples; a bbox is replaced by the bounds of the tile
+//	@Security		ApiKeyAuth
+//	@Tags			geodata
+//	@Produce		application/vnd.mapbox-vector-tile
+//	@Param			z	path		int		true	"zoom level 0-29"
+//	@Param			x	path		int		true	"tile column"
+//	@Param			y	path		int		true	"tile row"
+//	@Success		200	{file}		binary
+//	@Failure		400	{object}	string
+//	@Failure		401	{object}	string
+//	@Failure		422	{object}	string
+//	@Failure		500	{object}	string
+//	@Router			/v2/geodata/tiles/{z}/{x}/{y}.mvt [get]
+func (h *Handler) GetTile_v2(c echo.Context) error {
+	logger, ok := c.Get(middleware.LOGGER_KEY).(middleware.APILogger)
+	if !ok {
+		panic(fmt.Sprintf("Can not get context.logger of type %T as type %T", c.Get(middleware.LOGGER_KEY), middleware.APILogger{}))
+	}
+	tile, err := parseTile(c.Param("z"), c.Param("x"), strings.TrimSuffix(c.Param("y"), TILE_EXTENSION))
+	if err != nil {
+		logger.Errorf("Invalid tile: %s", err.Error())
+		return c.String(http.StatusBadRequest, "Invalid tile")
+	}
+
+	f, err := parseFilters(c.QueryParams())
+	if err != nil {
+		logger.Errorf("can not parse filters: %s", err.Error())
+		return invalidFilters(c, err)
+	}
+	f.BBox = filter.ShapeFromPoints(tile.BBox())
+
+	layer, err := h.tileLayer(c, f, tile)
+	if err != nil {
+		logger.Errorf("Can not query tile %s: %v", tile.Key(), err)
+		if errors.Is(err, repository.ErrInvalidFilter) {
+			return c.String(http.StatusUnprocessableEntity, "Invalid filters")
+		}
+		return c.String(http.StatusInternalServerError, "Can not retrieve sample data")
+	}
+	b, err := mvt.Encode(layer)
+	if err != nil {
+		logger.Errorf("Can not encode tile %s: %v", tile.Key(), err)
+		return c.String(http.StatusInternalServerError, "Can not encode tile")
+	}
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", TILE_MAX_AGE))
+	return c.Blob(http.StatusOK, mvt.CONTENT_TYPE, b)
+}
+
+// parseTile parses the path params of a tile
+func parseTile(zS string, xS string, yS string) (geometry.Tile, error) {
+	z, errZ := strconv.Atoi(zS)
+	x, errX := strconv.Atoi(xS)
+	y, errY := strconv.Atoi(yS)
+	if errZ != nil || errX != nil || errY != nil {
+		return geometry.Tile{}, fmt.Errorf("tile %s/%s/%s must be integers", zS, xS, yS)
+	}
+	return geometry.NewTile(z, x, y)
+}
+
+// tileLayer returns the layer of the samples matching the filters inside the tile
+// The samples are clustered by geotiles unless the tile is zoomed in far enough and holds at most MAX_TILE_POINTS samples
+func (h *Handler) tileLayer(c echo.Context, f filter.Filter, tile geometry.Tile) (mvt.Layer, error) {
+	// the clusters are needed at every zoom level: below TILE_POINTS_ZOOM they are the layer
+	// and above they count the samples of the tile, which decides whether the samples fit into the layer
+	precision := min(tile.Z+TILE_CLUSTER_OFFSET, geometry.MAX_TILE_ZOOM)
+	clustered, err := h.searchIndex.QueryClustered(nil, f, precision, nil)
+	if err != nil {
+		return mvt.Layer{}, err
+	}
+	if tile.Z < TILE_POINTS_ZOOM {
+		return clusterLayer(clustered, tile), nil
+	}
+	total := 0
+	for _, cluster := range clustered.Clusters {
+		total += clusterSize(cluster)
+	}
+	if total > MAX_TILE_POINTS {
+		return clusterLayer(clustered, tile), nil
+	}
+	page, err := h.searchIndex.QueryDocuments(c.Request().Context(), TILE_FIELDS, f, MAX_TILE_POINTS)
+	if err != nil {
+		return mvt.Layer{}, err
+	}
+	return sampleLayer(page, tile), nil
+}
+
+// clusterLayer returns the centroids of the clusters as point features of the tile
+func clusterLayer(clustered model.ClusterResponse, tile geometry.Tile) mvt.Layer {
+	layer := mvt.Layer{Name: TILE_LAYER_CLUSTERS, Extent: mvt.DEFAULT_EXTENT}
+	for _, cluster := range clustered.Clusters {
+		coords := cluster.Centroid.Geometry.Coordinates
+		if len(coords) != 2 {
+			continue
+		}
+		lon, lonOk := coords[0].(float64)
+		lat, latOk := coords[1].(float64)
+		if !lonOk || !latOk {
+			continue
+		}
+		x, y := tile.Project(lat, lon, layer.Extent)
+		layer.Features = append(layer.Features, mvt.Feature{
+			ID: uint64(cluster.ClusterID + 1),
+			X:  x,
+			Y:  y,
+			Properties: map[string]any{
+				"clusterSize": clusterSize(cluster),
+				"tileKey":     cluster.Centroid.ID,
+			},
+		})
+	}
+	return layer
+}
+
+// sampleLayer returns the samples of the page as point features of the tile
+func sampleLayer(page model.SearchIndexPage, tile geometry.Tile) mvt.Layer {
+	layer := mvt.Layer{Name: TILE_LAYER_SAMPLES, Extent: mvt.DEFAULT_EXTENT}
+	for _, doc := range page.Documents {
+		lat, latOk := doc["latitude"].(float64)
+		lon, lonOk := doc["longitude"].(float64)
+		if !latOk || !lonOk {
+			continue
+		}
+		x, y := tile.Project(lat, lon, layer.Extent)
+		feature := mvt.Feature{X: x, Y: y, Properties: map[string]any{}}
+		if id, ok := doc["sampleID"].(float64); ok {
+			feature.ID = uint64(id)
+			feature.Properties["sampleID"] = int(id)
+		}
+		for _, field := range []string{"sampleName", "tectonicSetting", "geologicalAge"} {
+			if v, ok := doc[field].(string); ok {
+				feature.Properties[field] = v
+			}
+		}
+		layer.Features = append(layer.Features, feature)
+	}
+	return layer
+}
+
+// clusterSize returns the number of samples of a cluster
+func clusterSize(cluster model.GeoJSONCluster) int {
+	size, _ := cluster.Centroid.Properties["clusterSize"].(int)
+	return size
+}
@@ -0,0 +1,178 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package download_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/download"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// kml holds the parts of a KML document checked by the tests
+type kml struct {
+	Document struct {
+		Styles []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"Style"`
+		Folders []struct {
+			Name    string `xml:"name"`
+			Folders []struct {
+				Name       string `xml:"name"`
+				Placemarks []struct {
+					Name        string `xml:"name"`
+					Description string `xml:"description"`
+					StyleURL    string `xml:"styleUrl"`
+					Coordinates string `xml:"Point>coordinates"`
+				} `xml:"Placemark"`
+			} `xml:"Folder"`
+		} `xml:"Folder"`
+	} `xml:"Document"`
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func samples() []model.FullData {
+	siO2 := &model.Result{ItemName: ptr("SiO2"), ItemGroup: ptr("mj"), Value: ptr(48.5), Unit: ptr("wt%")}
+	sr := &model.Result{ItemName: ptr("Sr"), ItemGroup: ptr("te"), Value: ptr(310.0), Unit: ptr("ppm")}
+	return []model.FullData{
+		{
+			SampleID:        1,
+			SampleName:      ptr("IC<1>"),
+			LocationNames:   []*string{ptr("Iceland"), ptr("Reykjanes"), ptr("Hengill")},
+			Latitude:        ptr(float32(64.2)),
+			Longitude:       ptr(float32(-21.8)),
+			TectonicSetting: ptr("SPREADING CENTER"),
+			RockClasses:     []*model.FullDataTaxonomicClassifier{{Value: "basalt", Label: ptr("BASALT")}},
+			References: []model.Citation{{
+				Title:              ptr("Basalts of the Reykjanes Peninsula"),
+				Publicationyear:    ptr(2001),
+				Externalidentifier: ptr("10.1000/xyz"),
+				Authors:            []model.Author{{PersonLastName: ptr("Smith")}, {PersonLastName: ptr("Jones")}},
+			}},
+			BatchData: []*model.Batch{{Results: []*model.Result{siO2, sr}}},
+		},
+		{
+			SampleID:        2,
+			SampleName:      ptr("IC2"),
+			LocationNames:   []*string{ptr("Iceland")},
+			Latitude:        ptr(float32(64.1)),
+			Longitude:       ptr(float32(-21.9)),
+			TectonicSetting: ptr("SPREADING CENTER"),
+		},
+		// samples without coordinates are omitted
+		{SampleID: 3, SampleName: ptr("NOCOORDS")},
+	}
+}
+
+func TestKMLFormatter(t *testing.T) {
+	data, err := download.NewKMLFormatter(download.KML_STYLE_ROCKCLASS, false).FormatData(samples())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := kml{}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid kml: %v", err)
+	}
+	// BASALT and the unknown rock class of the second sample
+	if len(doc.Document.Styles) != 2 {
+		t.Errorf("expected 2 styles, got %d", len(doc.Document.Styles))
+	}
+	folders := doc.Document.Folders
+	if len(folders) != 1 || folders[0].Name != "Iceland" {
+		t.Fatalf("expected folder Iceland, got %+v", folders)
+	}
+	if len(folders[0].Folders) != 2 || folders[0].Folders[0].Name != "Reykjanes" || folders[0].Folders[1].Name != download.KML_UNKNOWN {
+		t.Fatalf("expected folders Reykjanes and %s, got %+v", download.KML_UNKNOWN, folders[0].Folders)
+	}
+	placemark := folders[0].Folders[0].Placemarks[0]
+	if placemark.Name != "IC<1>" || placemark.Coordinates != "-21.8,64.2" {
+		t.Errorf("unexpected placemark %s at %s", placemark.Name, placemark.Coordinates)
+	}
+	for _, expected := range []string{"IC&lt;1&gt;", "Smith, Jones (2001)", "https://doi.org/10.1000/xyz", "<td>SiO2</td><td>48.5 wt%</td>"} {
+		if !strings.Contains(placemark.Description, expected) {
+			t.Errorf("expected %s in description %s", expected, placemark.Description)
+		}
+	}
+	if strings.Contains(placemark.Description, "Sr") {
+		t.Errorf("expected only oxides in description %s", placemark.Description)
+	}
+
+	// both samples share the setting and thereby the style
+	data, err = download.NewKMLFormatter(download.KML_STYLE_SETTING, false).FormatData(samples())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = kml{}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid kml: %v", err)
+	}
+	if len(doc.Document.Styles) != 1 {
+		t.Errorf("expected 1 style, got %d", len(doc.Document.Styles))
+	}
+}
+
+func TestKMZFormatter(t *testing.T) {
+	data, err := download.GetFormatter(download.KMZ).FormatData(samples())
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid kmz: %v", err)
+	}
+	if len(archive.File) != 1 || archive.File[0].Name != "doc.kml" {
+		t.Fatalf("expected doc.kml in kmz, got %d files", len(archive.File))
+	}
+	f, err := archive.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := kml{}
+	if err := xml.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("invalid kml in kmz: %v", err)
+	}
+	if len(doc.Document.Folders) != 1 {
+		t.Errorf("expected 1 folder, got %d", len(doc.Document.Folders))
+	}
+}
+
+func TestFormatSites(t *testing.T) {
+	lat, lon, id, num := -38.6, 176.1, 7, 3
+	sites := []model.GeoJSONSiteSummary{{
+		GeoJSONSite: model.GeoJSONSite{Latitude: &lat, Longitude: &lon, LocationID: &id, NumSamplingFeatureIDs: &num, Loc1: ptr("New Zealand"), Loc2: ptr("Taupo"), Setting: ptr("CONVERGENT MARGIN")},
+		Materials:   map[string]int{"WR": 2, "MIN": 1},
+	}}
+	data, err := download.FormatSites(sites, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := kml{}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid kml: %v", err)
+	}
+	if len(doc.Document.Folders) != 1 || len(doc.Document.Folders[0].Folders) != 1 {
+		t.Fatalf("expected folders New Zealand/Taupo, got %+v", doc.Document.Folders)
+	}
+	placemark := doc.Document.Folders[0].Folders[0].Placemarks[0]
+	if placemark.Name != "3 samples" || placemark.Coordinates != "176.1,-38.6" {
+		t.Errorf("unexpected placemark %s at %s", placemark.Name, placemark.Coordinates)
+	}
+	if !strings.Contains(placemark.Description, "<td>MIN</td><td>1</td></tr><tr><td>WR</td><td>2</td>") {
+		t.Errorf("expected materials in description %s", placemark.Description)
+	}
+}
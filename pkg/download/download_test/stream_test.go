@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package download_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/download"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// stream formats the batches with the stream formatter of the target format
+func stream(t *testing.T, targetFormat string, styleBy string, batches ...[]model.FullData) []byte {
+	formatter, err := download.NewStreamFormatter(targetFormat, styleBy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer formatter.Close()
+	for _, batch := range batches {
+		if err := formatter.Add(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := formatter.Finish(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// batches returns the samples twice in batches of one sample, so the placemarks of the folders are spooled interleaved
+func batches() ([]model.FullData, [][]model.FullData) {
+	all := append(samples(), samples()...)
+	batches := [][]model.FullData{}
+	for i := range all {
+		batches = append(batches, all[i:i+1])
+	}
+	return all, batches
+}
+
+func TestStreamFormatterCSV(t *testing.T) {
+	all, batches := batches()
+	expected, err := download.GetFormatter(download.CSV).FormatData(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := stream(t, download.CSV, "", batches...); !bytes.Equal(data, expected) {
+		t.Errorf("expected\n%s\ngot\n%s", expected, data)
+	}
+	// an empty export holds the header row
+	if data := stream(t, download.CSV, ""); !bytes.HasPrefix(data, []byte(download.KEY_YEAR+",")) || bytes.Contains(data, []byte("\n")) {
+		t.Errorf("expected only the header row, got %s", data)
+	}
+}
+
+func TestStreamFormatterXLSX(t *testing.T) {
+	all, batches := batches()
+	expected, err := download.GetFormatter(download.XLSX).FormatData(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := func(data []byte) [][]string {
+		file, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("invalid xlsx: %v", err)
+		}
+		defer file.Close()
+		rows, err := file.GetRows("Sheet1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+	if got := rows(stream(t, download.XLSX, "", batches...)); !reflect.DeepEqual(got, rows(expected)) || len(got) != len(all)+1 {
+		t.Errorf("expected rows\n%v\ngot\n%v", rows(expected), got)
+	}
+}
+
+func TestStreamFormatterKML(t *testing.T) {
+	all, batches := batches()
+	for _, styleBy := range []string{download.KML_STYLE_ROCKCLASS, download.KML_STYLE_SETTING} {
+		data, err := download.NewKMLFormatter(styleBy, false).FormatData(all)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := kml{}
+		if err := xml.Unmarshal(data, &expected); err != nil {
+			t.Fatalf("invalid kml: %v", err)
+		}
+		doc := kml{}
+		if err := xml.Unmarshal(stream(t, download.KML, styleBy, batches...), &doc); err != nil {
+			t.Fatalf("invalid streamed kml: %v", err)
+		}
+		if !reflect.DeepEqual(doc, expected) {
+			t.Errorf("styled by %s: expected %+v, got %+v", styleBy, expected, doc)
+		}
+	}
+
+	data := stream(t, download.KMZ, "", batches...)
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid kmz: %v", err)
+	}
+	if len(archive.File) != 1 || archive.File[0].Name != "doc.kml" {
+		t.Fatalf("expected doc.kml in kmz, got %d files", len(archive.File))
+	}
+	f, err := archive.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := kml{}
+	if err := xml.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("invalid kml in kmz: %v", err)
+	}
+	if len(doc.Document.Folders) != 1 || len(doc.Document.Folders[0].Folders[0].Placemarks) != 2 {
+		t.Errorf("expected 2 placemarks in Iceland/Reykjanes, got %+v", doc.Document.Folders)
+	}
+}
+
+func TestStreamFormatterInvalidFormat(t *testing.T) {
+	if _, err := download.NewStreamFormatter("pdf", ""); err == nil {
+		t.Error("expected error for format pdf")
+	}
+}
@@ -65,6 +65,9 @@ func GetFormatter(targetFormat string) Formatter {
 	if targetFormat == XLSX {
 		return NewXLSXFormatter()
 	}
+	if targetFormat == KML || targetFormat == KMZ {
+		return NewKMLFormatter(KML_STYLE_ROCKCLASS, targetFormat == KMZ)
+	}
 	return nil
 }
 
@@ -173,108 +176,123 @@ func parseTaxonomicclassifier(types []*model.FullDataTaxonomicClassifier) string
 
 // makeRows formats a slice of FullData models as table rows
 func makeRows(samples []model.FullData) [][]string {
-	rows := make([][]string, 0, len(samples))
-	// column headers
-	headerRow := []string{KEY_YEAR, KEY_DOI, KEY_CITATION, KEY_CITATION_METADATA, KEY_AUTHORS, KEY_SAMPLENAME, KEY_UNIQUE_ID, KEY_LOCATION, KEY_ELEVATION_MIN, KEY_ELEVATION_MAX, KEY_SAMPLING_TECHNIQUE, KEY_DRILLDEPTH_MIN, KEY_DRILLDEPTH_MAX, KEY_LANDORSEA, KEY_ROCKTYPE, KEY_ROCKNAME, KEY_ROCKTEXTURE, KEY_SAMPLECOMMENT, KEY_AGE_MIN, KEY_AGE_MAX, KEY_GEO_AGE, KEY_AGE_PREFIX, KEY_ERUPTION_DATE, KEY_ALTERATION, KEY_ALTERATION_TYPE, KEY_MATERIAL_TYPE, KEY_MINERAL, KEY_CRYSTAL, KEY_RIMORCORE, KEY_INCLUSIONTYPE, KEY_INCLUSION_MINERAL, KEY_RIMORCORE_INC, KEY_HOST_MINERAL, KEY_LAT_MIN, KEY_LONG_MIN, KEY_LAT_MAX, KEY_LONG_MAX}
+	rows := make([][]string, 0, len(samples)+1)
 	itemsMap := map[string]map[string]bool{}
 	rowMaps := make([]map[string]string, 0, len(samples))
 	for _, sample := range samples {
-		rowMap := map[string]string{}
-		// citation metadata
-		if len(sample.References) > 0 {
-			ref := sample.References[0]
-			rowMap[KEY_YEAR] = getInt(ref.Publicationyear)
-			rowMap[KEY_DOI] = getString(ref.Externalidentifier)
-			rowMap[KEY_CITATION] = getString(ref.Title)
-			authors := ""
-			for i, author := range ref.Authors {
-				if i > 0 {
-					authors += ";"
-				}
-				authors += fmt.Sprintf("%s %s", getString(author.PersonLastName), getString(author.PersonFirstName))
+		rowMaps = append(rowMaps, makeRowMap(sample, itemsMap))
+	}
+	headerRow := makeHeaderRow(itemsMap)
+	rows = append(rows, headerRow)
+	for _, rowMap := range rowMaps {
+		rows = append(rows, makeRow(headerRow, rowMap))
+	}
+	return rows
+}
+
+// makeRowMap returns the values of the sample by column key and adds the keys of its chemical items to items by item type
+func makeRowMap(sample model.FullData, items map[string]map[string]bool) map[string]string {
+	rowMap := map[string]string{}
+	// citation metadata
+	if len(sample.References) > 0 {
+		ref := sample.References[0]
+		rowMap[KEY_YEAR] = getInt(ref.Publicationyear)
+		rowMap[KEY_DOI] = getString(ref.Externalidentifier)
+		rowMap[KEY_CITATION] = getString(ref.Title)
+		authors := ""
+		for i, author := range ref.Authors {
+			if i > 0 {
+				authors += ";"
 			}
-			rowMap[KEY_AUTHORS] = authors
-			rowMap[KEY_CITATION_METADATA] = fmt.Sprintf("Journal:%s;Volume:%s;Issue:%s;BookTitle:%s;FirstPage:%s;LastPage:%s", getString(ref.Journal), getString(ref.Volume), getString(ref.Issue), getString(ref.BookTitle), getString(ref.FirstPage), getString(ref.LastPage))
+			authors += fmt.Sprintf("%s %s", getString(author.PersonLastName), getString(author.PersonFirstName))
 		}
-		// sample data
-		rowMap[KEY_SAMPLENAME] = getString(sample.SampleName)
-		rowMap[KEY_UNIQUE_ID] = getString(sample.UniqueID)
-		rowMap[KEY_LOCATION] = join(sample.LocationNames, "/")
-		rowMap[KEY_ELEVATION_MIN] = getString(sample.ElevationMin)
-		rowMap[KEY_ELEVATION_MAX] = getString(sample.ElevationMax)
-		rowMap[KEY_SAMPLING_TECHNIQUE] = getString(sample.SamplingTechnique)
-		rowMap[KEY_DRILLDEPTH_MIN] = getString(sample.DrillDepthMin)
-		rowMap[KEY_DRILLDEPTH_MAX] = getString(sample.DrillDepthMax)
-		rowMap[KEY_LANDORSEA] = getString(sample.LandOrSea)
-		rowMap[KEY_ROCKTYPE] = parseTaxonomicclassifier(sample.RockTypes)
-		rowMap[KEY_ROCKNAME] = parseTaxonomicclassifier(sample.RockClasses)
-		rowMap[KEY_ROCKTEXTURE] = join(sample.RockTextures, ";")
-		rowMap[KEY_SAMPLECOMMENT] = join(sample.Comments, ";")
-		rowMap[KEY_AGE_MIN] = getFloat64(sample.AgeMin)
-		rowMap[KEY_AGE_MAX] = getFloat64(sample.AgeMax)
-		rowMap[KEY_GEO_AGE] = getString(sample.GeologicalAge)
-		rowMap[KEY_AGE_PREFIX] = getString(sample.GeologicalAgePrefix)
-		rowMap[KEY_ERUPTION_DATE] = getString(sample.EruptionDate)
-		rowMap[KEY_ALTERATION] = getString(sample.Alteration)
-		rowMap[KEY_ALTERATION_TYPE] = getString(sample.AlterationType)
+		rowMap[KEY_AUTHORS] = authors
+		rowMap[KEY_CITATION_METADATA] = fmt.Sprintf("Journal:%s;Volume:%s;Issue:%s;BookTitle:%s;FirstPage:%s;LastPage:%s", getString(ref.Journal), getString(ref.Volume), getString(ref.Issue), getString(ref.BookTitle), getString(ref.FirstPage), getString(ref.LastPage))
+	}
+	// sample data
+	rowMap[KEY_SAMPLENAME] = getString(sample.SampleName)
+	rowMap[KEY_UNIQUE_ID] = getString(sample.UniqueID)
+	rowMap[KEY_LOCATION] = join(sample.LocationNames, "/")
+	rowMap[KEY_ELEVATION_MIN] = getString(sample.ElevationMin)
+	rowMap[KEY_ELEVATION_MAX] = getString(sample.ElevationMax)
+	rowMap[KEY_SAMPLING_TECHNIQUE] = getString(sample.SamplingTechnique)
+	rowMap[KEY_DRILLDEPTH_MIN] = getString(sample.DrillDepthMin)
+	rowMap[KEY_DRILLDEPTH_MAX] = getString(sample.DrillDepthMax)
+	rowMap[KEY_LANDORSEA] = getString(sample.LandOrSea)
+	rowMap[KEY_ROCKTYPE] = parseTaxonomicclassifier(sample.RockTypes)
+	rowMap[KEY_ROCKNAME] = parseTaxonomicclassifier(sample.RockClasses)
+	rowMap[KEY_ROCKTEXTURE] = join(sample.RockTextures, ";")
+	rowMap[KEY_SAMPLECOMMENT] = join(sample.Comments, ";")
+	rowMap[KEY_AGE_MIN] = getFloat64(sample.AgeMin)
+	rowMap[KEY_AGE_MAX] = getFloat64(sample.AgeMax)
+	rowMap[KEY_GEO_AGE] = getString(sample.GeologicalAge)
+	rowMap[KEY_AGE_PREFIX] = getString(sample.GeologicalAgePrefix)
+	rowMap[KEY_ERUPTION_DATE] = getString(sample.EruptionDate)
+	rowMap[KEY_ALTERATION] = getString(sample.Alteration)
+	rowMap[KEY_ALTERATION_TYPE] = getString(sample.AlterationType)
 
-		// batch data
-		for _, batch := range sample.BatchData {
-			rowMap[KEY_MATERIAL_TYPE] = getString(batch.Material)
-			rowMap[KEY_MINERAL] = parseTaxonomicclassifier(batch.Minerals)
-			rowMap[KEY_CRYSTAL] = getString(batch.Crystal)
-			rowMap[KEY_RIMORCORE] = getString(batch.RimOrCoreMineral)
-			rowMap[KEY_INCLUSIONTYPE] = join(batch.InclusionTypes, ";")
-			rowMap[KEY_INCLUSION_MINERAL] = parseTaxonomicclassifier(batch.InclusionMinerals)
-			rowMap[KEY_RIMORCORE_INC] = getString(batch.RimOrCoreInclusion)
-			rowMap[KEY_HOST_MINERAL] = parseTaxonomicclassifier(batch.HostMinerals)
-			rowMap[KEY_LAT_MIN] = getString(sample.LatitudeMin)
-			rowMap[KEY_LONG_MIN] = getString(sample.LongitudeMin)
-			rowMap[KEY_LAT_MAX] = getString(sample.LatitudeMax)
-			rowMap[KEY_LONG_MAX] = getString(sample.LongitudeMax)
-			// add result data
-			for _, result := range batch.Results {
-				itemName := getString(result.ItemName)
-				itemType := getString(result.ItemGroup)
-				value := getFloat64(result.Value)
-				unit := getString(result.Unit)
-				method := getString(result.Method)
-				if itemName == "" || value == "" {
-					continue
-				}
-				key := itemName
-				if unit != "" {
-					key += fmt.Sprintf("(%s)", unit)
-				}
-				if method != "" {
-					key += fmt.Sprintf("[%s]", method)
-				}
-				if typeMap := itemsMap[itemType]; typeMap == nil {
-					itemsMap[itemType] = map[string]bool{}
-				}
-				itemsMap[itemType][key] = true
-				rowMap[key] = value
+	// batch data
+	for _, batch := range sample.BatchData {
+		rowMap[KEY_MATERIAL_TYPE] = getString(batch.Material)
+		rowMap[KEY_MINERAL] = parseTaxonomicclassifier(batch.Minerals)
+		rowMap[KEY_CRYSTAL] = getString(batch.Crystal)
+		rowMap[KEY_RIMORCORE] = getString(batch.RimOrCoreMineral)
+		rowMap[KEY_INCLUSIONTYPE] = join(batch.InclusionTypes, ";")
+		rowMap[KEY_INCLUSION_MINERAL] = parseTaxonomicclassifier(batch.InclusionMinerals)
+		rowMap[KEY_RIMORCORE_INC] = getString(batch.RimOrCoreInclusion)
+		rowMap[KEY_HOST_MINERAL] = parseTaxonomicclassifier(batch.HostMinerals)
+		rowMap[KEY_LAT_MIN] = getString(sample.LatitudeMin)
+		rowMap[KEY_LONG_MIN] = getString(sample.LongitudeMin)
+		rowMap[KEY_LAT_MAX] = getString(sample.LatitudeMax)
+		rowMap[KEY_LONG_MAX] = getString(sample.LongitudeMax)
+		// add result data
+		for _, result := range batch.Results {
+			itemName := getString(result.ItemName)
+			itemType := getString(result.ItemGroup)
+			value := getFloat64(result.Value)
+			unit := getString(result.Unit)
+			method := getString(result.Method)
+			if itemName == "" || value == "" {
+				continue
+			}
+			key := itemName
+			if unit != "" {
+				key += fmt.Sprintf("(%s)", unit)
 			}
+			if method != "" {
+				key += fmt.Sprintf("[%s]", method)
+			}
+			if typeMap := items[itemType]; typeMap == nil {
+				items[itemType] = map[string]bool{}
+			}
+			items[itemType][key] = true
+			rowMap[key] = value
 		}
-		rowMaps = append(rowMaps, rowMap)
 	}
+	return rowMap
+}
+
+// makeHeaderRow returns the column headers followed by the sorted chemical items
+func makeHeaderRow(items map[string]map[string]bool) []string {
+	headerRow := []string{KEY_YEAR, KEY_DOI, KEY_CITATION, KEY_CITATION_METADATA, KEY_AUTHORS, KEY_SAMPLENAME, KEY_UNIQUE_ID, KEY_LOCATION, KEY_ELEVATION_MIN, KEY_ELEVATION_MAX, KEY_SAMPLING_TECHNIQUE, KEY_DRILLDEPTH_MIN, KEY_DRILLDEPTH_MAX, KEY_LANDORSEA, KEY_ROCKTYPE, KEY_ROCKNAME, KEY_ROCKTEXTURE, KEY_SAMPLECOMMENT, KEY_AGE_MIN, KEY_AGE_MAX, KEY_GEO_AGE, KEY_AGE_PREFIX, KEY_ERUPTION_DATE, KEY_ALTERATION, KEY_ALTERATION_TYPE, KEY_MATERIAL_TYPE, KEY_MINERAL, KEY_CRYSTAL, KEY_RIMORCORE, KEY_INCLUSIONTYPE, KEY_INCLUSION_MINERAL, KEY_RIMORCORE_INC, KEY_HOST_MINERAL, KEY_LAT_MIN, KEY_LONG_MIN, KEY_LAT_MAX, KEY_LONG_MAX}
 	// append sorted items to headerRow
 	for _, itemType := range []string{"mj", "ree", "te", "rg", "ir", "is", "us", "em", "age"} {
-		items := getKeySlice(itemsMap[itemType])
-		sort.SliceStable(items, func(i, j int) bool { return items[i] < items[j] })
-		headerRow = append(headerRow, items...)
+		keys := getKeySlice(items[itemType])
+		sort.SliceStable(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		headerRow = append(headerRow, keys...)
 	}
-	rows = append(rows, headerRow)
-	for _, rowMap := range rowMaps {
-		// every row must have the same order (as defined by the header row), especially for the chemical items - so we lookup each column name in the map
-		row := make([]string, 0, len(headerRow))
-		for _, key := range headerRow {
-			metaData := rowMap[key]
-			row = append(row, fmt.Sprintf("\"%s\"", metaData))
-		}
-		rows = append(rows, row)
+	return headerRow
+}
+
+// makeRow returns the values of the row map in the order of the header row
+func makeRow(headerRow []string, rowMap map[string]string) []string {
+	// every row must have the same order (as defined by the header row), especially for the chemical items - so we lookup each column name in the map
+	row := make([]string, 0, len(headerRow))
+	for _, key := range headerRow {
+		metaData := rowMap[key]
+		row = append(row, fmt.Sprintf("\"%s\"", metaData))
 	}
-	return rows
+	return row
 }
 
 func getKeySlice(m map[string]bool) []string {
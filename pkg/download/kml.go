@@ -0,0 +1,368 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+const (
+	KML = "kml"
+	KMZ = "kmz"
+
+	// attributes the placemarks of the samples can be styled by
+	KML_STYLE_ROCKCLASS = "rockclass"
+	KML_STYLE_SETTING   = "setting"
+
+	KML_NAMESPACE = "http://www.opengis.net/kml/2.2"
+	// KML_UNKNOWN is the name of the folders and styles of samples without location or style attribute
+	KML_UNKNOWN = "Unknown"
+	// kmzDocument is the name of the KML document inside a KMZ archive
+	kmzDocument = "doc.kml"
+	kmlIcon     = "http://maps.google.com/mapfiles/kml/shapes/placemark_circle.png"
+)
+
+// KML_OXIDES holds the major element oxides shown in the description of the sample placemarks
+var KML_OXIDES = []string{"SiO2", "TiO2", "Al2O3", "FeOT", "MgO", "CaO", "Na2O", "K2O"}
+
+// kmlColors holds the palette of the styles as aabbggrr
+var kmlColors = []string{
+	"ff1f77b4", "ff0e7fff", "ff2ca02c", "ff2827d6", "ffbd6794", "ff4b568c",
+	"ffc277e3", "ff7f7f7f", "ff22bdbc", "ffcfbe17", "ff3dbfff", "ff8e33a7",
+}
+
+// KML Formatter for Google Earth files
+type KMLFormatter struct {
+	styleBy string
+	zipped  bool
+}
+
+// NewKMLFormatter returns a formatter styling the placemarks by one of the KML_STYLE_ attributes
+// If zipped is set, the KML document is packed as KMZ
+func NewKMLFormatter(styleBy string, zipped bool) Formatter {
+	if styleBy != KML_STYLE_SETTING {
+		styleBy = KML_STYLE_ROCKCLASS
+	}
+	return &KMLFormatter{styleBy: styleBy, zipped: zipped}
+}
+
+// FormatData returns a placemark per sample with coordinates in folders of the first and second location level
+func (f *KMLFormatter) FormatData(samples []model.FullData) ([]byte, error) {
+	doc := newKMLDocument("GEOROC samples")
+	for _, sample := range samples {
+		if location, style, placemark, ok := f.placemark(sample); ok {
+			doc.add(location, style, placemark)
+		}
+	}
+	return doc.encode(f.zipped)
+}
+
+// placemark returns the placemark of the sample with its location path and style attribute value; ok is false if the sample has no coordinates
+func (f *KMLFormatter) placemark(sample model.FullData) (location []string, style string, placemark kmlPlacemark, ok bool) {
+	if sample.Latitude == nil || sample.Longitude == nil {
+		return nil, "", kmlPlacemark{}, false
+	}
+	if f.styleBy == KML_STYLE_SETTING {
+		style = getString(sample.TectonicSetting)
+	} else if len(sample.RockClasses) > 0 && sample.RockClasses[0] != nil {
+		style = getString(sample.RockClasses[0].Label)
+	}
+	// missing levels are added as unknown to keep all placemarks at the same depth
+	location = make([]string, 2)
+	for i, name := range sample.LocationNames {
+		if i < len(location) {
+			location[i] = getString(name)
+		}
+	}
+	return location, style, kmlPlacemark{
+		ID:          "sample" + strconv.Itoa(sample.SampleID),
+		Name:        getString(sample.SampleName),
+		Description: kmlCDATA{Text: sampleDescription(sample)},
+		Point:       kmlPoint{Coordinates: kmlCoordinates(float64(*sample.Longitude), float64(*sample.Latitude), 32)},
+	}, true
+}
+
+// FormatSites returns a placemark per site styled by the tectonic setting in folders of the first and second location level
+// If zipped is set, the KML document is packed as KMZ
+func FormatSites(sites []model.GeoJSONSiteSummary, zipped bool) ([]byte, error) {
+	doc := newKMLDocument("GEOROC sites")
+	for _, site := range sites {
+		if site.Latitude == nil || site.Longitude == nil {
+			continue
+		}
+		id := ""
+		if site.LocationID != nil {
+			id = "site" + strconv.Itoa(*site.LocationID)
+		}
+		location := []string{getString(site.Loc1), getString(site.Loc2)}
+		doc.add(location, getString(site.Setting), kmlPlacemark{
+			ID:          id,
+			Name:        fmt.Sprintf("%s samples", getInt(site.NumSamplingFeatureIDs)),
+			Description: kmlCDATA{Text: siteDescription(site)},
+			Point:       kmlPoint{Coordinates: kmlCoordinates(*site.Longitude, *site.Latitude, 64)},
+		})
+	}
+	return doc.encode(zipped)
+}
+
+// ContentType returns the MIME type of the target format
+func ContentType(targetFormat string) string {
+	switch targetFormat {
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case KML:
+		return "application/vnd.google-earth.kml+xml"
+	case KMZ:
+		return "application/vnd.google-earth.kmz"
+	}
+	return "text/csv"
+}
+
+// sampleDescription returns the HTML of the description balloon of a sample
+func sampleDescription(sample model.FullData) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b>%s</b>", html.EscapeString(getString(sample.SampleName)))
+	if len(sample.References) > 0 {
+		ref := sample.References[0]
+		authors := make([]string, 0, len(ref.Authors))
+		for _, author := range ref.Authors {
+			authors = append(authors, getString(author.PersonLastName))
+		}
+		fmt.Fprintf(&b, "<p>%s (%s): %s", html.EscapeString(strings.Join(authors, ", ")), getInt(ref.Publicationyear), html.EscapeString(getString(ref.Title)))
+		if doi := getString(ref.Externalidentifier); doi != "" {
+			fmt.Fprintf(&b, `<br/><a href="https://doi.org/%s">%s</a>`, html.EscapeString(doi), html.EscapeString(doi))
+		}
+		b.WriteString("</p>")
+	}
+	oxides := map[string]string{}
+	for _, batch := range sample.BatchData {
+		if batch == nil {
+			continue
+		}
+		for _, result := range batch.Results {
+			if result == nil || result.Value == nil {
+				continue
+			}
+			name := getString(result.ItemName)
+			if _, ok := oxides[name]; !ok {
+				oxides[name] = strings.TrimSpace(getFloat64(result.Value) + " " + getString(result.Unit))
+			}
+		}
+	}
+	rows := ""
+	for _, oxide := range KML_OXIDES {
+		if value, ok := oxides[oxide]; ok {
+			rows += fmt.Sprintf("<tr><td>%s</td><td>%s</td></tr>", oxide, html.EscapeString(value))
+		}
+	}
+	if rows != "" {
+		fmt.Fprintf(&b, "<table>%s</table>", rows)
+	}
+	return b.String()
+}
+
+// siteDescription returns the HTML of the description balloon of a site
+func siteDescription(site model.GeoJSONSiteSummary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b>%s samples</b>", getInt(site.NumSamplingFeatureIDs))
+	fmt.Fprintf(&b, "<p>%s<br/>%s</p>", html.EscapeString(getString(site.Setting)), html.EscapeString(getString(site.LandOrSea)))
+	materials := make([]string, 0, len(site.Materials))
+	for material := range site.Materials {
+		materials = append(materials, material)
+	}
+	sort.Strings(materials)
+	b.WriteString("<table>")
+	for _, material := range materials {
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%d</td></tr>", html.EscapeString(material), site.Materials[material])
+	}
+	b.WriteString("</table>")
+	return b.String()
+}
+
+// kmlCoordinates formats the point as longitude,latitude with the precision of the bitSize of the source values
+func kmlCoordinates(lon float64, lat float64, bitSize int) string {
+	return strconv.FormatFloat(lon, 'f', -1, bitSize) + "," + strconv.FormatFloat(lat, 'f', -1, bitSize)
+}
+
+// kmlHash returns the hash of the attribute value identifying its style
+func kmlHash(value string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return h.Sum32()
+}
+
+// kmlDocument collects the placemarks in the folders of their location and the styles they use
+type kmlDocument struct {
+	root   kmlFolder
+	styles map[string]kmlStyle
+}
+
+func newKMLDocument(name string) *kmlDocument {
+	return &kmlDocument{root: kmlFolder{Name: name}, styles: map[string]kmlStyle{}}
+}
+
+// add adds the placemark styled by the attribute value to the folders of the location path
+func (d *kmlDocument) add(location []string, style string, placemark kmlPlacemark) {
+	folder, placemark := d.place(location, style, placemark)
+	folder.Placemarks = append(folder.Placemarks, placemark)
+}
+
+// place returns the folder of the location path and the placemark styled by the attribute value
+// The style and the folders are added to the document if they do not exist
+func (d *kmlDocument) place(location []string, style string, placemark kmlPlacemark) (*kmlFolder, kmlPlacemark) {
+	if style == "" {
+		style = KML_UNKNOWN
+	}
+	// the color is selected by the hash to keep the colors stable between exports
+	hash := kmlHash(style)
+	styleID := fmt.Sprintf("style%08x", hash)
+	if _, ok := d.styles[styleID]; !ok {
+		d.styles[styleID] = kmlStyle{
+			ID:        styleID,
+			IconStyle: kmlIconStyle{Color: kmlColors[hash%uint32(len(kmlColors))], Icon: kmlIconHref{Href: kmlIcon}},
+		}
+	}
+	placemark.StyleURL = "#" + styleID
+	if placemark.Name == "" {
+		placemark.Name = style
+	}
+	folder := &d.root
+	for _, name := range location {
+		if name == "" {
+			name = KML_UNKNOWN
+		}
+		folder = folder.folder(name)
+	}
+	return folder, placemark
+}
+
+// sortedStyles returns the styles of the document ordered by ID
+func (d *kmlDocument) sortedStyles() []kmlStyle {
+	styles := make([]kmlStyle, 0, len(d.styles))
+	for _, style := range d.styles {
+		styles = append(styles, style)
+	}
+	sort.Slice(styles, func(i, j int) bool { return styles[i].ID < styles[j].ID })
+	return styles
+}
+
+// encode returns the KML document or the KMZ archive holding it
+func (d *kmlDocument) encode(zipped bool) ([]byte, error) {
+	d.root.sort()
+	root := kmlRoot{
+		Namespace: KML_NAMESPACE,
+		Document: kmlDocumentElement{
+			Name:       d.root.Name,
+			Styles:     d.sortedStyles(),
+			Folders:    d.root.Folders,
+			Placemarks: d.root.Placemarks,
+		},
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(root); err != nil {
+		return nil, fmt.Errorf("Can not encode kml: %s", err.Error())
+	}
+	if !zipped {
+		return buf.Bytes(), nil
+	}
+	var archive bytes.Buffer
+	w := zip.NewWriter(&archive)
+	file, err := w.Create(kmzDocument)
+	if err != nil {
+		return nil, fmt.Errorf("Can not create kmz: %s", err.Error())
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("Can not write kmz: %s", err.Error())
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("Can not write kmz: %s", err.Error())
+	}
+	return archive.Bytes(), nil
+}
+
+// KML elements, see https://developers.google.com/kml/documentation/kmlreference
+
+type kmlRoot struct {
+	XMLName   xml.Name           `xml:"kml"`
+	Namespace string             `xml:"xmlns,attr"`
+	Document  kmlDocumentElement `xml:"Document"`
+}
+
+type kmlDocumentElement struct {
+	Name       string         `xml:"name"`
+	Styles     []kmlStyle     `xml:"Style"`
+	Folders    []*kmlFolder   `xml:"Folder"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlStyle struct {
+	ID        string       `xml:"id,attr"`
+	IconStyle kmlIconStyle `xml:"IconStyle"`
+}
+
+type kmlIconStyle struct {
+	Color string      `xml:"color"`
+	Icon  kmlIconHref `xml:"Icon"`
+}
+
+type kmlIconHref struct {
+	Href string `xml:"href"`
+}
+
+type kmlFolder struct {
+	Name       string         `xml:"name"`
+	Folders    []*kmlFolder   `xml:"Folder"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+// folder returns the sub folder of the name and adds it if it does not exist
+func (f *kmlFolder) folder(name string) *kmlFolder {
+	for _, sub := range f.Folders {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	sub := &kmlFolder{Name: name}
+	f.Folders = append(f.Folders, sub)
+	return sub
+}
+
+// sort orders the sub folders by name recursively
+func (f *kmlFolder) sort() {
+	sort.Slice(f.Folders, func(i, j int) bool { return f.Folders[i].Name < f.Folders[j].Name })
+	for _, sub := range f.Folders {
+		sub.sort()
+	}
+}
+
+type kmlPlacemark struct {
+	ID          string   `xml:"id,attr,omitempty"`
+	Name        string   `xml:"name"`
+	Description kmlCDATA `xml:"description"`
+	StyleURL    string   `xml:"styleUrl"`
+	Point       kmlPoint `xml:"Point"`
+}
+
+// kmlCDATA holds HTML which is rendered in the description balloon
+type kmlCDATA struct {
+	Text string `xml:",cdata"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
@@ -0,0 +1,346 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package download
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// StreamFormatter formats an export batch by batch without holding all samples in memory
+// The column headers of the tables and the folders of the KML documents depend on all samples,
+// so each batch is spooled into a temporary file and the export is written once all batches are added
+type StreamFormatter interface {
+	// Add spools the samples of a batch
+	Add(samples []model.FullData) error
+	// Finish writes the export of all added samples to w
+	Finish(w io.Writer) error
+	// Close removes the spooled samples
+	Close() error
+}
+
+// NewStreamFormatter returns the stream formatter of the target format
+// The placemarks of kml and kmz are styled by one of the KML_STYLE_ attributes
+func NewStreamFormatter(targetFormat string, styleBy string) (StreamFormatter, error) {
+	if targetFormat != CSV && targetFormat != XLSX && targetFormat != KML && targetFormat != KMZ {
+		return nil, fmt.Errorf("Invalid format '%s': must be one of 'csv', 'xlsx', 'kml' or 'kmz'", targetFormat)
+	}
+	s, err := newSpool()
+	if err != nil {
+		return nil, err
+	}
+	if targetFormat == KML || targetFormat == KMZ {
+		formatter := NewKMLFormatter(styleBy, targetFormat == KMZ).(*KMLFormatter)
+		return &kmlStream{formatter: formatter, spool: s, doc: newKMLDocument("GEOROC samples"), placemarks: map[*kmlFolder][]span{}}, nil
+	}
+	return &tableStream{format: targetFormat, spool: s, items: map[string]map[string]bool{}}, nil
+}
+
+// span is the position of a spooled record
+type span struct {
+	offset int64
+	length int64
+}
+
+// spool is a temporary file the formatted samples are appended to
+type spool struct {
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+}
+
+func newSpool() (*spool, error) {
+	file, err := os.CreateTemp("", "georoc-spool-*")
+	if err != nil {
+		return nil, fmt.Errorf("Can not create spool file: %s", err.Error())
+	}
+	return &spool{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// append appends the record and returns its position
+func (s *spool) append(data []byte) (span, error) {
+	n, err := s.writer.Write(data)
+	position := span{offset: s.size, length: int64(n)}
+	s.size += int64(n)
+	if err != nil {
+		return position, fmt.Errorf("Can not write spool file: %s", err.Error())
+	}
+	return position, nil
+}
+
+// reader returns a reader of all records
+func (s *spool) reader() (io.Reader, error) {
+	err := s.writer.Flush()
+	if err != nil {
+		return nil, fmt.Errorf("Can not write spool file: %s", err.Error())
+	}
+	return io.NewSectionReader(s.file, 0, s.size), nil
+}
+
+// copy copies the record at the position to w; the spool must be flushed by reader before
+func (s *spool) copy(w io.Writer, position span) error {
+	_, err := io.Copy(w, io.NewSectionReader(s.file, position.offset, position.length))
+	return err
+}
+
+// close closes and removes the spool file
+func (s *spool) close() error {
+	return errors.Join(s.file.Close(), os.Remove(s.file.Name()))
+}
+
+// tableStream spools the row of each sample as JSON line and collects the chemical items of the header row
+type tableStream struct {
+	format string
+	spool  *spool
+	items  map[string]map[string]bool
+}
+
+func (s *tableStream) Add(samples []model.FullData) error {
+	for _, sample := range samples {
+		data, err := json.Marshal(makeRowMap(sample, s.items))
+		if err != nil {
+			return fmt.Errorf("Can not encode row: %s", err.Error())
+		}
+		_, err = s.spool.append(append(data, '\n'))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Finish writes the header row followed by the spooled rows in the order of the header row
+func (s *tableStream) Finish(w io.Writer) error {
+	r, err := s.spool.reader()
+	if err != nil {
+		return err
+	}
+	headerRow := makeHeaderRow(s.items)
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	next := func() ([]string, error) {
+		rowMap := map[string]string{}
+		err := decoder.Decode(&rowMap)
+		if err != nil {
+			return nil, err
+		}
+		return makeRow(headerRow, rowMap), nil
+	}
+	if s.format == XLSX {
+		return writeXLSX(w, headerRow, next)
+	}
+	return writeCSV(w, headerRow, next)
+}
+
+func (s *tableStream) Close() error {
+	return s.spool.close()
+}
+
+// writeCSV writes the header row and the rows returned by next until io.EOF in the format of the CSVFormatter
+func writeCSV(w io.Writer, headerRow []string, next func() ([]string, error)) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(strings.Join(headerRow, ","))
+	for {
+		row, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Can not read row: %s", err.Error())
+		}
+		bw.WriteString("\n" + strings.Join(row, ","))
+	}
+	err := bw.Flush()
+	if err != nil {
+		return fmt.Errorf("Can not write csv: %s", err.Error())
+	}
+	return nil
+}
+
+// writeXLSX writes the header row and the rows returned by next until io.EOF with the stream writer of excelize
+func writeXLSX(w io.Writer, headerRow []string, next func() ([]string, error)) error {
+	file := excelize.NewFile()
+	defer file.Close()
+	sw, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		return fmt.Errorf("Can not create xlsx stream: %s", err.Error())
+	}
+	row := headerRow
+	for i := 1; ; i++ {
+		cell, err := excelize.CoordinatesToCellName(1, i) // cells are 1-based
+		if err != nil {
+			return fmt.Errorf("Can not convert coordinates (%d, 1) to cellName: %s", i, err.Error())
+		}
+		values := make([]interface{}, 0, len(row))
+		for _, val := range row {
+			values = append(values, val)
+		}
+		err = sw.SetRow(cell, values)
+		if err != nil {
+			return fmt.Errorf("Can not set row %s: %s", cell, err.Error())
+		}
+		row, err = next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Can not read row: %s", err.Error())
+		}
+	}
+	err = sw.Flush()
+	if err != nil {
+		return fmt.Errorf("Can not write xlsx stream: %s", err.Error())
+	}
+	err = file.Write(w)
+	if err != nil {
+		return fmt.Errorf("Can not write xlsx data: %s", err.Error())
+	}
+	return nil
+}
+
+// kmlStream spools the placemark of each sample and keeps the folders and styles of the document with the positions of their placemarks
+type kmlStream struct {
+	formatter  *KMLFormatter
+	spool      *spool
+	doc        *kmlDocument
+	placemarks map[*kmlFolder][]span
+}
+
+func (s *kmlStream) Add(samples []model.FullData) error {
+	var buf bytes.Buffer
+	encoder := xml.NewEncoder(&buf)
+	for _, sample := range samples {
+		location, style, placemark, ok := s.formatter.placemark(sample)
+		if !ok {
+			continue
+		}
+		folder, placemark := s.doc.place(location, style, placemark)
+		buf.Reset()
+		err := encoder.EncodeElement(placemark, xml.StartElement{Name: xml.Name{Local: "Placemark"}})
+		if err != nil {
+			return fmt.Errorf("Can not encode kml: %s", err.Error())
+		}
+		position, err := s.spool.append(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		s.placemarks[folder] = append(s.placemarks[folder], position)
+	}
+	return nil
+}
+
+// Finish writes the KML document or the KMZ archive holding it with the styles followed by the folders sorted by name
+func (s *kmlStream) Finish(w io.Writer) error {
+	_, err := s.spool.reader()
+	if err != nil {
+		return err
+	}
+	if !s.formatter.zipped {
+		return s.writeDocument(w)
+	}
+	archive := zip.NewWriter(w)
+	file, err := archive.Create(kmzDocument)
+	if err != nil {
+		return fmt.Errorf("Can not create kmz: %s", err.Error())
+	}
+	err = s.writeDocument(file)
+	if err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("Can not write kmz: %s", err.Error())
+	}
+	return nil
+}
+
+func (s *kmlStream) Close() error {
+	return s.spool.close()
+}
+
+// writeDocument writes the KML document copying the spooled placemarks into their folders
+func (s *kmlStream) writeDocument(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	encoder := xml.NewEncoder(bw)
+	kml := xml.StartElement{Name: xml.Name{Local: "kml"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: KML_NAMESPACE}}}
+	document := xml.StartElement{Name: xml.Name{Local: "Document"}}
+	err := encoder.EncodeToken(kml)
+	if err == nil {
+		err = encoder.EncodeToken(document)
+	}
+	if err == nil {
+		err = encoder.EncodeElement(s.doc.root.Name, xml.StartElement{Name: xml.Name{Local: "name"}})
+	}
+	for _, style := range s.doc.sortedStyles() {
+		if err == nil {
+			err = encoder.EncodeElement(style, xml.StartElement{Name: xml.Name{Local: "Style"}})
+		}
+	}
+	if err == nil {
+		s.doc.root.sort()
+		err = s.writeFolder(bw, encoder, &s.doc.root)
+	}
+	if err == nil {
+		err = encoder.EncodeToken(document.End())
+	}
+	if err == nil {
+		err = encoder.EncodeToken(kml.End())
+	}
+	if err == nil {
+		err = encoder.Flush()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("Can not encode kml: %s", err.Error())
+	}
+	return nil
+}
+
+// writeFolder writes the sub folders of the folder followed by its placemarks
+func (s *kmlStream) writeFolder(bw *bufio.Writer, encoder *xml.Encoder, folder *kmlFolder) error {
+	for _, sub := range folder.Folders {
+		start := xml.StartElement{Name: xml.Name{Local: "Folder"}}
+		err := encoder.EncodeToken(start)
+		if err != nil {
+			return err
+		}
+		err = encoder.EncodeElement(sub.Name, xml.StartElement{Name: xml.Name{Local: "name"}})
+		if err != nil {
+			return err
+		}
+		err = s.writeFolder(bw, encoder, sub)
+		if err != nil {
+			return err
+		}
+		err = encoder.EncodeToken(start.End())
+		if err != nil {
+			return err
+		}
+	}
+	// the spooled placemarks are copied behind the tokens of the encoder
+	err := encoder.Flush()
+	if err != nil {
+		return err
+	}
+	for _, position := range s.placemarks[folder] {
+		err := s.spool.copy(bw, position)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package filter
+
+import "gitlab.gwdg.de/fe/digis/database-api/pkg/sql"
+
+// Group of a field in the sql filter query; filters of the same group are evaluated in the same sub query
+type Group int
+
+const (
+	// GroupNone marks fields that are only available in the search index
+	GroupNone Group = iota
+	GroupAnnotations
+	GroupTaxonomicClassifiers
+	GroupLocations
+	// GroupResults holds the chemistry filters
+	GroupResults
+	GroupCitations
+	GroupAges
+	GroupOrganizations
+)
+
+// Field describes a filterable field and how it is mapped onto the sql database and the search index
+type Field struct {
+	// Name is the name of the query parameter
+	Name string
+	// Group is the sql sub query the field is evaluated in
+	Group Group
+	// Column is the sql column of the field
+	Column string
+	// Join is an additional sql block that has to be added to the sub query if the field is filtered
+	Join string
+	// Array marks sql columns holding arrays which only support the operators "eq" and "in"
+	Array bool
+	// IndexField is the key of the field in the search index documents
+	IndexField string
+	// NestedPath is the path of the nested objects holding the field in the search index documents; empty for top level fields
+	NestedPath string
+	// Position is the 1-based position of the value in the array IndexField, e.g. the level of the location names; 0 for all values
+	Position int
+}
+
+// registry holds all filterable fields
+// The order of the fields determines the order of the sql filters within their group
+var registry = []Field{
+	// annotations
+	{Name: "material", Group: GroupAnnotations, Column: "ann_mat.annotationtext", Join: sql.GetSamplingfeatureIdsByFilterAnnotationsMaterial, IndexField: "material", NestedPath: "batchData"},
+	{Name: "inclusiontype", Group: GroupAnnotations, Column: "ann_inc_type.annotationtext", Join: sql.GetSamplingfeatureIdsByFilterAnnotationsIncType, IndexField: "inclusionTypes", NestedPath: "batchData"},
+	{Name: "sampletech", Group: GroupAnnotations, Column: "ann_stech.annotationtext", Join: sql.GetSamplingfeatureIdsByFilterAnnotationsSampTech, IndexField: "samplingTechnique"},
+	{Name: "rimorcore", Group: GroupAnnotations, Column: "ann_roc.annotationtext", Join: sql.GetSamplingfeatureIdsByFilterAnnotationsRimOrCore, IndexField: "rimOrCoreMineral", NestedPath: "batchData"},
+	// taxonomic classifiers
+	{Name: "rocktype", Group: GroupTaxonomicClassifiers, Column: "st.rocktypes", Array: true, IndexField: "value", NestedPath: "rockTypes"},
+	{Name: "rockclass", Group: GroupTaxonomicClassifiers, Column: "st.rockclassids::varchar[]", Array: true, IndexField: "id", NestedPath: "rockClasses"},
+	{Name: "mineral", Group: GroupTaxonomicClassifiers, Column: "st.minerals", Array: true, IndexField: "value", NestedPath: "batchData.minerals"},
+	{Name: "hostmaterial", Group: GroupTaxonomicClassifiers, Column: "st.hostMinerals", Array: true, IndexField: "value", NestedPath: "batchData.hostMinerals"},
+	{Name: "inclusionmaterial", Group: GroupTaxonomicClassifiers, Column: "st.incMinerals", Array: true, IndexField: "value", NestedPath: "batchData.inclusionMinerals"},
+	// locations; the search index holds the names of all location levels in one field ordered by level
+	{Name: "setting", Group: GroupLocations, Column: "gs.settingname", IndexField: "tectonicSetting"},
+	{Name: "location1", Group: GroupLocations, Column: "toplevelloc.locationname", IndexField: "locationNames", Position: 1},
+	{Name: "location2", Group: GroupLocations, Column: "secondlevelloc.locationname", IndexField: "locationNames", Position: 2},
+	{Name: "location3", Group: GroupLocations, Column: "thirdlevelloc.locationname", IndexField: "locationNames", Position: 3},
+	{Name: "latitude", Group: GroupLocations, Column: "s.latitude", IndexField: "latitude"},
+	{Name: "longitude", Group: GroupLocations, Column: "s.longitude", IndexField: "longitude"},
+	// citations
+	{Name: "title", Group: GroupCitations, Column: "scd.title", IndexField: "title", NestedPath: "references"},
+	{Name: "publicationyear", Group: GroupCitations, Column: "scd.publicationyear", IndexField: "publicationYear", NestedPath: "references"},
+	{Name: "doi", Group: GroupCitations, Column: "scd.externalidentifier", IndexField: "externalIdentifier", NestedPath: "references"},
+	{Name: "firstname", Group: GroupCitations, Column: "scd.personfirstnames", Array: true, IndexField: "firstName", NestedPath: "references.authors"},
+	{Name: "lastname", Group: GroupCitations, Column: "scd.personlastnames", Array: true, IndexField: "lastName", NestedPath: "references.authors"},
+	// ages
+	{Name: "agemin", Group: GroupAges, Column: "sa.specimenagemin", IndexField: "ageMin"},
+	{Name: "agemax", Group: GroupAges, Column: "sa.specimenagemax", IndexField: "ageMax"},
+	{Name: "geoage", Group: GroupAges, Column: "sa.specimengeolage", IndexField: "geologicalAge"},
+	{Name: "geoageprefix", Group: GroupAges, Column: "sa.specimengeolageprefix", IndexField: "geologicalAgePrefix"},
+	// organizations
+	{Name: "lab", Group: GroupOrganizations, Column: "o.organizationname", IndexField: "institutions"},
+	// search index only
+	{Name: "sampleID", IndexField: "sampleID"},
+	{Name: "sampleName", IndexField: "sampleName"},
+	{Name: "uniqueID", IndexField: "uniqueID"},
+	{Name: "landOrSea", IndexField: "landOrSea"},
+	{Name: "eruptionDate", IndexField: "eruptionDate"},
+	{Name: "alteration", IndexField: "alteration"},
+	{Name: "alterationType", IndexField: "alterationType"},
+	{Name: "batchName", IndexField: "batchName", NestedPath: "batchData"},
+	{Name: "batchID", IndexField: "batchID", NestedPath: "batchData"},
+	{Name: "crystal", IndexField: "crystal", NestedPath: "batchData"},
+	{Name: "rimOrCoreInclusion", IndexField: "rimOrCoreInclusion", NestedPath: "batchData"},
+	{Name: "rimOrCoreMineral", IndexField: "rimOrCoreMineral", NestedPath: "batchData"},
+	{Name: "specimenMedium", IndexField: "specimenMedium", NestedPath: "batchData"},
+	{Name: "itemName", IndexField: "itemName", NestedPath: "batchData.results"},
+	{Name: "itemGroup", IndexField: "itemGroup", NestedPath: "batchData.results"},
+	{Name: "medium", IndexField: "medium", NestedPath: "batchData.results"},
+	{Name: "method", IndexField: "method", NestedPath: "batchData.results"},
+	{Name: "unit", IndexField: "unit", NestedPath: "batchData.results"},
+	{Name: "value", IndexField: "value", NestedPath: "batchData.results"},
+	{Name: "valueCount", IndexField: "valueCount", NestedPath: "batchData.results"},
+	{Name: "standards", IndexField: "standardName", NestedPath: "batchData.results.standards"},
+	{Name: "citationID", IndexField: "citationID", NestedPath: "references"},
+	{Name: "publisher", IndexField: "publisher", NestedPath: "references"},
+	{Name: "citationLink", IndexField: "citationLink", NestedPath: "references"},
+	{Name: "journal", IndexField: "journal", NestedPath: "references"},
+	{Name: "volume", IndexField: "volume", NestedPath: "references"},
+	{Name: "issue", IndexField: "issue", NestedPath: "references"},
+	{Name: "firstPage", IndexField: "firstPage", NestedPath: "references"},
+	{Name: "lastPage", IndexField: "lastPage", NestedPath: "references"},
+	{Name: "bookTitle", IndexField: "bookTitle", NestedPath: "references"},
+	{Name: "editors", IndexField: "editors", NestedPath: "references"},
+	{Name: "personID", IndexField: "personID", NestedPath: "references.authors"},
+	{Name: "firstName", IndexField: "firstName", NestedPath: "references.authors"},
+	{Name: "lastName", IndexField: "lastName", NestedPath: "references.authors"},
+	{Name: "order", IndexField: "order", NestedPath: "references.authors"},
+}
+
+// POSITION_OPERATORS holds the operators of the positive conditions on fields with a Position in the search index
+var POSITION_OPERATORS = []Operator{OpEq, OpIn, OpExists, OpLike}
+
+// aliases maps the former query parameter names that are still documented to the names of the registered fields
+var aliases = map[string]string{
+	"rockclassID":      "rockclass",
+	"hostmineral":      "hostmaterial",
+	"inclusionmineral": "inclusionmaterial",
+}
+
+// LookupField returns the registered Field for the query parameter name or one of its aliases and whether it exists
+func LookupField(name string) (Field, bool) {
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+	for _, field := range registry {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// Fields returns all registered fields
+func Fields() []Field {
+	fields := make([]Field, len(registry))
+	copy(fields, registry)
+	return fields
+}
+
+// IndexPath returns the full path of the field in the search index documents
+func (f Field) IndexPath() string {
+	if f.NestedPath == "" {
+		return f.IndexField
+	}
+	return f.NestedPath + "." + f.IndexField
+}
+
+// index returns the position of the field in the registry
+func (f Field) index() int {
+	for i, field := range registry {
+		if field.Name == f.Name {
+			return i
+		}
+	}
+	return len(registry)
+}
+
+// TextField is a field of the full text search
+type TextField struct {
+	// Path is the full path of the field in the search index documents
+	Path string
+	// NestedPath is the path of the nested objects holding the field; empty for top level fields
+	NestedPath string
+}
+
+// TEXT_FIELDS holds the fields searched by the full text search
+var TEXT_FIELDS = []TextField{
+	{Path: "sampleName"},
+	{Path: "locationNames"},
+	{Path: "references.title", NestedPath: "references"},
+	{Path: "references.journal", NestedPath: "references"},
+	{Path: "references.authors.lastName", NestedPath: "references.authors"},
+	{Path: "rockClasses.value", NestedPath: "rockClasses"},
+	{Path: "rockTypes.value", NestedPath: "rockTypes"},
+}
@@ -0,0 +1,408 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package filter parses the Filter DSL of the request parameters into a backend-neutral Filter
+// that can be compiled into sql and search index queries
+package filter
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/regions"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/sql"
+)
+
+// Operator of a filter Condition
+type Operator string
+
+// Operators of the Filter DSL
+const (
+	OpEq      Operator = "eq"
+	OpIn      Operator = "in"
+	OpLt      Operator = "lt"
+	OpLte     Operator = "lte"
+	OpGt      Operator = "gt"
+	OpGte     Operator = "gte"
+	OpLike    Operator = "lk"
+	OpBetween Operator = "btw"
+	OpNe      Operator = "ne"
+	OpNotIn   Operator = "nin"
+	OpExists  Operator = "exists"
+	OpMissing Operator = "missing"
+)
+
+// negations maps the negating operators to the operator they negate
+var negations = map[Operator]Operator{
+	OpNe:      OpEq,
+	OpNotIn:   OpIn,
+	OpMissing: OpExists,
+}
+
+// Query parameters with a special syntax
+const (
+	KEY_CHEMISTRY       = "chemistry"
+	KEY_POLYGON         = "polygon"
+	KEY_POLYGON_GEOJSON = "polygon_geojson"
+	KEY_BBOX            = "bbox"
+	KEY_NEAR            = "near"
+	KEY_REGION          = "region"
+	KEY_GEOTILE         = "geotile"
+	KEY_OR              = "or"
+	KEY_TEXT            = "q"
+	KEY_SORT            = "sort"
+
+	DELIM    = ","
+	DELIM_OR = "|"
+
+	// MAX_NEAR_RADIUS_KM is half of the equatorial circumference which covers the whole globe
+	MAX_NEAR_RADIUS_KM = 20037.5
+)
+
+// Condition compares a Field with one or more values
+type Condition struct {
+	Field    Field
+	Operator Operator
+	// Values holds the comma-separated values of "in" and "nin", the lower and upper bound of "btw",
+	// no value for "exists" and "missing" and the single value of all other operators
+	Values []string
+}
+
+// Shape is a polygon filter on the location of the samples
+type Shape struct {
+	// Points holds the vertices if the polygon was given as point array
+	Points []model.SimplePoint
+	// Feature holds the polygon as GeoJSON Polygon or MultiPolygon
+	Feature model.GeoJSONFeature
+}
+
+// Circle is a radius filter on the location of the samples
+type Circle struct {
+	// Center holds the longitude translated to -180 to +180
+	Center   model.SimplePoint
+	RadiusKM float64
+}
+
+// Filter is the parsed representation of all filter parameters of a request
+// All parts of a Filter are evaluated conjunctively
+type Filter struct {
+	Conditions []Condition
+	// Disjunctions holds groups of conditions of which at least one has to match
+	Disjunctions [][]Condition
+	Chemistry    []model.CQExpression
+	Polygon      *Shape
+	BBox         *Shape
+	// Region holds the polygon of a named region of the regions registry
+	Region *Shape
+	// Near restricts the samples to the geodesic distance from a point
+	Near *Circle
+	// Geotile restricts the samples to a tile of the geotile_grid aggregation, e.g. to the samples of a cluster
+	Geotile *geometry.Tile
+	// Text is the free text of the full text search over the TEXT_FIELDS; the search index sorts the matches by relevance
+	Text string
+	// Sort holds the sort order of the search index; see SortKeys for the complete order
+	Sort []SortKey
+}
+
+// Parse parses the query parameters into a Filter and validates them against the field registry
+// Parameters listed in skip are not interpreted as filters
+func Parse(params url.Values, skip ...string) (Filter, error) {
+	f := Filter{}
+	// GeoJSON takes precedence over the deprecated point array polygon
+	if geojson := params.Get(KEY_POLYGON_GEOJSON); geojson != "" && !slices.Contains(skip, KEY_POLYGON_GEOJSON) {
+		feature, err := geometry.ParseGeoJSONArea([]byte(geojson))
+		if err != nil {
+			return f, fmt.Errorf("can not parse %s: %w", KEY_POLYGON_GEOJSON, err)
+		}
+		feature, err = geometry.RepairPolygon(feature)
+		if err != nil {
+			return f, fmt.Errorf("can not parse %s: %w", KEY_POLYGON_GEOJSON, err)
+		}
+		f.Polygon = &Shape{Feature: feature}
+		skip = append(skip, KEY_POLYGON)
+	}
+	// iterate the keys in order to produce deterministic filters
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		if slices.Contains(skip, k) || k == KEY_POLYGON_GEOJSON {
+			continue
+		}
+		for _, v := range params[k] {
+			if v == "" {
+				continue
+			}
+			switch k {
+			case KEY_CHEMISTRY:
+				chemQuery, err := model.ParseChemQuery(v)
+				if err != nil {
+					return f, err
+				}
+				for _, expr := range chemQuery.Expressions {
+					if _, _, err := ChemistryBounds(expr); err != nil {
+						return f, fmt.Errorf("invalid filter %s: %w", KEY_CHEMISTRY, err)
+					}
+					if len(f.Chemistry) > 0 && expr.Junctor == model.CQ_JUNCTOR_NONE {
+						expr.Junctor = model.CQ_JUNCTOR_AND
+					}
+					f.Chemistry = append(f.Chemistry, expr)
+				}
+			case KEY_POLYGON:
+				shape, err := parsePolygon(v)
+				if err != nil {
+					return f, fmt.Errorf("can not parse %s: %w", KEY_POLYGON, err)
+				}
+				f.Polygon = shape
+			case KEY_OR:
+				disjunction, err := parseDisjunction(v)
+				if err != nil {
+					return f, fmt.Errorf("invalid filter %s: %w", KEY_OR, err)
+				}
+				f.Disjunctions = append(f.Disjunctions, disjunction)
+			case KEY_REGION:
+				region, ok := regions.Lookup(v)
+				if !ok {
+					return f, fmt.Errorf("unknown %s %s", KEY_REGION, v)
+				}
+				f.Region = &Shape{Feature: region.Feature}
+			case KEY_GEOTILE:
+				tile, err := geometry.ParseGeotileKey(v)
+				if err != nil {
+					return f, fmt.Errorf("can not parse %s: %w", KEY_GEOTILE, err)
+				}
+				f.Geotile = &tile
+			case KEY_NEAR:
+				circle, err := parseNear(v)
+				if err != nil {
+					return f, fmt.Errorf("can not parse %s: %w", KEY_NEAR, err)
+				}
+				f.Near = circle
+			case KEY_TEXT:
+				f.Text = strings.TrimSpace(f.Text + " " + v)
+			case KEY_SORT:
+				keys, err := parseSort(v)
+				if err != nil {
+					return f, fmt.Errorf("invalid %s: %w", KEY_SORT, err)
+				}
+				f.Sort = append(f.Sort, keys...)
+			case KEY_BBOX:
+				shape, err := parsePointArray(v)
+				if err != nil {
+					return f, fmt.Errorf("can not parse %s: %w", KEY_BBOX, err)
+				}
+				f.BBox = shape
+			default:
+				field, ok := LookupField(k)
+				if !ok {
+					return f, fmt.Errorf("unknown filter field %s", k)
+				}
+				condition, err := ParseCondition(field, v)
+				if err != nil {
+					return f, fmt.Errorf("invalid filter %s: %w", k, err)
+				}
+				f.Conditions = append(f.Conditions, condition)
+			}
+		}
+	}
+	return f, nil
+}
+
+// ParseCondition parses a value of the Filter DSL for the given field
+func ParseCondition(field Field, v string) (Condition, error) {
+	condition := Condition{Field: field, Operator: OpEq, Values: []string{v}}
+	operator, value, found := strings.Cut(v, ":")
+	if !found {
+		// if no operator is specified, "eq" is assumed as default
+		return condition, nil
+	}
+	condition.Operator = Operator(strings.ToLower(operator))
+	condition.Values = []string{value}
+	switch condition.Operator {
+	case OpEq, OpNe:
+	case OpIn, OpNotIn:
+		condition.Values = strings.Split(value, DELIM)
+	case OpExists, OpMissing:
+		if value != "" {
+			return condition, fmt.Errorf("operator %s does not take a value", condition.Operator)
+		}
+		condition.Values = nil
+	case OpLike:
+		// LIKE is not supported for numeric values
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return condition, fmt.Errorf("operator lk cannot be applied to numeric value: %f", f)
+		}
+	case OpLt, OpLte, OpGt, OpGte:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return condition, fmt.Errorf("operator %s is only applicable to numeric values", condition.Operator)
+		}
+	case OpBetween:
+		lower, upper, _ := strings.Cut(value, DELIM)
+		if lower == "" {
+			// assume min value
+			lower = sql.MIN_LOWER_BOUND
+		}
+		if upper == "" {
+			// assume max value
+			upper = sql.MAX_UPPER_BOUND
+		}
+		for _, bound := range []string{lower, upper} {
+			if _, err := strconv.ParseFloat(bound, 64); err != nil {
+				return condition, fmt.Errorf("operator btw is only applicable to numeric values")
+			}
+		}
+		condition.Values = []string{lower, upper}
+	default:
+		return condition, fmt.Errorf("unknown operator %s", operator)
+	}
+	return condition, nil
+}
+
+// Positive returns the condition with the operator it negates and true for the operators "ne", "nin" and "missing"
+// All other conditions are returned unchanged with false
+func (c Condition) Positive() (Condition, bool) {
+	operator, ok := negations[c.Operator]
+	if !ok {
+		return c, false
+	}
+	c.Operator = operator
+	return c, true
+}
+
+// Bounds returns the numeric bounds of a range condition keyed by the comparison operator
+// Conditions with other operators return an empty map
+func (c Condition) Bounds() map[Operator]float64 {
+	bounds := map[Operator]float64{}
+	switch c.Operator {
+	case OpLt, OpLte, OpGt, OpGte:
+		// values are validated during parsing
+		value, _ := strconv.ParseFloat(c.Values[0], 64)
+		bounds[c.Operator] = value
+	case OpBetween:
+		lower, _ := strconv.ParseFloat(c.Values[0], 64)
+		upper, _ := strconv.ParseFloat(c.Values[1], 64)
+		bounds[OpGte] = lower
+		bounds[OpLte] = upper
+	}
+	return bounds
+}
+
+// parseDisjunction parses the conditions of an OR-group given as FIELD=OPERATOR:VALUE|FIELD=OPERATOR:VALUE|...
+func parseDisjunction(v string) ([]Condition, error) {
+	disjunction := []Condition{}
+	for _, part := range strings.Split(v, DELIM_OR) {
+		name, value, found := strings.Cut(part, "=")
+		if !found || value == "" {
+			return nil, fmt.Errorf("%s must be formatted as FIELD=OPERATOR:VALUE", part)
+		}
+		field, ok := LookupField(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown filter field %s", name)
+		}
+		condition, err := ParseCondition(field, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %s: %w", name, err)
+		}
+		disjunction = append(disjunction, condition)
+	}
+	return disjunction, nil
+}
+
+// ChemistryBounds returns the value range of a chemistry expression
+// Missing bounds are returned as negative and positive infinity
+func ChemistryBounds(expr model.CQExpression) (float64, float64, error) {
+	minValue := math.Inf(-1)
+	maxValue := math.Inf(1)
+	var err error
+	if expr.MinValue != "" {
+		minValue, err = strconv.ParseFloat(expr.MinValue, 64)
+		if err != nil {
+			return minValue, maxValue, err
+		}
+	}
+	if expr.MaxValue != "" {
+		maxValue, err = strconv.ParseFloat(expr.MaxValue, 64)
+		if err != nil {
+			return minValue, maxValue, err
+		}
+	}
+	return minValue, maxValue, nil
+}
+
+// ShapeFromPoints returns a Shape for the polygon given as points
+func ShapeFromPoints(points []model.SimplePoint) *Shape {
+	return &Shape{Points: points, Feature: geometry.ParsePolygon(points)}
+}
+
+// parsePolygon parses a polygon given as GeoJSON Feature, FeatureCollection, (multi-)polygon geometry or point array
+// The polygon is repaired and simplified by geometry.RepairPolygon
+func parsePolygon(v string) (*Shape, error) {
+	shape := &Shape{}
+	// GeoJSON is given as object, point arrays as array
+	if strings.HasPrefix(strings.TrimSpace(v), "{") {
+		feature, err := geometry.ParseGeoJSONArea([]byte(v))
+		if err != nil {
+			return nil, err
+		}
+		shape.Feature = feature
+	} else {
+		// fallback: parse as point array
+		var err error
+		shape, err = parsePointArray(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	feature, err := geometry.RepairPolygon(shape.Feature)
+	if err != nil {
+		return nil, err
+	}
+	shape.Feature = feature
+	return shape, nil
+}
+
+// parsePointArray parses a polygon given as point array
+func parsePointArray(v string) (*Shape, error) {
+	points, err := geometry.ParsePointArray(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(points) < 3 {
+		return nil, fmt.Errorf("polygon needs at least 3 points")
+	}
+	return ShapeFromPoints(points), nil
+}
+
+// parseNear parses a radius filter given as LON,LAT,RADIUS_KM
+// Longitudes beyond the +/-180 meridian are translated into the bounds, since the distance is calculated geodesically
+func parseNear(v string) (*Circle, error) {
+	parts := strings.Split(v, DELIM)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%s must be formatted as LON,LAT,RADIUS_KM", v)
+	}
+	values := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, fmt.Errorf("invalid number %s", part)
+		}
+		values = append(values, value)
+	}
+	lon, lat, radius := values[0], values[1], values[2]
+	if lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("latitude %f out of bounds", lat)
+	}
+	if radius <= 0 || radius > MAX_NEAR_RADIUS_KM {
+		return nil, fmt.Errorf("radius must be greater than 0 and at most %.1f km", MAX_NEAR_RADIUS_KM)
+	}
+	return &Circle{Center: model.SimplePoint{X: geometry.TranslateLon(lon), Y: lat}, RadiusKM: radius}, nil
+}
@@ -0,0 +1,376 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package filter_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		params   url.Values
+		expected string
+	}{
+		{url.Values{"mineral": {"QUARTZ"}}, "[mineral eq [QUARTZ]]"},
+		{url.Values{"rockclass": {"IN:1,5"}}, "[rockclass in [1 5]]"},
+		{url.Values{"latitude": {"gte:-10.5"}}, "[latitude gte [-10.5]]"},
+		{url.Values{"agemin": {"btw:,100"}}, "[agemin btw [0 100]]"},
+		{url.Values{"title": {"lk:*basalt*"}}, "[title lk [*basalt*]]"},
+		{url.Values{"setting": {"eq:RIFT"}, "lab": {"GEOMAR"}}, "[lab eq [GEOMAR] setting eq [RIFT]]"},
+		{url.Values{"rocktype": {"nin:PLUTONIC,VOLCANIC"}}, "[rocktype nin [PLUTONIC VOLCANIC]]"},
+		{url.Values{"doi": {"exists:"}, "title": {"MISSING:"}}, "[doi exists [] title missing []]"},
+		{url.Values{"limit": {"10"}}, "[]"},
+		// documented former names of fields
+		{url.Values{"rockclassID": {"in:1,5"}}, "[rockclass in [1 5]]"},
+		{url.Values{"hostmineral": {"OLIVINE"}}, "[hostmaterial eq [OLIVINE]]"},
+		{url.Values{"inclusionmineral": {"SPINEL"}}, "[inclusionmaterial eq [SPINEL]]"},
+	}
+	for _, test := range tests {
+		f, err := filter.Parse(test.params, "limit")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conditions := []string{}
+		for _, c := range f.Conditions {
+			conditions = append(conditions, fmt.Sprintf("%s %s %v", c.Field.Name, c.Operator, c.Values))
+		}
+		if o := fmt.Sprintf("[%s]", strings.Join(conditions, " ")); o != test.expected {
+			t.Fatalf("Input: %v | Output: %s | Expected: %s", test.params, o, test.expected)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []url.Values{
+		{"sampleName": {"xx:ICE-02"}},
+		{"latitude": {"gt:north"}},
+		{"batchID": {"btw:a,b"}},
+		{"sampleName": {"lk:42"}},
+		{"unknown": {"42"}},
+		{"chemistry": {"(MAJOR,SiO2,low,)"}},
+		{"polygon": {"[[0,0],[1,1]]"}},
+		{"doi": {"exists:10.1000"}},
+		{"or": {"setting=RIFT|unknown=42"}},
+		{"or": {"setting"}},
+		{"sort": {"unknown"}},
+		{"sort": {"latitude:up"}},
+		{"sort": {"distance:10"}},
+		{"sort": {"element:"}},
+		{"near": {"10,20"}},
+		{"near": {"10,95,50"}},
+		{"near": {"10,20,-5"}},
+		{"geotile": {"2/4/1"}},
+		{"geotile": {"2/1"}},
+	}
+	for _, params := range tests {
+		_, err := filter.Parse(params)
+		if err == nil {
+			t.Fatalf("Input: %v | Expected error but got nil", params)
+		}
+	}
+}
+
+func TestParseDisjunctions(t *testing.T) {
+	f, err := filter.Parse(url.Values{"or": {"setting=RIFT|location1=in:ICELAND,NORWAY", "doi=missing:|title=lk:*basalt*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Disjunctions) != 2 || len(f.Disjunctions[0]) != 2 || f.Disjunctions[0][1].Operator != filter.OpIn || f.Disjunctions[1][0].Operator != filter.OpMissing {
+		t.Fatalf("Expected 2 disjunctions of 2 conditions but got %v", f.Disjunctions)
+	}
+}
+
+func TestParseShapes(t *testing.T) {
+	params := url.Values{
+		"polygon":         {"[[0,0],[10,0],[10,10],[0,10],[0,0]]"},
+		"polygon_geojson": {`{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[1,1],[2,1],[2,2],[1,1]]]}}`},
+		"bbox":            {"[[-30,60],[-10,60],[-10,70],[-30,70],[-30,60]]"},
+	}
+	f, err := filter.Parse(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Polygon == nil || len(f.Polygon.Points) != 0 || f.Polygon.Feature.Geometry.Type != "Polygon" {
+		t.Fatalf("Expected polygon_geojson to take precedence but got %v", f.Polygon)
+	}
+	if f.BBox == nil || len(f.BBox.Points) != 5 {
+		t.Fatalf("Expected bbox with 5 points but got %v", f.BBox)
+	}
+
+	// broken polygons are reported as ErrInvalidPolygon
+	_, err = filter.Parse(url.Values{"polygon_geojson": {`{"type":"Polygon","coordinates":[[[0,0],[10,10],[10,0],[0,10],[0,0]]]}`}})
+	if !errors.Is(err, geometry.ErrInvalidPolygon) {
+		t.Fatalf("Expected ErrInvalidPolygon for self-intersecting polygon but got %v", err)
+	}
+}
+
+func TestParseNear(t *testing.T) {
+	// longitudes beyond the antimeridian are translated into the bounds
+	f, err := filter.Parse(url.Values{"near": {"185.5, -38.6, 50"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Near == nil || f.Near.Center.X != -174.5 || f.Near.Center.Y != -38.6 || f.Near.RadiusKM != 50 {
+		t.Fatalf("Expected circle around -174.5,-38.6 with 50 km but got %v", f.Near)
+	}
+	query, err := filter.ToSQL(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(query.GetQueryString(), "ST_DWITHIN(sg.geometry::geography, ST_SETSRID(ST_MAKEPOINT($1, $2), 4326)::geography, $3)") {
+		t.Fatalf("Expected distance filter in query %s", query.GetQueryString())
+	}
+	if fmt.Sprint(query.GetFilterValues()) != "[-174.5 -38.6 50000]" {
+		t.Fatalf("Expected filter values [-174.5 -38.6 50000] but got %v", query.GetFilterValues())
+	}
+}
+
+func TestPolygonToSQL(t *testing.T) {
+	polygon := `{"type":"Feature","geometry":{"type":"MultiPolygon","coordinates":[
+		[[[170,-10],[190,-10],[190,10],[170,10],[170,-10]],[[172,-2],[174,-2],[174,2],[172,2],[172,-2]]],
+		[[[0,0],[10,0],[10,10],[0,0]]]
+	]}}`
+	f, err := filter.Parse(url.Values{"polygon": {polygon}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := filter.ToSQL(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(query.GetQueryString(), "ST_WITHIN(sg.geometry, ST_GEOMETRYFROMTEXT($1, 4326))") {
+		t.Fatalf("Expected polygon filter in query %s", query.GetQueryString())
+	}
+	wkt := fmt.Sprint(query.GetFilterValues()...)
+	// the polygon crossing the antimeridian is split in two and keeps its hole
+	if !strings.HasPrefix(wkt, "MULTIPOLYGON(((") || strings.Count(wkt, ")),((") != 2 || strings.Count(wkt, "),(") != 3 {
+		t.Fatalf("Expected MULTIPOLYGON of 3 polygons with one hole but got %s", wkt)
+	}
+}
+
+func TestToSQL(t *testing.T) {
+	f, err := filter.Parse(url.Values{"rocktype": {"in:BASALT,RHYOLITE"}, "title": {"lk:*basalt?"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := filter.ToSQL(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := fmt.Sprint(query.GetFilterValues()...)
+	for _, expected := range []string{"BASALT", "%basalt_"} {
+		if !strings.Contains(values, expected) {
+			t.Fatalf("Expected filter value %s in %s", expected, values)
+		}
+	}
+
+	// negations and disjunctions of the same table
+	f, err = filter.Parse(url.Values{"rocktype": {"ne:PLUTONIC"}, "or": {"setting=RIFT|location1=ICELAND"}, "doi": {"exists:"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err = filter.ToSQL(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"WHERE ( sf.samplingfeatureid NOT IN (select matched.samplingfeatureid from ( -- taxonomic classifiers select st.samplingfeatureid from odm2.sampletaxonomicclassifiers st WHERE $1 = any(st.rocktypes) )",
+		"WHERE ( gs.settingname = $2 OR toplevelloc.locationname = $3 )",
+		"WHERE scd.externalidentifier IS NOT NULL",
+	} {
+		if !strings.Contains(strings.Join(strings.Fields(query.GetQueryString()), " "), expected) {
+			t.Fatalf("Expected %s in query %s", expected, query.GetQueryString())
+		}
+	}
+
+	// negations of fields with multiple rows per sample exclude samples with any matching row like must_not of the search index,
+	// so a sample citing the title next to other titles is excluded and samples without citations are kept
+	f, err = filter.Parse(url.Values{"title": {"ne:Icelandic basalts"}, "or": {"doi=missing:|publicationyear=gte:2000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err = filter.ToSQL(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := strings.Join(strings.Fields(query.GetQueryString()), " ")
+	for _, expected := range []string{
+		"from odm2.samplingfeatures sf WHERE ( sf.samplingfeatureid NOT IN (select matched.samplingfeatureid from ( select distinct scd.samplingfeatureid from odm2.samplecitationdata scd WHERE scd.title = $1 ) matched where matched.samplingfeatureid is not null) ) ) neg1 on neg1.samplingfeatureid = spec.sampleid",
+		"WHERE ( sf.samplingfeatureid NOT IN (select matched.samplingfeatureid from ( select distinct scd.samplingfeatureid from odm2.samplecitationdata scd WHERE scd.externalidentifier IS NOT NULL ) matched where matched.samplingfeatureid is not null) OR sf.samplingfeatureid IN (select matched.samplingfeatureid from ( select distinct scd.samplingfeatureid from odm2.samplecitationdata scd WHERE scd.publicationyear >= $2 ) matched where matched.samplingfeatureid is not null) ) ) neg2",
+	} {
+		if !strings.Contains(q, expected) {
+			t.Fatalf("Expected %s in query %s", expected, q)
+		}
+	}
+	// the rows of the citations are not joined, so a sample can not match by one of its other citations
+	if strings.Contains(q, "citations on citations.samplingfeatureid") {
+		t.Fatalf("Expected no row-level join of the citations in query %s", q)
+	}
+
+	// disjunctions across tables can not be compiled to sql
+	f, err = filter.Parse(url.Values{"or": {"setting=RIFT|doi=exists:"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filter.ToSQL(f); err == nil {
+		t.Fatal("Expected error for disjunction across tables but got nil")
+	}
+
+	// fields only available in the search index can not be compiled to sql
+	f, err = filter.Parse(url.Values{"sampleName": {"ICE-02"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filter.ToSQL(f); err == nil {
+		t.Fatal("Expected error for search index field but got nil")
+	}
+
+	// the full text search is only available in the search index
+	f, err = filter.Parse(url.Values{"q": {" taupo ", "rhyolite"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Text != "taupo rhyolite" {
+		t.Fatalf("Output: %s | Expected: taupo rhyolite", f.Text)
+	}
+	if _, err := filter.ToSQL(f); err == nil {
+		t.Fatal("Expected error for full text search but got nil")
+	}
+}
+
+func TestToOpenSearchSort(t *testing.T) {
+	tests := map[string]string{
+		"":                    `[{"sampleID":{"order":"asc"}}]`,
+		"latitude:desc":       `[{"latitude":{"order":"desc"}},{"sampleID":{"order":"asc"}}]`,
+		"publicationyear":     `[{"references.publicationYear":{"mode":"min","nested":{"path":"references"},"order":"asc"}},{"sampleID":{"order":"asc"}}]`,
+		"element:MgO:desc":    `[{"batchData.results.value":{"mode":"max","nested":{"nested":{"filter":{"term":{"batchData.results.itemName":"MgO"}},"path":"batchData.results"},"path":"batchData"},"order":"desc"}},{"sampleID":{"order":"asc"}}]`,
+		"distance:10.5:-20":   `[{"_geo_distance":{"geo_point":{"lat":-20,"lon":10.5},"order":"asc","unit":"km"}},{"sampleID":{"order":"asc"}}]`,
+		"score,sampleID:desc": `[{"_score":{"order":"desc"}},{"sampleID":{"order":"desc"}}]`,
+	}
+	for sort, expected := range tests {
+		f, err := filter.Parse(url.Values{"sort": {sort}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(filter.ToOpenSearchSort(f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Fatalf("Input: %s | Output: %s | Expected: %s", sort, b, expected)
+		}
+	}
+
+	// full text searches are sorted by relevance by default
+	b, _ := json.Marshal(filter.ToOpenSearchSort(filter.Filter{Text: "basalt"}))
+	if expected := `[{"_score":{"order":"desc"}},{"sampleID":{"order":"asc"}}]`; string(b) != expected {
+		t.Fatalf("Output: %s | Expected: %s", b, expected)
+	}
+}
+
+func TestToOpenSearch(t *testing.T) {
+	tests := []struct {
+		params   url.Values
+		expected string
+	}{
+		{url.Values{"latitude": {"gte:-10.5"}}, `{"bool":{"filter":[{"range":{"latitude":{"gte":-10.5}}}]}}`},
+		{url.Values{"latitude": {"lt:10"}, "longitude": {"gt:-20"}}, `{"bool":{"filter":[{"range":{"latitude":{"lt":10}}},{"range":{"longitude":{"gt":-20}}}]}}`},
+		{url.Values{"agemin": {"btw:10,100"}}, `{"bool":{"filter":[{"range":{"ageMin":{"gte":10,"lte":100}}}]}}`},
+		// missing bounds of btw are assumed as 0 and 9999999 like in sql
+		{url.Values{"agemin": {"btw:,5"}}, `{"bool":{"filter":[{"range":{"ageMin":{"gte":0,"lte":5}}}]}}`},
+		{url.Values{"sampleName": {"lk:ICE-0?*"}}, `{"bool":{"filter":[{"wildcard":{"sampleName":{"value":"ICE-0?*"}}}]}}`},
+		{url.Values{"setting": {"in:RIFT,OCEAN ISLAND"}, "lab": {"exists:"}}, `{"bool":{"filter":[{"exists":{"field":"institutions"}},{"terms":{"tectonicSetting":["RIFT","OCEAN ISLAND"]}}]}}`},
+		{url.Values{"sampleName": {"ne:ICE-02"}, "rocktype": {"nin:PLUTONIC,VOLCANIC"}}, `{"bool":{"must_not":[{"nested":{"path":"rockTypes","query":{"terms":{"rockTypes.value":["PLUTONIC","VOLCANIC"]}}}},{"term":{"sampleName":{"value":"ICE-02"}}}]}}`},
+		// negations of nested fields exclude samples with any matching nested object
+		{url.Values{"title": {"ne:Icelandic basalts"}, "doi": {"missing:"}}, `{"bool":{"must_not":[{"nested":{"path":"references","query":{"exists":{"field":"references.externalIdentifier"}}}},{"nested":{"path":"references","query":{"term":{"references.title":{"value":"Icelandic basalts"}}}}}]}}`},
+		{url.Values{"or": {"setting=RIFT|publicationyear=gte:2000", "doi=missing:|title=lk:*basalt*"}}, `{"bool":{"filter":[{"bool":{"minimum_should_match":1,"should":[{"term":{"tectonicSetting":{"value":"RIFT"}}},{"nested":{"path":"references","query":{"range":{"references.publicationYear":{"gte":2000}}}}}]}},{"bool":{"minimum_should_match":1,"should":[{"bool":{"must_not":[{"nested":{"path":"references","query":{"exists":{"field":"references.externalIdentifier"}}}}]}},{"nested":{"path":"references","query":{"wildcard":{"references.title":{"value":"*basalt*"}}}}}]}}]}}`},
+		// all conditions of a chemistry expression have to match within the same result
+		{url.Values{"chemistry": {"(MAJOR,SiO2,45,55)"}}, `{"bool":{"filter":[{"nested":{"path":"batchData.results","query":{"bool":{"filter":[{"range":{"batchData.results.value":{"gte":45,"lte":55}}},{"term":{"batchData.results.itemGroup":{"value":"MAJOR"}}},{"term":{"batchData.results.itemName":{"value":"SiO2"}}}]}}}}]}}`},
+		{url.Values{"chemistry": {"(MAJOR,SiO2,45,) OR (TRACE,Sr,,100,PPM,ICPMS)"}}, `{"bool":{"filter":[{"bool":{"minimum_should_match":1,"should":[{"nested":{"path":"batchData.results","query":{"bool":{"filter":[{"range":{"batchData.results.value":{"gte":45}}},{"term":{"batchData.results.itemGroup":{"value":"MAJOR"}}},{"term":{"batchData.results.itemName":{"value":"SiO2"}}}]}}}},{"nested":{"path":"batchData.results","query":{"bool":{"filter":[{"range":{"batchData.results.value":{"lte":100}}},{"term":{"batchData.results.itemGroup":{"value":"TRACE"}}},{"term":{"batchData.results.itemName":{"value":"Sr"}}},{"term":{"batchData.results.unit":{"value":"PPM"}}},{"term":{"batchData.results.method":{"value":"ICPMS"}}}]}}}}]}}]}}`},
+		{url.Values{"chemistry": {"SiO2>45 AND MgO<=10"}}, `{"bool":{"filter":[{"bool":{"filter":[{"nested":{"path":"batchData.results","query":{"bool":{"filter":[{"range":{"batchData.results.value":{"gt":45}}},{"term":{"batchData.results.itemName":{"value":"SiO2"}}}]}}}},{"nested":{"path":"batchData.results","query":{"bool":{"filter":[{"range":{"batchData.results.value":{"lte":10}}},{"term":{"batchData.results.itemName":{"value":"MgO"}}}]}}}}]}}]}}`},
+		{url.Values{"near": {"185.5,-38.6,50"}}, `{"bool":{"filter":[{"geo_distance":{"distance":"50.000000km","geo_point":{"lat":-38.6,"lon":-174.5}}}]}}`},
+	}
+	for _, test := range tests {
+		f, err := filter.Parse(test.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query, err := filter.ToOpenSearch(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(query.Map())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.expected {
+			t.Errorf("Input: %v | Output: %s | Expected: %s", test.params, b, test.expected)
+		}
+	}
+}
+
+// scriptSource matches the sources of scripts which are not pinned
+var scriptSource = regexp.MustCompile(`"source":"(?:[^"\\]|\\.)*"`)
+
+// openSearchJSON returns the search index query of the filter parameters with the script sources replaced by "..."
+func openSearchJSON(t *testing.T, params url.Values) string {
+	f, err := filter.Parse(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := filter.ToOpenSearch(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(query.Map())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scriptSource.ReplaceAllString(string(b), `"source":"..."`)
+}
+
+func TestToOpenSearchRatio(t *testing.T) {
+	tests := map[string]string{
+		"La/Yb>=10":              `{"bool":{"filter":[{"script_score":{"min_score":1,"query":{"bool":{"filter":[{"nested":{"path":"batchData.results","query":{"bool":{"filter":[{"term":{"batchData.results.itemName":{"value":"La"}}}]}}}},{"nested":{"path":"batchData.results","query":{"bool":{"filter":[{"term":{"batchData.results.itemName":{"value":"Yb"}}}]}}}}]}},"script":{"params":{"divisor":"Yb","element":"La","max":null,"maxExclusive":false,"method":null,"min":10,"minExclusive":false,"type":null,"unit":null},"source":"..."}}}]}}`,
+		"(TRACE,La/Yb,5,20,PPM)": `{"bool":{"filter":[{"script_score":{"min_score":1,"query":{"bool":{"filter":[{"nested":{"path":"batchData.results","query":{"bool":{"filter":[{"term":{"batchData.results.itemName":{"value":"La"}}},{"term":{"batchData.results.itemGroup":{"value":"TRACE"}}},{"term":{"batchData.results.unit":{"value":"PPM"}}}]}}}},{"nested":{"path":"batchData.results","query":{"bool":{"filter":[{"term":{"batchData.results.itemName":{"value":"Yb"}}},{"term":{"batchData.results.itemGroup":{"value":"TRACE"}}},{"term":{"batchData.results.unit":{"value":"PPM"}}}]}}}}]}},"script":{"params":{"divisor":"Yb","element":"La","max":20,"maxExclusive":false,"method":null,"min":5,"minExclusive":false,"type":"TRACE","unit":"PPM"},"source":"..."}}}]}}`,
+	}
+	for chemistry, expected := range tests {
+		if o := openSearchJSON(t, url.Values{"chemistry": {chemistry}}); o != expected {
+			t.Errorf("Input: %s | Output: %s | Expected: %s", chemistry, o, expected)
+		}
+	}
+}
+
+func TestToOpenSearchPosition(t *testing.T) {
+	tests := map[string]string{
+		"ICELAND":           `{"bool":{"filter":[{"script_score":{"min_score":1,"query":{"term":{"locationNames":{"value":"ICELAND"}}},"script":{"params":{"field":"locationNames","operator":"eq","position":2,"values":["ICELAND"]},"source":"..."}}}]}}`,
+		"nin:ICELAND,HEKLA": `{"bool":{"must_not":[{"script_score":{"min_score":1,"query":{"terms":{"locationNames":["ICELAND","HEKLA"]}},"script":{"params":{"field":"locationNames","operator":"in","position":2,"values":["ICELAND","HEKLA"]},"source":"..."}}}]}}`,
+		"lk:HEK*":           `{"bool":{"filter":[{"script_score":{"min_score":1,"query":{"wildcard":{"locationNames":{"value":"HEK*"}}},"script":{"params":{"field":"locationNames","operator":"lk","position":2,"values":["HEK*"]},"source":"..."}}}]}}`,
+		"exists:":           `{"bool":{"filter":[{"script_score":{"min_score":1,"query":{"exists":{"field":"locationNames"}},"script":{"params":{"field":"locationNames","operator":"exists","position":2,"values":null},"source":"..."}}}]}}`,
+	}
+	for value, expected := range tests {
+		if o := openSearchJSON(t, url.Values{"location2": {value}}); o != expected {
+			t.Errorf("Input: %s | Output: %s | Expected: %s", value, o, expected)
+		}
+	}
+
+	// ranges are not applicable to a level of the location names
+	f, err := filter.Parse(url.Values{"location1": {"gt:5"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filter.ToOpenSearch(f); err == nil {
+		t.Fatal("Expected error for range filter on location1 but got nil")
+	}
+}
@@ -0,0 +1,445 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package filter
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/defensestation/osquery/v2"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// Fields of the search index documents used by the special filters
+const (
+	FIELD_GEOPOINT  = "geo_point"
+	FIELD_RESULTS   = "batchData.results"
+	FIELD_VALUE     = "value"
+	FIELD_ITEMGROUP = "itemGroup"
+	FIELD_ITEMNAME  = "itemName"
+	FIELD_UNIT      = "unit"
+	FIELD_METHOD    = "method"
+
+	// FIELD_DISTANCE is the script field holding the distance of a hit to the center of the near filter in km
+	FIELD_DISTANCE = "distance"
+)
+
+// ToOpenSearch compiles the Filter into a osquery.BoolQuery for the search index
+func ToOpenSearch(f Filter) (*osquery.BoolQuery, error) {
+	osFilters := []osquery.Mappable{}
+	osMustNot := []osquery.Mappable{}
+	for _, condition := range f.Conditions {
+		fq, negated, err := fieldQuery(condition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %s: %w", condition.Field.Name, err)
+		}
+		if negated {
+			osMustNot = append(osMustNot, fq)
+			continue
+		}
+		osFilters = append(osFilters, fq)
+	}
+	for _, disjunction := range f.Disjunctions {
+		should := []osquery.Mappable{}
+		for _, condition := range disjunction {
+			fq, negated, err := fieldQuery(condition)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter %s: %w", KEY_OR, err)
+			}
+			if negated {
+				fq = osquery.Bool().MustNot(fq)
+			}
+			should = append(should, fq)
+		}
+		osFilters = append(osFilters, osquery.Bool().Should(should...).MinimumShouldMatch(1))
+	}
+	chemQ, err := chemistryQuery(f.Chemistry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %s: %w", KEY_CHEMISTRY, err)
+	}
+	osFilters = append(osFilters, chemQ...)
+	for i, shape := range []*Shape{f.Polygon, f.BBox, f.Region} {
+		if shape == nil {
+			continue
+		}
+		polygonQ, err := polygonQuery(shape)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %s: %w", []string{KEY_POLYGON, KEY_BBOX, KEY_REGION}[i], err)
+		}
+		osFilters = append(osFilters, polygonQ)
+	}
+	if f.Near != nil {
+		osFilters = append(osFilters, nearQuery(f.Near))
+	}
+	if f.Geotile != nil {
+		osFilters = append(osFilters, geotileQuery(f.Geotile))
+	}
+	query := osquery.Bool().Filter(osFilters...).MustNot(osMustNot...)
+	if f.Text != "" {
+		// the text query is the only scoring part of the query
+		query = query.Must(textQuery(f.Text))
+	}
+	return query, nil
+}
+
+// textQuery returns the full text query over the TEXT_FIELDS
+// Nested fields are searched by nested queries returning their highlights as inner hits
+func textQuery(text string) osquery.Mappable {
+	topLevel := []string{}
+	nested := map[string][]string{}
+	nestedPaths := []string{}
+	for _, field := range TEXT_FIELDS {
+		if field.NestedPath == "" {
+			topLevel = append(topLevel, field.Path)
+			continue
+		}
+		if _, exists := nested[field.NestedPath]; !exists {
+			nestedPaths = append(nestedPaths, field.NestedPath)
+		}
+		nested[field.NestedPath] = append(nested[field.NestedPath], field.Path)
+	}
+	should := []any{multiMatch(text, topLevel)}
+	for _, path := range nestedPaths {
+		highlightFields := map[string]any{}
+		for _, field := range nested[path] {
+			highlightFields[field] = map[string]any{}
+		}
+		should = append(should, map[string]any{
+			"nested": map[string]any{
+				"path":       path,
+				"query":      multiMatch(text, nested[path]),
+				"score_mode": "max",
+				"inner_hits": map[string]any{
+					"name":      path,
+					"_source":   false,
+					"highlight": map[string]any{"fields": highlightFields},
+				},
+			},
+		})
+	}
+	return osquery.CustomQuery(map[string]any{
+		"bool": map[string]any{
+			"should":               should,
+			"minimum_should_match": 1,
+		},
+	})
+}
+
+// multiMatch returns a multi_match query of the text on the fields
+func multiMatch(text string, fields []string) map[string]any {
+	return map[string]any{
+		"multi_match": map[string]any{
+			"query":   text,
+			"fields":  fields,
+			"lenient": true,
+		},
+	}
+}
+
+// TextHighlight returns the highlight of the top level TEXT_FIELDS; nested fields are highlighted by the inner hits of the text query
+func TextHighlight() osquery.Mappable {
+	fields := map[string]any{}
+	for _, field := range TEXT_FIELDS {
+		if field.NestedPath == "" {
+			fields[field.Path] = map[string]any{}
+		}
+	}
+	return osquery.CustomQuery(map[string]any{"fields": fields})
+}
+
+// fieldQuery returns the search index query for the positive form of a Condition and whether it has to be negated
+func fieldQuery(condition Condition) (osquery.Mappable, bool, error) {
+	positive, negated := condition.Positive()
+	fq, err := conditionQuery(positive)
+	if err != nil {
+		return nil, false, err
+	}
+	if condition.Field.Position > 0 {
+		fq, err = positionQuery(positive, fq)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if condition.Field.NestedPath != "" {
+		// at least one of the nested objects has to match the condition
+		// a negated condition therefore matches if none of the nested objects match
+		fq = osquery.Nested(condition.Field.NestedPath, fq)
+	}
+	return fq, negated, nil
+}
+
+// conditionQuery returns the search index query for a single Condition
+func conditionQuery(condition Condition) (osquery.Mappable, error) {
+	field := condition.Field.IndexPath()
+	switch condition.Operator {
+	case OpEq:
+		return osquery.Term(field, condition.Values[0]), nil
+	case OpIn:
+		generified := []any{}
+		for _, v := range condition.Values {
+			generified = append(generified, v)
+		}
+		return osquery.Terms(field, generified...), nil
+	case OpExists:
+		return osquery.Exists(field), nil
+	case OpLike:
+		// opensearch wildcard queries support the same wildcards `*` and `?` as the filter DSL
+		return osquery.Wildcard(field, condition.Values[0]), nil
+	case OpLt, OpLte, OpGt, OpGte, OpBetween:
+		rng := osquery.Range(field)
+		for bound, value := range condition.Bounds() {
+			switch bound {
+			case OpLt:
+				rng = rng.Lt(value)
+			case OpLte:
+				rng = rng.Lte(value)
+			case OpGt:
+				rng = rng.Gt(value)
+			case OpGte:
+				rng = rng.Gte(value)
+			}
+		}
+		return rng, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", condition.Operator)
+}
+
+// positionScript returns 1 if the value at the position of the array field matches the condition, otherwise 0
+// The wildcards `*` and `?` of the operator "lk" are matched like by the wildcard query
+const positionScript = `
+boolean like(String s, String p) {
+	int si = 0; int pi = 0; int star = -1; int mark = 0;
+	while (si < s.length()) {
+		if (pi < p.length() && (p.charAt(pi) == (char) '?' || p.charAt(pi) == s.charAt(si))) { si++; pi++; }
+		else if (pi < p.length() && p.charAt(pi) == (char) '*') { star = pi; mark = si; pi++; }
+		else if (star >= 0) { pi = star + 1; mark++; si = mark; }
+		else { return false; }
+	}
+	while (pi < p.length() && p.charAt(pi) == (char) '*') { pi++; }
+	return pi == p.length();
+}
+def values = params['_source'][params.field];
+if (values == null || values.size() < params.position || values[params.position - 1] == null) { return 0; }
+String value = values[params.position - 1].toString();
+if (params.operator == 'exists') { return 1; }
+if (params.operator == 'lk') { return like(value, params.values[0]) ? 1 : 0; }
+return params.values.contains(value) ? 1 : 0;
+`
+
+// positionQuery returns a script_score query matching documents with a value at the position of the array field matching the condition
+// Doc values of arrays are sorted, so the script evaluates the source of the candidates matching the condition at any position
+func positionQuery(condition Condition, candidates osquery.Mappable) (osquery.Mappable, error) {
+	if !slices.Contains(POSITION_OPERATORS, condition.Operator) {
+		return nil, fmt.Errorf("operator %s is not applicable to a position of the field %s", condition.Operator, condition.Field.IndexField)
+	}
+	params := map[string]any{
+		"field":    condition.Field.IndexPath(),
+		"position": condition.Field.Position,
+		"operator": condition.Operator,
+		"values":   condition.Values,
+	}
+	// min_score excludes all documents the script returns 0 for
+	return osquery.CustomQuery(map[string]any{
+		"script_score": map[string]any{
+			"query":     candidates.Map(),
+			"script":    map[string]any{"source": positionScript, "params": params},
+			"min_score": 1,
+		},
+	}), nil
+}
+
+// chemistryQuery returns the osquery.Mappables to add to the opensearch query for the chemistry expressions
+// The expressions are combined from left to right according to their junctors
+func chemistryQuery(expressions []model.CQExpression) ([]osquery.Mappable, error) {
+	var combined osquery.Mappable
+	for i, chemFilter := range expressions {
+		q, err := chemistryExpressionQuery(chemFilter)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 0:
+			combined = q
+		case chemFilter.Junctor == model.CQ_JUNCTOR_OR:
+			combined = osquery.Bool().Should(combined, q).MinimumShouldMatch(1)
+		default:
+			combined = osquery.Bool().Filter(combined, q)
+		}
+	}
+	if combined == nil {
+		return []osquery.Mappable{}, nil
+	}
+	return []osquery.Mappable{combined}, nil
+}
+
+// chemistryExpressionQuery returns the query for a single chemistry expression
+// All conditions of the expression have to match within the same result
+func chemistryExpressionQuery(chemFilter model.CQExpression) (osquery.Mappable, error) {
+	minValue, maxValue, err := ChemistryBounds(chemFilter)
+	if err != nil {
+		return nil, err
+	}
+	if chemFilter.IsRatio() {
+		return ratioQuery(chemFilter, minValue, maxValue), nil
+	}
+	filters := []osquery.Mappable{}
+	rng := osquery.Range(fmt.Sprintf("%s.%s", FIELD_RESULTS, FIELD_VALUE))
+	if chemFilter.MinValue != "" {
+		if chemFilter.MinExclusive {
+			rng = rng.Gt(minValue)
+		} else {
+			rng = rng.Gte(minValue)
+		}
+	}
+	if chemFilter.MaxValue != "" {
+		if chemFilter.MaxExclusive {
+			rng = rng.Lt(maxValue)
+		} else {
+			rng = rng.Lte(maxValue)
+		}
+	}
+	if chemFilter.MinValue != "" || chemFilter.MaxValue != "" {
+		// at least one value is set
+		filters = append(filters, rng)
+	}
+	terms := map[string]string{
+		FIELD_ITEMGROUP: chemFilter.Type,
+		FIELD_ITEMNAME:  chemFilter.Element,
+		FIELD_UNIT:      chemFilter.Unit,
+		FIELD_METHOD:    chemFilter.Method,
+	}
+	for _, field := range []string{FIELD_ITEMGROUP, FIELD_ITEMNAME, FIELD_UNIT, FIELD_METHOD} {
+		if terms[field] != "" {
+			filters = append(filters, osquery.Term(fmt.Sprintf("%s.%s", FIELD_RESULTS, field), terms[field]))
+		}
+	}
+	q := osquery.Bool().Filter(filters...)
+	return osquery.Nested(FIELD_RESULTS, q), nil
+}
+
+// ratioScript calculates the ratio of two elements within each batch of a document
+// and returns 1 if the ratio of any batch is within the bounds, otherwise 0
+const ratioScript = `
+def batches = params['_source']['batchData'];
+if (batches == null) { return 0; }
+for (def batch : batches) {
+	def results = batch['results'];
+	if (results == null) { continue; }
+	Double numerator = null;
+	Double denominator = null;
+	for (def r : results) {
+		if (r['value'] == null) { continue; }
+		if (params.type != null && params.type != r['itemGroup']) { continue; }
+		if (params.unit != null && params.unit != r['unit']) { continue; }
+		if (params.method != null && params.method != r['method']) { continue; }
+		if (r['itemName'] == params.element) { numerator = ((Number) r['value']).doubleValue(); }
+		if (r['itemName'] == params.divisor) { denominator = ((Number) r['value']).doubleValue(); }
+	}
+	if (numerator == null || denominator == null || denominator == 0) { continue; }
+	double ratio = numerator / denominator;
+	boolean aboveMin = params.min == null || ratio > params.min || (!params.minExclusive && ratio == params.min);
+	boolean belowMax = params.max == null || ratio < params.max || (!params.maxExclusive && ratio == params.max);
+	if (aboveMin && belowMax) { return 1; }
+}
+return 0;
+`
+
+// ratioQuery returns a script_score query matching documents with a ratio of two elements in the bounds
+// Nested documents can not be compared with each other, so the script evaluates the source of the documents;
+// only documents holding results of both elements are evaluated
+func ratioQuery(chemFilter model.CQExpression, minValue float64, maxValue float64) osquery.Mappable {
+	params := map[string]any{
+		"element":      chemFilter.Element,
+		"divisor":      chemFilter.Divisor,
+		"minExclusive": chemFilter.MinExclusive,
+		"maxExclusive": chemFilter.MaxExclusive,
+	}
+	optional := map[string]string{"type": chemFilter.Type, "unit": chemFilter.Unit, "method": chemFilter.Method}
+	for k, v := range optional {
+		params[k] = nil
+		if v != "" {
+			params[k] = v
+		}
+	}
+	params["min"] = nil
+	if chemFilter.MinValue != "" {
+		params["min"] = minValue
+	}
+	params["max"] = nil
+	if chemFilter.MaxValue != "" {
+		params["max"] = maxValue
+	}
+	candidates := osquery.Bool().Filter(ratioResultQuery(chemFilter, chemFilter.Element), ratioResultQuery(chemFilter, chemFilter.Divisor))
+	// min_score excludes all documents the script returns 0 for
+	return osquery.CustomQuery(map[string]any{
+		"script_score": map[string]any{
+			"query":     candidates.Map(),
+			"script":    map[string]any{"source": ratioScript, "params": params},
+			"min_score": 1,
+		},
+	})
+}
+
+// ratioResultQuery returns the nested query matching documents with a result of the element of a ratio expression
+func ratioResultQuery(chemFilter model.CQExpression, element string) osquery.Mappable {
+	filters := []osquery.Mappable{osquery.Term(fmt.Sprintf("%s.%s", FIELD_RESULTS, FIELD_ITEMNAME), element)}
+	terms := map[string]string{
+		FIELD_ITEMGROUP: chemFilter.Type,
+		FIELD_UNIT:      chemFilter.Unit,
+		FIELD_METHOD:    chemFilter.Method,
+	}
+	for _, field := range []string{FIELD_ITEMGROUP, FIELD_UNIT, FIELD_METHOD} {
+		if terms[field] != "" {
+			filters = append(filters, osquery.Term(fmt.Sprintf("%s.%s", FIELD_RESULTS, field), terms[field]))
+		}
+	}
+	return osquery.Nested(FIELD_RESULTS, osquery.Bool().Filter(filters...))
+}
+
+// polygonQuery returns a osquery.Mappable for the polygon to add to the opensearch query
+func polygonQuery(shape *Shape) (osquery.Mappable, error) {
+	wrappedPoly, err := WrappedFeature(shape)
+	if err != nil {
+		return nil, err
+	}
+	return osquery.CustomQuery(map[string]any{"geo_shape": map[string]any{FIELD_GEOPOINT: map[string]any{"shape": wrappedPoly.Geometry, "relation": "INTERSECTS"}}}), nil
+}
+
+// nearQuery returns the geo_distance query of the radius filter
+// The distance is geodesic, so the circle wraps around the +/-180 meridian
+func nearQuery(circle *Circle) osquery.Mappable {
+	return osquery.CustomQuery(map[string]any{"geo_distance": map[string]any{
+		"distance":     fmt.Sprintf("%fkm", circle.RadiusKM),
+		FIELD_GEOPOINT: map[string]any{"lat": circle.Center.Y, "lon": circle.Center.X},
+	}})
+}
+
+// geotileQuery returns the geo_bounding_box query of the bounds of the geotile
+func geotileQuery(tile *geometry.Tile) osquery.Mappable {
+	bbox := tile.BBox()
+	return osquery.CustomQuery(map[string]any{"geo_bounding_box": map[string]any{FIELD_GEOPOINT: map[string]any{
+		"top_left":     map[string]any{"lat": bbox[3].Y, "lon": bbox[3].X},
+		"bottom_right": map[string]any{"lat": bbox[1].Y, "lon": bbox[1].X},
+	}}})
+}
+
+// DistanceScriptFields returns the script fields of a search request holding the distance of each hit to the center of the
+// near filter as FIELD_DISTANCE; nil if the filter has no near filter
+func DistanceScriptFields(f Filter) map[string]any {
+	if f.Near == nil {
+		return nil
+	}
+	return map[string]any{FIELD_DISTANCE: map[string]any{"script": map[string]any{
+		"source": fmt.Sprintf("doc['%s'].arcDistance(params.lat, params.lon) / 1000", FIELD_GEOPOINT),
+		"params": map[string]any{"lat": f.Near.Center.Y, "lon": f.Near.Center.X},
+	}}}
+}
+
+// WrappedFeature returns the GeoJSON of the Shape wrapped around the +/-180 meridian
+func WrappedFeature(shape *Shape) (*model.GeoJSONFeature, error) {
+	// imitate a wrap around +/-180 meridian by cutting the original polygon on the crossed boundary and translating the other half into the boundaries
+	return geometry.WrapPolygonLon(shape.Feature)
+}
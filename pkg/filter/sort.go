@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package filter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// Sort orders and special sort keys
+const (
+	SORT_ASC  = "asc"
+	SORT_DESC = "desc"
+
+	// SORT_DISTANCE sorts by the distance from a point given as distance:LON:LAT
+	SORT_DISTANCE = "distance"
+	// SORT_ELEMENT sorts by the value of an element given as element:ELEMENT
+	SORT_ELEMENT = "element"
+	// SORT_SCORE sorts by the relevance of the full text search
+	SORT_SCORE = "score"
+
+	// FIELD_TIEBREAKER is the unique field sorted by last to keep the order of search_after pages stable
+	FIELD_TIEBREAKER = "sampleID"
+)
+
+// SortKey is one key of the sort order of a search
+type SortKey struct {
+	// Field is the sorted field; empty for distance, element and score sorts
+	Field Field
+	// Point is the origin of distance sorts
+	Point *model.SimplePoint
+	// Element is the item name of element sorts
+	Element string
+	// Score marks the relevance sort of full text searches
+	Score bool
+	Order string
+}
+
+// parseSort parses the comma-separated sort keys of the form KEY[:ORDER]
+// where KEY is a field, distance:LON:LAT, element:ELEMENT or score
+func parseSort(v string) ([]SortKey, error) {
+	keys := []SortKey{}
+	for _, part := range strings.Split(v, DELIM) {
+		parts := strings.Split(strings.TrimSpace(part), ":")
+		key := SortKey{Order: SORT_ASC}
+		args := 0
+		switch strings.ToLower(parts[0]) {
+		case SORT_DISTANCE:
+			args = 2
+			if len(parts) < 3 {
+				return nil, fmt.Errorf("distance sort needs a point as distance:LON:LAT")
+			}
+			lon, errLon := strconv.ParseFloat(parts[1], 64)
+			lat, errLat := strconv.ParseFloat(parts[2], 64)
+			if errLon != nil || errLat != nil || lat < -90 || lat > 90 {
+				return nil, fmt.Errorf("invalid point of distance sort %s:%s", parts[1], parts[2])
+			}
+			key.Point = &model.SimplePoint{X: lon, Y: lat}
+		case SORT_ELEMENT:
+			args = 1
+			if len(parts) < 2 || parts[1] == "" {
+				return nil, fmt.Errorf("element sort needs an element as element:ELEMENT")
+			}
+			key.Element = parts[1]
+		case SORT_SCORE:
+			key.Score = true
+			key.Order = SORT_DESC
+		default:
+			field, ok := LookupField(parts[0])
+			if !ok || field.IndexField == "" {
+				return nil, fmt.Errorf("unknown sort field %s", parts[0])
+			}
+			key.Field = field
+		}
+		switch len(parts) - 1 - args {
+		case 0:
+			// default order
+		case 1:
+			order := strings.ToLower(parts[len(parts)-1])
+			if order != SORT_ASC && order != SORT_DESC {
+				return nil, fmt.Errorf("invalid sort order %s", order)
+			}
+			key.Order = order
+		default:
+			return nil, fmt.Errorf("invalid sort key %s", part)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// SortKeys returns the sort keys of the filter completed by the tiebreaker
+// Full text searches are sorted by relevance if no sort is given
+func SortKeys(f Filter) []SortKey {
+	keys := f.Sort
+	if len(keys) == 0 && f.Text != "" {
+		keys = []SortKey{{Score: true, Order: SORT_DESC}}
+	}
+	tiebreaker, _ := LookupField(FIELD_TIEBREAKER)
+	if len(keys) > 0 && keys[len(keys)-1].Field.Name == tiebreaker.Name {
+		return keys
+	}
+	return append(slices.Clip(keys), SortKey{Field: tiebreaker, Order: SORT_ASC})
+}
+
+// ToOpenSearchSort compiles the sort keys of the filter into the sort of a search request
+// Nested fields are sorted by the minimum value for ascending and the maximum value for descending order
+func ToOpenSearchSort(f Filter) []any {
+	sort := []any{}
+	for _, key := range SortKeys(f) {
+		switch {
+		case key.Score:
+			sort = append(sort, map[string]any{"_score": map[string]any{"order": key.Order}})
+		case key.Point != nil:
+			sort = append(sort, map[string]any{"_geo_distance": map[string]any{
+				FIELD_GEOPOINT: map[string]any{"lat": key.Point.Y, "lon": key.Point.X},
+				"order":        key.Order,
+				"unit":         "km",
+			}})
+		case key.Element != "":
+			filter := map[string]any{"term": map[string]any{FIELD_RESULTS + "." + FIELD_ITEMNAME: key.Element}}
+			sort = append(sort, map[string]any{FIELD_RESULTS + "." + FIELD_VALUE: map[string]any{
+				"order":  key.Order,
+				"mode":   sortMode(key.Order),
+				"nested": nestedSort(FIELD_RESULTS, filter),
+			}})
+		case key.Field.NestedPath != "":
+			sort = append(sort, map[string]any{key.Field.NestedPath + "." + key.Field.IndexField: map[string]any{
+				"order":  key.Order,
+				"mode":   sortMode(key.Order),
+				"nested": nestedSort(key.Field.NestedPath, nil),
+			}})
+		default:
+			sort = append(sort, map[string]any{key.Field.IndexField: map[string]any{"order": key.Order}})
+		}
+	}
+	return sort
+}
+
+// sortMode returns the mode to pick the sort value of multi-valued fields
+func sortMode(order string) string {
+	if order == SORT_DESC {
+		return "max"
+	}
+	return "min"
+}
+
+// nestedSort returns the nested sort of a nested path with each level of multi-level nested paths
+// The filter selects the nested objects of the innermost level; nil for no filter
+func nestedSort(nestedPath string, filter map[string]any) map[string]any {
+	levels := strings.Split(nestedPath, ".")
+	var nested map[string]any
+	for i := len(levels); i > 0; i-- {
+		level := map[string]any{"path": strings.Join(levels[:i], ".")}
+		if nested != nil {
+			level["nested"] = nested
+		} else if filter != nil {
+			level["filter"] = filter
+		}
+		nested = level
+	}
+	return nested
+}
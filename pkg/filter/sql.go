@@ -0,0 +1,420 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package filter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/sql"
+)
+
+// sqlGroup holds the sql blocks opening and closing the sub query of a Group
+type sqlGroup struct {
+	start string
+	end   string
+	// rows selects the rows of the sub query without opening it; id is the column of the sample ids selected by rows
+	rows string
+	id   string
+}
+
+// sqlGroups maps the groups to their sub queries in the order they are added to the query
+var sqlGroups = []struct {
+	group Group
+	sqlGroup
+}{
+	{GroupAnnotations, sqlGroup{sql.GetSamplingfeatureIdsByFilterAnnotationsStart, sql.GetSamplingfeatureIdsByFilterAnnotationsEnd, sql.GetSamplingfeatureIdsByFilterAnnotationsSelect, "sampleid"}},
+	{GroupTaxonomicClassifiers, sqlGroup{sql.GetSamplingfeatureIdsByFilterTaxonomicClassifiersStart, sql.GetSamplingfeatureIdsByFilterTaxonomicClassifiersEnd, sql.GetSamplingfeatureIdsByFilterTaxonomicClassifiersSelect, "samplingfeatureid"}},
+	{GroupLocations, sqlGroup{sql.GetSamplingfeatureIdsByFilterLocationsStart, sql.GetSamplingfeatureIdsByFilterLocationsEnd, sql.GetSamplingfeatureIdsByFilterLocationsSelect, "sample"}},
+	{GroupResults, sqlGroup{}},
+	{GroupCitations, sqlGroup{sql.GetSamplingfeatureIdsByFilterCitationsStart, sql.GetSamplingfeatureIdsByFilterCitationsEnd, sql.GetSamplingfeatureIdsByFilterCitationsSelect, "samplingfeatureid"}},
+	{GroupAges, sqlGroup{sql.GetSamplingfeatureIdsByFilterAgesStart, sql.GetSamplingfeatureIdsByFilterAgesEnd, sql.GetSamplingfeatureIdsByFilterAgesSelect, "samplingfeatureid"}},
+	{GroupOrganizations, sqlGroup{sql.GestSamplingfeatureIdsByFilterOrganizationsStart, sql.GestSamplingfeatureIdsByFilterOrganizationsEnd, sql.GestSamplingfeatureIdsByFilterOrganizationsSelect, "sid"}},
+}
+
+// sqlOperators maps the Filter DSL operators to sql operators
+var sqlOperators = map[Operator]sql.FilterOperator{
+	OpEq:      sql.OpEq,
+	OpIn:      sql.OpIn,
+	OpLt:      sql.OpLt,
+	OpLte:     sql.OpLte,
+	OpGt:      sql.OpGt,
+	OpGte:     sql.OpGte,
+	OpLike:    sql.OpLike,
+	OpBetween: sql.OpBetween,
+	OpExists:  sql.OpNotNull,
+}
+
+// ToSQL compiles the Filter into a sql.Query selecting the samplingfeatureIDs of all matching samples
+// Conditions and disjunctions are evaluated on the rows of the sub query of their group,
+// so all conditions of a disjunction have to belong to the same group
+// Negated conditions and disjunctions holding them are evaluated per sample like must_not of the search index:
+// a sample is excluded if any of its rows matches the positive condition
+func ToSQL(f Filter) (*sql.Query, error) {
+	if f.Text != "" {
+		return nil, fmt.Errorf("full text search %s is not supported by this endpoint", KEY_TEXT)
+	}
+	if len(f.Sort) > 0 {
+		return nil, fmt.Errorf("%s is not supported by this endpoint", KEY_SORT)
+	}
+	for _, condition := range f.Conditions {
+		if condition.Field.Column == "" {
+			return nil, fmt.Errorf("filter %s is not supported by this endpoint", condition.Field.Name)
+		}
+	}
+	disjunctionGroups := make([]Group, 0, len(f.Disjunctions))
+	for _, disjunction := range f.Disjunctions {
+		group, err := sqlDisjunctionGroup(disjunction)
+		if err != nil {
+			return nil, err
+		}
+		disjunctionGroups = append(disjunctionGroups, group)
+	}
+	query := sql.NewQuery(sql.GetSamplingfeatureIdsByFilterBaseQuery)
+	var bboxBoundary, bboxFactor float64
+	if f.BBox != nil {
+		if len(f.BBox.Points) == 0 {
+			return nil, fmt.Errorf("bbox must be given as point array")
+		}
+		var err error
+		bboxBoundary, bboxFactor, err = geometry.CalcTranslation(f.BBox.Points)
+		if err != nil {
+			return nil, fmt.Errorf("can not calculate bbox translation: %w", err)
+		}
+		query = sql.NewQuery("")
+		params := map[string]interface{}{
+			"translationFactor": -bboxFactor,
+		}
+		query.AddSQLBlockParametrized(sql.GetSamplingFeatureIdsByFilteBaseQueryTranslated, params)
+	}
+
+	numNegations := 0
+	for _, g := range sqlGroups {
+		if g.group == GroupResults {
+			err := addChemistrySQL(query, f.Chemistry)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		conditions := []Condition{}
+		negated := []Condition{}
+		for _, condition := range f.Conditions {
+			if condition.Field.Group != g.group {
+				continue
+			}
+			if isNegated(condition) {
+				negated = append(negated, condition)
+				continue
+			}
+			conditions = append(conditions, condition)
+		}
+		// keep the order of the registry for stable queries
+		byRegistry := func(a, b Condition) int {
+			return a.Field.index() - b.Field.index()
+		}
+		slices.SortStableFunc(conditions, byRegistry)
+		slices.SortStableFunc(negated, byRegistry)
+		// negations are evaluated per sample in separate sub queries
+		negations := [][]Condition{}
+		for _, condition := range negated {
+			negations = append(negations, []Condition{condition})
+		}
+		disjunctions := [][]Condition{}
+		for i, disjunction := range f.Disjunctions {
+			if disjunctionGroups[i] != g.group {
+				continue
+			}
+			if slices.ContainsFunc(disjunction, isNegated) {
+				negations = append(negations, disjunction)
+				continue
+			}
+			disjunctions = append(disjunctions, disjunction)
+		}
+		for _, disjunction := range negations {
+			numNegations++
+			err := addSQLNegation(query, g.sqlGroup, disjunction, fmt.Sprintf("neg%d", numNegations))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(conditions) == 0 && len(disjunctions) == 0 {
+			continue
+		}
+		query.AddSQLBlock(g.start)
+		// add additional sub-modules of the filtered fields
+		joins := []string{}
+		for _, condition := range slices.Concat(append(disjunctions, conditions)...) {
+			if condition.Field.Join != "" && !slices.Contains(joins, condition.Field.Join) {
+				joins = append(joins, condition.Field.Join)
+				query.AddSQLBlock(condition.Field.Join)
+			}
+		}
+		junctor := sql.OpWhere // junctor to connect a new filter clause to the query: can be "WHERE" or "AND/OR"
+		for _, condition := range conditions {
+			err := addSQLCondition(query, condition, junctor)
+			if err != nil {
+				return nil, err
+			}
+			junctor = sql.OpAnd // after first filter is added with "WHERE", change to "AND" for following filters
+		}
+		for _, disjunction := range disjunctions {
+			query.OpenFilterGroup(junctor)
+			disjunctor := sql.OpNone
+			for _, condition := range disjunction {
+				err := addSQLCondition(query, condition, disjunctor)
+				if err != nil {
+					return nil, err
+				}
+				disjunctor = sql.OpOr
+			}
+			query.CloseFilterGroup()
+			junctor = sql.OpAnd
+		}
+		query.AddSQLBlock(g.end)
+	}
+
+	// Geometries
+	junctor := sql.OpWhere // reset junctor for new subquery
+	if f.Polygon != nil || f.BBox != nil || f.Near != nil || f.Region != nil || f.Geotile != nil {
+		// add query module geometry
+		if f.BBox != nil {
+			// format bbox string for postGIS/SQL syntax
+			bboxFormatted, err := geometry.FormatPolygonArray(f.BBox.Points)
+			if err != nil {
+				return nil, err
+			}
+			params := map[string]interface{}{
+				"bboxPolygon": fmt.Sprintf("POLYGON(%s)", bboxFormatted),
+			}
+			query.AddSQLBlockParametrized(sql.GestSamplingfeatureIdsByFilterGeometryBBOXStart, params)
+			query.AddInTranslatedPolygonFilter("sg.geometry", bboxFormatted, junctor, bboxBoundary, bboxFactor)
+			junctor = sql.OpAnd
+		} else {
+			// if no bbox is supplied, use filter block without bbox check
+			query.AddSQLBlock(sql.GestSamplingfeatureIdsByFilterGeometryStart)
+		}
+		shapes := []*Shape{f.Polygon, f.Region}
+		if f.Geotile != nil {
+			shapes = append(shapes, ShapeFromPoints(f.Geotile.BBox()))
+		}
+		for _, shape := range shapes {
+			if shape == nil {
+				continue
+			}
+			err := addPolygonSQL(query, shape, junctor)
+			if err != nil {
+				return nil, err
+			}
+			junctor = sql.OpAnd
+		}
+		if f.Near != nil {
+			query.AddWithinDistanceFilter("sg.geometry", f.Near.Center.X, f.Near.Center.Y, f.Near.RadiusKM*1000, junctor)
+		}
+		query.AddSQLBlock(sql.GestSamplingfeatureIdsByFilterGeometryEnd)
+	}
+
+	// coordinates
+	// add query module coordinates
+	query.AddSQLBlock(sql.GetGestSamplingfeatureIdsByFilterCoordinates)
+
+	return query, nil
+}
+
+// addSQLCondition adds the filter of a positive Condition to the query
+func addSQLCondition(query *sql.Query, condition Condition, junctor sql.FilterJunctor) error {
+	operator, value, err := sqlCondition(condition)
+	if err != nil {
+		return err
+	}
+	query.AddFilter(condition.Field.Column, value, operator, junctor)
+	return nil
+}
+
+// addSQLNegation adds the sub query of the samples matching the disjunction of the conditions of the group
+// A positive condition matches samples with a matching row, a negated condition samples without a row matching its positive condition
+func addSQLNegation(query *sql.Query, g sqlGroup, disjunction []Condition, alias string) error {
+	query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterNegationStart)
+	query.OpenFilterGroup(sql.OpWhere)
+	junctor := sql.OpNone
+	for _, condition := range disjunction {
+		positive, negated := condition.Positive()
+		operator := "IN"
+		if negated {
+			operator = "NOT IN"
+		}
+		query.AddSQLBlock(fmt.Sprintf("%s sf.samplingfeatureid %s (select matched.%s from (", junctor, operator, g.id))
+		query.AddSQLBlock(g.rows)
+		if positive.Field.Join != "" {
+			query.AddSQLBlock(positive.Field.Join)
+		}
+		err := addSQLCondition(query, positive, sql.OpWhere)
+		if err != nil {
+			return err
+		}
+		// NOT IN matches nothing if the ids contain NULL
+		query.AddSQLBlock(fmt.Sprintf(") matched where matched.%s is not null)", g.id))
+		junctor = sql.OpOr
+	}
+	query.CloseFilterGroup()
+	query.AddSQLBlock(fmt.Sprintf(") %s on %s.samplingfeatureid = spec.sampleid", alias, alias))
+	return nil
+}
+
+// isNegated returns whether the condition is a negation of another operator
+func isNegated(condition Condition) bool {
+	_, negated := condition.Positive()
+	return negated
+}
+
+// sqlDisjunctionGroup returns the Group all conditions of the disjunction belong to
+func sqlDisjunctionGroup(disjunction []Condition) (Group, error) {
+	group := GroupNone
+	for _, condition := range disjunction {
+		if condition.Field.Column == "" {
+			return GroupNone, fmt.Errorf("filter %s is not supported by this endpoint", condition.Field.Name)
+		}
+		if group != GroupNone && condition.Field.Group != group {
+			return GroupNone, fmt.Errorf("disjunctions of filters on different tables are not supported by this endpoint")
+		}
+		group = condition.Field.Group
+	}
+	return group, nil
+}
+
+// sqlCondition returns the sql operator and the value string of a Condition
+func sqlCondition(condition Condition) (sql.FilterOperator, string, error) {
+	operator, ok := sqlOperators[condition.Operator]
+	if !ok {
+		return "", "", fmt.Errorf("unknown operator %s", condition.Operator)
+	}
+	value := strings.Join(condition.Values, sql.SEPARATOR)
+	if operator == sql.OpLike {
+		// replace url-compatible wildcards with sql wildcards
+		value = strings.ReplaceAll(value, "*", "%")
+		value = strings.ReplaceAll(value, "?", "_")
+	}
+	if condition.Field.Array {
+		// we compare to arrays here, so we need to adapt the filters
+		arrayOp, err := sql.MapArrayOperators(operator)
+		if err != nil {
+			return "", "", fmt.Errorf("filter %s: %w", condition.Field.Name, err)
+		}
+		operator = arrayOp
+	}
+	return operator, value, nil
+}
+
+// addChemistrySQL adds the sub query for the chemistry expressions to the query
+func addChemistrySQL(query *sql.Query, expressions []model.CQExpression) error {
+	if len(expressions) == 0 {
+		return nil
+	}
+	// add query module results
+	mvIDList := ""
+	for i := range expressions {
+		if i > 0 {
+			mvIDList += ","
+		}
+		mvIDList += fmt.Sprintf("m%d.sampleid", i+1)
+	}
+	query.AddSQLBlock(fmt.Sprintf("%s%s%s", sql.GetSamplingfeatureIdsByFilterResultsStartPre, mvIDList, sql.GetSamplingfeatureIdsByFilterResultsStartPost))
+	// add ResultFilterExpression for each expression
+	for i, expr := range expressions {
+		junctor := sql.OpWhere // reset junctor for new expression
+		exprJunctor, exists := model.CQSQLMap[expr.Junctor]
+		if !exists {
+			return fmt.Errorf("Invalid junctor in chemical query")
+		}
+		// units and methods are only available for the measured values
+		measured := expr.Unit != "" || expr.Method != ""
+		if measured {
+			query.AddSQLBlock(exprJunctor + sql.GetSamplingfeatureIdsByFilterResultsMeasuredExpression)
+		} else {
+			query.AddSQLBlock(exprJunctor + sql.GetSamplingfeatureIdsByFilterResultsExpression)
+		}
+		// the value is compared against the ratio of both elements for ratio expressions
+		value := "n.datavalue"
+		tables := []string{"n"}
+		if expr.IsRatio() {
+			if measured {
+				query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterResultsMeasuredRatioJoin)
+			} else {
+				query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterResultsRatioJoin)
+			}
+			value = "n.datavalue / nullif(d.datavalue, 0)"
+			tables = append(tables, "d")
+		}
+		for _, table := range tables {
+			if expr.Type != "" {
+				query.AddFilter(table+".variabletypecode", expr.Type, sql.OpEq, junctor)
+				junctor = sql.OpAnd
+			}
+			if expr.Unit != "" {
+				query.AddFilter(table+".unitgeoroc", expr.Unit, sql.OpEq, junctor)
+				junctor = sql.OpAnd
+			}
+			if expr.Method != "" {
+				query.AddFilter(table+".methodcode", expr.Method, sql.OpEq, junctor)
+				junctor = sql.OpAnd
+			}
+		}
+		if expr.Element != "" {
+			query.AddFilter("upper(n.variablecode)", expr.Element, sql.OpEq, junctor)
+			junctor = sql.OpAnd
+		}
+		if expr.IsRatio() {
+			query.AddFilter("upper(d.variablecode)", expr.Divisor, sql.OpEq, junctor)
+			junctor = sql.OpAnd
+		}
+		if expr.MinValue != "" {
+			operator := sql.OpGte
+			if expr.MinExclusive {
+				operator = sql.OpGt
+			}
+			query.AddFilter(value, expr.MinValue, operator, junctor)
+			junctor = sql.OpAnd
+		}
+		if expr.MaxValue != "" {
+			operator := sql.OpLte
+			if expr.MaxExclusive {
+				operator = sql.OpLt
+			}
+			query.AddFilter(value, expr.MaxValue, operator, junctor)
+		}
+		if i == 0 {
+			query.AddSQLBlock(fmt.Sprintf(") m%d", i+1))
+			continue
+		}
+		// join on the batch of any of the preceding expressions as they can be missing for disjunctions
+		previous := make([]string, i)
+		for j := range previous {
+			previous[j] = fmt.Sprintf("m%d.samplingfeatureid", j+1)
+		}
+		query.AddSQLBlock(fmt.Sprintf(") m%d on m%d.samplingfeatureid = coalesce(%s)", i+1, i+1, strings.Join(previous, ",")))
+	}
+	// add closing block for results
+	query.AddSQLBlock(sql.GetSamplingfeatureIdsByFilterResultsEnd)
+	return nil
+}
+
+// addPolygonSQL adds the filter of a polygon Shape to the geometry sub query
+// The polygon is split on the +/-180 meridian like for the search index and keeps its holes
+func addPolygonSQL(query *sql.Query, shape *Shape, junctor sql.FilterJunctor) error {
+	wrapped, err := WrappedFeature(shape)
+	if err != nil {
+		return fmt.Errorf("can not wrap polygon - polygon too big: %w", err)
+	}
+	// format polygon for postGIS/SQL syntax
+	polygonWKT, err := geometry.FormatMultiPolygonWKT(*wrapped)
+	if err != nil {
+		return err
+	}
+	query.AddInWKTFilter("sg.geometry", polygonWKT, junctor)
+	return nil
+}
@@ -8,7 +8,10 @@
 package geometry
 
 import (
+	"fmt"
 	"math"
+	"strconv"
+	"strings"
 
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
 )
@@ -77,3 +80,59 @@ func TruncateBBox(bbox []model.SimplePoint) []model.SimplePoint {
 	bbox[3].Y = math.Min(bbox[3].Y, middleLat+LAT_MAX)
 	return bbox
 }
+
+// ParseCoordinateBBox parses a bbox formatted as MINLON,MINLAT,MAXLON,MAXLAT like the bbox of OGC API Features
+// A bbox with six values holds the minimum and maximum height as third and sixth value, which are ignored
+// If MINLON is greater than MAXLON the bbox crosses the antimeridian and the eastern longitude is shifted by 360
+// Returns the bbox formatted [SW, SE, NE, NW]
+func ParseCoordinateBBox(v string) ([]model.SimplePoint, error) {
+	parts := strings.Split(v, ",")
+	if len(parts) != 4 && len(parts) != 6 {
+		return nil, fmt.Errorf("bbox %s must have 4 or 6 values", v)
+	}
+	values := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("can not parse bbox %s: %w", v, err)
+		}
+		values = append(values, value)
+	}
+	if len(values) == 6 {
+		values = []float64{values[0], values[1], values[3], values[4]}
+	}
+	west, south, east, north := values[0], values[1], values[2], values[3]
+	if outOfBounds(west) || outOfBounds(east) || south < LAT_MIN || north > LAT_MAX || south > north {
+		return nil, fmt.Errorf("bbox %s out of bounds", v)
+	}
+	if west > east {
+		east += 2 * LONG_MAX
+	}
+	return []model.SimplePoint{
+		{X: west, Y: south},
+		{X: east, Y: south},
+		{X: east, Y: north},
+		{X: west, Y: north},
+	}, nil
+}
+
+// NormalizeBBox returns the bbox formatted [SW, SE, NE, NW] with its western longitude translated into -180 to 180
+// The width is kept up to one whole world, so the eastern longitude exceeds 180 if the bbox crosses the antimeridian
+func NormalizeBBox(bbox []model.SimplePoint) []model.SimplePoint {
+	west := bbox[0].X
+	width := math.Min(bbox[1].X-west, 2*LONG_MAX)
+	if width == 2*LONG_MAX {
+		west = LONG_MIN
+	} else {
+		west = TranslateLon(west)
+	}
+	east := west + width
+	south := math.Max(bbox[0].Y, LAT_MIN)
+	north := math.Min(bbox[3].Y, LAT_MAX)
+	return []model.SimplePoint{
+		{X: west, Y: south},
+		{X: east, Y: south},
+		{X: east, Y: north},
+		{X: west, Y: north},
+	}
+}
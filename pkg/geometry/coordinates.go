@@ -121,6 +121,23 @@ func WrapPolygonLon(polygon model.GeoJSONFeature) (*model.GeoJSONFeature, error)
 		}
 		return &polygon, nil
 	}
+	// handle polygons keeping the interior rings with their exterior ring
+	if polygon.Geometry.Type == model.GEOJSON_GEOMETRY_POLYGON || polygon.Geometry.Type == model.GEOJSON_GEOMETRY_MULTIPOLYGON {
+		polygons, err := GetPolygonRings(&polygon.Geometry)
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := wrapPolygonRings(polygons)
+		if err != nil {
+			return nil, err
+		}
+		multi := ParseMultiPolygonRings(wrapped)
+		bm, _ := json.Marshal(multi)
+		orig, _ := json.Marshal(polygon)
+		fmt.Printf("Original polygon:\n%+v\n", string(orig))
+		fmt.Printf("Multipolygon:\n%+v\n", string(bm))
+		return &multi, nil
+	}
 	// handle complex shapes that need cutting
 	shapes, err := GetSimplePointShapes(&polygon.Geometry)
 	if err != nil {
@@ -151,36 +168,50 @@ func WrapPolygonLon(polygon model.GeoJSONFeature) (*model.GeoJSONFeature, error)
 	return &multi, nil
 }
 
+// wrapPolygonRings cuts the polygons given as rings on the crossed +-180 boundary and translates the cut off part into the boundaries
+// The interior rings are cut and translated with the exterior ring of their polygon; rings that are completely cut off are dropped
+func wrapPolygonRings(polygons [][][]model.SimplePoint) ([][][]model.SimplePoint, error) {
+	wrapped := [][][]model.SimplePoint{}
+	for _, rings := range polygons {
+		_, factor, err := CalcTranslation(rings[0])
+		if err != nil {
+			return nil, err
+		}
+		if factor == 0 {
+			// polygon is within bounds, so leave it as-is
+			wrapped = append(wrapped, rings)
+			continue
+		}
+		for _, f := range []float64{0, factor} {
+			part := [][]model.SimplePoint{}
+			for i, ring := range rings {
+				cut := cutPolygon(translatePolygonLon(ring, f))
+				if len(cut) < 3 {
+					if i == 0 {
+						// the exterior ring lies completely on the other side of the boundary
+						break
+					}
+					continue
+				}
+				part = append(part, cut)
+			}
+			if len(part) > 0 {
+				wrapped = append(wrapped, part)
+			}
+		}
+	}
+	return wrapped, nil
+}
+
 // ParseMultiPolygon takes a list of polygons in the form of lists of model.SimplePoint and parses them as GeoJSON Multipolygon/MultiLineString
 func ParseMultiPolygon(featureType model.GeoJSONGeometryType, parts [][]model.SimplePoint) model.GeoJSONFeature {
 	if featureType == model.GEOJSON_GEOMETRY_MULTIPOLYGON || featureType == model.GEOJSON_GEOMETRY_POLYGON {
-		// close shapes
-		for i, part := range parts {
-			if !IsClosed(part) {
-				part = append(part, part[0])
-				parts[i] = part
-			}
-		}
-		polygons := []any{}
+		// each part is a polygon without interior rings
+		polygons := make([][][]model.SimplePoint, 0, len(parts))
 		for _, part := range parts {
-			// polygons can contain multiple shapes
-			shapes := []any{}
-			// a shape is a set of coordinate-tuples
-			shape := []any{}
-			for _, point := range part {
-				shape = append(shape, []any{point.X, point.Y})
-			}
-			shapes = append(shapes, shape)
-			// add polygon to multipolygon
-			polygons = append(polygons, shapes)
-		}
-		return model.GeoJSONFeature{
-			Type: model.GEOJSONTYPE_FEATURE,
-			Geometry: model.Geometry{
-				Type:        model.GEOJSON_GEOMETRY_MULTIPOLYGON,
-				Coordinates: polygons,
-			},
+			polygons = append(polygons, [][]model.SimplePoint{part})
 		}
+		return ParseMultiPolygonRings(polygons)
 	}
 	if featureType == model.GEOJSON_GEOMETRY_LINESTRING || featureType == model.GEOJSON_GEOMETRY_MULTILINESTRING {
 		lines := []any{}
@@ -202,6 +233,37 @@ func ParseMultiPolygon(featureType model.GeoJSONGeometryType, parts [][]model.Si
 	return model.GeoJSONFeature{Type: "UNSUPPORTED TYPE"}
 }
 
+// ParseMultiPolygonRings takes a list of polygons in the form of lists of rings and parses them as GeoJSON MultiPolygon
+// The first ring of each polygon is the exterior ring, all following rings are holes
+func ParseMultiPolygonRings(polygons [][][]model.SimplePoint) model.GeoJSONFeature {
+	coordinates := []any{}
+	for _, rings := range polygons {
+		// polygons can contain multiple shapes
+		shapes := []any{}
+		for _, ring := range rings {
+			// close shapes
+			if !IsClosed(ring) {
+				ring = append(ring, ring[0])
+			}
+			// a shape is a set of coordinate-tuples
+			shape := []any{}
+			for _, point := range ring {
+				shape = append(shape, []any{point.X, point.Y})
+			}
+			shapes = append(shapes, shape)
+		}
+		// add polygon to multipolygon
+		coordinates = append(coordinates, shapes)
+	}
+	return model.GeoJSONFeature{
+		Type: model.GEOJSONTYPE_FEATURE,
+		Geometry: model.Geometry{
+			Type:        model.GEOJSON_GEOMETRY_MULTIPOLYGON,
+			Coordinates: coordinates,
+		},
+	}
+}
+
 // ParsePolygon takes a polygon as a list of model.SimplePoints and parses it as a GeoJSON Polygon
 func ParsePolygon(polygon []model.SimplePoint) model.GeoJSONFeature {
 	coordinates := []any{}
@@ -222,7 +284,7 @@ func ParsePolygon(polygon []model.SimplePoint) model.GeoJSONFeature {
 }
 
 // GetSimplePointShapes gather coordinates as collection of model.SimplePoint arrays - this can be a line, polygon or multi-feature
-// Note: Polygons consisting of multiple shapes that are semantically subtracted are not supported yet
+// Note: the rings of polygons are returned as separate shapes - use GetPolygonRings to keep the holes with their polygon
 func GetSimplePointShapes(geom *model.Geometry) ([][]model.SimplePoint, error) {
 	shapes := [][]model.SimplePoint{}
 	if len(geom.Coordinates) == 0 {
@@ -312,6 +374,61 @@ func GetSimplePointShapes(geom *model.Geometry) ([][]model.SimplePoint, error) {
 	return nil, fmt.Errorf("unsupported GeoJSON Type: %s", geom.Type)
 }
 
+// GetPolygonRings gathers the coordinates of a Polygon or MultiPolygon as list of polygons holding their rings as model.SimplePoint arrays
+// The first ring of each polygon is the exterior ring, all following rings are holes
+func GetPolygonRings(geom *model.Geometry) ([][][]model.SimplePoint, error) {
+	switch geom.Type {
+	case model.GEOJSON_GEOMETRY_POLYGON:
+		rings, err := GetSimplePointShapes(geom)
+		if err != nil {
+			return nil, err
+		}
+		if len(rings) == 0 {
+			return nil, fmt.Errorf("GeoJSON Polygon without rings")
+		}
+		return [][][]model.SimplePoint{rings}, nil
+	case model.GEOJSON_GEOMETRY_MULTIPOLYGON:
+		polygons := make([][][]model.SimplePoint, 0, len(geom.Coordinates))
+		for i, p := range geom.Coordinates {
+			polygon, ok := p.([]any)
+			if !ok {
+				return nil, fmt.Errorf("invalid GeoJSON Multi polygon type: %T", geom.Coordinates[i])
+			}
+			rings, err := GetPolygonRings(&model.Geometry{Type: model.GEOJSON_GEOMETRY_POLYGON, Coordinates: polygon})
+			if err != nil {
+				return nil, err
+			}
+			polygons = append(polygons, rings...)
+		}
+		return polygons, nil
+	}
+	return nil, fmt.Errorf("unsupported GeoJSON Type for polygon rings: %s", geom.Type)
+}
+
+// ContainsPoint returns whether the given point lies within the (multi-)polygon geometry of the feature
+// The rings of the polygon are evaluated with the even-odd rule, so interior rings are treated as holes
+func ContainsPoint(polygon model.GeoJSONFeature, point model.SimplePoint) (bool, error) {
+	if polygon.Geometry.Type != model.GEOJSON_GEOMETRY_POLYGON && polygon.Geometry.Type != model.GEOJSON_GEOMETRY_MULTIPOLYGON {
+		return false, fmt.Errorf("unsupported GeoJSON Type for point containment: %s", polygon.Geometry.Type)
+	}
+	shapes, err := GetSimplePointShapes(&polygon.Geometry)
+	if err != nil {
+		return false, err
+	}
+	inside := false
+	for _, shape := range shapes {
+		for i := range shape {
+			// compare each edge of the ring with a horizontal ray from the point
+			p1 := shape[i]
+			p2 := shape[(i+1)%len(shape)]
+			if (p1.Y > point.Y) != (p2.Y > point.Y) && point.X < (p2.X-p1.X)*(point.Y-p1.Y)/(p2.Y-p1.Y)+p1.X {
+				inside = !inside
+			}
+		}
+	}
+	return inside, nil
+}
+
 // cutGeometry cuts the given geometry based on its type
 func cutGeometry(polygon []model.SimplePoint, typ model.GeoJSONGeometryType) []model.SimplePoint {
 	if typ == model.GEOJSON_GEOMETRY_LINESTRING || typ == model.GEOJSON_GEOMETRY_MULTILINESTRING {
@@ -357,7 +474,7 @@ func cutPolygon(polygon []model.SimplePoint) []model.SimplePoint {
 		}
 	}
 	// close polygon again
-	if wasClosed && !IsClosed(partial) {
+	if wasClosed && len(partial) > 0 && !IsClosed(partial) {
 		partial = append(partial, partial[0])
 	}
 	return partial
@@ -421,6 +538,13 @@ func IsClosed(polygon []model.SimplePoint) bool {
 	return polygon[0].X == polygon[lastPos].X && polygon[0].Y == polygon[lastPos].Y
 }
 
+// DistanceKM returns the geodesic distance between two points in kilometers
+func DistanceKM(p1 model.SimplePoint, p2 model.SimplePoint) float64 {
+	var dist float64
+	geodesic.WGS84.Inverse(p1.Y, p1.X, p2.Y, p2.X, &dist, nil, nil)
+	return dist / 1000
+}
+
 // translatePolygonLon translates a polygon in longitudinal direction by a multiple of +/-360 degrees longitude given by the calculated factor
 // So any vertices that are outside the bounds in the orignal polygon are now inside the bounds in the translated copy (and ones that were within the bounds are pushed out on the other side)
 func translatePolygonLon(polygon []model.SimplePoint, factor float64) []model.SimplePoint {
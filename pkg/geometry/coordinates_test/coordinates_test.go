@@ -6,8 +6,12 @@ package coordinates_test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
@@ -413,3 +417,360 @@ func TestGeoJSONPolygons(t *testing.T) {
 		}
 	}
 }
+
+func TestWrapPolygonWithHole(t *testing.T) {
+	// rectangle across the antimeridian with a hole on each side
+	polygon, err := geometry.ParseGeoJSONArea([]byte(`{"type":"Polygon","coordinates":[
+		[[170,-10],[190,-10],[190,10],[170,10],[170,-10]],
+		[[172,-2],[174,-2],[174,2],[172,2],[172,-2]],
+		[[184,-2],[186,-2],[186,2],[184,2],[184,-2]]
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := geometry.WrapPolygonLon(polygon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	polygons, err := geometry.GetPolygonRings(&wrapped.Geometry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each half keeps the hole on its side of the antimeridian
+	if len(polygons) != 2 || len(polygons[0]) != 2 || len(polygons[1]) != 2 {
+		t.Fatalf("Expected 2 polygons with one hole each but got %v", polygons)
+	}
+	if polygons[1][1][0].X != -176 {
+		t.Fatalf("Expected translated hole starting at -176 but got %v", polygons[1][1])
+	}
+	for _, test := range []struct {
+		point    model.SimplePoint
+		expected bool
+	}{
+		{model.SimplePoint{X: 171, Y: 0}, true},
+		{model.SimplePoint{X: 173, Y: 0}, false},
+		{model.SimplePoint{X: -178, Y: 0}, true},
+		{model.SimplePoint{X: -175, Y: 0}, false},
+	} {
+		inside, err := geometry.ContainsPoint(*wrapped, test.point)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inside != test.expected {
+			t.Fatalf("Point: %v | Output: %t | Expected: %t", test.point, inside, test.expected)
+		}
+	}
+	wkt, err := geometry.FormatMultiPolygonWKT(*wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "MULTIPOLYGON(((170.000000 -10.000000,180.000000 -10.000000,180.000000 10.000000,170.000000 10.000000,170.000000 -10.000000)," +
+		"(172.000000 -2.000000,174.000000 -2.000000,174.000000 2.000000,172.000000 2.000000,172.000000 -2.000000))," +
+		"((-180.000000 -10.000000,-170.000000 -10.000000,-170.000000 10.000000,-180.000000 10.000000,-180.000000 -10.000000)," +
+		"(-176.000000 -2.000000,-174.000000 -2.000000,-174.000000 2.000000,-176.000000 2.000000,-176.000000 -2.000000)))"
+	if wkt != expected {
+		t.Fatalf("Expected:\n%s\n but got:\n%s", expected, wkt)
+	}
+}
+
+func TestParseGeoJSONArea(t *testing.T) {
+	b, err := os.ReadFile("./polygons/multipoly_NZ.geojson")
+	if err != nil {
+		t.Fatalf("Can not read file: %s", err.Error())
+	}
+	feature, err := geometry.ParseGeoJSONArea(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feature.Geometry.Type != model.GEOJSON_GEOMETRY_MULTIPOLYGON || len(feature.Geometry.Coordinates) != 24 {
+		t.Fatalf("Expected MultiPolygon of 24 polygons but got %s of %d", feature.Geometry.Type, len(feature.Geometry.Coordinates))
+	}
+	// the polygons of multiple features are merged
+	collection := `{"type":"FeatureCollection","features":[
+		{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}},
+		{"type":"Feature","geometry":{"type":"MultiPolygon","coordinates":[[[[2,2],[3,2],[3,3],[2,2]]],[[[4,4],[5,4],[5,5],[4,4]]]]}}
+	]}`
+	feature, err = geometry.ParseGeoJSONArea([]byte(collection))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feature.Geometry.Type != model.GEOJSON_GEOMETRY_MULTIPOLYGON || len(feature.Geometry.Coordinates) != 3 {
+		t.Fatalf("Expected MultiPolygon of 3 polygons but got %s of %d", feature.Geometry.Type, len(feature.Geometry.Coordinates))
+	}
+	for _, invalid := range []string{
+		`{"type":"Point","coordinates":[1,2]}`,
+		`{"type":"Feature","geometry":{"type":"LineString","coordinates":[[0,0],[1,1]]}}`,
+		`{"type":"FeatureCollection","features":[]}`,
+	} {
+		if _, err := geometry.ParseGeoJSONArea([]byte(invalid)); err == nil {
+			t.Fatalf("Input: %s | Expected error but got nil", invalid)
+		}
+	}
+}
+
+func TestRepairPolygon(t *testing.T) {
+	// unclosed clockwise ring with a duplicate vertex
+	polygon, err := geometry.ParseGeoJSONArea([]byte(`{"type":"Polygon","coordinates":[[[0,0],[0,10],[0,10],[10,10],[10,0]]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repaired, err := geometry.RepairPolygon(polygon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[[[0 0] [10 0] [10 10] [0 10] [0 0]]]"
+	if repaired.Geometry.Type != model.GEOJSON_GEOMETRY_POLYGON || fmt.Sprint(repaired.Geometry.Coordinates) != expected {
+		t.Fatalf("Expected Polygon %s but got %s %v", expected, repaired.Geometry.Type, repaired.Geometry.Coordinates)
+	}
+
+	for input, msg := range map[string]string{
+		`{"type":"Polygon","coordinates":[[[0,0],[10,10],[10,0],[0,10],[0,0]]]}`: "intersects itself",
+		`{"type":"Polygon","coordinates":[[[0,0],[10,0],[0,0]]]}`:                "less than 3 distinct vertices",
+		`{"type":"Polygon","coordinates":[[[0,0],[5,0],[10,0],[0,0]]]}`:          "no area",
+	} {
+		polygon, err := geometry.ParseGeoJSONArea([]byte(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = geometry.RepairPolygon(polygon)
+		if !errors.Is(err, geometry.ErrInvalidPolygon) || !strings.Contains(err.Error(), msg) {
+			t.Fatalf("Input: %s | Output: %v | Expected: ErrInvalidPolygon with %s", input, err, msg)
+		}
+	}
+}
+
+func TestSimplifyPolygon(t *testing.T) {
+	b, err := os.ReadFile("./polygons/many_vertex_Iceland.geojson")
+	if err != nil {
+		t.Fatalf("Can not read file: %s", err.Error())
+	}
+	polygon, err := geometry.ParseGeoJSONArea(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repaired, err := geometry.RepairPolygon(polygon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rings, err := geometry.GetSimplePointShapes(&repaired.Geometry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rings) != 1 || len(rings[0]) > geometry.MAX_POLYGON_VERTICES || len(rings[0]) < 100 {
+		t.Fatalf("Expected one ring simplified to 100 to %d vertices but got %d rings", geometry.MAX_POLYGON_VERTICES, len(rings))
+	}
+	// Reykjavik stays inside of the simplified polygon
+	inside, err := geometry.ContainsPoint(repaired, model.SimplePoint{X: -21.9, Y: 64.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inside {
+		t.Fatalf("Expected point inside of the simplified polygon")
+	}
+}
+
+func TestTiles(t *testing.T) {
+	tile := geometry.TileOf(64.13, -21.9, 6)
+	if tile.Key() != "6/28/17" {
+		t.Errorf("expected tile 6/28/17 of Reykjavik, got %s", tile.Key())
+	}
+	parsed, err := geometry.ParseGeotileKey(tile.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != tile {
+		t.Errorf("expected parsed tile %v, got %v", tile, parsed)
+	}
+	bbox := tile.BBox()
+	sw, ne := bbox[0], bbox[2]
+	if sw.X > -21.9 || ne.X < -21.9 || sw.Y > 64.13 || ne.Y < 64.13 {
+		t.Errorf("expected bbox %v to contain Reykjavik", bbox)
+	}
+	x, y := tile.Project(64.13, -21.9, 4096)
+	if x < 0 || x > 4096 || y < 0 || y > 4096 {
+		t.Errorf("expected Reykjavik inside the tile extent, got %d,%d", x, y)
+	}
+	// the corners of the tile are projected to the corners of the extent
+	x, y = tile.Project(ne.Y, sw.X, 4096)
+	if x != 0 || y != 0 {
+		t.Errorf("expected north west corner at 0,0, got %d,%d", x, y)
+	}
+
+	world := geometry.Tile{}.BBox()
+	if world[0].X != -180 || world[1].X != 180 || math.Abs(world[2].Y-geometry.MERCATOR_LAT_MAX) > 1e-6 {
+		t.Errorf("expected bbox of the world, got %v", world)
+	}
+
+	for _, key := range []string{"", "6/28", "a/1/1", "1/2/0", "30/0/0", "-1/0/0"} {
+		_, err := geometry.ParseGeotileKey(key)
+		if err == nil {
+			t.Errorf("expected error for geotile key %q", key)
+		}
+	}
+}
+
+func TestGeohash(t *testing.T) {
+	// example of the geohash specification
+	hash := geometry.GeohashOf(57.64911, 10.40744, 11)
+	if hash != "u4pruydqqvj" {
+		t.Errorf("expected geohash u4pruydqqvj, got %s", hash)
+	}
+	bbox, err := geometry.GeohashBBox(hash[:5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw, ne := bbox[0], bbox[2]
+	if sw.X > 10.40744 || ne.X < 10.40744 || sw.Y > 57.64911 || ne.Y < 57.64911 {
+		t.Errorf("expected bbox %v to contain the location", bbox)
+	}
+	// cells at the antimeridian end at it instead of crossing it
+	bbox, err = geometry.GeohashBBox(geometry.GeohashOf(-38.6, 179.9, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bbox[1].X != 180 || bbox[0].X >= bbox[1].X {
+		t.Errorf("expected bbox ending at the antimeridian, got %v", bbox)
+	}
+
+	for _, hash := range []string{"", "u4pa", "u4pruydqqvjxy"} {
+		_, err := geometry.GeohashBBox(hash)
+		if err == nil {
+			t.Errorf("expected error for geohash %q", hash)
+		}
+	}
+}
+
+func TestH3(t *testing.T) {
+	key, err := geometry.H3CellOf(64.1, -21.9, 3)
+	if err != nil || key != "83075dfffffffff" {
+		t.Fatalf("expected h3 cell 83075dfffffffff, got %s: %v", key, err)
+	}
+	polygons, err := geometry.H3CellPolygons(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(polygons) != 1 || len(polygons[0]) != 6 {
+		t.Fatalf("expected a hexagon, got %v", polygons)
+	}
+	// cells crossing the antimeridian are split into a polygon ending at 180 and one starting at -180
+	key, err = geometry.H3CellOf(-17, 179.99, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	polygons, err = geometry.H3CellPolygons(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(polygons) != 2 {
+		t.Fatalf("expected 2 polygons, got %v", polygons)
+	}
+	for _, polygon := range polygons {
+		atBoundary := 0
+		for _, point := range polygon {
+			if point.X < -180 || point.X > 180 {
+				t.Errorf("expected longitudes inside -180 and 180, got %v", polygon)
+			}
+			if math.Abs(point.X) == 180 {
+				atBoundary++
+			}
+		}
+		if atBoundary != 2 {
+			t.Errorf("expected 2 vertices at the antimeridian, got %v", polygon)
+		}
+	}
+	// cells around a pole are closed along the pole and cover all longitudes
+	for _, lat := range []float64{90, -90} {
+		key, err = geometry.H3CellOf(lat, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		polygons, err = geometry.H3CellPolygons(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		width := 0.0
+		for _, polygon := range polygons {
+			west, east := 180.0, -180.0
+			atPole := false
+			for _, point := range polygon {
+				west, east = min(west, point.X), max(east, point.X)
+				atPole = atPole || point.Y == lat
+			}
+			if !atPole {
+				t.Errorf("expected polygon at the pole %f, got %v", lat, polygon)
+			}
+			width += east - west
+		}
+		if math.Abs(width-360) > 1e-9 {
+			t.Errorf("expected polygons of the pole %f to cover 360 degrees of longitude, got %f: %v", lat, width, polygons)
+		}
+	}
+
+	if _, err := geometry.H3CellPolygons("u4pru"); err == nil {
+		t.Error("expected error for invalid h3 cell")
+	}
+}
+
+func TestParseCoordinateBBox(t *testing.T) {
+	bbox, err := geometry.ParseCoordinateBBox("-30,60,-10,70")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []model.SimplePoint{{X: -30, Y: 60}, {X: -10, Y: 60}, {X: -10, Y: 70}, {X: -30, Y: 70}}
+	if !reflect.DeepEqual(bbox, expected) {
+		t.Errorf("expected bbox %v, got %v", expected, bbox)
+	}
+	// heights are ignored
+	bbox, err = geometry.ParseCoordinateBBox("-30,60,0,-10,70,100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(bbox, expected) {
+		t.Errorf("expected bbox %v, got %v", expected, bbox)
+	}
+	// the eastern longitude of a bbox crossing the antimeridian is shifted
+	bbox, err = geometry.ParseCoordinateBBox("170,-50,-170,0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bbox[0].X != 170 || bbox[1].X != 190 {
+		t.Errorf("expected bbox from 170 to 190, got %v", bbox)
+	}
+
+	for _, v := range []string{"", "1,2,3", "a,0,1,1", "-190,0,0,10", "0,10,10,0", "0,-95,10,0"} {
+		_, err := geometry.ParseCoordinateBBox(v)
+		if err == nil {
+			t.Errorf("expected error for bbox %q", v)
+		}
+	}
+}
+
+func TestNormalizeBBox(t *testing.T) {
+	tests := []struct {
+		name     string
+		bbox     []model.SimplePoint
+		expected []model.SimplePoint
+	}{
+		{
+			name:     "inside",
+			bbox:     []model.SimplePoint{{X: -30, Y: 60}, {X: -10, Y: 60}, {X: -10, Y: 70}, {X: -30, Y: 70}},
+			expected: []model.SimplePoint{{X: -30, Y: 60}, {X: -10, Y: 60}, {X: -10, Y: 70}, {X: -30, Y: 70}},
+		},
+		{
+			name:     "panned west over the antimeridian",
+			bbox:     []model.SimplePoint{{X: -200, Y: -50}, {X: -170, Y: -50}, {X: -170, Y: 0}, {X: -200, Y: 0}},
+			expected: []model.SimplePoint{{X: 160, Y: -50}, {X: 190, Y: -50}, {X: 190, Y: 0}, {X: 160, Y: 0}},
+		},
+		{
+			name:     "more than the world",
+			bbox:     []model.SimplePoint{{X: -300, Y: -100}, {X: 300, Y: -100}, {X: 300, Y: 100}, {X: -300, Y: 100}},
+			expected: []model.SimplePoint{{X: -180, Y: -90}, {X: 180, Y: -90}, {X: 180, Y: 90}, {X: -180, Y: 90}},
+		},
+	}
+	for _, test := range tests {
+		bbox := geometry.NormalizeBBox(test.bbox)
+		if !reflect.DeepEqual(bbox, test.expected) {
+			t.Errorf("%s: expected bbox %v, got %v", test.name, test.expected, bbox)
+		}
+	}
+}
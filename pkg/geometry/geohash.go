@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+/**
+** This file contains helper functions for handling geohash cells as used by the geohash_grid aggregation
+**/
+package geometry
+
+import (
+	"fmt"
+	"strings"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+const (
+	// MAX_GEOHASH_PRECISION is the highest precision of the geohash_grid aggregation
+	MAX_GEOHASH_PRECISION = 12
+
+	geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+// GeohashOf returns the geohash of the given precision of the cell containing the location
+func GeohashOf(lat float64, lon float64, precision int) string {
+	latMin, latMax := LAT_MIN, LAT_MAX
+	lonMin, lonMax := LONG_MIN, LONG_MAX
+	var b strings.Builder
+	bits, index := 0, 0
+	// the bits alternate between longitude and latitude starting with longitude
+	even := true
+	for b.Len() < precision {
+		index <<= 1
+		if even {
+			mid := (lonMin + lonMax) / 2
+			if lon >= mid {
+				index |= 1
+				lonMin = mid
+			} else {
+				lonMax = mid
+			}
+		} else {
+			mid := (latMin + latMax) / 2
+			if lat >= mid {
+				index |= 1
+				latMin = mid
+			} else {
+				latMax = mid
+			}
+		}
+		even = !even
+		bits++
+		if bits == 5 {
+			b.WriteByte(geohashAlphabet[index])
+			bits, index = 0, 0
+		}
+	}
+	return b.String()
+}
+
+// GeohashBBox returns the bounds of the geohash cell as bbox formatted [SW, SE, NE, NW]
+func GeohashBBox(hash string) ([]model.SimplePoint, error) {
+	if hash == "" || len(hash) > MAX_GEOHASH_PRECISION {
+		return nil, fmt.Errorf("invalid geohash %s", hash)
+	}
+	latMin, latMax := LAT_MIN, LAT_MAX
+	lonMin, lonMax := LONG_MIN, LONG_MAX
+	even := true
+	for _, c := range strings.ToLower(hash) {
+		index := strings.IndexRune(geohashAlphabet, c)
+		if index < 0 {
+			return nil, fmt.Errorf("invalid geohash %s", hash)
+		}
+		for bit := 4; bit >= 0; bit-- {
+			set := index>>bit&1 == 1
+			if even {
+				mid := (lonMin + lonMax) / 2
+				if set {
+					lonMin = mid
+				} else {
+					lonMax = mid
+				}
+			} else {
+				mid := (latMin + latMax) / 2
+				if set {
+					latMin = mid
+				} else {
+					latMax = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return []model.SimplePoint{
+		{X: lonMin, Y: latMin},
+		{X: lonMax, Y: latMin},
+		{X: lonMax, Y: latMax},
+		{X: lonMin, Y: latMax},
+	}, nil
+}
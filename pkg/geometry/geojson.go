@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package geometry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// geoJSONObject holds the members of all GeoJSON objects that describe an area
+type geoJSONObject struct {
+	Type        string                 `json:"type"`
+	Geometry    *model.Geometry        `json:"geometry"`
+	Features    []model.GeoJSONFeature `json:"features"`
+	Coordinates []any                  `json:"coordinates"`
+}
+
+// ParseGeoJSONArea parses a GeoJSON Feature, FeatureCollection or bare geometry of polygons into a single feature
+// The polygons of all features of a FeatureCollection are merged into one MultiPolygon
+func ParseGeoJSONArea(b []byte) (model.GeoJSONFeature, error) {
+	obj := geoJSONObject{}
+	err := json.Unmarshal(b, &obj)
+	if err != nil {
+		return model.GeoJSONFeature{}, err
+	}
+	geometries := []model.Geometry{}
+	switch obj.Type {
+	case model.GEOJSONTYPE_FEATURECOLLECTION:
+		for _, feature := range obj.Features {
+			geometries = append(geometries, feature.Geometry)
+		}
+	case model.GEOJSONTYPE_FEATURE:
+		if obj.Geometry == nil {
+			return model.GeoJSONFeature{}, fmt.Errorf("GeoJSON Feature without geometry")
+		}
+		geometries = append(geometries, *obj.Geometry)
+	case model.GEOJSON_GEOMETRY_POLYGON, model.GEOJSON_GEOMETRY_MULTIPOLYGON:
+		geometries = append(geometries, model.Geometry{Type: obj.Type, Coordinates: obj.Coordinates})
+	default:
+		return model.GeoJSONFeature{}, fmt.Errorf("unsupported GeoJSON Type: %s", obj.Type)
+	}
+	if len(geometries) == 0 {
+		return model.GeoJSONFeature{}, fmt.Errorf("GeoJSON FeatureCollection without features")
+	}
+	for _, geom := range geometries {
+		if geom.Type != model.GEOJSON_GEOMETRY_POLYGON && geom.Type != model.GEOJSON_GEOMETRY_MULTIPOLYGON {
+			return model.GeoJSONFeature{}, fmt.Errorf("unsupported GeoJSON geometry type for an area: %s", geom.Type)
+		}
+	}
+	if len(geometries) == 1 {
+		return model.GeoJSONFeature{Type: model.GEOJSONTYPE_FEATURE, Geometry: geometries[0]}, nil
+	}
+	// merge the polygons of all features
+	coordinates := []any{}
+	for _, geom := range geometries {
+		if geom.Type == model.GEOJSON_GEOMETRY_POLYGON {
+			coordinates = append(coordinates, geom.Coordinates)
+			continue
+		}
+		coordinates = append(coordinates, geom.Coordinates...)
+	}
+	return model.GeoJSONFeature{
+		Type: model.GEOJSONTYPE_FEATURE,
+		Geometry: model.Geometry{
+			Type:        model.GEOJSON_GEOMETRY_MULTIPOLYGON,
+			Coordinates: coordinates,
+		},
+	}, nil
+}
+
+// FormatMultiPolygonWKT formats the (multi-)polygon geometry of a feature as WKT MULTIPOLYGON including the interior rings
+// Output is postGIS geometry syntax: MULTIPOLYGON(((long1 lat1, long2 lat2, ...),(hole...)),((...)))
+func FormatMultiPolygonWKT(feature model.GeoJSONFeature) (string, error) {
+	polygons, err := GetPolygonRings(&feature.Geometry)
+	if err != nil {
+		return "", err
+	}
+	formatted := make([]string, 0, len(polygons))
+	for _, rings := range polygons {
+		formattedRings := make([]string, 0, len(rings))
+		for _, ring := range rings {
+			if len(ring) < 3 {
+				return "", fmt.Errorf("polygon ring needs at least 3 points")
+			}
+			// WKT rings have to be closed
+			if !IsClosed(ring) {
+				ring = append(ring[:len(ring):len(ring)], ring[0])
+			}
+			formattedRing, err := FormatPolygonArray(ring)
+			if err != nil {
+				return "", err
+			}
+			formattedRings = append(formattedRings, formattedRing)
+		}
+		formatted = append(formatted, fmt.Sprintf("(%s)", strings.Join(formattedRings, ",")))
+	}
+	return fmt.Sprintf("MULTIPOLYGON(%s)", strings.Join(formatted, ",")), nil
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+/**
+** This file contains helper functions for handling web mercator tiles as used by the geotile_grid aggregation
+**/
+package geometry
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+const (
+	// MAX_TILE_ZOOM is the highest precision of the geotile_grid aggregation
+	MAX_TILE_ZOOM = 29
+	// MERCATOR_LAT_MAX is the latitude bound of the web mercator projection
+	MERCATOR_LAT_MAX = 85.05112878
+)
+
+// Tile is a web mercator tile addressed by zoom level, column and row
+type Tile struct {
+	Z int
+	X int
+	Y int
+}
+
+// NewTile returns the tile of the zoom level, column and row or an error if it does not exist
+func NewTile(z int, x int, y int) (Tile, error) {
+	if z < 0 || z > MAX_TILE_ZOOM {
+		return Tile{}, fmt.Errorf("zoom level %d out of range 0-%d", z, MAX_TILE_ZOOM)
+	}
+	n := 1 << z
+	if x < 0 || x >= n || y < 0 || y >= n {
+		return Tile{}, fmt.Errorf("tile %d/%d/%d does not exist", z, x, y)
+	}
+	return Tile{Z: z, X: x, Y: y}, nil
+}
+
+// ParseGeotileKey parses a geotile key formatted as ZOOM/X/Y like the bucket keys of the geotile_grid aggregation
+func ParseGeotileKey(key string) (Tile, error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 {
+		return Tile{}, fmt.Errorf("invalid geotile key %s - must be ZOOM/X/Y", key)
+	}
+	values := [3]int{}
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return Tile{}, fmt.Errorf("invalid geotile key %s - must be ZOOM/X/Y", key)
+		}
+		values[i] = v
+	}
+	return NewTile(values[0], values[1], values[2])
+}
+
+// TileOf returns the tile of the zoom level containing the location
+func TileOf(lat float64, lon float64, zoom int) Tile {
+	n := math.Exp2(float64(zoom))
+	x := int(math.Floor((lon + 180) / 360 * n))
+	y := int(math.Floor(mercatorY(lat) * n))
+	maxTile := int(n) - 1
+	return Tile{
+		Z: zoom,
+		X: max(0, min(x, maxTile)),
+		Y: max(0, min(y, maxTile)),
+	}
+}
+
+// Key returns the geotile key of the tile formatted as ZOOM/X/Y
+func (t Tile) Key() string {
+	return fmt.Sprintf("%d/%d/%d", t.Z, t.X, t.Y)
+}
+
+// BBox returns the bounds of the tile as bbox formatted [SW, SE, NE, NW]
+func (t Tile) BBox() []model.SimplePoint {
+	n := math.Exp2(float64(t.Z))
+	west := float64(t.X)/n*360 - 180
+	east := float64(t.X+1)/n*360 - 180
+	north := mercatorLat(float64(t.Y) / n)
+	south := mercatorLat(float64(t.Y+1) / n)
+	return []model.SimplePoint{
+		{X: west, Y: south},
+		{X: east, Y: south},
+		{X: east, Y: north},
+		{X: west, Y: north},
+	}
+}
+
+// Project returns the position of the location inside the tile scaled to the extent
+// The origin is the north west corner of the tile; locations outside the tile are projected beyond [0, extent]
+func (t Tile) Project(lat float64, lon float64, extent int) (int, int) {
+	n := math.Exp2(float64(t.Z))
+	x := ((lon+180)/360*n - float64(t.X)) * float64(extent)
+	y := (mercatorY(lat)*n - float64(t.Y)) * float64(extent)
+	return int(math.Round(x)), int(math.Round(y))
+}
+
+// mercatorY returns the web mercator y of the latitude scaled to [0, 1] from north to south
+func mercatorY(lat float64) float64 {
+	// clip latitude to the bounds of the web mercator projection
+	lat = math.Max(-MERCATOR_LAT_MAX, math.Min(MERCATOR_LAT_MAX, lat))
+	latRad := lat * math.Pi / 180
+	return (1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2
+}
+
+// mercatorLat returns the latitude of the web mercator y scaled to [0, 1] from north to south
+func mercatorLat(y float64) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y))) * 180 / math.Pi
+}
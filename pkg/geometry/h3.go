@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+/**
+** This file contains helper functions for handling H3 cells as used by the geohex_grid aggregation
+**/
+package geometry
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/uber/h3-go/v4"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// MAX_H3_RESOLUTION is the highest precision of the geohex_grid aggregation
+const MAX_H3_RESOLUTION = 15
+
+// H3CellOf returns the H3 index of the cell of the resolution containing the location as hex string like the keys of the geohex_grid aggregation
+func H3CellOf(lat float64, lon float64, resolution int) (string, error) {
+	cell, err := h3.LatLngToCell(h3.NewLatLng(lat, lon), resolution)
+	if err != nil {
+		return "", fmt.Errorf("can not index %f,%f at resolution %d: %w", lat, lon, resolution, err)
+	}
+	return cell.String(), nil
+}
+
+// H3CellPolygons returns the boundary of the H3 cell as rings of unclosed polygons
+// A cell crossing the antimeridian is split into one polygon per side and a cell around a pole is closed along the pole
+func H3CellPolygons(key string) ([][]model.SimplePoint, error) {
+	cell := h3.Cell(h3.IndexFromString(key))
+	if !cell.IsValid() {
+		return nil, fmt.Errorf("invalid h3 cell %s", key)
+	}
+	boundary, err := cell.Boundary()
+	if err != nil {
+		return nil, fmt.Errorf("can not get boundary of h3 cell %s: %w", key, err)
+	}
+	// unwrap the longitudes, so consecutive vertices are less than 180° apart
+	ring := make([]model.SimplePoint, 0, len(boundary)+2)
+	for i, vertex := range boundary {
+		lon := vertex.Lng
+		if i > 0 {
+			prev := ring[i-1].X
+			for lon-prev > LONG_MAX {
+				lon -= 2 * LONG_MAX
+			}
+			for lon-prev < LONG_MIN {
+				lon += 2 * LONG_MAX
+			}
+		}
+		ring = append(ring, model.SimplePoint{X: lon, Y: vertex.Lat})
+	}
+	// the unwrapped ring of a cell around a pole ends a full turn east or west of its start, so it is closed along the pole
+	first, last := ring[0], ring[len(ring)-1]
+	if math.Abs(last.X-first.X) > LONG_MAX {
+		center, err := cell.LatLng()
+		if err != nil {
+			return nil, fmt.Errorf("can not get center of h3 cell %s: %w", key, err)
+		}
+		pole := LAT_MAX
+		if center.Lat < 0 {
+			pole = LAT_MIN
+		}
+		turn := 2 * LONG_MAX
+		if last.X < first.X {
+			turn = 2 * LONG_MIN
+		}
+		ring = append(ring, model.SimplePoint{X: first.X + turn, Y: first.Y}, model.SimplePoint{X: first.X + turn, Y: pole}, model.SimplePoint{X: first.X, Y: pole})
+	}
+	// cut the ring into the parts inside [-180, 180] and the parts shifted by a full turn
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	for _, point := range ring {
+		minX, maxX = min(minX, point.X), max(maxX, point.X)
+	}
+	polygons := [][]model.SimplePoint{}
+	for _, shift := range []float64{0, 2 * LONG_MAX, 2 * LONG_MIN} {
+		west, east := LONG_MIN-shift, LONG_MAX-shift
+		if maxX <= west || minX >= east {
+			continue
+		}
+		part := clipRingLon(clipRingLon(ring, west, true), east, false)
+		if len(part) < 3 {
+			continue
+		}
+		for i := range part {
+			part[i].X += shift
+		}
+		polygons = append(polygons, part)
+	}
+	return polygons, nil
+}
+
+// clipRingLon returns the part of the unclosed ring east (or west) of the meridian
+func clipRingLon(ring []model.SimplePoint, boundary float64, keepEast bool) []model.SimplePoint {
+	inside := func(p model.SimplePoint) bool {
+		if keepEast {
+			return p.X >= boundary
+		}
+		return p.X <= boundary
+	}
+	clipped := make([]model.SimplePoint, 0, len(ring)+2)
+	for i, current := range ring {
+		prev := ring[(i+len(ring)-1)%len(ring)]
+		if inside(current) != inside(prev) {
+			clipped = append(clipped, model.SimplePoint{X: boundary, Y: calcCrossingYCartesian(prev, current, boundary)})
+		}
+		if inside(current) {
+			clipped = append(clipped, current)
+		}
+	}
+	return clipped
+}
@@ -0,0 +1,322 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package geometry
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+const (
+	MAX_POLYGON_VERTICES       = 1000   // polygons with more vertices are simplified to stay within this budget
+	MAX_POLYGON_INPUT_VERTICES = 100000 // polygons with more vertices are rejected
+	DOUGLAS_PEUCKER_FACTOR     = 4      // rings with more than this factor times their budget are reduced with Douglas-Peucker first
+)
+
+// ErrInvalidPolygon is returned for polygons that can not be repaired
+var ErrInvalidPolygon = errors.New("invalid polygon")
+
+// RepairPolygon validates and repairs the (multi-)polygon geometry of a feature
+// It removes duplicate vertices, closes the rings and orients exterior rings counterclockwise and holes clockwise as of RFC 7946.
+// Polygons exceeding MAX_POLYGON_VERTICES are simplified without introducing self-intersections.
+// Rings with less than 3 distinct vertices, without area or intersecting themselves return an error wrapping ErrInvalidPolygon.
+func RepairPolygon(feature model.GeoJSONFeature) (model.GeoJSONFeature, error) {
+	polygons, err := GetPolygonRings(&feature.Geometry)
+	if err != nil {
+		return feature, fmt.Errorf("%w: %w", ErrInvalidPolygon, err)
+	}
+	numVertices := 0
+	for i, rings := range polygons {
+		for j, ring := range rings {
+			ring = closeRing(removeDuplicateVertices(ring))
+			if len(ring) < 4 {
+				return feature, fmt.Errorf("%w: ring %d of polygon %d has less than 3 distinct vertices", ErrInvalidPolygon, j+1, i+1)
+			}
+			area := signedArea(ring)
+			if area == 0 {
+				// e.g. bow ties have no area
+				if p, ok := selfIntersection(ring); ok {
+					return feature, fmt.Errorf("%w: ring %d of polygon %d intersects itself at %f %f", ErrInvalidPolygon, j+1, i+1, p.X, p.Y)
+				}
+				return feature, fmt.Errorf("%w: ring %d of polygon %d has no area", ErrInvalidPolygon, j+1, i+1)
+			}
+			// exterior rings are counterclockwise with a positive area, holes are clockwise
+			if (j == 0) != (area > 0) {
+				ring = reverseRing(ring)
+			}
+			rings[j] = ring
+			numVertices += len(ring)
+		}
+	}
+	if numVertices > MAX_POLYGON_INPUT_VERTICES {
+		return feature, fmt.Errorf("%w: more than %d vertices", ErrInvalidPolygon, MAX_POLYGON_INPUT_VERTICES)
+	}
+	if numVertices > MAX_POLYGON_VERTICES {
+		// the intersections are checked on the simplified rings
+		polygons, err = simplifyPolygons(polygons, numVertices, MAX_POLYGON_VERTICES)
+		if err != nil {
+			return feature, err
+		}
+	}
+	for i, rings := range polygons {
+		for j, ring := range rings {
+			if p, ok := selfIntersection(ring); ok {
+				return feature, fmt.Errorf("%w: ring %d of polygon %d intersects itself at %f %f", ErrInvalidPolygon, j+1, i+1, p.X, p.Y)
+			}
+		}
+	}
+	repaired := ParseMultiPolygonRings(polygons)
+	if len(polygons) == 1 {
+		// keep single polygons as Polygon
+		repaired.Geometry.Type = model.GEOJSON_GEOMETRY_POLYGON
+		repaired.Geometry.Coordinates = repaired.Geometry.Coordinates[0].([]any)
+	}
+	repaired.ID = feature.ID
+	repaired.Properties = feature.Properties
+	return repaired, nil
+}
+
+// removeDuplicateVertices removes consecutive duplicates of vertices
+func removeDuplicateVertices(ring []model.SimplePoint) []model.SimplePoint {
+	unique := make([]model.SimplePoint, 0, len(ring))
+	for _, p := range ring {
+		if len(unique) > 0 && unique[len(unique)-1] == p {
+			continue
+		}
+		unique = append(unique, p)
+	}
+	return unique
+}
+
+// closeRing appends the first vertex to the ring if it is not closed
+func closeRing(ring []model.SimplePoint) []model.SimplePoint {
+	if len(ring) > 0 && !IsClosed(ring) {
+		ring = append(ring, ring[0])
+	}
+	return ring
+}
+
+// reverseRing returns the vertices of the ring in reverse order
+func reverseRing(ring []model.SimplePoint) []model.SimplePoint {
+	reversed := make([]model.SimplePoint, 0, len(ring))
+	for i := len(ring) - 1; i >= 0; i-- {
+		reversed = append(reversed, ring[i])
+	}
+	return reversed
+}
+
+// signedArea returns the cartesian area of a closed ring - positive for counterclockwise and negative for clockwise rings
+func signedArea(ring []model.SimplePoint) float64 {
+	area := 0.0
+	for i := 0; i < len(ring)-1; i++ {
+		area += ring[i].X*ring[i+1].Y - ring[i+1].X*ring[i].Y
+	}
+	return area / 2
+}
+
+// simplifyPolygons simplifies the rings of the polygons until they have at most maxVertices in total
+// Each ring gets a share of the budget proportional to its number of vertices but keeps at least 3 distinct vertices
+func simplifyPolygons(polygons [][][]model.SimplePoint, numVertices int, maxVertices int) ([][][]model.SimplePoint, error) {
+	simplified := make([][][]model.SimplePoint, 0, len(polygons))
+	for i, rings := range polygons {
+		simplifiedRings := make([][]model.SimplePoint, 0, len(rings))
+		for j, ring := range rings {
+			budget := max(4, len(ring)*maxVertices/numVertices)
+			s, ok := simplifyRing(ring, budget)
+			if !ok {
+				return nil, fmt.Errorf("%w: ring %d of polygon %d can not be simplified to %d vertices without intersecting itself", ErrInvalidPolygon, j+1, i+1, budget)
+			}
+			simplifiedRings = append(simplifiedRings, s)
+		}
+		simplified = append(simplified, simplifiedRings)
+	}
+	return simplified, nil
+}
+
+// simplifyRing simplifies a closed ring to at most maxVertices with the Visvalingam-Whyatt algorithm
+// Vertices are only removed if the new edge does not intersect the ring, so the simplified ring does not intersect itself.
+// Large rings are reduced with the Douglas-Peucker algorithm first if that does not introduce intersections.
+func simplifyRing(ring []model.SimplePoint, maxVertices int) ([]model.SimplePoint, bool) {
+	if len(ring) > DOUGLAS_PEUCKER_FACTOR*maxVertices {
+		// start with a tolerance relative to the extent of the ring
+		left, right, bottom, top := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+		for _, p := range ring {
+			left, right = math.Min(left, p.X), math.Max(right, p.X)
+			bottom, top = math.Min(bottom, p.Y), math.Max(top, p.Y)
+		}
+		for tolerance := math.Max(right-left, top-bottom) / 100000; tolerance > 0; tolerance *= 2 {
+			s := simplifyRingDouglasPeucker(ring, tolerance)
+			if len(s) <= DOUGLAS_PEUCKER_FACTOR*maxVertices {
+				if _, ok := selfIntersection(s); !ok && len(s) >= 4 {
+					ring = s
+				}
+				break
+			}
+		}
+	}
+	// the ring is handled as cyclic list of its distinct vertices
+	n := len(ring) - 1
+	prev := make([]int, n)
+	next := make([]int, n)
+	for i := range n {
+		prev[i] = (i + n - 1) % n
+		next[i] = (i + 1) % n
+	}
+	removed := make([]bool, n)
+	blocked := make([]bool, n)
+	area := func(i int) float64 {
+		return math.Abs(orientation(ring[prev[i]], ring[i], ring[next[i]])) / 2
+	}
+	areas := make([]float64, n)
+	for i := range n {
+		areas[i] = area(i)
+	}
+	for count := n; count+1 > maxVertices; {
+		// remove the vertex with the smallest effective area whose removal does not lead to an intersection
+		candidate := -1
+		for i := range n {
+			if !removed[i] && !blocked[i] && (candidate < 0 || areas[i] < areas[candidate]) {
+				candidate = i
+			}
+		}
+		if candidate < 0 || count <= 3 {
+			return nil, false
+		}
+		if shortcutIntersects(ring, next, removed, prev[candidate], next[candidate]) {
+			blocked[candidate] = true
+			continue
+		}
+		removed[candidate] = true
+		count--
+		p, q := prev[candidate], next[candidate]
+		next[p], prev[q] = q, p
+		areas[p], areas[q] = area(p), area(q)
+		blocked[p], blocked[q] = false, false
+	}
+	// collect the remaining vertices starting with the first one that was kept
+	start := 0
+	for removed[start] {
+		start++
+	}
+	simplified := []model.SimplePoint{ring[start]}
+	for i := next[start]; i != start; i = next[i] {
+		simplified = append(simplified, ring[i])
+	}
+	return append(simplified, ring[start]), true
+}
+
+// shortcutIntersects returns whether the edge from vertex a to vertex b intersects any edge of the ring not adjacent to a or b
+func shortcutIntersects(ring []model.SimplePoint, next []int, removed []bool, a int, b int) bool {
+	for i := range next {
+		j := next[i]
+		if removed[i] || i == a || j == a || i == b || j == b {
+			continue
+		}
+		if _, ok := segmentIntersection(ring[a], ring[b], ring[i], ring[j]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// simplifyRingDouglasPeucker simplifies a closed ring with the Douglas-Peucker algorithm
+// The ring is split at the vertex farthest from the first vertex, so both halves are simplified as lines
+func simplifyRingDouglasPeucker(ring []model.SimplePoint, tolerance float64) []model.SimplePoint {
+	farthest := 0
+	maxDist := 0.0
+	for i, p := range ring {
+		dist := math.Hypot(p.X-ring[0].X, p.Y-ring[0].Y)
+		if dist > maxDist {
+			farthest, maxDist = i, dist
+		}
+	}
+	first := simplifyLine(ring[:farthest+1], tolerance)
+	second := simplifyLine(ring[farthest:], tolerance)
+	return append(first, second[1:]...)
+}
+
+// simplifyLine simplifies a line with the Douglas-Peucker algorithm keeping its first and last vertex
+func simplifyLine(line []model.SimplePoint, tolerance float64) []model.SimplePoint {
+	if len(line) < 3 {
+		return append([]model.SimplePoint{}, line...)
+	}
+	farthest := 0
+	maxDist := 0.0
+	for i := 1; i < len(line)-1; i++ {
+		dist := segmentDistance(line[i], line[0], line[len(line)-1])
+		if dist > maxDist {
+			farthest, maxDist = i, dist
+		}
+	}
+	if maxDist <= tolerance {
+		return []model.SimplePoint{line[0], line[len(line)-1]}
+	}
+	first := simplifyLine(line[:farthest+1], tolerance)
+	second := simplifyLine(line[farthest:], tolerance)
+	return append(first, second[1:]...)
+}
+
+// segmentDistance returns the cartesian distance of the point p to the segment between a and b
+func segmentDistance(p model.SimplePoint, a model.SimplePoint, b model.SimplePoint) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y)
+	}
+	t := math.Max(0, math.Min(1, ((p.X-a.X)*dx+(p.Y-a.Y)*dy)/(dx*dx+dy*dy)))
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
+
+// selfIntersection returns the first intersection of two non-adjacent edges of a closed ring and whether one exists
+func selfIntersection(ring []model.SimplePoint) (model.SimplePoint, bool) {
+	numEdges := len(ring) - 1
+	for i := 0; i < numEdges; i++ {
+		for j := i + 2; j < numEdges; j++ {
+			if i == 0 && j == numEdges-1 {
+				// the first and last edge share the closing vertex
+				continue
+			}
+			if p, ok := segmentIntersection(ring[i], ring[i+1], ring[j], ring[j+1]); ok {
+				return p, true
+			}
+		}
+	}
+	return model.SimplePoint{}, false
+}
+
+// segmentIntersection returns the intersection of the segments p1-p2 and p3-p4 and whether they intersect
+// Collinear overlapping segments return their first overlapping vertex
+func segmentIntersection(p1, p2, p3, p4 model.SimplePoint) (model.SimplePoint, bool) {
+	d1 := orientation(p3, p4, p1)
+	d2 := orientation(p3, p4, p2)
+	d3 := orientation(p1, p2, p3)
+	d4 := orientation(p1, p2, p4)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		t := d1 / (d1 - d2)
+		return model.SimplePoint{X: p1.X + t*(p2.X-p1.X), Y: p1.Y + t*(p2.Y-p1.Y)}, true
+	}
+	// touching or collinear segments
+	for _, c := range []struct {
+		d         float64
+		p, s1, s2 model.SimplePoint
+	}{{d1, p1, p3, p4}, {d2, p2, p3, p4}, {d3, p3, p1, p2}, {d4, p4, p1, p2}} {
+		if c.d == 0 && onSegment(c.p, c.s1, c.s2) {
+			return c.p, true
+		}
+	}
+	return model.SimplePoint{}, false
+}
+
+// orientation returns the cross product of a-b and a-c - positive if c lies left of a-b, negative if right and 0 if collinear
+func orientation(a, b, c model.SimplePoint) float64 {
+	return (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)
+}
+
+// onSegment returns whether the point p collinear to the segment a-b lies within its bounding box
+func onSegment(p, a, b model.SimplePoint) bool {
+	return math.Min(a.X, b.X) <= p.X && p.X <= math.Max(a.X, b.X) && math.Min(a.Y, b.Y) <= p.Y && p.Y <= math.Max(a.Y, b.Y)
+}
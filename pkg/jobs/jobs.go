@@ -0,0 +1,337 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package jobs runs long tasks like large downloads outside of the HTTP requests
+// The tasks write their result into a file of the storage directory which is removed when the job expires
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+const (
+	// FILE_PREFIX is the prefix of the result files; only files with the prefix are removed from the storage directory
+	FILE_PREFIX = "job_"
+	// tmpSuffix marks result files that are still written
+	tmpSuffix = ".tmp"
+
+	DEFAULT_WORKERS = 2
+	DEFAULT_QUEUE   = 100
+	DEFAULT_EXPIRY  = 24 * time.Hour
+)
+
+var (
+	ErrNotFound  = errors.New("job not found")
+	ErrNotReady  = errors.New("job not done")
+	ErrQueueFull = errors.New("job queue full")
+	ErrClosed    = errors.New("job manager closed")
+)
+
+// Task writes the result of a job to w and reports its progress as number of processed items and number of all items
+// The task must stop when ctx is canceled
+type Task func(ctx context.Context, w io.Writer, progress func(done int, total int)) error
+
+// Config holds the settings of a Manager; zero values select the defaults
+type Config struct {
+	// Dir is the storage directory of the result files
+	Dir string
+	// Workers is the number of jobs running concurrently
+	Workers int
+	// Queue is the number of jobs waiting for a worker
+	Queue int
+	// Expiry is the time a finished job and its result file are kept
+	Expiry time.Duration
+}
+
+// job holds the status of a job with its task
+type job struct {
+	status model.Job
+	task   Task
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Manager runs the jobs with a bounded number of workers
+type Manager struct {
+	config Config
+	jobs   map[string]*job
+	mu     sync.RWMutex
+	queue  chan *job
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewManager creates the storage directory, removes the result files of previous runs and starts the workers
+func NewManager(config Config) (*Manager, error) {
+	if config.Dir == "" {
+		config.Dir = filepath.Join(os.TempDir(), "georoc-jobs")
+	}
+	if config.Workers <= 0 {
+		config.Workers = DEFAULT_WORKERS
+	}
+	if config.Queue <= 0 {
+		config.Queue = DEFAULT_QUEUE
+	}
+	if config.Expiry <= 0 {
+		config.Expiry = DEFAULT_EXPIRY
+	}
+	err := os.MkdirAll(config.Dir, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("can not create job directory: %w", err)
+	}
+	// the jobs are kept in memory, so the files of previous runs can not be requested anymore
+	entries, err := os.ReadDir(config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("can not read job directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), FILE_PREFIX) {
+			os.Remove(filepath.Join(config.Dir, entry.Name()))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		config: config,
+		jobs:   map[string]*job{},
+		queue:  make(chan *job, config.Queue),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for i := 0; i < config.Workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+	m.wg.Add(1)
+	go m.cleanup()
+	return m, nil
+}
+
+// Submit queues the task of a job whose result is downloaded with the file name
+func (m *Manager) Submit(fileName string, task Task) (model.Job, error) {
+	if m.ctx.Err() != nil {
+		return model.Job{}, ErrClosed
+	}
+	id, err := newID()
+	if err != nil {
+		return model.Job{}, err
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	j := &job{
+		status: model.Job{ID: id, Status: model.JOB_QUEUED, FileName: fileName, CreatedAt: time.Now().UTC()},
+		task:   task,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case m.queue <- j:
+	default:
+		cancel()
+		return model.Job{}, ErrQueueFull
+	}
+	m.jobs[id] = j
+	return j.status, nil
+}
+
+// Get returns the status of the job
+func (m *Manager) Get(id string) (model.Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return model.Job{}, ErrNotFound
+	}
+	return j.status, nil
+}
+
+// File opens the result file of the job; the job must be done and the caller must close the file
+// The file is opened under the lock, so it stays readable if the job is removed while it is read
+func (m *Manager) File(id string) (*os.File, model.Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, model.Job{}, ErrNotFound
+	}
+	if j.status.Status != model.JOB_DONE {
+		return nil, j.status, ErrNotReady
+	}
+	f, err := os.Open(m.path(id))
+	if err != nil {
+		return nil, j.status, fmt.Errorf("can not open job file: %w", err)
+	}
+	return f, j.status, nil
+}
+
+// Cancel stops a queued or running job; a finished job is removed with its result file
+func (m *Manager) Cancel(id string) (model.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return model.Job{}, ErrNotFound
+	}
+	if j.status.Finished() {
+		m.remove(id)
+		return j.status, nil
+	}
+	j.cancel()
+	// a running job is set to canceled by its worker once the task returned
+	if j.status.Status == model.JOB_QUEUED {
+		m.finish(j, model.JOB_CANCELED, "")
+	}
+	return j.status, nil
+}
+
+// Close cancels all jobs and waits for the workers to stop
+func (m *Manager) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// RemoveExpired removes the finished jobs that expired before now with their result files
+func (m *Manager) RemoveExpired(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, j := range m.jobs {
+		if j.status.ExpiresAt != nil && j.status.ExpiresAt.Before(now) {
+			m.remove(id)
+		}
+	}
+}
+
+// work runs the queued jobs until the manager is closed
+func (m *Manager) work() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case j := <-m.queue:
+			m.run(j)
+		}
+	}
+}
+
+// run runs the task of the job writing its result into a temporary file which is renamed when the task succeeded
+func (m *Manager) run(j *job) {
+	m.mu.Lock()
+	if j.status.Status != model.JOB_QUEUED {
+		// canceled while queued
+		m.mu.Unlock()
+		return
+	}
+	started := time.Now().UTC()
+	j.status.Status = model.JOB_RUNNING
+	j.status.StartedAt = &started
+	m.mu.Unlock()
+
+	path := m.path(j.status.ID)
+	err := m.runTask(j, path+tmpSuffix)
+	if err == nil {
+		err = os.Rename(path+tmpSuffix, path)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case err == nil:
+		m.finish(j, model.JOB_DONE, "")
+	case j.ctx.Err() != nil:
+		os.Remove(path + tmpSuffix)
+		m.finish(j, model.JOB_CANCELED, "")
+	default:
+		log.Errorf("Job %s failed: %v", j.status.ID, err)
+		os.Remove(path + tmpSuffix)
+		m.finish(j, model.JOB_FAILED, err.Error())
+	}
+}
+
+// runTask runs the task of the job writing into the file
+func (m *Manager) runTask(j *job, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("can not create job file: %w", err)
+	}
+	progress := func(done int, total int) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		j.status.Done = done
+		j.status.Total = total
+	}
+	err = j.task(j.ctx, f, progress)
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return fmt.Errorf("can not write job file: %w", closeErr)
+	}
+	return j.ctx.Err()
+}
+
+// finish sets the final state of the job and starts its expiry; the caller must hold the lock
+func (m *Manager) finish(j *job, status string, errMsg string) {
+	finished := time.Now().UTC()
+	expires := finished.Add(m.config.Expiry)
+	j.status.Status = status
+	j.status.Error = errMsg
+	j.status.FinishedAt = &finished
+	j.status.ExpiresAt = &expires
+	j.cancel()
+}
+
+// remove removes the job and its result file; the caller must hold the lock
+func (m *Manager) remove(id string) {
+	delete(m.jobs, id)
+	err := os.Remove(m.path(id))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Errorf("Can not remove file of job %s: %v", id, err)
+	}
+}
+
+// cleanup removes the expired jobs periodically until the manager is closed
+func (m *Manager) cleanup() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(min(m.config.Expiry/10+time.Second, time.Hour))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.RemoveExpired(now)
+		}
+	}
+}
+
+// path returns the path of the result file of the job
+func (m *Manager) path(id string) string {
+	return filepath.Join(m.config.Dir, FILE_PREFIX+id)
+}
+
+// newID returns a random job id
+func newID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("can not create job id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
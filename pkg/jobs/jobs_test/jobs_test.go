@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/jobs"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// wait polls the job until it has the status
+func wait(t *testing.T, m *jobs.Manager, id string, status string) model.Job {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == status {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach status %s", id, status)
+	return model.Job{}
+}
+
+// blocking returns a task that blocks until release is closed or the job is canceled
+func blocking(release chan struct{}) jobs.Task {
+	return func(ctx context.Context, w io.Writer, progress func(int, int)) error {
+		progress(1, 2)
+		select {
+		case <-release:
+			_, err := w.Write([]byte("done"))
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestManager(t *testing.T) {
+	dir := t.TempDir()
+	// files of previous runs are removed
+	stale := filepath.Join(dir, jobs.FILE_PREFIX+"stale")
+	other := filepath.Join(dir, "other.csv")
+	for _, path := range []string{stale, other} {
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := jobs.NewManager(jobs.Config{Dir: dir, Workers: 1, Queue: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if _, err := os.Stat(stale); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected stale job file to be removed")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("expected other file to be kept: %v", err)
+	}
+
+	release := make(chan struct{})
+	first, err := m.Submit("first.csv", blocking(release))
+	if err != nil {
+		t.Fatal(err)
+	}
+	running := wait(t, m, first.ID, model.JOB_RUNNING)
+	if running.Done != 1 || running.Total != 2 || running.StartedAt == nil {
+		t.Errorf("expected progress 1 of 2, got %+v", running)
+	}
+	// the only worker is busy, so the second job stays queued and the queue is full
+	second, err := m.Submit("second.csv", blocking(release))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Submit("third.csv", blocking(release)); !errors.Is(err, jobs.ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	if _, _, err := m.File(first.ID); !errors.Is(err, jobs.ErrNotReady) {
+		t.Errorf("expected ErrNotReady, got %v", err)
+	}
+	canceled, err := m.Cancel(second.ID)
+	if err != nil || canceled.Status != model.JOB_CANCELED {
+		t.Errorf("expected canceled job, got %+v %v", canceled, err)
+	}
+
+	close(release)
+	done := wait(t, m, first.ID, model.JOB_DONE)
+	if done.FinishedAt == nil || done.ExpiresAt == nil {
+		t.Errorf("expected finished job with expiry, got %+v", done)
+	}
+	file, job, err := m.File(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := m.Get("unknown"); !errors.Is(err, jobs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// removing a finished job removes its file but an opened file can still be read
+	if _, err := m.Cancel(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file.Name()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected file to be removed")
+	}
+	content, err := io.ReadAll(file)
+	if err != nil || string(content) != "done" || job.FileName != "first.csv" {
+		t.Errorf("unexpected file %s of %s: %v", content, job.FileName, err)
+	}
+	if _, err := m.Get(first.ID); !errors.Is(err, jobs.ErrNotFound) {
+		t.Errorf("expected removed job, got %v", err)
+	}
+}
+
+func TestManagerCancelRunning(t *testing.T) {
+	m, err := jobs.NewManager(jobs.Config{Dir: t.TempDir(), Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	job, err := m.Submit("running.csv", blocking(make(chan struct{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, job.ID, model.JOB_RUNNING)
+	if _, err := m.Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, job.ID, model.JOB_CANCELED)
+	if _, _, err := m.File(job.ID); !errors.Is(err, jobs.ErrNotReady) {
+		t.Errorf("expected ErrNotReady, got %v", err)
+	}
+}
+
+func TestManagerExpiry(t *testing.T) {
+	dir := t.TempDir()
+	m, err := jobs.NewManager(jobs.Config{Dir: dir, Expiry: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	failing, err := m.Submit("failing.csv", func(ctx context.Context, w io.Writer, progress func(int, int)) error {
+		return errors.New("query failed")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := wait(t, m, failing.ID, model.JOB_FAILED)
+	if failed.Error != "query failed" {
+		t.Errorf("expected error of the task, got %s", failed.Error)
+	}
+	ok, err := m.Submit("ok.csv", func(ctx context.Context, w io.Writer, progress func(int, int)) error {
+		_, err := w.Write([]byte("ok"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, ok.ID, model.JOB_DONE)
+
+	m.RemoveExpired(time.Now())
+	if _, err := m.Get(ok.ID); err != nil {
+		t.Errorf("expected job to be kept until expiry: %v", err)
+	}
+	m.RemoveExpired(time.Now().Add(2 * time.Minute))
+	for _, id := range []string{failing.ID, ok.ID} {
+		if _, err := m.Get(id); !errors.Is(err, jobs.ErrNotFound) {
+			t.Errorf("expected expired job %s to be removed, got %v", id, err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected empty job directory, got %d files: %v", len(entries), err)
+	}
+}
@@ -0,0 +1,253 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// cqNumberRegex matches signed decimals with optional exponent, e.g. -3.5 or 1.2e-4
+var cqNumberRegex = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// ChemQueryError is returned for invalid chemical queries
+type ChemQueryError struct {
+	// Position is the 1-based position of the character the error occurred at
+	Position int
+	Msg      string
+}
+
+func (e *ChemQueryError) Error() string {
+	return fmt.Sprintf("can not parse chemical query at position %d: %s", e.Position, e.Msg)
+}
+
+// cqParser holds the state of parsing a chemical query
+type cqParser struct {
+	query string
+	pos   int
+}
+
+// ParseChemQuery takes a chemistry query DSL string and parses it into a ChemQuery structure
+//
+// The query consists of expressions connected by the junctors "," or "AND" and "OR" which are evaluated from left to right.
+// An expression is either a tuple `(TYPE,ELEMENT,MIN,MAX[,UNIT[,METHOD]])` with inclusive bounds
+// or a comparison `ELEMENT OPERATOR VALUE` with one of the operators >, >=, <, <=, =.
+// ELEMENT can be a ratio of two elements like La/Yb.
+func ParseChemQuery(query string) (ChemQuery, error) {
+	p := &cqParser{query: query}
+	chemQuery := ChemQuery{}
+	junctor := CQ_JUNCTOR_NONE
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return chemQuery, p.errorf("expected expression")
+		}
+		expr, err := p.parseExpression()
+		if err != nil {
+			return chemQuery, err
+		}
+		expr.Junctor = junctor
+		chemQuery.Expressions = append(chemQuery.Expressions, expr)
+		p.skipSpace()
+		if p.eof() {
+			return chemQuery, nil
+		}
+		junctor, err = p.parseJunctor()
+		if err != nil {
+			return chemQuery, err
+		}
+	}
+}
+
+// parseJunctor parses the junctor between two expressions
+// Tuples without a junctor in between are connected conjunctively
+func (p *cqParser) parseJunctor() (string, error) {
+	switch {
+	case p.peek() == ',':
+		p.pos++
+		return CQ_JUNCTOR_AND, nil
+	case p.peek() == '(':
+		return CQ_JUNCTOR_AND, nil
+	case p.consumeKeyword("AND"):
+		return CQ_JUNCTOR_AND, nil
+	case p.consumeKeyword("OR"):
+		return CQ_JUNCTOR_OR, nil
+	}
+	return "", p.errorf("expected junctor ',', 'AND' or 'OR'")
+}
+
+// parseExpression parses a tuple or a comparison
+func (p *cqParser) parseExpression() (CQExpression, error) {
+	if p.peek() == '(' {
+		return p.parseTuple()
+	}
+	return p.parseComparison()
+}
+
+// parseTuple parses an expression of the form (TYPE,ELEMENT,MIN,MAX[,UNIT[,METHOD]])
+func (p *cqParser) parseTuple() (CQExpression, error) {
+	expr := CQExpression{}
+	start := p.pos
+	p.pos++ // opening bracket
+	end := strings.IndexByte(p.query[p.pos:], ')')
+	if end < 0 {
+		return expr, p.errorAt(start, "missing closing bracket")
+	}
+	values := strings.Split(p.query[p.pos:p.pos+end], ",")
+	if len(values) < 4 || len(values) > 6 {
+		return expr, p.errorAt(start, "tuple must have 4 to 6 values: (TYPE,ELEMENT,MIN,MAX[,UNIT[,METHOD]])")
+	}
+	// positions of the values for error reporting
+	positions := make([]int, len(values))
+	offset := p.pos
+	for i, v := range values {
+		positions[i] = offset
+		offset += len(v) + 1
+		values[i] = strings.TrimSpace(v)
+	}
+	if !isCQName(values[0]) {
+		return expr, p.errorAt(positions[0], "invalid type")
+	}
+	expr.Type = values[0]
+	if values[1] != "" {
+		element, divisor, isRatio := strings.Cut(values[1], "/")
+		if element == "" || !isCQName(element) || (isRatio && (divisor == "" || !isCQName(divisor))) {
+			return expr, p.errorAt(positions[1], "invalid element")
+		}
+		expr.Element = element
+		expr.Divisor = divisor
+	}
+	for i, bound := range []*string{&expr.MinValue, &expr.MaxValue} {
+		v := values[2+i]
+		if v != "" && !cqNumberRegex.MatchString(v) {
+			return expr, p.errorAt(positions[2+i], "invalid number")
+		}
+		*bound = v
+	}
+	if len(values) > 4 {
+		expr.Unit = values[4]
+	}
+	if len(values) > 5 {
+		expr.Method = values[5]
+	}
+	if expr.Type == "" && expr.Element == "" {
+		return expr, p.errorAt(start, "tuple needs a type or an element")
+	}
+	p.pos += end + 1
+	return expr, nil
+}
+
+// parseComparison parses an expression of the form ELEMENT OPERATOR VALUE
+func (p *cqParser) parseComparison() (CQExpression, error) {
+	expr := CQExpression{}
+	expr.Element = p.consumeName()
+	if expr.Element == "" {
+		return expr, p.errorf("expected '(' or element")
+	}
+	if p.peek() == '/' {
+		p.pos++
+		expr.Divisor = p.consumeName()
+		if expr.Divisor == "" {
+			return expr, p.errorf("expected element as divisor")
+		}
+	}
+	p.skipSpace()
+	operator := ""
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(p.query[p.pos:], op) {
+			operator = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if operator == "" {
+		return expr, p.errorf("expected operator >, >=, <, <= or =")
+	}
+	p.skipSpace()
+	start := p.pos
+	for !p.eof() && strings.ContainsRune("0123456789.eE+-", p.peek()) {
+		p.pos++
+	}
+	value := p.query[start:p.pos]
+	if !cqNumberRegex.MatchString(value) {
+		return expr, p.errorAt(start, "invalid number")
+	}
+	switch operator {
+	case ">", ">=":
+		expr.MinValue = value
+		expr.MinExclusive = operator == ">"
+	case "<", "<=":
+		expr.MaxValue = value
+		expr.MaxExclusive = operator == "<"
+	case "=":
+		expr.MinValue = value
+		expr.MaxValue = value
+	}
+	return expr, nil
+}
+
+// consumeKeyword consumes the case-insensitive keyword if it is not followed by a name character
+func (p *cqParser) consumeKeyword(keyword string) bool {
+	end := p.pos + len(keyword)
+	if end > len(p.query) || !strings.EqualFold(p.query[p.pos:end], keyword) {
+		return false
+	}
+	if next, _ := utf8.DecodeRuneInString(p.query[end:]); end < len(p.query) && isCQNameRune(next) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+// consumeName consumes a name of letters, digits and underscores
+func (p *cqParser) consumeName() string {
+	start := p.pos
+	for !p.eof() && isCQNameRune(p.peek()) {
+		_, size := utf8.DecodeRuneInString(p.query[p.pos:])
+		p.pos += size
+	}
+	return p.query[start:p.pos]
+}
+
+func (p *cqParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+func (p *cqParser) eof() bool {
+	return p.pos >= len(p.query)
+}
+
+func (p *cqParser) peek() rune {
+	r, _ := utf8.DecodeRuneInString(p.query[p.pos:])
+	return r
+}
+
+func (p *cqParser) errorf(msg string) error {
+	return p.errorAt(p.pos, msg)
+}
+
+// errorAt returns a ChemQueryError for the byte offset pos in the query
+func (p *cqParser) errorAt(pos int, msg string) error {
+	return &ChemQueryError{Position: utf8.RuneCountInString(p.query[:pos]) + 1, Msg: msg}
+}
+
+// isCQName returns whether all characters of the string are valid name characters
+func isCQName(s string) bool {
+	for _, r := range s {
+		if !isCQNameRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isCQNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
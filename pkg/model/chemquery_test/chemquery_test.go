@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package chemquery_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+func TestParseChemQuery(t *testing.T) {
+	tests := map[string][]model.CQExpression{
+		"(MAJOR,SiO2,45,55)": {
+			{Junctor: model.CQ_JUNCTOR_NONE, Type: "MAJOR", Element: "SiO2", MinValue: "45", MaxValue: "55"},
+		},
+		"(MAJOR,SiO2,45,55),(TRACE,Sr,,)": {
+			{Junctor: model.CQ_JUNCTOR_NONE, Type: "MAJOR", Element: "SiO2", MinValue: "45", MaxValue: "55"},
+			{Junctor: model.CQ_JUNCTOR_AND, Type: "TRACE", Element: "Sr"},
+		},
+		"(MAJOR,SiO2,45,55)(TRACE,Sr,,)": {
+			{Junctor: model.CQ_JUNCTOR_NONE, Type: "MAJOR", Element: "SiO2", MinValue: "45", MaxValue: "55"},
+			{Junctor: model.CQ_JUNCTOR_AND, Type: "TRACE", Element: "Sr"},
+		},
+		"SiO2>49 or MgO<=9.5": {
+			{Junctor: model.CQ_JUNCTOR_NONE, Element: "SiO2", MinValue: "49", MinExclusive: true},
+			{Junctor: model.CQ_JUNCTOR_OR, Element: "MgO", MaxValue: "9.5"},
+		},
+		"La/Yb >= 10 AND (ISOTOPE,d18O,-3.5,1e1,PERMIL,SIMS)": {
+			{Junctor: model.CQ_JUNCTOR_NONE, Element: "La", Divisor: "Yb", MinValue: "10"},
+			{Junctor: model.CQ_JUNCTOR_AND, Type: "ISOTOPE", Element: "d18O", MinValue: "-3.5", MaxValue: "1e1", Unit: "PERMIL", Method: "SIMS"},
+		},
+		"Sr=120": {
+			{Junctor: model.CQ_JUNCTOR_NONE, Element: "Sr", MinValue: "120", MaxValue: "120"},
+		},
+		"(,Ni/Co,,.5)": {
+			{Junctor: model.CQ_JUNCTOR_NONE, Element: "Ni", Divisor: "Co", MaxValue: ".5"},
+		},
+	}
+	for query, expected := range tests {
+		chemQuery, err := model.ParseChemQuery(query)
+		if err != nil {
+			t.Fatalf("Input: %s | Error: %s", query, err)
+		}
+		if fmt.Sprint(chemQuery.Expressions) != fmt.Sprint(expected) {
+			t.Fatalf("Input: %s | Output: %v | Expected: %v", query, chemQuery.Expressions, expected)
+		}
+	}
+}
+
+func TestParseChemQueryInvalid(t *testing.T) {
+	tests := map[string]int{
+		"":                           1,
+		"(MAJOR,SiO2,45,55":          1,
+		"(,,45,55)":                  1,
+		"(MAJOR,SiO2,4x5,55)":        13,
+		"(MAJOR,Si-O2,45,55)":        8,
+		"(MAJOR,SiO2,45)":            1,
+		"SiO2 > abc":                 8,
+		"SiO2 ~ 45":                  6,
+		"SiO2>45 XOR MgO<9":          9,
+		"SiO2>45 AND":                12,
+		"(MAJOR,SiO2,45,55) OR MgO/": 27,
+	}
+	for query, position := range tests {
+		_, err := model.ParseChemQuery(query)
+		var chemErr *model.ChemQueryError
+		if !errors.As(err, &chemErr) {
+			t.Fatalf("Input: %s | Output: %v | Expected: ChemQueryError", query, err)
+		}
+		if chemErr.Position != position {
+			t.Fatalf("Input: %s | Output: %d (%s) | Expected: position %d", query, chemErr.Position, chemErr.Msg, position)
+		}
+	}
+}
@@ -28,6 +28,11 @@ type GeoJSONFeatureCollection struct {
 	Features       []GeoJSONFeature   `json:"features"`
 	NumberMatched  int                `json:"numberMatched"`
 	NumberReturned int                `json:"numberReturned"`
+	// Truncated is set if features were omitted because the collection exceeds its maximum size
+	Truncated bool `json:"truncated,omitempty"`
+	// TimeStamp and Links are set by the OGC API Features endpoints
+	TimeStamp string    `json:"timeStamp,omitempty"`
+	Links     []OGCLink `json:"links,omitempty"`
 }
 
 // GeoJSON Feature
@@ -49,6 +54,17 @@ type GeoJSONCluster struct {
 	ClusterID  int            `json:"clusterID"`
 	Centroid   GeoJSONFeature `json:"centroid"`
 	ConvexHull GeoJSONFeature `json:"convexHull"`
+	// TileKey is the key ZOOM/X/Y of the geotile of the cluster
+	TileKey string `json:"tileKey,omitempty"`
+	// TileBounds is the bounding box [WEST, SOUTH, EAST, NORTH] of the geotile of the cluster
+	TileBounds []float64 `json:"tileBounds,omitempty"`
+	// DrillDownBBox is the bbox of the samples of the cluster formatted like the bbox param: [[SW_Long,SW_Lat],[SE_Long,SE_Lat],[NE_Long,NE_Lat],[NW_Long,NW_Lat]]
+	DrillDownBBox [][]float64 `json:"drillDownBBox,omitempty"`
+}
+
+// GeoJSONSiteCount holds the number of aggregated GeoJSON sites
+type GeoJSONSiteCount struct {
+	NumSites int `json:"numSites"`
 }
 
 // GeoJSONSite
@@ -76,6 +92,15 @@ type GeoJSONSite struct {
 	LandOrSea *string `json:"landOrSea"`
 }
 
+// GeoJSONSiteSummary is a GeoJSONSite of the samples matching filters
+type GeoJSONSiteSummary struct {
+	GeoJSONSite
+	// Materials holds the number of samples per material; samples without material are counted as unknown
+	Materials map[string]int `json:"materials"`
+	// NumMatched is the number of sites matching the filters
+	NumMatched int `json:"numMatched"`
+}
+
 type SimplePoint struct {
 	X float64 // West - East axis in geocoordinates
 	Y float64 // South - North axis in geocoordinates
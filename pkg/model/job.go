@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package model
+
+import "time"
+
+// States of a Job
+const (
+	JOB_QUEUED   = "queued"
+	JOB_RUNNING  = "running"
+	JOB_DONE     = "done"
+	JOB_FAILED   = "failed"
+	JOB_CANCELED = "canceled"
+)
+
+// Job is the status of an asynchronous job writing a result file
+type Job struct {
+	ID string `json:"id"`
+	// Status is one of the JOB_ states
+	Status string `json:"status"`
+	// FileName is the name the result file is downloaded as
+	FileName string `json:"fileName"`
+	// Done and Total are the number of processed items and the number of all items; Total is 0 until it is known
+	Done  int `json:"done"`
+	Total int `json:"total"`
+	// Error describes why the job failed
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// nullable
+	StartedAt *time.Time `json:"startedAt"`
+	// nullable
+	FinishedAt *time.Time `json:"finishedAt"`
+	// ExpiresAt is the time the finished job and its result file are removed
+	// nullable
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// Finished returns whether the job is in a final state
+func (j Job) Finished() bool {
+	return j.Status == JOB_DONE || j.Status == JOB_FAILED || j.Status == JOB_CANCELED
+}
+
+// DownloadJobResponse is the status of a download job with the links to itself and its file
+type DownloadJobResponse struct {
+	Job
+	Links []OGCLink `json:"links"`
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package model
+
+// Models for OGC API - Features Part 1 Core. See https://docs.ogc.org/is/17-069r4/17-069r4.html
+
+// OGCLink is a link to a resource of the API
+type OGCLink struct {
+	Href  string `json:"href"`
+	Rel   string `json:"rel"`
+	Type  string `json:"type,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+// OGCLandingPage is the entry point of the API linking to its resources
+type OGCLandingPage struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Links       []OGCLink `json:"links"`
+}
+
+// OGCConformance lists the conformance classes implemented by the API
+type OGCConformance struct {
+	ConformsTo []string `json:"conformsTo"`
+}
+
+// OGCSpatialExtent holds the bounding boxes of a collection formatted [MINLON, MINLAT, MAXLON, MAXLAT]
+type OGCSpatialExtent struct {
+	BBox [][]float64 `json:"bbox"`
+	Crs  string      `json:"crs"`
+}
+
+// OGCExtent is the extent of the features of a collection
+type OGCExtent struct {
+	Spatial OGCSpatialExtent `json:"spatial"`
+}
+
+// OGCCollection describes a collection of features
+type OGCCollection struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Links       []OGCLink `json:"links"`
+	Extent      OGCExtent `json:"extent"`
+	ItemType    string    `json:"itemType"`
+	Crs         []string  `json:"crs"`
+}
+
+// OGCCollections lists the collections of the API
+type OGCCollections struct {
+	Links       []OGCLink       `json:"links"`
+	Collections []OGCCollection `json:"collections"`
+}
+
+// OGCQueryables is the JSON schema of the properties of a collection that can be used in filters
+type OGCQueryables struct {
+	Schema     string                  `json:"$schema"`
+	ID         string                  `json:"$id"`
+	Type       string                  `json:"type"`
+	Title      string                  `json:"title"`
+	Properties map[string]OGCQueryable `json:"properties"`
+}
+
+// OGCQueryable describes a property that can be used in filters
+type OGCQueryable struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Format      string `json:"format,omitempty"`
+}
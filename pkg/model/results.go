@@ -4,11 +4,6 @@
 
 package model
 
-import (
-	"fmt"
-	"regexp"
-)
-
 const (
 	CQ_JUNCTOR_NONE = "%"
 	CQ_JUNCTOR_AND  = "^"
@@ -43,46 +38,30 @@ type ElementTypeResponse struct {
 	Data     []ElementType `json:"data"`
 }
 
+// CQExpression is a single filter tuple or comparison of a chemical query
 type CQExpression struct {
-	Junctor  string
-	Type     string
-	Element  string
+	// Junctor connects the expression to the preceding expressions; CQ_JUNCTOR_NONE for the first expression
+	Junctor string
+	Type    string
+	Element string
+	// Divisor is the element the value of Element is divided by for ratio expressions like La/Yb
+	Divisor  string
 	MinValue string
 	MaxValue string
+	// MinExclusive and MaxExclusive mark bounds given with the operators > and <
+	MinExclusive bool
+	MaxExclusive bool
+	Unit         string
+	Method       string
 }
 
-type ChemQuery struct {
-	Expressions []CQExpression
+// IsRatio returns whether the expression filters on the ratio of two elements
+func (e CQExpression) IsRatio() bool {
+	return e.Divisor != ""
 }
 
-// ParseChemQuery takes a chemistry query DSL string and parses it into a ChemQuery structure
-func ParseChemQuery(query string) (ChemQuery, error) {
-	chemQuery := ChemQuery{}
-	expressionRegex := regexp.MustCompile(`\(([\w]+)?,([\w\d]+)?,([\d\.]+)?,([\d\.]+)?\)`)
-	matches := expressionRegex.FindAllStringSubmatch(query, -1)
-	if len(matches) == 0 {
-		return chemQuery, fmt.Errorf("can not parse chemical query")
-	}
-	for i, match := range matches {
-		junctor := CQ_JUNCTOR_AND
-		if i == 0 {
-			// first expression gets no junctor
-			junctor = CQ_JUNCTOR_NONE
-		}
-		expr := CQExpression{
-			Junctor:  junctor,
-			Type:     match[1],
-			Element:  match[2],
-			MinValue: match[3],
-			MaxValue: match[4],
-		}
-		// omit expressions without type or element as they make no sense
-		if expr.Type == "" && expr.Element == "" {
-			continue
-		}
-		chemQuery.Expressions = append(chemQuery.Expressions, expr)
-	}
-	return chemQuery, nil
+type ChemQuery struct {
+	Expressions []CQExpression
 }
 
 type Result struct {
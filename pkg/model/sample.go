@@ -124,12 +124,25 @@ type SampleByFiltersData struct {
 	GeologicalAgesMin    []*string      `json:"geologicalAgesMin"`
 	GeologicalAgesMax    []*string      `json:"geologicalAgesMax"`
 	SelectedMeasurements []*Measurement `json:"selectedMeasurements"`
+	// only filled for full text searches
+	Highlights map[string][]string `json:"highlights,omitempty"`
+	// only filled for near filters: distance to the center in km
+	Distance *float64 `json:"distance,omitempty"`
 }
 
 type SampleByFilterResponse struct {
 	NumItems   int                   `json:"numItems"`
 	TotalCount int                   `json:"totalCount"`
 	Data       []SampleByFiltersData `json:"data"`
+	NextCursor string                `json:"nextCursor,omitempty"`
+}
+
+// SparseSampleResponse holds the sample documents reduced to the requested fields
+type SparseSampleResponse struct {
+	NumItems   int              `json:"numItems"`
+	TotalCount int              `json:"totalCount"`
+	Data       []map[string]any `json:"data"`
+	NextCursor string           `json:"nextCursor,omitempty"`
 }
 
 type ClusteredSample struct {
@@ -3,12 +3,67 @@ package model
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 )
 
 type SearchIndexPage struct {
 	TotalHits    int              `json:"totalHits"`
 	Documents    []map[string]any `json:"documents"`
 	Aggregations map[string]any   `json:"aggregations"`
+	NextCursor   string           `json:"nextCursor,omitempty"`
+	// Highlights holds the fragments matching the full text search per field for each of the Documents; nil without full text search
+	Highlights []map[string][]string `json:"highlights,omitempty"`
+	// Distances holds the distance of each of the Documents to the center of the near filter in km; nil without near filter
+	Distances []float64 `json:"distances,omitempty"`
+}
+
+// FacetAggregation holds the buckets of a facet of a search
+type FacetAggregation struct {
+	Buckets []FacetBucket `json:"buckets"`
+}
+
+// FacetBucket holds the number of samples with the value of the key
+type FacetBucket struct {
+	Key      string `json:"key"`
+	DocCount int    `json:"doc_count"`
+}
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type FacetResponse struct {
+	TotalHits int                     `json:"totalHits"`
+	Facets    map[string][]FacetValue `json:"facets"`
+}
+
+type SuggestResponse struct {
+	NumItems int          `json:"numItems"`
+	Data     []FacetValue `json:"data"`
+}
+
+// ParseToFacetResponse creates the FacetResponse from the facet aggregations of the page
+func ParseToFacetResponse(page SearchIndexPage) (FacetResponse, error) {
+	resp := FacetResponse{TotalHits: page.TotalHits, Facets: map[string][]FacetValue{}}
+	// marshal into FacetAggregations first
+	bytes, err := json.Marshal(page.Aggregations)
+	if err != nil {
+		return resp, err
+	}
+	aggs := map[string]FacetAggregation{}
+	err = json.Unmarshal(bytes, &aggs)
+	if err != nil {
+		return resp, err
+	}
+	for name, agg := range aggs {
+		values := make([]FacetValue, 0, len(agg.Buckets))
+		for _, b := range agg.Buckets {
+			values = append(values, FacetValue{Value: b.Key, Count: b.DocCount})
+		}
+		resp.Facets[name] = values
+	}
+	return resp, nil
 }
 
 type GeoPoint struct {
@@ -28,6 +83,33 @@ type Bucket struct {
 	Key      string      `json:"key"`
 	DocCount int         `json:"doc_count"`
 	Centroid CentroidAgg `json:"centroid"`
+	Bounds   BoundsAgg   `json:"bounds"`
+	// Stats holds the requested statistics of the samples of the bucket as centroid properties
+	Stats map[string]any `json:"-"`
+}
+
+// ElementStats holds the statistics of the measured values of an element
+type ElementStats struct {
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	Max    float64 `json:"max"`
+}
+
+// Density holds the cells of a density grid
+type Density struct {
+	Cells []DensityCell
+	// Truncated is set if cells were omitted because the grid has more than the maximum number of cells
+	Truncated bool
+}
+
+// DensityCell holds the number of documents of a cell of a density grid
+type DensityCell struct {
+	// Key is the geohash, the geotile key or the H3 index of the cell
+	Key      string
+	DocCount int
+	// Mean is the mean value of the element of the density grid; nil if the cell holds no measurement of it
+	Mean *float64
 }
 
 type CentroidAgg struct {
@@ -35,11 +117,42 @@ type CentroidAgg struct {
 	Location AggLocation `json:"location"`
 }
 
+// BoundsAgg holds the bounding box of the locations of a geo_bounds aggregation; nil if there are no locations
+type BoundsAgg struct {
+	Bounds *GeoBounds `json:"bounds"`
+}
+
+type GeoBounds struct {
+	TopLeft     AggLocation `json:"top_left"`
+	BottomRight AggLocation `json:"bottom_right"`
+}
+
 type AggLocation struct {
 	Lon float64 `json:"lon"`
 	Lat float64 `json:"lat"`
 }
 
+// SelectMeasurements returns the measured values of the elements in all batches of the document
+func SelectMeasurements(doc map[string]any, elements []string) []*Measurement {
+	measurements := []*Measurement{}
+	batches, _ := doc["batchData"].([]any)
+	for _, b := range batches {
+		batch, _ := b.(map[string]any)
+		results, _ := batch["results"].([]any)
+		for _, r := range results {
+			result, _ := r.(map[string]any)
+			element, _ := result["itemName"].(string)
+			value, ok := result["value"].(float64)
+			if !ok || !slices.Contains(elements, element) {
+				continue
+			}
+			unit, _ := result["unit"].(string)
+			measurements = append(measurements, &Measurement{Element: element, Value: value, Unit: unit})
+		}
+	}
+	return measurements
+}
+
 func ParseToSampleByFiltersData(doc map[string]any) (*SampleByFiltersData, error) {
 	// marhsal into fullData first
 	bytes, err := json.Marshal(doc)
@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package mvt encodes point features as Mapbox Vector Tiles (specification version 2)
+package mvt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+)
+
+const (
+	// CONTENT_TYPE is the media type of encoded tiles
+	CONTENT_TYPE = "application/vnd.mapbox-vector-tile"
+	// DEFAULT_EXTENT is the number of units along each side of a tile
+	DEFAULT_EXTENT = 4096
+
+	VERSION = 2
+)
+
+// protobuf field numbers of the vector tile schema
+const (
+	tileLayers = 3
+
+	layerVersion  = 15
+	layerName     = 1
+	layerFeatures = 2
+	layerKeys     = 3
+	layerValues   = 4
+	layerExtent   = 5
+
+	featureID       = 1
+	featureTags     = 2
+	featureType     = 3
+	featureGeometry = 4
+
+	valueString = 1
+	valueDouble = 3
+	valueInt    = 4
+	valueBool   = 7
+
+	geomTypePoint = 1
+	cmdMoveTo     = 1
+)
+
+// protobuf wire types
+const (
+	wireVarint = 0
+	wire64Bit  = 1
+	wireBytes  = 2
+)
+
+// Layer is a named layer of point features
+type Layer struct {
+	Name string
+	// Extent is the number of units along each side of the tile; DEFAULT_EXTENT if 0
+	Extent   int
+	Features []Feature
+}
+
+// Feature is a point feature positioned in tile units with the origin in the north west corner
+// Properties can hold string, bool, integer and float values
+type Feature struct {
+	ID         uint64
+	X          int
+	Y          int
+	Properties map[string]any
+}
+
+// Encode encodes the layers as vector tile
+func Encode(layers ...Layer) ([]byte, error) {
+	tile := []byte{}
+	for _, layer := range layers {
+		b, err := encodeLayer(layer)
+		if err != nil {
+			return nil, fmt.Errorf("can not encode layer %s: %w", layer.Name, err)
+		}
+		tile = appendBytes(tile, tileLayers, b)
+	}
+	return tile, nil
+}
+
+// encodeLayer encodes the features of a layer with the keys and values of their properties
+func encodeLayer(layer Layer) ([]byte, error) {
+	extent := layer.Extent
+	if extent <= 0 {
+		extent = DEFAULT_EXTENT
+	}
+	keys := []string{}
+	keyIndex := map[string]int{}
+	values := [][]byte{}
+	valueIndex := map[string]int{}
+
+	b := appendVarint(nil, layerVersion, VERSION)
+	b = appendBytes(b, layerName, []byte(layer.Name))
+	for _, feature := range layer.Features {
+		tags := []uint64{}
+		// sort the property names for reproducible tiles
+		names := make([]string, 0, len(feature.Properties))
+		for name := range feature.Properties {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			value, err := encodeValue(feature.Properties[name])
+			if err != nil {
+				return nil, fmt.Errorf("property %s: %w", name, err)
+			}
+			if value == nil {
+				continue
+			}
+			ki, ok := keyIndex[name]
+			if !ok {
+				ki = len(keys)
+				keyIndex[name] = ki
+				keys = append(keys, name)
+			}
+			vi, ok := valueIndex[string(value)]
+			if !ok {
+				vi = len(values)
+				valueIndex[string(value)] = vi
+				values = append(values, value)
+			}
+			tags = append(tags, uint64(ki), uint64(vi))
+		}
+		f := []byte{}
+		if feature.ID != 0 {
+			f = appendVarint(f, featureID, feature.ID)
+		}
+		if len(tags) > 0 {
+			f = appendPacked(f, featureTags, tags)
+		}
+		f = appendVarint(f, featureType, geomTypePoint)
+		f = appendPacked(f, featureGeometry, []uint64{command(cmdMoveTo, 1), zigzag(feature.X), zigzag(feature.Y)})
+		b = appendBytes(b, layerFeatures, f)
+	}
+	for _, key := range keys {
+		b = appendBytes(b, layerKeys, []byte(key))
+	}
+	for _, value := range values {
+		b = appendBytes(b, layerValues, value)
+	}
+	b = appendVarint(b, layerExtent, uint64(extent))
+	return b, nil
+}
+
+// encodeValue encodes a property value as vector tile value; nil values are skipped
+func encodeValue(v any) ([]byte, error) {
+	switch value := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return appendBytes(nil, valueString, []byte(value)), nil
+	case bool:
+		if value {
+			return appendVarint(nil, valueBool, 1), nil
+		}
+		return appendVarint(nil, valueBool, 0), nil
+	case int:
+		return appendVarint(nil, valueInt, uint64(value)), nil
+	case int64:
+		return appendVarint(nil, valueInt, uint64(value)), nil
+	case float64:
+		b := appendKey(nil, valueDouble, wire64Bit)
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(value)), nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+// command returns the command integer of a geometry command repeated count times
+func command(id int, count int) uint64 {
+	return uint64(id&0x7) | uint64(count)<<3
+}
+
+// zigzag encodes a signed parameter integer of a geometry
+func zigzag(v int) uint64 {
+	n := int32(v)
+	return uint64(uint32((n << 1) ^ (n >> 31)))
+}
+
+func appendKey(b []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wireType))
+}
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	b = appendKey(b, field, wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendKey(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendPacked(b []byte, field int, values []uint64) []byte {
+	packed := []byte{}
+	for _, v := range values {
+		packed = binary.AppendUvarint(packed, v)
+	}
+	return appendBytes(b, field, packed)
+}
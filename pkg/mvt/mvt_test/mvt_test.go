@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package mvt_test
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/mvt"
+)
+
+// field is a decoded protobuf field holding either a varint, a fixed 64 bit value or bytes
+type field struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+// decode splits a protobuf message into its fields
+func decode(t *testing.T, b []byte) []field {
+	t.Helper()
+	fields := []field{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("invalid field key")
+		}
+		b = b[n:]
+		f := field{num: int(key >> 3)}
+		switch key & 0x7 {
+		case 0:
+			f.varint, n = binary.Uvarint(b)
+			b = b[n:]
+		case 1:
+			f.varint = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			f.bytes = b[n : n+int(length)]
+			b = b[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&0x7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// packed decodes packed varints
+func packed(b []byte) []uint64 {
+	values := []uint64{}
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values
+}
+
+func unzigzag(v uint64) int {
+	return int(int32(v>>1) ^ -int32(v&1))
+}
+
+type decodedFeature struct {
+	id         uint64
+	geomType   uint64
+	geometry   []uint64
+	properties map[string]any
+}
+
+func decodeLayer(t *testing.T, b []byte) (string, uint64, []decodedFeature) {
+	t.Helper()
+	name := ""
+	extent := uint64(0)
+	keys := []string{}
+	values := []any{}
+	rawFeatures := [][]byte{}
+	for _, f := range decode(t, b) {
+		switch f.num {
+		case 1:
+			name = string(f.bytes)
+		case 2:
+			rawFeatures = append(rawFeatures, f.bytes)
+		case 3:
+			keys = append(keys, string(f.bytes))
+		case 4:
+			v := decode(t, f.bytes)[0]
+			switch v.num {
+			case 1:
+				values = append(values, string(v.bytes))
+			case 3:
+				values = append(values, math.Float64frombits(v.varint))
+			case 4:
+				values = append(values, int(v.varint))
+			case 7:
+				values = append(values, v.varint == 1)
+			}
+		case 5:
+			extent = f.varint
+		case 15:
+			if f.varint != mvt.VERSION {
+				t.Errorf("expected version %d, got %d", mvt.VERSION, f.varint)
+			}
+		}
+	}
+	features := []decodedFeature{}
+	for _, raw := range rawFeatures {
+		feature := decodedFeature{properties: map[string]any{}}
+		for _, f := range decode(t, raw) {
+			switch f.num {
+			case 1:
+				feature.id = f.varint
+			case 2:
+				tags := packed(f.bytes)
+				for i := 0; i+1 < len(tags); i += 2 {
+					feature.properties[keys[tags[i]]] = values[tags[i+1]]
+				}
+			case 3:
+				feature.geomType = f.varint
+			case 4:
+				feature.geometry = packed(f.bytes)
+			}
+		}
+		features = append(features, feature)
+	}
+	return name, extent, features
+}
+
+func TestEncode(t *testing.T) {
+	b, err := mvt.Encode(mvt.Layer{
+		Name: "samples",
+		Features: []mvt.Feature{
+			{ID: 1, X: 10, Y: 4000, Properties: map[string]any{"sampleName": "ICE-01", "size": 3, "mean": 51.5, "public": true}},
+			{ID: 2, X: -5, Y: 0, Properties: map[string]any{"sampleName": "ICE-01", "size": 4, "missing": nil}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers := decode(t, b)
+	if len(layers) != 1 || layers[0].num != 3 {
+		t.Fatalf("expected one layer, got %v", layers)
+	}
+	name, extent, features := decodeLayer(t, layers[0].bytes)
+	if name != "samples" || extent != mvt.DEFAULT_EXTENT {
+		t.Errorf("expected layer samples with extent %d, got %s with %d", mvt.DEFAULT_EXTENT, name, extent)
+	}
+	if len(features) != 2 {
+		t.Fatalf("expected 2 features, got %d", len(features))
+	}
+	expected := []struct {
+		id         uint64
+		x, y       int
+		properties map[string]any
+	}{
+		{1, 10, 4000, map[string]any{"sampleName": "ICE-01", "size": 3, "mean": 51.5, "public": true}},
+		{2, -5, 0, map[string]any{"sampleName": "ICE-01", "size": 4}},
+	}
+	for i, e := range expected {
+		f := features[i]
+		if f.id != e.id || f.geomType != 1 {
+			t.Errorf("expected point feature %d, got %d of type %d", e.id, f.id, f.geomType)
+		}
+		// MoveTo with one point
+		if len(f.geometry) != 3 || f.geometry[0] != 9 {
+			t.Fatalf("expected MoveTo geometry, got %v", f.geometry)
+		}
+		if x, y := unzigzag(f.geometry[1]), unzigzag(f.geometry[2]); x != e.x || y != e.y {
+			t.Errorf("expected point %d,%d, got %d,%d", e.x, e.y, x, y)
+		}
+		if len(f.properties) != len(e.properties) {
+			t.Errorf("expected properties %v, got %v", e.properties, f.properties)
+		}
+		for k, v := range e.properties {
+			if f.properties[k] != v {
+				t.Errorf("expected property %s=%v, got %v", k, v, f.properties[k])
+			}
+		}
+	}
+}
+
+func TestEncodeUnsupportedValue(t *testing.T) {
+	_, err := mvt.Encode(mvt.Layer{
+		Name:     "samples",
+		Features: []mvt.Feature{{Properties: map[string]any{"list": []string{"a"}}}},
+	})
+	if err == nil {
+		t.Error("expected error for unsupported property value")
+	}
+}
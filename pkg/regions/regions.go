@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package regions holds the registry of named regions that can be used as spatial filters
+package regions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// FILE_EXTENSION is the extension of the GeoJSON files of the regions; the file name without extension is the region id
+const FILE_EXTENSION = ".geojson"
+
+// Region is a named area given as GeoJSON
+type Region struct {
+	ID          string
+	Name        string
+	Description string
+	// Feature holds the repaired (multi-)polygon of the region
+	Feature model.GeoJSONFeature
+}
+
+// regionFile holds the descriptive members of a region file
+// The members are taken from the FeatureCollection or from the properties of the first feature
+type regionFile struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Features    []struct {
+		Properties map[string]any `json:"properties"`
+	} `json:"features"`
+	Properties map[string]any `json:"properties"`
+}
+
+var (
+	registry   = map[string]Region{}
+	registryMu sync.RWMutex
+)
+
+// LoadDir replaces the registered regions with the regions of all GeoJSON files in the directory
+func LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("can not read regions directory: %w", err)
+	}
+	loaded := map[string]Region{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), FILE_EXTENSION) {
+			continue
+		}
+		region, err := loadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("can not load region %s: %w", entry.Name(), err)
+		}
+		loaded[region.ID] = region
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = loaded
+	return nil
+}
+
+// loadFile loads a region from a GeoJSON file
+func loadFile(path string) (Region, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Region{}, err
+	}
+	feature, err := geometry.ParseGeoJSONArea(b)
+	if err != nil {
+		return Region{}, err
+	}
+	feature, err = geometry.RepairPolygon(feature)
+	if err != nil {
+		return Region{}, err
+	}
+	file := regionFile{}
+	err = json.Unmarshal(b, &file)
+	if err != nil {
+		return Region{}, err
+	}
+	properties := file.Properties
+	if len(file.Features) > 0 {
+		properties = file.Features[0].Properties
+	}
+	id := strings.ToLower(strings.TrimSuffix(filepath.Base(path), FILE_EXTENSION))
+	region := Region{
+		ID:          id,
+		Name:        file.Name,
+		Description: file.Description,
+		Feature:     feature,
+	}
+	if name, ok := properties["name"].(string); ok && region.Name == "" {
+		region.Name = name
+	}
+	if description, ok := properties["description"].(string); ok && region.Description == "" {
+		region.Description = description
+	}
+	if region.Name == "" {
+		region.Name = id
+	}
+	return region, nil
+}
+
+// Lookup returns the region of the id and whether it exists
+func Lookup(id string) (Region, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	region, ok := registry[strings.ToLower(id)]
+	return region, ok
+}
+
+// List returns all regions sorted by id
+func List() []Region {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	regions := make([]Region, 0, len(registry))
+	for _, region := range registry {
+		regions = append(regions, region)
+	}
+	slices.SortFunc(regions, func(a, b Region) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return regions
+}
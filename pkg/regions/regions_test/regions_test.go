@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package regions_test
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/regions"
+)
+
+const FIXTURES = "fixtures"
+
+func TestLoadDir(t *testing.T) {
+	err := regions.LoadDir(FIXTURES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := regions.List()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 regions, got %d", len(list))
+	}
+	expected := []struct {
+		id   string
+		name string
+	}{
+		{"aleutian_arc", "Aleutian Arc"},
+		{"mid_atlantic_ridge", "Mid-Atlantic Ridge"},
+	}
+	for i, e := range expected {
+		if list[i].ID != e.id || list[i].Name != e.name {
+			t.Errorf("expected region %s (%s), got %s (%s)", e.id, e.name, list[i].ID, list[i].Name)
+		}
+		if list[i].Description == "" {
+			t.Errorf("expected description of region %s", e.id)
+		}
+	}
+
+	region, ok := regions.Lookup("Aleutian_Arc")
+	if !ok {
+		t.Fatal("expected case-insensitive lookup of aleutian_arc")
+	}
+	if region.Feature.Geometry.Type != model.GEOJSON_GEOMETRY_POLYGON {
+		t.Errorf("expected Polygon, got %s", region.Feature.Geometry.Type)
+	}
+	if _, ok := regions.Lookup("atlantis"); ok {
+		t.Error("expected unknown region atlantis")
+	}
+}
+
+func TestLoadDirInvalid(t *testing.T) {
+	err := regions.LoadDir(filepath.Join(FIXTURES, "missing"))
+	if err == nil {
+		t.Error("expected error for missing directory")
+	}
+
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "point.geojson"), []byte(`{"type": "Point", "coordinates": [0, 0]}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = regions.LoadDir(dir)
+	if err == nil {
+		t.Error("expected error for region without area")
+	}
+}
+
+func TestRegionFilter(t *testing.T) {
+	err := regions.LoadDir(FIXTURES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := filter.Parse(url.Values{filter.KEY_REGION: {"aleutian_arc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Region == nil {
+		t.Fatal("expected region shape")
+	}
+	// the arc crosses the antimeridian and is split like drawn polygons
+	wrapped, err := filter.WrappedFeature(f.Region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	polygons, err := geometry.GetPolygonRings(&wrapped.Geometry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(polygons) != 2 {
+		t.Errorf("expected aleutian_arc split into 2 polygons, got %d", len(polygons))
+	}
+
+	_, err = filter.Parse(url.Values{filter.KEY_REGION: {"atlantis"}})
+	if err == nil {
+		t.Error("expected error for unknown region")
+	}
+}
@@ -0,0 +1,291 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// Statistics of the samples of a cluster
+const (
+	// CLUSTERSTAT_ROCKCLASS is the most frequent rock class name
+	CLUSTERSTAT_ROCKCLASS = "rockclass"
+	// CLUSTERSTAT_SETTING are the TOP_SETTINGS most frequent tectonic settings
+	CLUSTERSTAT_SETTING = "setting"
+	// CLUSTERSTAT_AGE is the range of the specimen ages
+	CLUSTERSTAT_AGE = "age"
+	// CLUSTERSTAT_ELEMENT is the minimum, median and maximum value of an element given as element:ELEMENT
+	CLUSTERSTAT_ELEMENT = "element"
+
+	TOP_SETTINGS = 3
+
+	KEY_STAT_PREFIX = "stat_"
+)
+
+// Properties of the cluster centroids holding the statistics
+const (
+	PROPERTY_ROCKCLASS = "rockClass"
+	PROPERTY_SETTINGS  = "settings"
+	PROPERTY_AGEMIN    = "ageMin"
+	PROPERTY_AGEMAX    = "ageMax"
+	PROPERTY_ELEMENTS  = "elements"
+)
+
+// clusterStatFacets holds the facets of the statistics aggregating terms and their number of buckets
+var clusterStatFacets = map[string]struct {
+	facet Facet
+	size  int
+}{
+	CLUSTERSTAT_ROCKCLASS: {Facet{Name: KEY_STAT_PREFIX + CLUSTERSTAT_ROCKCLASS, Field: "rockclass", Path: "rockClasses.value", NestedPath: "rockClasses"}, 1},
+	CLUSTERSTAT_SETTING:   {Facet{Name: KEY_STAT_PREFIX + CLUSTERSTAT_SETTING, Field: "setting"}, TOP_SETTINGS},
+}
+
+// ClusterStat is a statistic of the samples of each cluster
+type ClusterStat struct {
+	// Name is one of the CLUSTERSTAT_ names
+	Name string
+	// Element is the item name of element statistics
+	Element string
+}
+
+// ParseClusterStats parses the comma-separated statistics rockclass, setting, age and element:ELEMENT
+func ParseClusterStats(v string) ([]ClusterStat, error) {
+	stats := []ClusterStat{}
+	for _, part := range strings.Split(v, filter.DELIM) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, element, _ := strings.Cut(part, ":")
+		stat := ClusterStat{Name: strings.ToLower(name)}
+		switch stat.Name {
+		case CLUSTERSTAT_ROCKCLASS, CLUSTERSTAT_SETTING, CLUSTERSTAT_AGE:
+			if element != "" {
+				return nil, fmt.Errorf("cluster statistic %s takes no element", stat.Name)
+			}
+		case CLUSTERSTAT_ELEMENT:
+			if element == "" {
+				return nil, fmt.Errorf("element statistic needs an element as element:ELEMENT")
+			}
+			stat.Element = element
+		default:
+			return nil, fmt.Errorf("unknown cluster statistic %s", name)
+		}
+		if !slices.Contains(stats, stat) {
+			stats = append(stats, stat)
+		}
+	}
+	return stats, nil
+}
+
+// elementStatKey returns the aggregation key of the i-th statistic
+// Element names are not used as keys as they may contain characters that are not allowed in aggregation names
+func elementStatKey(i int) string {
+	return fmt.Sprintf("%s%s_%d", KEY_STAT_PREFIX, CLUSTERSTAT_ELEMENT, i)
+}
+
+// ageFields returns the search index fields of the minimum and maximum age
+func ageFields() (string, string) {
+	ageMin, _ := filter.LookupField("agemin")
+	ageMax, _ := filter.LookupField("agemax")
+	return ageMin.IndexField, ageMax.IndexField
+}
+
+// clusterStatAggregations returns the sub-aggregations of the geotile_grid aggregation computing the statistics
+func clusterStatAggregations(stats []ClusterStat) (map[string]any, error) {
+	aggs := map[string]any{}
+	for i, stat := range stats {
+		switch stat.Name {
+		case CLUSTERSTAT_ROCKCLASS, CLUSTERSTAT_SETTING:
+			statFacet := clusterStatFacets[stat.Name]
+			agg, err := facetAggregation(statFacet.facet, statFacet.size, "")
+			if err != nil {
+				return nil, err
+			}
+			aggs[statFacet.facet.Name] = agg
+		case CLUSTERSTAT_AGE:
+			ageMin, ageMax := ageFields()
+			aggs[KEY_STAT_PREFIX+PROPERTY_AGEMIN] = map[string]any{"min": map[string]any{"field": ageMin}}
+			aggs[KEY_STAT_PREFIX+PROPERTY_AGEMAX] = map[string]any{"max": map[string]any{"field": ageMax}}
+		case CLUSTERSTAT_ELEMENT:
+			valueField := filter.FIELD_RESULTS + "." + filter.FIELD_VALUE
+			aggs[elementStatKey(i)] = map[string]any{
+				"nested": map[string]any{"path": filter.FIELD_RESULTS},
+				"aggs": map[string]any{KEY_FACET_VALUES: map[string]any{
+					"filter": map[string]any{"term": map[string]any{filter.FIELD_RESULTS + "." + filter.FIELD_ITEMNAME: stat.Element}},
+					"aggs": map[string]any{
+						"min":    map[string]any{"min": map[string]any{"field": valueField}},
+						"max":    map[string]any{"max": map[string]any{"field": valueField}},
+						"median": map[string]any{"percentiles": map[string]any{"field": valueField, "percents": []float64{50}}},
+					},
+				}},
+			}
+		}
+	}
+	return aggs, nil
+}
+
+// osElementStatAggregation holds the result of the aggregation of an element statistic
+type osElementStatAggregation struct {
+	Values struct {
+		DocCount int `json:"doc_count"`
+		Min      struct {
+			Value *float64 `json:"value"`
+		} `json:"min"`
+		Max struct {
+			Value *float64 `json:"value"`
+		} `json:"max"`
+		Median struct {
+			Values map[string]*float64 `json:"values"`
+		} `json:"median"`
+	} `json:"values"`
+}
+
+// parseClusterStats returns the statistics of the sub-aggregations of a geotile_grid bucket as centroid properties
+func parseClusterStats(stats []ClusterStat, bucket map[string]json.RawMessage) (map[string]any, error) {
+	facetAggs := map[string]json.RawMessage{}
+	for _, statFacet := range clusterStatFacets {
+		if raw, ok := bucket[statFacet.facet.Name]; ok {
+			facetAggs[statFacet.facet.Name] = raw
+		}
+	}
+	b, err := json.Marshal(facetAggs)
+	if err != nil {
+		return nil, err
+	}
+	facets, err := parseFacetAggregations(b)
+	if err != nil {
+		return nil, err
+	}
+	properties := map[string]any{}
+	for i, stat := range stats {
+		switch stat.Name {
+		case CLUSTERSTAT_ROCKCLASS, CLUSTERSTAT_SETTING:
+			setFacetStat(properties, stat, facets[clusterStatFacets[stat.Name].facet.Name].Buckets)
+		case CLUSTERSTAT_AGE:
+			for _, property := range []string{PROPERTY_AGEMIN, PROPERTY_AGEMAX} {
+				agg := struct {
+					Value *float64 `json:"value"`
+				}{}
+				if raw, ok := bucket[KEY_STAT_PREFIX+property]; ok {
+					err := json.Unmarshal(raw, &agg)
+					if err != nil {
+						return nil, err
+					}
+				}
+				if agg.Value != nil {
+					properties[property] = *agg.Value
+				}
+			}
+		case CLUSTERSTAT_ELEMENT:
+			agg := osElementStatAggregation{}
+			if raw, ok := bucket[elementStatKey(i)]; ok {
+				err := json.Unmarshal(raw, &agg)
+				if err != nil {
+					return nil, err
+				}
+			}
+			values := agg.Values
+			if values.DocCount == 0 || values.Min.Value == nil || values.Max.Value == nil {
+				continue
+			}
+			elementStats := model.ElementStats{Count: values.DocCount, Min: *values.Min.Value, Max: *values.Max.Value}
+			for _, median := range values.Median.Values {
+				if median != nil {
+					elementStats.Median = *median
+				}
+			}
+			setElementStat(properties, stat.Element, elementStats)
+		}
+	}
+	return properties, nil
+}
+
+// setFacetStat sets the property of a rock class or setting statistic from the buckets of its facet
+func setFacetStat(properties map[string]any, stat ClusterStat, buckets []model.FacetBucket) {
+	if len(buckets) == 0 {
+		return
+	}
+	if stat.Name == CLUSTERSTAT_ROCKCLASS {
+		properties[PROPERTY_ROCKCLASS] = buckets[0].Key
+		return
+	}
+	settings := make([]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		settings = append(settings, bucket.Key)
+	}
+	properties[PROPERTY_SETTINGS] = settings
+}
+
+// setElementStat adds the statistic of an element to the elements property
+func setElementStat(properties map[string]any, element string, elementStats model.ElementStats) {
+	elements, ok := properties[PROPERTY_ELEMENTS].(map[string]model.ElementStats)
+	if !ok {
+		elements = map[string]model.ElementStats{}
+		properties[PROPERTY_ELEMENTS] = elements
+	}
+	elements[element] = elementStats
+}
+
+// computeClusterStats returns the statistics of the documents of a cluster as centroid properties analogous to the sub-aggregations
+func computeClusterStats(stats []ClusterStat, docs []map[string]any) (map[string]any, error) {
+	properties := map[string]any{}
+	for _, stat := range stats {
+		switch stat.Name {
+		case CLUSTERSTAT_ROCKCLASS, CLUSTERSTAT_SETTING:
+			statFacet := clusterStatFacets[stat.Name]
+			buckets, err := facetBuckets(docs, statFacet.facet, "", statFacet.size)
+			if err != nil {
+				return nil, err
+			}
+			setFacetStat(properties, stat, buckets)
+		case CLUSTERSTAT_AGE:
+			ageMinField, ageMaxField := ageFields()
+			var ageMin, ageMax *float64
+			for _, doc := range docs {
+				if v, ok := doc[ageMinField].(float64); ok && (ageMin == nil || v < *ageMin) {
+					ageMin = &v
+				}
+				if v, ok := doc[ageMaxField].(float64); ok && (ageMax == nil || v > *ageMax) {
+					ageMax = &v
+				}
+			}
+			if ageMin != nil {
+				properties[PROPERTY_AGEMIN] = *ageMin
+			}
+			if ageMax != nil {
+				properties[PROPERTY_AGEMAX] = *ageMax
+			}
+		case CLUSTERSTAT_ELEMENT:
+			values := []float64{}
+			for _, doc := range docs {
+				for _, measurement := range model.SelectMeasurements(doc, []string{stat.Element}) {
+					values = append(values, measurement.Value)
+				}
+			}
+			if len(values) == 0 {
+				continue
+			}
+			slices.Sort(values)
+			median := values[len(values)/2]
+			if len(values)%2 == 0 {
+				median = (values[len(values)/2-1] + median) / 2
+			}
+			setElementStat(properties, stat.Element, model.ElementStats{
+				Count:  len(values),
+				Min:    values[0],
+				Median: median,
+				Max:    values[len(values)-1],
+			})
+		}
+	}
+	return properties, nil
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidCursor is returned if a pagination cursor can not be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrCursorExpired is returned if the point in time of a pagination cursor expired
+	ErrCursorExpired = errors.New("cursor expired")
+)
+
+// cursor holds the state to continue a paginated search after the last returned document
+type cursor struct {
+	// PitID is the id of the point in time the search is run on; empty for indices without point in time support
+	PitID string `json:"pit,omitempty"`
+	// SearchAfter holds the sort values of the last returned document
+	SearchAfter []any `json:"after"`
+}
+
+// encodeCursor returns the cursor as opaque url-safe string
+func encodeCursor(c cursor) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("can not marshal cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor parses an opaque cursor string created by encodeCursor
+func decodeCursor(s string) (cursor, error) {
+	c := cursor{}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return c, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	if len(c.SearchAfter) == 0 {
+		return c, fmt.Errorf("%w: missing sort values", ErrInvalidCursor)
+	}
+	return c, nil
+}
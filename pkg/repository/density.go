@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// Types of density grids
+const (
+	GRID_GEOHASH = "geohash"
+	GRID_GEOTILE = "geotile"
+	// GRID_H3 is the grid of the hexagons of the H3 index which have about the same area
+	GRID_H3 = "h3"
+
+	// MAX_DENSITY_CELLS is the maximum number of cells of a density grid; the cells with the most documents are kept
+	MAX_DENSITY_CELLS = 10000
+
+	KEY_DENSITY = "density"
+	KEY_MEAN    = "mean"
+)
+
+// DEFAULT_RESOLUTIONS holds the resolution of each grid type if none is given
+var DEFAULT_RESOLUTIONS = map[string]int{
+	GRID_GEOHASH: 3,
+	GRID_GEOTILE: 5,
+	GRID_H3:      3,
+}
+
+// gridAggregations holds the aggregation of each grid type
+var gridAggregations = map[string]string{
+	GRID_GEOHASH: "geohash_grid",
+	GRID_GEOTILE: "geotile_grid",
+	GRID_H3:      "geohex_grid",
+}
+
+// DensityGrid describes the grid the samples are counted in
+type DensityGrid struct {
+	// Type is one of the GRID_ types
+	Type string
+	// Resolution is the precision of the geohashes, the zoom level of the geotiles or the resolution of the H3 cells
+	Resolution int
+	// Element is the item name of the element whose mean value is calculated per cell; empty for no mean
+	Element string
+}
+
+// NewDensityGrid returns the validated DensityGrid; a resolution below 0 selects the DEFAULT_RESOLUTIONS of the type
+func NewDensityGrid(gridType string, resolution int, element string) (DensityGrid, error) {
+	grid := DensityGrid{Type: strings.ToLower(gridType), Resolution: resolution, Element: element}
+	if grid.Type == "" {
+		grid.Type = GRID_GEOTILE
+	}
+	maxResolution := 0
+	switch grid.Type {
+	case GRID_GEOHASH:
+		maxResolution = geometry.MAX_GEOHASH_PRECISION
+	case GRID_GEOTILE:
+		maxResolution = geometry.MAX_TILE_ZOOM
+	case GRID_H3:
+		maxResolution = geometry.MAX_H3_RESOLUTION
+	default:
+		return grid, fmt.Errorf("unknown grid type %s", gridType)
+	}
+	if grid.Resolution < 0 {
+		grid.Resolution = DEFAULT_RESOLUTIONS[grid.Type]
+	}
+	// geohashes have at least one character
+	if grid.Resolution > maxResolution || (grid.Type == GRID_GEOHASH && grid.Resolution == 0) {
+		return grid, fmt.Errorf("resolution %d of grid type %s out of range", grid.Resolution, grid.Type)
+	}
+	return grid, nil
+}
+
+// CellKey returns the key of the cell containing the location like the keys of the grid aggregation
+func (grid DensityGrid) CellKey(lat float64, lon float64) (string, error) {
+	switch grid.Type {
+	case GRID_GEOHASH:
+		return geometry.GeohashOf(lat, lon, grid.Resolution), nil
+	case GRID_H3:
+		return geometry.H3CellOf(lat, lon, grid.Resolution)
+	}
+	return geometry.TileOf(lat, lon, grid.Resolution).Key(), nil
+}
+
+// CellPolygons returns the boundary of the cell of the key as rings of unclosed polygons
+// Geohashes and geotiles are aligned to the +/-180 meridian and have a single polygon formatted [SW, SE, NE, NW];
+// H3 cells crossing the meridian are split into one polygon per side
+func (grid DensityGrid) CellPolygons(key string) ([][]model.SimplePoint, error) {
+	switch grid.Type {
+	case GRID_GEOHASH:
+		bbox, err := geometry.GeohashBBox(key)
+		if err != nil {
+			return nil, err
+		}
+		return [][]model.SimplePoint{bbox}, nil
+	case GRID_H3:
+		return geometry.H3CellPolygons(key)
+	}
+	tile, err := geometry.ParseGeotileKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return [][]model.SimplePoint{tile.BBox()}, nil
+}
+
+// densityAggregation returns the grid aggregation of the density with the mean of the element per cell
+// One cell more than the maximum is requested to detect truncated grids
+func densityAggregation(grid DensityGrid) map[string]any {
+	agg := map[string]any{
+		gridAggregations[grid.Type]: map[string]any{"field": FIELD_GEOPOINT, "precision": grid.Resolution, "size": MAX_DENSITY_CELLS + 1},
+	}
+	if grid.Element != "" {
+		agg["aggs"] = map[string]any{KEY_MEAN: map[string]any{
+			"nested": map[string]any{"path": filter.FIELD_RESULTS},
+			"aggs": map[string]any{KEY_FACET_VALUES: map[string]any{
+				"filter": map[string]any{"term": map[string]any{filter.FIELD_RESULTS + "." + filter.FIELD_ITEMNAME: grid.Element}},
+				"aggs":   map[string]any{KEY_MEAN: map[string]any{"avg": map[string]any{"field": filter.FIELD_RESULTS + "." + filter.FIELD_VALUE}}},
+			}},
+		}}
+	}
+	return agg
+}
+
+// osDensityAggregation holds the buckets of the grid aggregation of a density
+type osDensityAggregation struct {
+	Buckets []struct {
+		Key      string `json:"key"`
+		DocCount int    `json:"doc_count"`
+		Mean     struct {
+			Values struct {
+				Mean struct {
+					Value *float64 `json:"value"`
+				} `json:"mean"`
+			} `json:"values"`
+		} `json:"mean"`
+	} `json:"buckets"`
+}
+
+// parseDensityAggregation returns the cells of the grid aggregation of a density
+func parseDensityAggregation(aggregations json.RawMessage) (model.Density, error) {
+	cells := []model.DensityCell{}
+	if len(aggregations) == 0 {
+		return truncateDensity(cells), nil
+	}
+	aggs := map[string]osDensityAggregation{}
+	err := json.Unmarshal(aggregations, &aggs)
+	if err != nil {
+		return model.Density{}, err
+	}
+	for _, b := range aggs[KEY_DENSITY].Buckets {
+		cells = append(cells, model.DensityCell{Key: b.Key, DocCount: b.DocCount, Mean: b.Mean.Values.Mean.Value})
+	}
+	return truncateDensity(cells), nil
+}
+
+// truncateDensity returns the first MAX_DENSITY_CELLS of the cells ordered by size and whether cells were omitted
+func truncateDensity(cells []model.DensityCell) model.Density {
+	if len(cells) > MAX_DENSITY_CELLS {
+		return model.Density{Cells: cells[:MAX_DENSITY_CELLS], Truncated: true}
+	}
+	return model.Density{Cells: cells}
+}
@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	DEFAULT_FACET_SIZE      = 20
+	DEFAULT_SUGGESTION_SIZE = 10
+	MAX_FACET_SIZE          = 1000
+
+	KEY_FACET_VALUES  = "values"
+	KEY_FACET_SAMPLES = "samples"
+)
+
+// Facet describes an aggregation of the samples matching a search by the values of a field
+type Facet struct {
+	// Name is the key of the facet in the aggregations
+	Name string
+	// Field is the name of the aggregated filter field; the bucket keys can be used as values of this filter unless Path is set
+	Field string
+	// Path overrides the search index path of the filter field, e.g. to aggregate names instead of ids
+	Path string
+	// NestedPath is the path of the nested objects holding Path
+	NestedPath string
+	// Interval aggregates numeric values into buckets of the interval instead of single terms
+	Interval int
+	// Position aggregates only the value at the 1-based position of array fields, e.g. a level of the location names
+	Position int
+}
+
+// FACETS holds the facets returned for a search
+var FACETS = []Facet{
+	{Name: "rocktype", Field: "rocktype"},
+	{Name: "rockclass", Field: "rockclass"},
+	{Name: "mineral", Field: "mineral"},
+	{Name: "setting", Field: "setting"},
+	{Name: "material", Field: "material"},
+	{Name: "geoage", Field: "geoage"},
+	{Name: "location1", Field: "location1", Position: 1},
+	{Name: "publicationdecade", Field: "publicationyear", Interval: 10},
+}
+
+// SUGGESTIONS holds the facets of the controlled vocabularies that can be suggested
+var SUGGESTIONS = []Facet{
+	{Name: "mineral", Field: "mineral"},
+	{Name: "hostmaterial", Field: "hostmaterial"},
+	{Name: "inclusionmaterial", Field: "inclusionmaterial"},
+	{Name: "rocktype", Field: "rocktype"},
+	{Name: "rockclass", Field: "rockclass", Path: "rockClasses.value", NestedPath: "rockClasses"},
+	{Name: "material", Field: "material"},
+	{Name: "setting", Field: "setting"},
+	{Name: "geoage", Field: "geoage"},
+	{Name: "location1", Field: "location1", Position: 1},
+	{Name: "location2", Field: "location2", Position: 2},
+	{Name: "location3", Field: "location3", Position: 3},
+	{Name: "lab", Field: "lab"},
+	{Name: "author", Field: "lastname"},
+}
+
+// LookupSuggestion returns the suggestion Facet of the name and whether it exists
+func LookupSuggestion(name string) (Facet, bool) {
+	for _, facet := range SUGGESTIONS {
+		if facet.Name == name {
+			return facet, true
+		}
+	}
+	return Facet{}, false
+}
+
+// indexPath returns the full search index path of the facet and its nested path
+func (facet Facet) indexPath() (string, string, error) {
+	if facet.Path != "" {
+		return facet.Path, facet.NestedPath, nil
+	}
+	field, ok := filter.LookupField(facet.Field)
+	if !ok || field.IndexField == "" {
+		return "", "", fmt.Errorf("facet %s has no search index field", facet.Name)
+	}
+	if field.NestedPath == "" {
+		return field.IndexField, "", nil
+	}
+	return field.NestedPath + "." + field.IndexField, field.NestedPath, nil
+}
+
+// facetSize returns the number of buckets per facet limited to MAX_FACET_SIZE
+func facetSize(size int, defaultSize int) int {
+	if size <= 0 {
+		return defaultSize
+	}
+	return min(size, MAX_FACET_SIZE)
+}
+
+// facetAggregations returns the aggregations of a SearchIndexPage holding the buckets of the facets
+func facetAggregations(facets map[string]model.FacetAggregation) map[string]any {
+	aggs := make(map[string]any, len(facets))
+	for name, facet := range facets {
+		aggs[name] = facet
+	}
+	return aggs
+}
+
+// foldText returns the lower case text without diacritics for accent and case insensitive comparisons
+func foldText(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// foldVariants maps the folded latin letters to all of their upper case, lower case and accented variants
+var foldVariants = func() map[rune][]rune {
+	variants := map[rune][]rune{}
+	for r := rune('A'); r <= 0x24F; r++ {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		folded := []rune(foldText(string(r)))
+		if len(folded) != 1 {
+			continue
+		}
+		variants[folded[0]] = append(variants[folded[0]], r)
+	}
+	return variants
+}()
+
+// prefixRegex returns the regular expression of the search index matching all terms starting with the prefix
+// independent of case and accents
+func prefixRegex(prefix string) string {
+	var b strings.Builder
+	for _, r := range foldText(prefix) {
+		if variants, ok := foldVariants[r]; ok {
+			b.WriteString("[" + string(variants) + "]")
+			continue
+		}
+		// escape the reserved characters of the lucene regular expressions
+		if strings.ContainsRune(`.?+*|{}[]()"\#@&<>~`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteString(".*")
+	return b.String()
+}
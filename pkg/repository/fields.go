@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// FIELDS_MINIMAL is the alias of the MINIMALFIELDS in a list of fields
+	FIELDS_MINIMAL = "minimal"
+	// FIELD_RESULTS holds the measured values of the batches
+	FIELD_RESULTS = "batchData.results"
+)
+
+// PROJECTION_FIELDS holds the fields of the sample documents that can be requested as sparse documents
+var PROJECTION_FIELDS = []string{
+	"sampleID", "sampleName", "uniqueID", "latitude", "longitude", "elevationMin", "elevationMax", "landOrSea",
+	"locationNames", "locationTypes", "tectonicSetting", "geologicalAge", "geologicalAgePrefix", "ageMin", "ageMax", "eruptionDate",
+	"rockTypes", "rockClasses", "rockTextures", "alteration", "alterationType", "samplingTechnique", "institutions", "methods",
+	"references", "references.title", "references.publicationYear", "references.externalIdentifier", "references.journal", "references.authors",
+	"batchData", "batchData.batchID", "batchData.batchName", "batchData.material", "batchData.specimenMedium", "batchData.minerals",
+	"batchData.hostMinerals", "batchData.inclusionMinerals", "batchData.inclusionTypes", FIELD_RESULTS,
+}
+
+// ParseFields parses the comma-separated list of fields and validates them against the PROJECTION_FIELDS
+// The alias FIELDS_MINIMAL expands to the MINIMALFIELDS; the sampleID is always included
+func ParseFields(v string) ([]string, error) {
+	fields := []string{"sampleID"}
+	for _, field := range strings.Split(v, ",") {
+		field = strings.TrimSpace(field)
+		switch {
+		case field == "":
+			continue
+		case field == FIELDS_MINIMAL:
+			for _, f := range MINIMALFIELDS {
+				if !slices.Contains(fields, f) {
+					fields = append(fields, f)
+				}
+			}
+		case !slices.Contains(PROJECTION_FIELDS, field):
+			return nil, fmt.Errorf("field %s can not be requested", field)
+		case !slices.Contains(fields, field):
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// ProjectDocuments returns the documents reduced to the includeFields like the source filtering of the search index
+// An empty list of includeFields returns the documents unchanged
+func ProjectDocuments(docs []map[string]any, includeFields []string) []map[string]any {
+	projected := make([]map[string]any, 0, len(docs))
+	for _, doc := range docs {
+		if len(includeFields) == 0 {
+			projected = append(projected, doc)
+			continue
+		}
+		p := map[string]any{}
+		for _, field := range includeFields {
+			includePath(doc, p, strings.Split(field, "."))
+		}
+		projected = append(projected, p)
+	}
+	return projected
+}
+
+// includePath copies the value under path from src to dst, creating intermediate objects and arrays as needed
+func includePath(src map[string]any, dst map[string]any, path []string) {
+	v, ok := src[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		dst[path[0]] = v
+		return
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		sub, ok := dst[path[0]].(map[string]any)
+		if !ok {
+			sub = map[string]any{}
+			dst[path[0]] = sub
+		}
+		includePath(t, sub, path[1:])
+	case []any:
+		// keep the array positions so that multiple included fields end up in the same objects
+		sub, ok := dst[path[0]].([]any)
+		if !ok {
+			sub = make([]any, len(t))
+			dst[path[0]] = sub
+		}
+		for i, elem := range t {
+			obj, ok := elem.(map[string]any)
+			if !ok {
+				continue
+			}
+			subObj, ok := sub[i].(map[string]any)
+			if !ok {
+				subObj = map[string]any{}
+				sub[i] = subObj
+			}
+			includePath(obj, subObj, path[1:])
+		}
+	}
+}
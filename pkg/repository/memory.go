@@ -0,0 +1,955 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// MemoryIndex is a SearchIndex holding sample documents in memory
+// It evaluates the same filter semantics as the opensearch queries and can be used to run the api without an opensearch instance
+type MemoryIndex struct {
+	documents []map[string]any
+}
+
+// documentPredicate decides whether a document matches a single filter
+type documentPredicate func(doc map[string]any) bool
+
+// valuesPredicate decides whether the values of a document field match a single filter
+type valuesPredicate func(values []any) bool
+
+// NewMemoryIndex returns a pointer to a new MemoryIndex loaded with the model.FullData documents from the JSON fixture at path
+func NewMemoryIndex(path string) (*MemoryIndex, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can not read fixture file: %w", err)
+	}
+	samples := []model.FullData{}
+	err = json.Unmarshal(b, &samples)
+	if err != nil {
+		return nil, fmt.Errorf("can not unmarshal fixture as list of samples: %w", err)
+	}
+	index := MemoryIndex{documents: make([]map[string]any, 0, len(samples))}
+	for _, sample := range samples {
+		// marshal into generic documents to evaluate filters on the same field names as in the search index
+		sampleBytes, err := json.Marshal(sample)
+		if err != nil {
+			return nil, err
+		}
+		doc := map[string]any{}
+		err = json.Unmarshal(sampleBytes, &doc)
+		if err != nil {
+			return nil, err
+		}
+		// add the geo_point field which is derived from latitude and longitude during indexing
+		if sample.Latitude != nil && sample.Longitude != nil {
+			doc[FIELD_GEOPOINT] = map[string]any{"lat": doc["latitude"], "lon": doc["longitude"]}
+		}
+		index.documents = append(index.documents, doc)
+	}
+	// keep documents sorted by sampleID like the sorted search
+	sort.SliceStable(index.documents, func(i, j int) bool {
+		return getSampleID(index.documents[i]) < getSampleID(index.documents[j])
+	})
+	log.Infof("Loaded %d documents into in-memory search index", len(index.documents))
+	return &index, nil
+}
+
+func (mi *MemoryIndex) QueryClustered(includeFields []string, f filter.Filter, zoomLevel int, stats []ClusterStat) (model.ClusterResponse, error) {
+	matches, err := mi.search(f)
+	if err != nil {
+		return model.ClusterResponse{}, fmt.Errorf("can not build query from filters: %w", err)
+	}
+	// aggregate the documents into geotiles and calculate the centroid of each tile
+	buckets := map[string]*model.Bucket{}
+	bucketDocs := map[string][]map[string]any{}
+	for _, doc := range matches {
+		lat, lon, ok := getGeoPoint(doc)
+		if !ok {
+			continue
+		}
+		key := geometry.TileOf(lat, lon, zoomLevel).Key()
+		bucket, exists := buckets[key]
+		if !exists {
+			bucket = &model.Bucket{Key: key}
+			buckets[key] = bucket
+		}
+		bucketDocs[key] = append(bucketDocs[key], doc)
+		bucket.DocCount++
+		// extend the bounds by the location like the geo_bounds aggregation
+		if bucket.Bounds.Bounds == nil {
+			bucket.Bounds.Bounds = &model.GeoBounds{
+				TopLeft:     model.AggLocation{Lat: lat, Lon: lon},
+				BottomRight: model.AggLocation{Lat: lat, Lon: lon},
+			}
+		}
+		bounds := bucket.Bounds.Bounds
+		bounds.TopLeft.Lat = math.Max(bounds.TopLeft.Lat, lat)
+		bounds.TopLeft.Lon = math.Min(bounds.TopLeft.Lon, lon)
+		bounds.BottomRight.Lat = math.Min(bounds.BottomRight.Lat, lat)
+		bounds.BottomRight.Lon = math.Max(bounds.BottomRight.Lon, lon)
+		bucket.Centroid.Count++
+		// moving average of the locations
+		bucket.Centroid.Location.Lat += (lat - bucket.Centroid.Location.Lat) / float64(bucket.Centroid.Count)
+		bucket.Centroid.Location.Lon += (lon - bucket.Centroid.Location.Lon) / float64(bucket.Centroid.Count)
+	}
+	aggs := model.ClusterAggregations{}
+	for key, bucket := range buckets {
+		if len(stats) > 0 {
+			bucket.Stats, err = computeClusterStats(stats, bucketDocs[key])
+			if err != nil {
+				return model.ClusterResponse{}, fmt.Errorf("can not compute cluster statistics: %w", err)
+			}
+		}
+		aggs.Clustering.Buckets = append(aggs.Clustering.Buckets, *bucket)
+	}
+	// order buckets by size like the geotile_grid aggregation
+	sort.Slice(aggs.Clustering.Buckets, func(i, j int) bool {
+		bi, bj := aggs.Clustering.Buckets[i], aggs.Clustering.Buckets[j]
+		if bi.DocCount != bj.DocCount {
+			return bi.DocCount > bj.DocCount
+		}
+		return bi.Key < bj.Key
+	})
+	return buildClusterResponse(aggs), nil
+}
+
+func (mi *MemoryIndex) QueryDensity(ctx context.Context, f filter.Filter, grid DensityGrid) (model.Density, error) {
+	matches, err := mi.search(f)
+	if err != nil {
+		return model.Density{}, fmt.Errorf("can not build query from filters: %w", err)
+	}
+	// count the documents per cell and sum up the values of the element for the mean
+	cells := map[string]*model.DensityCell{}
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	for _, doc := range matches {
+		lat, lon, ok := getGeoPoint(doc)
+		if !ok {
+			continue
+		}
+		key, err := grid.CellKey(lat, lon)
+		if err != nil {
+			return model.Density{}, err
+		}
+		cell, exists := cells[key]
+		if !exists {
+			cell = &model.DensityCell{Key: key}
+			cells[key] = cell
+		}
+		cell.DocCount++
+		if grid.Element == "" {
+			continue
+		}
+		for _, measurement := range model.SelectMeasurements(doc, []string{grid.Element}) {
+			sums[key] += measurement.Value
+			counts[key]++
+		}
+	}
+	result := make([]model.DensityCell, 0, len(cells))
+	for key, cell := range cells {
+		if counts[key] > 0 {
+			mean := sums[key] / float64(counts[key])
+			cell.Mean = &mean
+		}
+		result = append(result, *cell)
+	}
+	// order cells by size like the grid aggregations
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].DocCount != result[j].DocCount {
+			return result[i].DocCount > result[j].DocCount
+		}
+		return result[i].Key < result[j].Key
+	})
+	return truncateDensity(result), nil
+}
+
+func (mi *MemoryIndex) QuerySortSearchAfterStream(ctx context.Context, includeFields []string, f filter.Filter, size int, resultChan chan model.SearchIndexPage) {
+	defer close(resultChan)
+	matches, err := mi.search(f)
+	if err != nil {
+		log.Errorf("can not build query from filters: %s", err.Error())
+		return
+	}
+	sortDocuments(matches, f)
+	if size <= 0 || size > MAX_OS_PAGESIZE {
+		size = MAX_OS_PAGESIZE
+	}
+	for start := 0; start == 0 || start < len(matches); start += size {
+		// cancel retrieving hits if request context is canceled
+		select {
+		case <-ctx.Done():
+			log.Info("Request context is done - stopping search")
+			return
+		default:
+			// continue search
+		}
+		end := min(start+size, len(matches))
+		resultChan <- model.SearchIndexPage{
+			TotalHits: len(matches),
+			Documents: ProjectDocuments(matches[start:end], includeFields),
+		}
+	}
+}
+
+func (mi *MemoryIndex) QuerySortSearchAfterPaginated(ctx context.Context, includeFields []string, f filter.Filter, size int, cursorS string) (model.SearchIndexPage, error) {
+	var page model.SearchIndexPage
+	matches, err := mi.search(f)
+	if err != nil {
+		return page, fmt.Errorf("can not build query from filters: %w", err)
+	}
+	sortValues, orders := sortDocuments(matches, f)
+	start := 0
+	if cursorS != "" {
+		cur, err := decodeCursor(cursorS)
+		if err != nil {
+			return page, err
+		}
+		if len(cur.SearchAfter) != len(orders) {
+			return page, fmt.Errorf("%w: sort values do not match the sort of the search", ErrInvalidCursor)
+		}
+		// skip all documents up to the search_after values
+		start = len(matches)
+		for i := range matches {
+			if compareSortValues(sortValues[i], cur.SearchAfter, orders) > 0 {
+				start = i
+				break
+			}
+		}
+	}
+	if size <= 0 || size > MAX_OS_PAGESIZE {
+		size = MAX_OS_PAGESIZE
+	}
+	end := min(start+size, len(matches))
+	page.TotalHits = len(matches)
+	page.Documents = ProjectDocuments(matches[start:end], includeFields)
+	if f.Text != "" {
+		terms := textTerms(f.Text)
+		page.Highlights = make([]map[string][]string, 0, end-start)
+		for _, doc := range matches[start:end] {
+			highlight, _ := textMatches(doc, terms)
+			page.Highlights = append(page.Highlights, highlight)
+		}
+	}
+	if f.Near != nil {
+		page.Distances = make([]float64, 0, end-start)
+		for _, doc := range matches[start:end] {
+			distance, _ := nearDistance(doc, f.Near)
+			page.Distances = append(page.Distances, distance)
+		}
+	}
+	// there is no point in time in memory, so the cursor only holds the sort values of the last document
+	if end-start == size {
+		page.NextCursor, err = encodeCursor(cursor{SearchAfter: sortValues[end-1]})
+		if err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
+
+func (mi *MemoryIndex) QueryDocuments(ctx context.Context, includeFields []string, f filter.Filter, size int) (model.SearchIndexPage, error) {
+	page, err := mi.QuerySortSearchAfterPaginated(ctx, includeFields, f, size, "")
+	page.NextCursor = ""
+	return page, err
+}
+
+// sortDocuments sorts the documents by filter.SortKeys analogous to the search index
+// It returns the sort values of the sorted documents and the order of each key with 1 for ascending and -1 for descending
+func sortDocuments(docs []map[string]any, f filter.Filter) ([][]any, []int) {
+	keys := filter.SortKeys(f)
+	orders := make([]int, 0, len(keys))
+	for _, key := range keys {
+		order := 1
+		if key.Order == filter.SORT_DESC {
+			order = -1
+		}
+		orders = append(orders, order)
+	}
+	terms := textTerms(f.Text)
+	values := make([][]any, len(docs))
+	for i, doc := range docs {
+		values[i] = make([]any, 0, len(keys))
+		for _, key := range keys {
+			values[i] = append(values[i], sortValue(doc, key, terms))
+		}
+	}
+	// sort indices to keep documents and their sort values in line
+	indices := make([]int, len(docs))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return compareSortValues(values[indices[i]], values[indices[j]], orders) < 0
+	})
+	sortedDocs := make([]map[string]any, len(docs))
+	sortedValues := make([][]any, len(docs))
+	for i, index := range indices {
+		sortedDocs[i] = docs[index]
+		sortedValues[i] = values[index]
+	}
+	copy(docs, sortedDocs)
+	return sortedValues, orders
+}
+
+// sortValue returns the value of the document for the sort key; nil if the document has no value
+// Multi-valued fields are sorted by their minimum for ascending and their maximum for descending order
+func sortValue(doc map[string]any, key filter.SortKey, terms []string) any {
+	var values []any
+	switch {
+	case key.Score:
+		_, score := textMatches(doc, terms)
+		return float64(score)
+	case key.Point != nil:
+		lat, lon, ok := getGeoPoint(doc)
+		if !ok {
+			return nil
+		}
+		return geometry.DistanceKM(*key.Point, model.SimplePoint{X: lon, Y: lat})
+	case key.Element != "":
+		for _, obj := range collectValues(doc, strings.Split(filter.FIELD_RESULTS, ".")) {
+			result, ok := obj.(map[string]any)
+			if ok && formatValue(result[filter.FIELD_ITEMNAME]) == key.Element {
+				values = append(values, result[filter.FIELD_VALUE])
+			}
+		}
+	default:
+		path := strings.Split(key.Field.IndexField, ".")
+		if key.Field.NestedPath != "" {
+			path = append(strings.Split(key.Field.NestedPath, "."), path...)
+		}
+		values = collectValues(doc, path)
+	}
+	var picked any
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if picked == nil || compareValues(v, picked) == -orderSign(key.Order) {
+			picked = v
+		}
+	}
+	return picked
+}
+
+func orderSign(order string) int {
+	if order == filter.SORT_DESC {
+		return -1
+	}
+	return 1
+}
+
+// compareSortValues compares the sort values of two documents where orders holds 1 for ascending and -1 for descending sort keys
+// Missing values are sorted last independent of the order like in the search index
+func compareSortValues(a []any, b []any, orders []int) int {
+	for i, order := range orders {
+		switch {
+		case a[i] == nil && b[i] == nil:
+			continue
+		case a[i] == nil:
+			return 1
+		case b[i] == nil:
+			return -1
+		}
+		if c := compareValues(a[i], b[i]); c != 0 {
+			return c * order
+		}
+	}
+	return 0
+}
+
+// compareValues compares two numbers numerically and all other values by their string representation
+func compareValues(a any, b any) int {
+	na, okA := a.(float64)
+	nb, okB := b.(float64)
+	if okA && okB {
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(formatValue(a), formatValue(b))
+}
+
+func (mi *MemoryIndex) QueryFacets(ctx context.Context, f filter.Filter, size int) (model.SearchIndexPage, error) {
+	return mi.queryFacetBuckets(f, FACETS, "", facetSize(size, DEFAULT_FACET_SIZE))
+}
+
+func (mi *MemoryIndex) QuerySuggestions(ctx context.Context, f filter.Filter, facet Facet, prefix string, size int) (model.SearchIndexPage, error) {
+	return mi.queryFacetBuckets(f, []Facet{facet}, prefix, facetSize(size, DEFAULT_SUGGESTION_SIZE))
+}
+
+// queryFacetBuckets counts the documents matching the filters per value of the facets starting with the prefix
+func (mi *MemoryIndex) queryFacetBuckets(f filter.Filter, facets []Facet, prefix string, size int) (model.SearchIndexPage, error) {
+	matches, err := mi.search(f)
+	if err != nil {
+		return model.SearchIndexPage{}, fmt.Errorf("can not build query from filters: %w", err)
+	}
+	aggs := map[string]model.FacetAggregation{}
+	for _, facet := range facets {
+		buckets, err := facetBuckets(matches, facet, prefix, size)
+		if err != nil {
+			return model.SearchIndexPage{}, err
+		}
+		aggs[facet.Name] = model.FacetAggregation{Buckets: buckets}
+	}
+	return model.SearchIndexPage{
+		TotalHits:    len(matches),
+		Documents:    []map[string]any{},
+		Aggregations: facetAggregations(aggs),
+	}, nil
+}
+
+// facetBuckets counts the documents per value of the facet analogous to the terms and histogram aggregations
+// Only values starting with the prefix independent of case and accents are counted
+func facetBuckets(docs []map[string]any, facet Facet, prefix string, size int) ([]model.FacetBucket, error) {
+	indexPath, _, err := facet.indexPath()
+	if err != nil {
+		return nil, err
+	}
+	path := strings.Split(indexPath, ".")
+	prefix = foldText(prefix)
+	counts := map[string]int{}
+	for _, doc := range docs {
+		values := collectValues(doc, path)
+		if facet.Position > 0 {
+			if len(values) < facet.Position {
+				continue
+			}
+			values = values[facet.Position-1 : facet.Position]
+		}
+		// count each document once per value
+		keys := map[string]bool{}
+		for _, v := range values {
+			if v == nil {
+				continue
+			}
+			if facet.Interval > 0 {
+				number, ok := v.(float64)
+				if !ok {
+					continue
+				}
+				v = math.Floor(number/float64(facet.Interval)) * float64(facet.Interval)
+			}
+			key := formatValue(v)
+			if strings.HasPrefix(foldText(key), prefix) {
+				keys[key] = true
+			}
+		}
+		for key := range keys {
+			counts[key]++
+		}
+	}
+	buckets := make([]model.FacetBucket, 0, len(counts))
+	for key, count := range counts {
+		buckets = append(buckets, model.FacetBucket{Key: key, DocCount: count})
+	}
+	if facet.Interval > 0 {
+		// histogram buckets are ordered by key
+		sort.Slice(buckets, func(i, j int) bool {
+			ki, _ := strconv.ParseFloat(buckets[i].Key, 64)
+			kj, _ := strconv.ParseFloat(buckets[j].Key, 64)
+			return ki < kj
+		})
+		return buckets, nil
+	}
+	// terms buckets are ordered by count and key
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].DocCount != buckets[j].DocCount {
+			return buckets[i].DocCount > buckets[j].DocCount
+		}
+		return buckets[i].Key < buckets[j].Key
+	})
+	return buckets[:min(size, len(buckets))], nil
+}
+
+// search returns all documents matching the filters sorted by sampleID
+func (mi *MemoryIndex) search(f filter.Filter) ([]map[string]any, error) {
+	predicates, err := buildPredicates(f)
+	if err != nil {
+		return nil, err
+	}
+	matches := []map[string]any{}
+Documents:
+	for _, doc := range mi.documents {
+		for _, predicate := range predicates {
+			if !predicate(doc) {
+				continue Documents
+			}
+		}
+		matches = append(matches, doc)
+	}
+	return matches, nil
+}
+
+// buildPredicates constructs a documentPredicate for each part of the filter analogous to filter.ToOpenSearch
+func buildPredicates(f filter.Filter) ([]documentPredicate, error) {
+	predicates := []documentPredicate{}
+	for _, condition := range f.Conditions {
+		predicate, err := fieldPredicate(condition)
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %w", ErrInvalidFilter, condition.Field.Name, err)
+		}
+		predicates = append(predicates, predicate)
+	}
+	if f.Text != "" {
+		terms := textTerms(f.Text)
+		predicates = append(predicates, func(doc map[string]any) bool {
+			_, score := textMatches(doc, terms)
+			return score > 0
+		})
+	}
+	for _, disjunction := range f.Disjunctions {
+		should := []documentPredicate{}
+		for _, condition := range disjunction {
+			predicate, err := fieldPredicate(condition)
+			if err != nil {
+				return nil, fmt.Errorf("%w %s: %w", ErrInvalidFilter, filter.KEY_OR, err)
+			}
+			should = append(should, predicate)
+		}
+		predicates = append(predicates, func(doc map[string]any) bool {
+			for _, predicate := range should {
+				if predicate(doc) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	chemPredicates, err := chemistryPredicates(f.Chemistry)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalidFilter, filter.KEY_CHEMISTRY, err)
+	}
+	predicates = append(predicates, chemPredicates...)
+	for _, shape := range []*filter.Shape{f.Polygon, f.BBox, f.Region} {
+		if shape == nil {
+			continue
+		}
+		polygonPredicate, err := shapePredicate(shape)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidFilter, err)
+		}
+		predicates = append(predicates, polygonPredicate)
+	}
+	if f.Near != nil {
+		predicates = append(predicates, nearPredicate(f.Near))
+	}
+	if f.Geotile != nil {
+		predicates = append(predicates, geotilePredicate(*f.Geotile))
+	}
+	return predicates, nil
+}
+
+// fieldPredicate returns a documentPredicate for a single condition analogous to the search index query
+func fieldPredicate(condition filter.Condition) (documentPredicate, error) {
+	positive, negated := condition.Positive()
+	valuesPredicate, err := conditionPredicate(positive)
+	if err != nil {
+		return nil, err
+	}
+	position := condition.Field.Position
+	if position > 0 && !slices.Contains(filter.POSITION_OPERATORS, positive.Operator) {
+		return nil, fmt.Errorf("operator %s is not applicable to a position of the field %s", positive.Operator, condition.Field.IndexField)
+	}
+	var predicate documentPredicate
+	if condition.Field.NestedPath != "" {
+		// at least one of the nested objects has to match the condition
+		predicate = nestedPredicate(condition.Field.NestedPath, condition.Field.IndexField, valuesPredicate)
+	} else {
+		field := strings.Split(condition.Field.IndexField, ".")
+		predicate = func(doc map[string]any) bool {
+			values := collectValues(doc, field)
+			if position > 0 {
+				// only the value at the position is matched
+				if len(values) < position || values[position-1] == nil {
+					return false
+				}
+				values = values[position-1 : position]
+			}
+			return valuesPredicate(values)
+		}
+	}
+	if negated {
+		return func(doc map[string]any) bool {
+			return !predicate(doc)
+		}, nil
+	}
+	return predicate, nil
+}
+
+// nestedPredicate returns a documentPredicate that matches if the field of at least one object under nestedPath matches
+func nestedPredicate(nestedPath string, field string, valuesPredicate valuesPredicate) documentPredicate {
+	path := strings.Split(nestedPath, ".")
+	return func(doc map[string]any) bool {
+		for _, obj := range collectValues(doc, path) {
+			if valuesPredicate(collectValues(obj, []string{field})) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// shapePredicate returns a documentPredicate that matches documents with a geo_point inside the shape
+func shapePredicate(shape *filter.Shape) (documentPredicate, error) {
+	wrappedPoly, err := filter.WrappedFeature(shape)
+	if err != nil {
+		return nil, err
+	}
+	return func(doc map[string]any) bool {
+		lat, lon, ok := getGeoPoint(doc)
+		if !ok {
+			return false
+		}
+		inside, err := geometry.ContainsPoint(*wrappedPoly, model.SimplePoint{X: lon, Y: lat})
+		if err != nil {
+			log.Warnf("can not check point in polygon: %s", err.Error())
+			return false
+		}
+		return inside
+	}, nil
+}
+
+// nearPredicate returns a documentPredicate that matches documents with a geo_point within the radius of the circle
+func nearPredicate(circle *filter.Circle) documentPredicate {
+	return func(doc map[string]any) bool {
+		distance, ok := nearDistance(doc, circle)
+		return ok && distance <= circle.RadiusKM
+	}
+}
+
+// geotilePredicate returns a documentPredicate that matches documents with a geo_point in the geotile
+func geotilePredicate(tile geometry.Tile) documentPredicate {
+	return func(doc map[string]any) bool {
+		lat, lon, ok := getGeoPoint(doc)
+		return ok && geometry.TileOf(lat, lon, tile.Z) == tile
+	}
+}
+
+// nearDistance returns the geodesic distance of the geo_point of the document to the center of the circle in km
+func nearDistance(doc map[string]any, circle *filter.Circle) (float64, bool) {
+	lat, lon, ok := getGeoPoint(doc)
+	if !ok {
+		return 0, false
+	}
+	return geometry.DistanceKM(circle.Center, model.SimplePoint{X: lon, Y: lat}), true
+}
+
+// chemistryPredicates returns the documentPredicates for the chemistry expressions analogous to the search index query
+// The expressions are combined from left to right according to their junctors
+func chemistryPredicates(expressions []model.CQExpression) ([]documentPredicate, error) {
+	var combined documentPredicate
+	for i, chemFilter := range expressions {
+		predicate, err := chemistryExpressionPredicate(chemFilter)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 0:
+			combined = predicate
+		case chemFilter.Junctor == model.CQ_JUNCTOR_OR:
+			left := combined
+			combined = func(doc map[string]any) bool {
+				return left(doc) || predicate(doc)
+			}
+		default:
+			left := combined
+			combined = func(doc map[string]any) bool {
+				return left(doc) && predicate(doc)
+			}
+		}
+	}
+	if combined == nil {
+		return []documentPredicate{}, nil
+	}
+	return []documentPredicate{combined}, nil
+}
+
+// chemistryExpressionPredicate returns a documentPredicate for a single chemistry expression
+func chemistryExpressionPredicate(chemFilter model.CQExpression) (documentPredicate, error) {
+	minValue, maxValue, err := filter.ChemistryBounds(chemFilter)
+	if err != nil {
+		return nil, err
+	}
+	inBounds := func(value float64) bool {
+		if value < minValue || (chemFilter.MinExclusive && value == minValue) {
+			return false
+		}
+		return value <= maxValue && !(chemFilter.MaxExclusive && value == maxValue)
+	}
+	if chemFilter.IsRatio() {
+		// both elements have to be measured in the same batch
+		return func(doc map[string]any) bool {
+			for _, batch := range collectValues(doc, []string{"batchData"}) {
+				var numerator, denominator *float64
+				for _, obj := range collectValues(batch, []string{"results"}) {
+					result, ok := obj.(map[string]any)
+					if !ok || !resultMatches(result, chemFilter) {
+						continue
+					}
+					value, ok := result[filter.FIELD_VALUE].(float64)
+					if !ok {
+						continue
+					}
+					switch formatValue(result[filter.FIELD_ITEMNAME]) {
+					case chemFilter.Element:
+						numerator = &value
+					case chemFilter.Divisor:
+						denominator = &value
+					}
+				}
+				if numerator != nil && denominator != nil && *denominator != 0 && inBounds(*numerator / *denominator) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	path := strings.Split(filter.FIELD_RESULTS, ".")
+	// all conditions of an analyte have to match within the same result
+	return func(doc map[string]any) bool {
+		for _, obj := range collectValues(doc, path) {
+			result, ok := obj.(map[string]any)
+			if !ok || !resultMatches(result, chemFilter) {
+				continue
+			}
+			if chemFilter.Element != "" && formatValue(result[filter.FIELD_ITEMNAME]) != chemFilter.Element {
+				continue
+			}
+			if chemFilter.MinValue != "" || chemFilter.MaxValue != "" {
+				value, ok := result[filter.FIELD_VALUE].(float64)
+				if !ok || !inBounds(value) {
+					continue
+				}
+			}
+			return true
+		}
+		return false
+	}, nil
+}
+
+// resultMatches returns whether the result matches the type, unit and method of the chemistry expression
+func resultMatches(result map[string]any, chemFilter model.CQExpression) bool {
+	constraints := map[string]string{
+		filter.FIELD_ITEMGROUP: chemFilter.Type,
+		filter.FIELD_UNIT:      chemFilter.Unit,
+		filter.FIELD_METHOD:    chemFilter.Method,
+	}
+	for field, expected := range constraints {
+		if expected != "" && formatValue(result[field]) != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// textTerms splits the text of a full text search into lower case terms analogous to the standard analyzer
+func textTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), isNotTermRune)
+}
+
+func isNotTermRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// textMatches returns the highlighted values of the TEXT_FIELDS of the document and the number of matching terms as score
+func textMatches(doc map[string]any, terms []string) (map[string][]string, int) {
+	highlight := map[string][]string{}
+	score := 0
+	for _, field := range filter.TEXT_FIELDS {
+		for _, v := range collectValues(doc, strings.Split(field.Path, ".")) {
+			value, ok := v.(string)
+			if !ok {
+				continue
+			}
+			fragment, matches := highlightTerms(value, terms)
+			if matches > 0 && !slices.Contains(highlight[field.Path], fragment) {
+				highlight[field.Path] = append(highlight[field.Path], fragment)
+			}
+			score += matches
+		}
+	}
+	return highlight, score
+}
+
+// highlightTerms wraps all words of the value matching one of the terms in <em> tags like the search index highlighter
+func highlightTerms(value string, terms []string) (string, int) {
+	var b strings.Builder
+	matches := 0
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		if slices.Contains(terms, strings.ToLower(string(word))) {
+			matches++
+			b.WriteString("<em>" + string(word) + "</em>")
+		} else {
+			b.WriteString(string(word))
+		}
+		word = word[:0]
+	}
+	for _, r := range value {
+		if isNotTermRune(r) {
+			flush()
+			b.WriteRune(r)
+			continue
+		}
+		word = append(word, r)
+	}
+	flush()
+	return b.String(), matches
+}
+
+// conditionPredicate returns a valuesPredicate for a single condition analogous to the search index query
+func conditionPredicate(condition filter.Condition) (valuesPredicate, error) {
+	switch condition.Operator {
+	case filter.OpEq, filter.OpIn:
+		return func(values []any) bool {
+			for _, val := range values {
+				if slices.Contains(condition.Values, formatValue(val)) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case filter.OpExists:
+		return func(values []any) bool {
+			return len(values) > 0
+		}, nil
+	case filter.OpLike:
+		// translate the wildcards `*` and `?` into an anchored regular expression
+		pattern := regexp.QuoteMeta(condition.Values[0])
+		pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+		pattern = strings.ReplaceAll(pattern, `\?`, ".")
+		re, err := regexp.Compile("^" + pattern + "$")
+		if err != nil {
+			return nil, err
+		}
+		return func(values []any) bool {
+			for _, val := range values {
+				if re.MatchString(formatValue(val)) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case filter.OpLt, filter.OpLte, filter.OpGt, filter.OpGte, filter.OpBetween:
+		bounds := condition.Bounds()
+		return func(values []any) bool {
+			for _, val := range values {
+				f, err := strconv.ParseFloat(formatValue(val), 64)
+				if err != nil {
+					continue
+				}
+				if inBounds(f, bounds) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", condition.Operator)
+}
+
+// inBounds returns whether the value satisfies all range bounds
+func inBounds(value float64, bounds map[filter.Operator]float64) bool {
+	for bound, boundValue := range bounds {
+		switch bound {
+		case filter.OpLt:
+			if value >= boundValue {
+				return false
+			}
+		case filter.OpLte:
+			if value > boundValue {
+				return false
+			}
+		case filter.OpGt:
+			if value <= boundValue {
+				return false
+			}
+		case filter.OpGte:
+			if value < boundValue {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// collectValues returns all values found under the path in the document
+// Arrays on the way are flattened, so the result contains the values of all array elements
+func collectValues(v any, path []string) []any {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		values := []any{}
+		for _, elem := range t {
+			values = append(values, collectValues(elem, path)...)
+		}
+		return values
+	case map[string]any:
+		if len(path) == 0 {
+			return []any{t}
+		}
+		return collectValues(t[path[0]], path[1:])
+	default:
+		if len(path) == 0 {
+			return []any{t}
+		}
+		return nil
+	}
+}
+
+// formatValue returns the string representation of a document value for comparison with filter values
+func formatValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
+
+// getSampleID returns the sampleID of a document
+func getSampleID(doc map[string]any) float64 {
+	id, _ := doc["sampleID"].(float64)
+	return id
+}
+
+// getGeoPoint returns latitude and longitude of the geo_point of a document and whether the document has one
+func getGeoPoint(doc map[string]any) (float64, float64, bool) {
+	point, ok := doc[FIELD_GEOPOINT].(map[string]any)
+	if !ok {
+		return 0, 0, false
+	}
+	lat, latOk := point["lat"].(float64)
+	lon, lonOk := point["lon"].(float64)
+	return lat, lon, latOk && lonOk
+}
@@ -0,0 +1,533 @@
+// SPDX-FileCopyrightText: 2024 DIGIS Project Group
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/repository"
+)
+
+const FIXTURE = "fixtures/samples.json"
+
+func getSampleIDs(page model.SearchIndexPage) []float64 {
+	ids := []float64{}
+	for _, doc := range page.Documents {
+		id, _ := doc["sampleID"].(float64)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func parseFilters(t *testing.T, filters map[string]string) filter.Filter {
+	params := url.Values{}
+	for k, v := range filters {
+		params.Set(k, v)
+	}
+	f, err := filter.Parse(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFilters(t *testing.T) {
+	index, err := repository.NewMemoryIndex(FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		filters  map[string]string
+		expected []float64
+	}{
+		{map[string]string{}, []float64{1, 2, 3}},
+		{map[string]string{"sampleName": "ICE-02"}, []float64{2}},
+		{map[string]string{"rockclass": "IN:1,5"}, []float64{2, 3}},
+		{map[string]string{"mineral": "EQ:QUARTZ"}, []float64{1}},
+		{map[string]string{"chemistry": "(MAJOR,SiO2,45,55)"}, []float64{2, 3}},
+		{map[string]string{"chemistry": "(MAJOR,SiO2,45,55),(TRACE,Sr,,)"}, []float64{2}},
+		{map[string]string{"chemistry": "SiO2>70 OR MgO>9"}, []float64{1, 3}},
+		{map[string]string{"chemistry": "(MAJOR,SiO2,45,55) AND Sr>100"}, []float64{2}},
+		{map[string]string{"chemistry": "SiO2>=50.3"}, []float64{1, 2}},
+		{map[string]string{"chemistry": "SiO2>50.3"}, []float64{1}},
+		{map[string]string{"chemistry": "SiO2/MgO<6"}, []float64{3}},
+		{map[string]string{"chemistry": "(TRACE,Sr,100,,PPM,ICPMS)"}, []float64{2}},
+		{map[string]string{"chemistry": "(TRACE,Sr,100,,WT%)"}, []float64{}},
+		{map[string]string{"bbox": "[[-30,60],[-10,60],[-10,70],[-30,70],[-30,60]]"}, []float64{2, 3}},
+		{map[string]string{"bbox": "[[-30,60],[-10,60],[-10,70],[-30,70],[-30,60]]", "batchID": "30"}, []float64{3}},
+		{map[string]string{"near": "-21.9,64.1,20"}, []float64{2, 3}},
+		{map[string]string{"near": "-21.9,64.1,1"}, []float64{3}},
+		{map[string]string{"near": "-179,-38.6,500"}, []float64{1}},
+		{map[string]string{"geotile": "2/1/1"}, []float64{2, 3}},
+		{map[string]string{"geotile": "2/3/2"}, []float64{1}},
+		{map[string]string{"geotile": "2/0/0"}, []float64{}},
+		{map[string]string{"near": "181,-38.6,500"}, []float64{1}},
+		{map[string]string{"polygon": `{"type":"Polygon","coordinates":[[[-30,60],[-10,60],[-10,70],[-30,70],[-30,60]],[[-21.95,64.05],[-21.85,64.05],[-21.85,64.15],[-21.95,64.15],[-21.95,64.05]]]}`}, []float64{2}},
+		{map[string]string{"latitude": "gt:0"}, []float64{2, 3}},
+		{map[string]string{"latitude": "lte:64.1"}, []float64{1, 3}},
+		{map[string]string{"batchID": "btw:15,30"}, []float64{2, 3}},
+		{map[string]string{"batchID": "btw:,15"}, []float64{1}},
+		{map[string]string{"sampleName": "lk:ICE-*"}, []float64{2, 3}},
+		{map[string]string{"mineral": "lk:?UARTZ"}, []float64{1}},
+		{map[string]string{"rockclass": "ne:1"}, []float64{1}},
+		{map[string]string{"mineral": "nin:QUARTZ,OLIVINE"}, []float64{2}},
+		{map[string]string{"doi": "exists:"}, []float64{1}},
+		{map[string]string{"doi": "missing:"}, []float64{2, 3}},
+		{map[string]string{"setting": "ne:RIFT VOLCANICS"}, []float64{1}},
+		{map[string]string{"location1": "ICELAND"}, []float64{2, 3}},
+		{map[string]string{"location2": "ICELAND"}, []float64{}},
+		{map[string]string{"location2": "lk:HEK*"}, []float64{2}},
+		{map[string]string{"location1": "nin:ICELAND,HEKLA"}, []float64{1}},
+		{map[string]string{"location3": "missing:"}, []float64{1, 2, 3}},
+		{map[string]string{"or": "setting=CONVERGENT MARGIN|batchID=30"}, []float64{1, 3}},
+		{map[string]string{"or": "doi=exists:|mineral=ne:PLAGIOCLASE", "latitude": "gt:0"}, []float64{3}},
+	}
+	for _, test := range tests {
+		page, err := index.QuerySortSearchAfterPaginated(context.Background(), []string{"sampleID"}, parseFilters(t, test.filters), 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := getSampleIDs(page)
+		if fmt.Sprint(ids) != fmt.Sprint(test.expected) || page.TotalHits != len(test.expected) {
+			t.Fatalf("Filters: %v | Output: %v (%d hits) | Expected: %v", test.filters, ids, page.TotalHits, test.expected)
+		}
+	}
+
+	// ranges are not applicable to a level of the location names
+	if _, err := index.QuerySortSearchAfterPaginated(context.Background(), []string{"sampleID"}, parseFilters(t, map[string]string{"location1": "gt:5"}), 0, ""); err == nil {
+		t.Fatal("Expected error for range filter on location1")
+	}
+}
+
+func TestFullText(t *testing.T) {
+	index, err := repository.NewMemoryIndex(FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		filters    map[string]string
+		expected   []float64
+		highlights string
+	}{
+		{map[string]string{"q": "basalt"}, []float64{2, 3}, "[map[rockClasses.value:[<em>BASALT</em>]] map[rockClasses.value:[<em>BASALT</em>]]]"},
+		{map[string]string{"q": "Iceland HEKLA"}, []float64{2, 3}, "[map[locationNames:[<em>ICELAND</em> <em>HEKLA</em>]] map[locationNames:[<em>ICELAND</em>]]]"},
+		{map[string]string{"q": "taupo"}, []float64{1}, "[map[locationNames:[<em>TAUPO</em>] references.title:[<em>Taupo</em> rhyolites]]]"},
+		{map[string]string{"q": "taupo", "latitude": "gt:0"}, []float64{}, "[]"},
+	}
+	for _, test := range tests {
+		page, err := index.QuerySortSearchAfterPaginated(context.Background(), []string{"sampleID"}, parseFilters(t, test.filters), 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := getSampleIDs(page)
+		if fmt.Sprint(ids) != fmt.Sprint(test.expected) || fmt.Sprint(page.Highlights) != test.highlights {
+			t.Fatalf("Filters: %v | Output: %v %v | Expected: %v %s", test.filters, ids, page.Highlights, test.expected, test.highlights)
+		}
+	}
+
+	// pages of a full text search follow the relevance
+	f := parseFilters(t, map[string]string{"q": "hekla iceland"})
+	page, err := index.QuerySortSearchAfterPaginated(context.Background(), []string{"sampleID"}, f, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := index.QuerySortSearchAfterPaginated(context.Background(), []string{"sampleID"}, f, 1, page.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := append(getSampleIDs(page), getSampleIDs(next)...); fmt.Sprint(ids) != "[2 3]" {
+		t.Fatalf("Pages: %v | Expected: [2 3]", ids)
+	}
+}
+
+func TestNearDistances(t *testing.T) {
+	index, err := repository.NewMemoryIndex(FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := index.QuerySortSearchAfterPaginated(context.Background(), []string{"sampleID"}, parseFilters(t, map[string]string{"near": "-21.9,64.1,20"}), 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Distances) != 2 || page.Distances[0] < 5 || page.Distances[0] > 15 || page.Distances[1] != 0 {
+		t.Fatalf("Expected distances of about 11 km and 0 km but got %v", page.Distances)
+	}
+	page, err = index.QuerySortSearchAfterPaginated(context.Background(), []string{"sampleID"}, filter.Filter{}, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Distances != nil {
+		t.Fatalf("Expected no distances without near filter but got %v", page.Distances)
+	}
+}
+
+func TestSort(t *testing.T) {
+	index, err := repository.NewMemoryIndex(FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		sort     string
+		expected []float64
+	}{
+		{"publicationyear:desc", []float64{2, 1, 3}},
+		{"publicationyear", []float64{1, 2, 3}},
+		{"latitude:desc", []float64{2, 3, 1}},
+		{"element:MgO:desc", []float64{3, 1, 2}},
+		{"element:SiO2:desc", []float64{1, 2, 3}},
+		{"distance:-21.9:64.1", []float64{3, 2, 1}},
+		{"setting,sampleID:desc", []float64{1, 3, 2}},
+	}
+	for _, test := range tests {
+		f := parseFilters(t, map[string]string{"sort": test.sort})
+		page, err := index.QuerySortSearchAfterPaginated(context.Background(), []string{"sampleID"}, f, 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := getSampleIDs(page); fmt.Sprint(ids) != fmt.Sprint(test.expected) {
+			t.Fatalf("Sort: %s | Output: %v | Expected: %v", test.sort, ids, test.expected)
+		}
+	}
+
+	// pages follow the sort
+	f := parseFilters(t, map[string]string{"sort": "element:SiO2"})
+	ids := []float64{}
+	cursor := ""
+	for range 3 {
+		page, err := index.QuerySortSearchAfterPaginated(context.Background(), []string{"sampleID"}, f, 1, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, getSampleIDs(page)...)
+		cursor = page.NextCursor
+	}
+	if fmt.Sprint(ids) != "[3 2 1]" {
+		t.Fatalf("Pages: %v | Expected: [3 2 1]", ids)
+	}
+}
+
+func TestFacets(t *testing.T) {
+	index, err := repository.NewMemoryIndex(FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		filters  map[string]string
+		size     int
+		expected map[string]string
+	}{
+		{map[string]string{}, 0, map[string]string{
+			"rockclass":         "[{1 2} {2 1}]",
+			"mineral":           "[{OLIVINE 1} {PLAGIOCLASE 1} {QUARTZ 1}]",
+			"setting":           "[{RIFT VOLCANICS 2} {CONVERGENT MARGIN 1}]",
+			"location1":         "[{ICELAND 2} {NEW ZEALAND 1}]",
+			"publicationdecade": "[{1990 1} {2000 1}]",
+			"rocktype":          "[]",
+		}},
+		{map[string]string{"latitude": "gt:0"}, 0, map[string]string{
+			"rockclass":         "[{1 2}]",
+			"location1":         "[{ICELAND 2}]",
+			"publicationdecade": "[{2000 1}]",
+		}},
+		{map[string]string{}, 1, map[string]string{
+			"mineral":           "[{OLIVINE 1}]",
+			"publicationdecade": "[{1990 1} {2000 1}]",
+		}},
+	}
+	for _, test := range tests {
+		page, err := index.QueryFacets(context.Background(), parseFilters(t, test.filters), test.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := model.ParseToFacetResponse(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, expected := range test.expected {
+			buckets := []string{}
+			for _, v := range resp.Facets[name] {
+				buckets = append(buckets, fmt.Sprintf("{%s %d}", v.Value, v.Count))
+			}
+			if output := fmt.Sprintf("[%s]", strings.Join(buckets, " ")); output != expected {
+				t.Fatalf("Filters: %v | Facet: %s | Output: %s | Expected: %s", test.filters, name, output, expected)
+			}
+		}
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	index, err := repository.NewMemoryIndex(FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		field    string
+		prefix   string
+		filters  map[string]string
+		expected string
+	}{
+		{"mineral", "oliv", map[string]string{}, "[{OLIVINE 1}]"},
+		{"location1", "Ícé", map[string]string{}, "[{ICELAND 2}]"},
+		{"location2", "", map[string]string{}, "[{HEKLA 1} {REYKJANES 1} {TAUPO 1}]"},
+		{"rockclass", "", map[string]string{}, "[{BASALT 2} {RHYOLITE 1}]"},
+		{"rockclass", "", map[string]string{"latitude": "lt:0"}, "[{RHYOLITE 1}]"},
+		{"setting", "x", map[string]string{}, "[]"},
+	}
+	for _, test := range tests {
+		facet, ok := repository.LookupSuggestion(test.field)
+		if !ok {
+			t.Fatalf("Unknown suggestion %s", test.field)
+		}
+		page, err := index.QuerySuggestions(context.Background(), parseFilters(t, test.filters), facet, test.prefix, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := model.ParseToFacetResponse(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buckets := []string{}
+		for _, v := range resp.Facets[facet.Name] {
+			buckets = append(buckets, fmt.Sprintf("{%s %d}", v.Value, v.Count))
+		}
+		if output := fmt.Sprintf("[%s]", strings.Join(buckets, " ")); output != test.expected {
+			t.Fatalf("Field: %s | Prefix: %s | Filters: %v | Output: %s | Expected: %s", test.field, test.prefix, test.filters, output, test.expected)
+		}
+	}
+}
+
+func TestPagination(t *testing.T) {
+	index, err := repository.NewMemoryIndex(FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := index.QuerySortSearchAfterPaginated(context.Background(), repository.MINIMALFIELDS, filter.Filter{}, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(getSampleIDs(page)) != "[1 2]" || page.TotalHits != 3 || page.NextCursor == "" {
+		t.Fatalf("Expected samples [1 2] of 3 hits with next cursor but got %v of %d hits", getSampleIDs(page), page.TotalHits)
+	}
+	if _, ok := page.Documents[0]["sampleName"]; ok {
+		t.Fatalf("Expected only included fields but got %v", page.Documents[0])
+	}
+	page, err = index.QuerySortSearchAfterPaginated(context.Background(), repository.MINIMALFIELDS, filter.Filter{}, 2, page.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(getSampleIDs(page)) != "[3]" || page.NextCursor != "" {
+		t.Fatalf("Expected last page with sample [3] but got %v with cursor '%s'", getSampleIDs(page), page.NextCursor)
+	}
+	_, err = index.QuerySortSearchAfterPaginated(context.Background(), repository.MINIMALFIELDS, filter.Filter{}, 2, "not-a-cursor")
+	if !errors.Is(err, repository.ErrInvalidCursor) {
+		t.Fatalf("Expected ErrInvalidCursor but got %v", err)
+	}
+	page, err = index.QueryDocuments(context.Background(), repository.MINIMALFIELDS, filter.Filter{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(getSampleIDs(page)) != "[1 2]" || page.TotalHits != 3 || page.NextCursor != "" {
+		t.Fatalf("Expected samples [1 2] of 3 hits without cursor but got %v of %d hits with cursor '%s'", getSampleIDs(page), page.TotalHits, page.NextCursor)
+	}
+
+	resultChan := make(chan model.SearchIndexPage)
+	go index.QuerySortSearchAfterStream(context.Background(), repository.MINIMALFIELDS, filter.Filter{}, 2, resultChan)
+	pages := 0
+	for range resultChan {
+		pages++
+	}
+	if pages != 2 {
+		t.Fatalf("Expected 2 pages but got %d", pages)
+	}
+}
+
+func TestFieldProjection(t *testing.T) {
+	index, err := repository.NewMemoryIndex(FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repository.ParseFields("sampleName,password"); err == nil {
+		t.Fatal("Expected error for field not in the whitelist")
+	}
+	fields, err := repository.ParseFields("latitude, batchData.batchID,latitude")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(fields) != "[sampleID latitude batchData.batchID]" {
+		t.Fatalf("Expected fields [sampleID latitude batchData.batchID] but got %v", fields)
+	}
+
+	includeFields := append(fields, repository.FIELD_RESULTS)
+	page, err := index.QuerySortSearchAfterPaginated(context.Background(), includeFields, filter.Filter{}, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	measurements := model.SelectMeasurements(page.Documents[1], []string{"Sr", "MgO"})
+	if len(measurements) != 1 || measurements[0].Element != "Sr" || measurements[0].Value != 120 || measurements[0].Unit != "PPM" {
+		t.Fatalf("Expected Sr 120 PPM but got %v", measurements)
+	}
+	docs := repository.ProjectDocuments(page.Documents, fields)
+	batches, _ := docs[0]["batchData"].([]any)
+	if _, ok := docs[0]["latitude"]; !ok || len(batches) != 1 {
+		t.Fatalf("Expected latitude and one batch but got %v", docs[0])
+	}
+	if batch, _ := batches[0].(map[string]any); batch["batchID"] == nil || batch["results"] != nil {
+		t.Fatalf("Expected batchID without results but got %v", batch)
+	}
+}
+
+func TestClustered(t *testing.T) {
+	index, err := repository.NewMemoryIndex(FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := index.QueryClustered(repository.MINIMALFIELDS, filter.Filter{}, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Clusters) != 2 {
+		t.Fatalf("Expected 2 clusters but got %d", len(resp.Clusters))
+	}
+	// the two samples of Iceland are clustered into one tile
+	iceland := resp.Clusters[0]
+	if iceland.TileKey != "2/1/1" {
+		t.Fatalf("Expected cluster of Iceland in tile 2/1/1 but got %s", iceland.TileKey)
+	}
+	if iceland.ConvexHull.Geometry.Type != model.GEOJSON_GEOMETRY_POLYGON {
+		t.Errorf("Expected polygon hull but got %s", iceland.ConvexHull.Geometry.Type)
+	}
+	expectedBBox := [][]float64{{-21.9, 64.1}, {-21.8, 64.1}, {-21.8, 64.2}, {-21.9, 64.2}}
+	if fmt.Sprint(iceland.DrillDownBBox) != fmt.Sprint(expectedBBox) {
+		t.Errorf("Expected drill-down bbox %v but got %v", expectedBBox, iceland.DrillDownBBox)
+	}
+	if len(iceland.TileBounds) != 4 || iceland.TileBounds[0] != -90 || iceland.TileBounds[2] != 0 {
+		t.Errorf("Expected bounds of tile 2/1/1 but got %v", iceland.TileBounds)
+	}
+	// a single sample is a point and drills down to its tile
+	single := resp.Clusters[1]
+	if single.ConvexHull.Geometry.Type != model.GEOJSON_GEOMETRY_POINT {
+		t.Errorf("Expected point hull but got %s", single.ConvexHull.Geometry.Type)
+	}
+	if fmt.Sprint(single.DrillDownBBox[0]) != fmt.Sprint([]float64{single.TileBounds[0], single.TileBounds[1]}) {
+		t.Errorf("Expected drill-down bbox of the tile but got %v", single.DrillDownBBox)
+	}
+}
+
+func TestClusterStats(t *testing.T) {
+	index, err := repository.NewMemoryIndex(FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := repository.ParseClusterStats("rockclass,setting,age,element:SiO2,element:MgO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := index.QueryClustered(repository.MINIMALFIELDS, filter.Filter{}, 2, stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := resp.Clusters[0].Centroid.Properties
+	if properties["clusterSize"] != 2 || properties["rockClass"] != "BASALT" {
+		t.Fatalf("Expected 2 samples of BASALT but got %v", properties)
+	}
+	if fmt.Sprint(properties["settings"]) != "[RIFT VOLCANICS]" {
+		t.Errorf("Expected settings [RIFT VOLCANICS] but got %v", properties["settings"])
+	}
+	// the fixture has no ages
+	if _, ok := properties["ageMin"]; ok {
+		t.Errorf("Expected no ageMin but got %v", properties["ageMin"])
+	}
+	elements, _ := properties["elements"].(map[string]model.ElementStats)
+	expected := model.ElementStats{Count: 2, Min: 48.5, Median: 49.4, Max: 50.3}
+	if sio2 := elements["SiO2"]; sio2.Count != expected.Count || sio2.Min != expected.Min || math.Abs(sio2.Median-expected.Median) > 1e-9 || sio2.Max != expected.Max {
+		t.Errorf("Expected SiO2 statistics %v but got %v", expected, elements["SiO2"])
+	}
+
+	for _, v := range []string{"rocks", "element", "age:SiO2"} {
+		_, err := repository.ParseClusterStats(v)
+		if err == nil {
+			t.Errorf("Expected error for cluster statistics %s", v)
+		}
+	}
+}
+
+func TestDensity(t *testing.T) {
+	index, err := repository.NewMemoryIndex(FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grid, err := repository.NewDensityGrid(repository.GRID_GEOHASH, 1, "SiO2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	density, err := index.QueryDensity(context.Background(), filter.Filter{}, grid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cells := density.Cells
+	if len(cells) != 2 || density.Truncated {
+		t.Fatalf("Expected 2 cells but got %d", len(cells))
+	}
+	// the two samples of Iceland are counted in one cell
+	iceland := cells[0]
+	if iceland.Key != "g" || iceland.DocCount != 2 {
+		t.Fatalf("Expected 2 samples in cell g but got %d in %s", iceland.DocCount, iceland.Key)
+	}
+	if iceland.Mean == nil || math.Abs(*iceland.Mean-49.4) > 1e-9 {
+		t.Errorf("Expected mean SiO2 49.4 but got %v", iceland.Mean)
+	}
+
+	grid, err = repository.NewDensityGrid("", -1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grid.Type != repository.GRID_GEOTILE || grid.Resolution != repository.DEFAULT_RESOLUTIONS[repository.GRID_GEOTILE] {
+		t.Errorf("Expected default geotile grid but got %v", grid)
+	}
+	density, err = index.QueryDensity(context.Background(), filter.Filter{}, grid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cell := range density.Cells {
+		if cell.Mean != nil {
+			t.Errorf("Expected no mean without element but got %v", *cell.Mean)
+		}
+	}
+
+	// the samples of Iceland are counted in the hexagon of the geohex_grid key at resolution 3
+	grid, err = repository.NewDensityGrid(repository.GRID_H3, 3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	density, err = index.QueryDensity(context.Background(), filter.Filter{}, grid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(density.Cells) == 0 || density.Cells[0].Key != "83075dfffffffff" || density.Cells[0].DocCount != 2 {
+		t.Fatalf("Expected 2 samples in H3 cell 83075dfffffffff but got %+v", density.Cells)
+	}
+	polygons, err := grid.CellPolygons(density.Cells[0].Key)
+	if err != nil || len(polygons) != 1 || len(polygons[0]) != 6 {
+		t.Errorf("Expected the hexagon of the cell but got %v: %v", polygons, err)
+	}
+
+	for _, g := range []struct {
+		gridType   string
+		resolution int
+	}{{repository.GRID_H3, 16}, {"hexagon", 3}, {repository.GRID_GEOHASH, 0}, {repository.GRID_GEOHASH, 13}, {repository.GRID_GEOTILE, 30}} {
+		_, err := repository.NewDensityGrid(g.gridType, g.resolution, "")
+		if err == nil {
+			t.Errorf("Expected error for grid %s with resolution %d", g.gridType, g.resolution)
+		}
+	}
+}
@@ -1,16 +1,19 @@
 package repository
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
-	"strconv"
-	"strings"
+	"maps"
+	"net/http"
+	"slices"
 	"time"
 
 	"github.com/defensestation/osquery/v2"
 	log "github.com/sirupsen/logrus"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/geometry"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
 	"gitlab.gwdg.de/fe/digis/database-api/pkg/secretstore"
@@ -23,26 +26,16 @@ const (
 	INDEX_NAME = "digis-test-index-multishard"
 
 	MAX_OS_PAGESIZE = 10000
+	PIT_KEEP_ALIVE  = 5 * time.Minute
+	// PIT_FIRST_PAGE_KEEP_ALIVE is the keep alive of the point in time of a first page
+	// Most clients never follow the cursor, so it is short to stay below the limit of open points in time (search.max_open_pit_context)
+	PIT_FIRST_PAGE_KEEP_ALIVE = 30 * time.Second
 
 	KEY_CLUSTERING = "clustering"
 	KEY_CENTROID   = "centroid"
+	KEY_BOUNDS     = "bounds"
 
-	FILTER_CHEMISTRY       = "chemistry"
-	FILTER_POLYGON         = "polygon"
-	FILTER_POLYGON_GEOJSON = "polygon_geojson"
-	FILTER_BBOX            = "bbox"
-
-	FIELD_GEOPOINT  = "geo_point"
-	FIELD_VALUE     = "value"
-	FIELD_ITEMGROUP = "itemGroup"
-	FIELD_ITEMNAME  = "itemName"
-
-	PREFIX_IN = "IN"
-	PREFIX_EQ = "EQ"
-	PREFIX_LT = "LT"
-	PREFIXGT  = "GT"
-
-	DELIM = ","
+	FIELD_GEOPOINT = filter.FIELD_GEOPOINT
 )
 
 var (
@@ -111,17 +104,23 @@ func (os *OSClient) connect(host string, user string, password string) error {
 	return nil
 }
 
-func (os *OSClient) QueryClustered(includeFields []string, filters map[string]string, zoomLevel int) (model.ClusterResponse, error) {
+func (os *OSClient) QueryClustered(includeFields []string, f filter.Filter, zoomLevel int, stats []ClusterStat) (model.ClusterResponse, error) {
 	clusterResp := model.ClusterResponse{}
-	query, err := buildQuery(filters)
+	query, err := filter.ToOpenSearch(f)
 	if err != nil {
-		return clusterResp, fmt.Errorf("can not build query from filters: %w", err)
+		return clusterResp, fmt.Errorf("can not build query from filters: %w: %w", ErrInvalidFilter, err)
 	}
 	params := &opensearchapi.SearchParams{
 		TrackTotalHits: true,
 		Source:         false,
 	}
-	baseQuery := osquery.Search().Size(0).Query(query).Sort(osquery.FieldSort("sampleID").Order(osquery.OrderAsc)).Aggs(osquery.CustomAgg(KEY_CLUSTERING, map[string]any{"geotile_grid": map[string]any{"field": FIELD_GEOPOINT, "precision": zoomLevel}, "aggs": map[string]any{KEY_CENTROID: map[string]any{"geo_centroid": map[string]any{"field": FIELD_GEOPOINT}}}}))
+	subAggs, err := clusterStatAggregations(stats)
+	if err != nil {
+		return clusterResp, fmt.Errorf("can not build cluster statistics: %w", err)
+	}
+	subAggs[KEY_CENTROID] = map[string]any{"geo_centroid": map[string]any{"field": FIELD_GEOPOINT}}
+	subAggs[KEY_BOUNDS] = map[string]any{"geo_bounds": map[string]any{"field": FIELD_GEOPOINT, "wrap_longitude": false}}
+	baseQuery := osquery.Search().Size(0).Query(query).Sort(osquery.FieldSort("sampleID").Order(osquery.OrderAsc)).Aggs(osquery.CustomAgg(KEY_CLUSTERING, map[string]any{"geotile_grid": map[string]any{"field": FIELD_GEOPOINT, "precision": zoomLevel}, "aggs": subAggs}))
 	q, _ := baseQuery.MarshalJSON()
 	fmt.Println(string(q))
 	searchResponse, err := runQuery(os.client.Client, *baseQuery, INDEX_NAME, params)
@@ -129,22 +128,41 @@ func (os *OSClient) QueryClustered(includeFields []string, filters map[string]st
 		return clusterResp, fmt.Errorf("can not run query: %w", err)
 	}
 
-	clusterResp, err = parseClusterResponse(searchResponse)
+	clusterResp, err = parseClusterResponse(searchResponse, stats)
 	if err != nil {
 		return clusterResp, fmt.Errorf("can not parse results: %w", err)
 	}
 	return clusterResp, nil
 }
 
-func (os *OSClient) QuerySortSearchAfterStream(ctx context.Context, includeFields []string, filters map[string]string, size int, resultChan chan model.SearchIndexPage) {
+func (os *OSClient) QueryDensity(ctx context.Context, f filter.Filter, grid DensityGrid) (model.Density, error) {
+	query, err := filter.ToOpenSearch(f)
+	if err != nil {
+		return model.Density{}, fmt.Errorf("can not build query from filters: %w: %w", ErrInvalidFilter, err)
+	}
+	params := &opensearchapi.SearchParams{
+		Source: false,
+	}
+	searchQuery := osquery.Search().Size(0).Query(query).Aggs(osquery.CustomAgg(KEY_DENSITY, densityAggregation(grid)))
+	searchResponse, err := runQuery(os.client.Client, *searchQuery, INDEX_NAME, params)
+	if err != nil {
+		return model.Density{}, fmt.Errorf("can not run query: %w", err)
+	}
+	density, err := parseDensityAggregation(searchResponse.Aggregations)
+	if err != nil {
+		return model.Density{}, fmt.Errorf("can not parse aggregations: %w", err)
+	}
+	return density, nil
+}
+
+func (os *OSClient) QuerySortSearchAfterStream(ctx context.Context, includeFields []string, f filter.Filter, size int, resultChan chan model.SearchIndexPage) {
 	defer close(resultChan)
-	// TODO: use PIT or not? If yes, need to remove index name from url as it will be taken from PIT
-	query, err := buildQuery(filters)
+	query, err := filter.ToOpenSearch(f)
 	if err != nil {
 		log.Errorf("can not build query from filters: %s", err.Error())
 		return
 	}
-	params := &opensearchapi.SearchParams{
+	params := opensearchapi.SearchParams{
 		TrackTotalHits: true,
 		Source:         true,
 		SourceIncludes: includeFields,
@@ -154,10 +172,16 @@ func (os *OSClient) QuerySortSearchAfterStream(ctx context.Context, includeField
 	if size <= 0 || size > MAX_OS_PAGESIZE {
 		size = MAX_OS_PAGESIZE
 	}
-	baseQuery := osquery.Search().Size(uint64(size)).Query(query).Sort(osquery.FieldSort("sampleID").Order(osquery.OrderAsc))
-	q, _ := baseQuery.MarshalJSON()
-	fmt.Println(string(q))
-	searchResponse, err := runQuery(os.client.Client, *baseQuery, INDEX_NAME, params)
+	// run all pages on the same point in time so the pages stay consistent while the index is updated
+	pitID, err := os.createPIT(ctx, PIT_KEEP_ALIVE)
+	if err != nil {
+		log.Errorf("can not create point in time: %s", err.Error())
+		return
+	}
+	defer os.deletePIT(pitID)
+
+	baseQuery := osquery.Search().Size(uint64(size)).Query(query)
+	searchResponse, err := os.runPITQuery(ctx, baseQuery, f, pitID, PIT_KEEP_ALIVE, params)
 	if err != nil {
 		log.Errorf("can not run query: %s", err.Error())
 		return
@@ -187,8 +211,8 @@ func (os *OSClient) QuerySortSearchAfterStream(ctx context.Context, includeField
 			return
 		}
 		lastSortVal := searchResponse.Hits.Hits[numReturned-1].Sort
-		pageQuery := osquery.Search().Size(uint64(size)).Query(query).SearchAfter(lastSortVal...).Sort(osquery.FieldSort("sampleID").Order(osquery.OrderAsc))
-		searchResponse, err = runQuery(os.client.Client, *pageQuery, INDEX_NAME, params)
+		pageQuery := osquery.Search().Size(uint64(size)).Query(query).SearchAfter(lastSortVal...)
+		searchResponse, err = os.runPITQuery(ctx, pageQuery, f, pitID, PIT_KEEP_ALIVE, params)
 		if err != nil {
 			log.Errorf("can not run subsequent query: %s", err.Error())
 			return
@@ -204,216 +228,285 @@ func (os *OSClient) QuerySortSearchAfterStream(ctx context.Context, includeField
 	}
 }
 
-func (os *OSClient) QuerySortSearchAfterPaginated(ctx context.Context, includeFields []string, filters map[string]string, size int, after string) (model.SearchIndexPage, error) {
+func (os *OSClient) QuerySortSearchAfterPaginated(ctx context.Context, includeFields []string, f filter.Filter, size int, cursorS string) (model.SearchIndexPage, error) {
 	var page model.SearchIndexPage
-	// TODO: use PIT or not? If yes, need to remove index name from url as it will be taken from PIT
-	query, err := buildQuery(filters)
+	if size <= 0 || size > MAX_OS_PAGESIZE {
+		size = MAX_OS_PAGESIZE
+	}
+	// the first page opens the point in time the following pages continue on, so all pages come from the same snapshot of the index
+	cur := cursor{}
+	keepAlive := PIT_KEEP_ALIVE
+	if cursorS != "" {
+		var err error
+		cur, err = decodeCursor(cursorS)
+		if err != nil {
+			return page, err
+		}
+	} else {
+		keepAlive = PIT_FIRST_PAGE_KEEP_ALIVE
+		pitID, err := os.createPIT(ctx, keepAlive)
+		if err != nil {
+			// e.g. if the limit of open points in time is reached, the page is returned without cursor instead of failing
+			log.Warnf("can not create point in time: %s", err.Error())
+			page, _, err := os.searchPage(ctx, includeFields, f, size, cursor{}, 0)
+			return page, err
+		}
+		cur.PitID = pitID
+	}
+	page, searchResponse, err := os.searchPage(ctx, includeFields, f, size, cur, keepAlive)
 	if err != nil {
-		return page, fmt.Errorf("can not build query from filters: %w", err)
+		if cur.PitID == "" {
+			return page, err
+		}
+		if cursorS != "" && pitMissing(err) {
+			return page, fmt.Errorf("%w: %w", ErrCursorExpired, err)
+		}
+		os.deletePIT(cur.PitID)
+		return page, err
 	}
-	params := &opensearchapi.SearchParams{
-		TrackTotalHits: true,
-		Source:         true,
-		SourceIncludes: includeFields,
+
+	// the point in time is only needed while there are more hits
+	numReturned := len(searchResponse.Hits.Hits)
+	if numReturned < size || searchResponse.Hits.Total.Value <= numReturned {
+		if cur.PitID != "" {
+			os.deletePIT(cur.PitID)
+		}
+		return page, nil
+	}
+	cur.SearchAfter = searchResponse.Hits.Hits[numReturned-1].Sort
+	page.NextCursor, err = encodeCursor(cur)
+	if err != nil {
+		os.deletePIT(cur.PitID)
+		return page, err
 	}
+	return page, nil
+}
 
+func (os *OSClient) QueryDocuments(ctx context.Context, includeFields []string, f filter.Filter, size int) (model.SearchIndexPage, error) {
 	if size <= 0 || size > MAX_OS_PAGESIZE {
 		size = MAX_OS_PAGESIZE
 	}
-	pageQuery := osquery.Search().Size(uint64(size)).Query(query).SearchAfter(after).Sort(osquery.FieldSort("sampleID").Order(osquery.OrderAsc))
-	searchResponse, err := runQuery(os.client.Client, *pageQuery, INDEX_NAME, params)
+	page, _, err := os.searchPage(ctx, includeFields, f, size, cursor{}, 0)
+	return page, err
+}
+
+// searchPage runs the search for one page of the documents matching the filters after the position of the cursor
+// An empty PitID of the cursor searches the index without point in time, otherwise the point in time is kept alive for keepAlive
+func (os *OSClient) searchPage(ctx context.Context, includeFields []string, f filter.Filter, size int, cur cursor, keepAlive time.Duration) (model.SearchIndexPage, *opensearchapi.SearchResp, error) {
+	var page model.SearchIndexPage
+	query, err := filter.ToOpenSearch(f)
 	if err != nil {
-		return page, fmt.Errorf("can not run subsequent query: %w", err)
+		return page, nil, fmt.Errorf("can not build query from filters: %w: %w", ErrInvalidFilter, err)
+	}
+	params := opensearchapi.SearchParams{
+		TrackTotalHits: true,
+		Source:         true,
+		SourceIncludes: includeFields,
+	}
+	pageQuery := osquery.Search().Size(uint64(size)).Query(query)
+	if f.Text != "" {
+		pageQuery = pageQuery.Highlight(filter.TextHighlight())
+	}
+	if len(cur.SearchAfter) > 0 {
+		pageQuery = pageQuery.SearchAfter(cur.SearchAfter...)
+	}
+	searchResponse, err := os.runPITQuery(ctx, pageQuery, f, cur.PitID, keepAlive, params)
+	if err != nil {
+		return page, nil, fmt.Errorf("can not run query: %w", err)
 	}
-	q, _ := pageQuery.MarshalJSON()
-	fmt.Println(string(q))
-
 	page, err = parseIndexPage(searchResponse.Hits, searchResponse.Aggregations)
 	if err != nil {
-		return page, fmt.Errorf("can not parse subsequent results: %w", err)
+		return page, nil, fmt.Errorf("can not parse results: %w", err)
 	}
-	return page, nil
+	return page, searchResponse, nil
 }
 
-// buildQuery constructs a osquery.BoolQuery from given filters
-func buildQuery(filters map[string]string) (*osquery.BoolQuery, error) {
-	osFilters := []osquery.Mappable{}
-	for k, v := range filters {
-		nestedPath := getNested(k)
-		k = translateKey(k)
-		var f []osquery.Mappable
-		if len(nestedPath) > 0 {
-			// construct fieldName from original key and nestedPath
-			fieldName := fmt.Sprintf("%s.%s", nestedPath, k)
-			// parse custom chemistry query DSL
-			if k == FILTER_CHEMISTRY {
-				chemQ, err := getChemistryQuery(nestedPath, v)
-				if err != nil {
-					return nil, err
-				}
-				f = append(f, chemQ...)
-			} else {
-				// add a nested query for the parameter
-				f = append(f, osquery.Nested(nestedPath, dslToFilterQuery(fieldName, v)))
-			}
-		} else {
-			switch k {
-			case FILTER_POLYGON, FILTER_POLYGON_GEOJSON, FILTER_BBOX:
-				polygonQ, err := getPolygonQuery(v)
-				if err != nil {
-					return nil, err
-				}
-				f = append(f, polygonQ)
-			default:
-				// do a normal term filter
-				f = append(f, dslToFilterQuery(k, v))
-			}
+func (os *OSClient) QueryFacets(ctx context.Context, f filter.Filter, size int) (model.SearchIndexPage, error) {
+	aggs := make([]osquery.Aggregation, 0, len(FACETS))
+	for _, facet := range FACETS {
+		agg, err := facetAggregation(facet, facetSize(size, DEFAULT_FACET_SIZE), "")
+		if err != nil {
+			return model.SearchIndexPage{}, err
 		}
-		osFilters = append(osFilters, f...)
+		aggs = append(aggs, osquery.CustomAgg(facet.Name, agg))
 	}
-	query := osquery.Bool().Filter(osFilters...)
-	return query, nil
+	return os.queryFacetAggregations(f, aggs)
 }
 
-// getPolygonQuery returns a osquery.Mappable for the polygon to add to the opensearch query
-func getPolygonQuery(v string) (osquery.Mappable, error) {
-	// try to parse polygon as geoJSON first
-	polygonGeoJSON := model.GeoJSONFeature{}
-	err := json.Unmarshal([]byte(v), &polygonGeoJSON)
+func (os *OSClient) QuerySuggestions(ctx context.Context, f filter.Filter, facet Facet, prefix string, size int) (model.SearchIndexPage, error) {
+	agg, err := facetAggregation(facet, facetSize(size, DEFAULT_SUGGESTION_SIZE), prefixRegex(prefix))
 	if err != nil {
-		// fallback: parse as point array
-		polygon, err := geometry.ParsePointArray(v)
-		if err != nil {
-			return nil, err
-		}
-		// parse to GeoJSON
-		polygonGeoJSON = geometry.ParsePolygon(polygon)
+		return model.SearchIndexPage{}, err
 	}
-	// imitate a wrap around +/-180 meridian by cutting the original polygon on the crossed boundary and translating the other half into the boundaries
-	wrappedPoly, err := geometry.WrapPolygonLon(polygonGeoJSON)
+	return os.queryFacetAggregations(f, []osquery.Aggregation{osquery.CustomAgg(facet.Name, agg)})
+}
+
+// queryFacetAggregations runs the facet aggregations on the documents matching the filters
+func (os *OSClient) queryFacetAggregations(f filter.Filter, aggs []osquery.Aggregation) (model.SearchIndexPage, error) {
+	var page model.SearchIndexPage
+	query, err := filter.ToOpenSearch(f)
+	if err != nil {
+		return page, fmt.Errorf("can not build query from filters: %w: %w", ErrInvalidFilter, err)
+	}
+	params := &opensearchapi.SearchParams{
+		TrackTotalHits: true,
+		Source:         false,
+	}
+	searchQuery := osquery.Search().Size(0).Query(query).Aggs(aggs...)
+	searchResponse, err := runQuery(os.client.Client, *searchQuery, INDEX_NAME, params)
+	if err != nil {
+		return page, fmt.Errorf("can not run query: %w", err)
+	}
+	facets, err := parseFacetAggregations(searchResponse.Aggregations)
+	if err != nil {
+		return page, fmt.Errorf("can not parse aggregations: %w", err)
+	}
+	page.TotalHits = searchResponse.Hits.Total.Value
+	page.Documents = []map[string]any{}
+	page.Aggregations = facetAggregations(facets)
+	return page, nil
+}
+
+// facetAggregation returns the aggregation of the facet with the terms matching the include regex; an empty include matches all terms
+// Facets on nested fields count the samples holding a value by a reverse_nested aggregation instead of the nested objects
+func facetAggregation(facet Facet, size int, include string) (map[string]any, error) {
+	path, nestedPath, err := facet.indexPath()
 	if err != nil {
 		return nil, err
 	}
-	return osquery.CustomQuery(map[string]any{"geo_shape": map[string]any{FIELD_GEOPOINT: map[string]any{"shape": wrappedPoly.Geometry, "relation": "INTERSECTS"}}}), nil
+	var values map[string]any
+	terms := map[string]any{"field": path, "size": size}
+	switch {
+	case facet.Interval > 0:
+		values = map[string]any{"histogram": map[string]any{"field": path, "interval": facet.Interval, "min_doc_count": 1}}
+	case facet.Position > 0:
+		// doc values of arrays are sorted so the value at the position has to be read from the source
+		script := "def v = params['_source'][params.field]; return v == null || v.size() < params.position ? null : v[params.position - 1];"
+		terms = map[string]any{"script": map[string]any{"source": script, "params": map[string]any{"field": path, "position": facet.Position}}, "size": size}
+		values = map[string]any{"terms": terms}
+	default:
+		values = map[string]any{"terms": terms}
+	}
+	if include != "" {
+		terms["include"] = include
+	}
+	if nestedPath == "" {
+		return values, nil
+	}
+	terms["order"] = map[string]any{KEY_FACET_SAMPLES: "desc"}
+	values["aggs"] = map[string]any{KEY_FACET_SAMPLES: map[string]any{"reverse_nested": map[string]any{}}}
+	return map[string]any{
+		"nested": map[string]any{"path": nestedPath},
+		"aggs":   map[string]any{KEY_FACET_VALUES: values},
+	}, nil
 }
 
-// getChemistryQuery returns a list of osquery.Mappables for each chemistry filter to add to the opensearch query
-func getChemistryQuery(nestedPath string, v string) ([]osquery.Mappable, error) {
-	f := []osquery.Mappable{}
-	chemFilters, err := model.ParseChemQuery(v)
+// osFacetAggregation holds the buckets of a facet aggregation or of its nested values aggregation
+type osFacetAggregation struct {
+	Buckets []struct {
+		Key      any `json:"key"`
+		DocCount int `json:"doc_count"`
+		Samples  *struct {
+			DocCount int `json:"doc_count"`
+		} `json:"samples"`
+	} `json:"buckets"`
+	Values *osFacetAggregation `json:"values"`
+}
+
+// parseFacetAggregations returns the buckets of the facets counting the samples
+func parseFacetAggregations(aggregations json.RawMessage) (map[string]model.FacetAggregation, error) {
+	facets := map[string]model.FacetAggregation{}
+	if len(aggregations) == 0 {
+		return facets, nil
+	}
+	aggs := map[string]osFacetAggregation{}
+	err := json.Unmarshal(aggregations, &aggs)
 	if err != nil {
 		return nil, err
 	}
-	// add a filter conjunction for each analyte
-	for _, chemFilter := range chemFilters.Expressions {
-		filters := []osquery.Mappable{}
-		rng := osquery.Range(fmt.Sprintf("%s.%s", nestedPath, FIELD_VALUE))
-		if chemFilter.MinValue != "" {
-			minValue, err := strconv.ParseFloat(chemFilter.MinValue, 64)
-			if err != nil {
-				return nil, err
-			}
-			if !math.IsNaN(minValue) {
-				rng = rng.Gte(minValue)
-			}
+	for name, agg := range aggs {
+		if agg.Values != nil {
+			agg = *agg.Values
 		}
-		if chemFilter.MaxValue != "" {
-			maxValue, err := strconv.ParseFloat(chemFilter.MaxValue, 64)
-			if err != nil {
-				return nil, err
-			}
-			if !math.IsNaN(maxValue) {
-				rng = rng.Lte(maxValue)
+		facet := model.FacetAggregation{Buckets: make([]model.FacetBucket, 0, len(agg.Buckets))}
+		for _, b := range agg.Buckets {
+			bucket := model.FacetBucket{Key: formatValue(b.Key), DocCount: b.DocCount}
+			if b.Samples != nil {
+				bucket.DocCount = b.Samples.DocCount
 			}
+			facet.Buckets = append(facet.Buckets, bucket)
 		}
-		if chemFilter.MinValue != "" || chemFilter.MaxValue != "" {
-			// at least one value is set
-			filters = append(filters, rng)
-		}
-		if chemFilter.Type != "" {
-			filters = append(filters, osquery.Term(fmt.Sprintf("%s.%s", nestedPath, FIELD_ITEMGROUP), chemFilter.Type))
-		}
-		if chemFilter.Element != "" {
-			filters = append(filters, osquery.Term(fmt.Sprintf("%s.%s", nestedPath, FIELD_ITEMNAME), chemFilter.Element))
-		}
-		q := osquery.Bool().Filter(filters...)
-		f = append(f, osquery.Nested(nestedPath, q))
+		facets[name] = facet
 	}
-	return f, nil
+	return facets, nil
 }
 
-// dslToFilterQuery takes a field name and a value string and parses the custom query dsl to return search index queries as osquery.Mappable objects
-func dslToFilterQuery(field string, v string) osquery.Mappable {
-	var fq osquery.Mappable
-	operator, value, found := strings.Cut(v, ":")
-	if !found {
-		// if no operator is specified, "EQ" is assumed as default
-		operator = PREFIX_EQ
-		// retain original value
-		value = v
-	}
-	operator = strings.ToUpper(operator)
-	switch operator {
-	case PREFIX_IN:
-		generified := []any{}
-		for s := range strings.SplitSeq(value, DELIM) {
-			generified = append(generified, s)
-		}
-		fq = osquery.Terms(field, generified...)
-	case PREFIX_EQ:
-		fq = osquery.Term(field, value)
-	default:
-		fq = osquery.Term(field, value)
+// createPIT creates a point in time on the index which is kept alive for keepAlive and returns its id
+func (os *OSClient) createPIT(ctx context.Context, keepAlive time.Duration) (string, error) {
+	resp, err := os.client.PointInTime.Create(ctx, opensearchapi.PointInTimeCreateReq{
+		Indices: []string{INDEX_NAME},
+		Params:  opensearchapi.PointInTimeCreateParams{KeepAlive: keepAlive},
+	})
+	if err != nil {
+		return "", err
 	}
-	return fq
+	return resp.PitID, nil
 }
 
-// translateKey returns the document key corresponding to a search term
-func translateKey(k string) string {
-	switch k {
-	case "doi":
-		return "externalIdentifier"
-	case "setting":
-		return "tectonicSetting"
-	case "geoage":
-		return "geologicalAge"
-	case "geoageprefix":
-		return "geologicalAgePrefix"
-	case "mineral", "inclusionmaterial", "hostmaterial", "rocktype", "rockclass":
-		return "value"
-	case "standards":
-		return "standardName"
-	case "inclusiontype":
-		return "inclusionTypes"
-	}
-	return k
+// deletePIT deletes the point in time with the given id; errors are only logged as the point in time expires anyway
+func (os *OSClient) deletePIT(pitID string) {
+	_, err := os.client.PointInTime.Delete(context.Background(), opensearchapi.PointInTimeDeleteReq{PitID: []string{pitID}})
+	if err != nil {
+		log.Warnf("can not delete point in time: %s", err.Error())
+	}
 }
 
-// getNested returns for a given key in the filters map, the nested field in the documents it belongs to; or empty string if the key is top level
-func getNested(key string) string {
-	switch key {
-	case "batchName", "batchID", "crystal", "inclusiontype", "material", "rimOrCoreInclusion", "rimOrCoreMineral", "specimenMedium":
-		return "batchData"
-	case "mineral":
-		return "batchData.minerals"
-	case "inclusionmaterial":
-		return "batchData.inclusionMinerals"
-	case "hostmaterial":
-		return "batchData.hostMinerals"
-	case "itemName", "itemGroup", "medium", "method", "unit", "value", "valueCount", FILTER_CHEMISTRY:
-		return "batchData.results"
-	case "standards":
-		return "batchData.results.standards"
-	case "rocktype":
-		return "rockTypes"
-	case "rockclass":
-		return "rockClasses"
-	case "citationID", "title", "publisher", "publicationYear", "citationLink", "journal", "volume", "issue", "firstPage", "lastPage", "bookTitle", "editors", "doi":
-		return "references"
-	case "personID", "firstName", "lastName", "order":
-		return "references.authors"
-	}
-	return ""
+// pitMissing returns whether the search failed because the point in time expired or is unknown
+func pitMissing(err error) bool {
+	var osErr *opensearch.StructError
+	if !errors.As(err, &osErr) {
+		return false
+	}
+	if osErr.Status == http.StatusNotFound || osErr.Err.Type == "search_context_missing_exception" {
+		return true
+	}
+	for _, cause := range osErr.Err.RootCause {
+		if cause.Type == "search_context_missing_exception" {
+			return true
+		}
+	}
+	return false
+}
+
+// runPITQuery executes the given search query with the sort of filter.ToOpenSearchSort on the point in time with the given id and extends its keep alive to keepAlive
+// An empty pitID runs the query on the index without point in time
+// The sort and the distance script fields are added to the request body as they can not be expressed by the query builder
+func (os *OSClient) runPITQuery(ctx context.Context, searchQuery *osquery.SearchRequest, f filter.Filter, pitID string, keepAlive time.Duration, params opensearchapi.SearchParams) (*opensearchapi.SearchResp, error) {
+	start := time.Now()
+	body := searchQuery.Map()
+	body["sort"] = filter.ToOpenSearchSort(f)
+	if scriptFields := filter.DistanceScriptFields(f); scriptFields != nil {
+		body["script_fields"] = scriptFields
+	}
+	req := &opensearchapi.SearchReq{Params: params}
+	if pitID == "" {
+		req.Indices = []string{INDEX_NAME}
+	} else {
+		// the index is taken from the point in time and must not be part of the request url
+		body["pit"] = map[string]any{"id": pitID, "keep_alive": fmt.Sprintf("%ds", int(keepAlive.Seconds()))}
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("can not marshal query: %w", err)
+	}
+	req.Body = bytes.NewReader(b)
+	searchResponse, err := os.client.Search(ctx, req)
+	took := time.Since(start).String()
+	if err != nil {
+		return nil, fmt.Errorf("can not query for documents: %w", err)
+	}
+	log.Debugf("Matched %d of %d results in %s (%dms search).", len(searchResponse.Hits.Hits), searchResponse.Hits.Total.Value, took, searchResponse.Took)
+	return searchResponse, nil
 }
 
 func parseIndexPage(hits opensearchapi.SearchHits, aggregations json.RawMessage) (model.SearchIndexPage, error) {
@@ -429,6 +522,10 @@ func parseIndexPage(hits opensearchapi.SearchHits, aggregations json.RawMessage)
 		page.Aggregations = aggs
 	}
 	results := make([]map[string]any, 0, len(hits.Hits))
+	highlights := make([]map[string][]string, 0, len(hits.Hits))
+	hasHighlights := false
+	distances := make([]float64, 0, len(hits.Hits))
+	hasDistances := false
 	for _, hit := range hits.Hits {
 		doc := map[string]any{}
 		err := json.Unmarshal(hit.Source, &doc)
@@ -436,12 +533,64 @@ func parseIndexPage(hits opensearchapi.SearchHits, aggregations json.RawMessage)
 			return page, err
 		}
 		results = append(results, doc)
+		highlight := hitHighlights(hit)
+		hasHighlights = hasHighlights || len(highlight) > 0
+		highlights = append(highlights, highlight)
+		distance, ok, err := hitDistance(hit)
+		if err != nil {
+			return page, err
+		}
+		hasDistances = hasDistances || ok
+		distances = append(distances, distance)
 	}
 	page.Documents = results
+	if hasHighlights {
+		page.Highlights = highlights
+	}
+	if hasDistances {
+		page.Distances = distances
+	}
 	return page, nil
 }
 
-func parseClusterResponse(resp *opensearchapi.SearchResp) (model.ClusterResponse, error) {
+// hitDistance returns the distance script field of a hit and whether it is present
+func hitDistance(hit opensearchapi.SearchHit) (float64, bool, error) {
+	if len(hit.Fields) == 0 {
+		return 0, false, nil
+	}
+	fields := map[string][]float64{}
+	err := json.Unmarshal(hit.Fields, &fields)
+	if err != nil {
+		return 0, false, fmt.Errorf("can not parse fields of hit: %w", err)
+	}
+	distance, ok := fields[filter.FIELD_DISTANCE]
+	if !ok || len(distance) == 0 {
+		return 0, false, nil
+	}
+	return distance[0], true, nil
+}
+
+// hitHighlights merges the highlights of a hit with the highlights of its inner hits
+func hitHighlights(hit opensearchapi.SearchHit) map[string][]string {
+	highlight := map[string][]string{}
+	for field, fragments := range hit.Highlight {
+		highlight[field] = append(highlight[field], fragments...)
+	}
+	for _, inner := range hit.InnerHits {
+		for _, innerHit := range inner.Hits.Hits {
+			for field, fragments := range innerHit.Highlight {
+				for _, fragment := range fragments {
+					if !slices.Contains(highlight[field], fragment) {
+						highlight[field] = append(highlight[field], fragment)
+					}
+				}
+			}
+		}
+	}
+	return highlight
+}
+
+func parseClusterResponse(resp *opensearchapi.SearchResp, stats []ClusterStat) (model.ClusterResponse, error) {
 	clusterResp := model.ClusterResponse{}
 	if len(resp.Aggregations) == 0 {
 		return clusterResp, nil
@@ -451,8 +600,33 @@ func parseClusterResponse(resp *opensearchapi.SearchResp) (model.ClusterResponse
 	if err != nil {
 		return clusterResp, err
 	}
+	if len(stats) > 0 {
+		// the sub-aggregations of the statistics have no fixed keys
+		rawAggs := struct {
+			Clustering struct {
+				Buckets []map[string]json.RawMessage `json:"buckets"`
+			} `json:"clustering"`
+		}{}
+		err = json.Unmarshal(resp.Aggregations, &rawAggs)
+		if err != nil {
+			return clusterResp, err
+		}
+		for i, bucket := range rawAggs.Clustering.Buckets {
+			aggs.Clustering.Buckets[i].Stats, err = parseClusterStats(stats, bucket)
+			if err != nil {
+				return clusterResp, fmt.Errorf("can not parse cluster statistics: %w", err)
+			}
+		}
+	}
+	return buildClusterResponse(aggs), nil
+}
+
+// buildClusterResponse creates the GeoJSON clusters from the buckets of the clustering aggregation
+// The hull of a cluster is the bounding box of its samples; the drill-down bbox falls back to the geotile if all samples share one location
+func buildClusterResponse(aggs model.ClusterAggregations) model.ClusterResponse {
+	clusterResp := model.ClusterResponse{}
 	for i, b := range aggs.Clustering.Buckets {
-		clusterResp.Clusters = append(clusterResp.Clusters, model.GeoJSONCluster{
+		cluster := model.GeoJSONCluster{
 			ClusterID: i,
 			Centroid: model.GeoJSONFeature{
 				Type: model.GEOJSONTYPE_FEATURE,
@@ -461,25 +635,85 @@ func parseClusterResponse(resp *opensearchapi.SearchResp) (model.ClusterResponse
 					Type:        model.GEOJSON_GEOMETRY_POINT,
 					Coordinates: []any{b.Centroid.Location.Lon, b.Centroid.Location.Lat},
 				},
-				Properties: map[string]any{
-					"clusterID":   i,
-					"clusterSize": b.DocCount,
-				},
+				Properties: clusterProperties(i, b),
 			},
-			// add dummy geometry
 			ConvexHull: model.GeoJSONFeature{
-				Type: model.GEOJSONTYPE_FEATURE,
-				ID:   b.Key,
-				Geometry: model.Geometry{
-					Type:        model.GEOJSON_GEOMETRY_POINT,
-					Coordinates: []any{b.Centroid.Location.Lon, b.Centroid.Location.Lat},
-				},
+				Type:     model.GEOJSONTYPE_FEATURE,
+				ID:       b.Key,
+				Geometry: boundsGeometry(b),
 			},
-		})
+			TileKey: b.Key,
+		}
+		tile, err := geometry.ParseGeotileKey(b.Key)
+		if err != nil {
+			log.Warnf("can not parse geotile key of cluster: %s", err.Error())
+		} else {
+			tileBBox := tile.BBox()
+			cluster.TileBounds = []float64{tileBBox[0].X, tileBBox[0].Y, tileBBox[2].X, tileBBox[2].Y}
+			cluster.DrillDownBBox = formatBBox(tileBBox)
+		}
+		if bounds := b.Bounds.Bounds; bounds != nil && bounds.TopLeft.Lon < bounds.BottomRight.Lon && bounds.BottomRight.Lat < bounds.TopLeft.Lat {
+			cluster.DrillDownBBox = formatBBox([]model.SimplePoint{
+				{X: bounds.TopLeft.Lon, Y: bounds.BottomRight.Lat},
+				{X: bounds.BottomRight.Lon, Y: bounds.BottomRight.Lat},
+				{X: bounds.BottomRight.Lon, Y: bounds.TopLeft.Lat},
+				{X: bounds.TopLeft.Lon, Y: bounds.TopLeft.Lat},
+			})
+		}
+		clusterResp.Clusters = append(clusterResp.Clusters, cluster)
 	}
 	// set to non-null
 	clusterResp.Points = []model.GeoJSONFeature{}
-	return clusterResp, nil
+	return clusterResp
+}
+
+// clusterProperties returns the properties of the centroid of a cluster including the statistics of its samples
+func clusterProperties(clusterID int, b model.Bucket) map[string]any {
+	properties := map[string]any{
+		"clusterID":   clusterID,
+		"clusterSize": b.DocCount,
+	}
+	maps.Copy(properties, b.Stats)
+	return properties
+}
+
+// boundsGeometry returns the bounding box of the samples of a bucket as Polygon
+// A bounding box without width or height is returned as LineString and a single location as Point
+func boundsGeometry(b model.Bucket) model.Geometry {
+	bounds := b.Bounds.Bounds
+	if bounds == nil {
+		return model.Geometry{
+			Type:        model.GEOJSON_GEOMETRY_POINT,
+			Coordinates: []any{b.Centroid.Location.Lon, b.Centroid.Location.Lat},
+		}
+	}
+	west, north := bounds.TopLeft.Lon, bounds.TopLeft.Lat
+	east, south := bounds.BottomRight.Lon, bounds.BottomRight.Lat
+	switch {
+	case west == east && north == south:
+		return model.Geometry{
+			Type:        model.GEOJSON_GEOMETRY_POINT,
+			Coordinates: []any{west, north},
+		}
+	case west == east || north == south:
+		return model.Geometry{
+			Type:        model.GEOJSON_GEOMETRY_LINESTRING,
+			Coordinates: []any{[]float64{west, south}, []float64{east, north}},
+		}
+	}
+	return model.Geometry{
+		Type:        model.GEOJSON_GEOMETRY_POLYGON,
+		Coordinates: []any{[][]float64{{west, south}, {east, south}, {east, north}, {west, north}, {west, south}}},
+	}
+}
+
+// formatBBox formats the points of a bbox like the bbox param
+func formatBBox(bbox []model.SimplePoint) [][]float64 {
+	formatted := make([][]float64, 0, len(bbox))
+	for _, p := range bbox {
+		formatted = append(formatted, []float64{p.X, p.Y})
+	}
+	return formatted
 }
 
 // collectResults marshals result data and aggregates it into the result array
@@ -1,5 +1,16 @@
 package repository
 
+import (
+	"context"
+	"errors"
+
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/filter"
+	"gitlab.gwdg.de/fe/digis/database-api/pkg/model"
+)
+
+// ErrInvalidFilter is returned by a SearchIndex if a filter can not be parsed into a query
+var ErrInvalidFilter = errors.New("invalid filter")
+
 // ConnectionParams holds the parameters for a database connection
 type ConnectionParams struct {
 	Host        string
@@ -12,3 +23,38 @@ type ConnectionParams struct {
 	SSHUser     string
 	SSHPassword string
 }
+
+// SearchIndex interface exposes methods to query a search index holding the sample documents
+type SearchIndex interface {
+	// QueryClustered returns the documents matching the filters clustered into geotiles of the given zoomLevel
+	// The statistics of the samples of each cluster are added to the properties of its centroid
+	QueryClustered(includeFields []string, f filter.Filter, zoomLevel int, stats []ClusterStat) (model.ClusterResponse, error)
+
+	// QueryDensity returns the number of documents matching the filters per cell of the grid
+	// Cells holding no documents are omitted; at most MAX_DENSITY_CELLS cells with the most documents are returned and Truncated is set if there are more
+	QueryDensity(ctx context.Context, f filter.Filter, grid DensityGrid) (model.Density, error)
+
+	// QuerySortSearchAfterStream sends all documents matching the filters sorted by filter.SortKeys as pages of the given size to the resultChan
+	// The resultChan is closed after the last page has been sent or the context is done
+	QuerySortSearchAfterStream(ctx context.Context, includeFields []string, f filter.Filter, size int, resultChan chan model.SearchIndexPage)
+
+	// QuerySortSearchAfterPaginated returns one page of documents matching the filters sorted by filter.SortKeys
+	// Full text searches return the highlights of the matching fields for each document
+	// starting after the position encoded in the cursor; an empty cursor returns the first page
+	// All pages are read from the point in time opened for the first page; if it can not be opened, the first page is returned without cursor
+	// The page holds the cursor to the next page or an empty cursor if it is the last page; ErrInvalidCursor is returned for malformed cursors
+	// and ErrCursorExpired for cursors whose point in time expired
+	QuerySortSearchAfterPaginated(ctx context.Context, includeFields []string, f filter.Filter, size int, cursor string) (model.SearchIndexPage, error)
+
+	// QueryDocuments returns the first size documents matching the filters sorted by filter.SortKeys
+	// Unlike QuerySortSearchAfterPaginated no point in time is opened, so the page holds no cursor
+	QueryDocuments(ctx context.Context, includeFields []string, f filter.Filter, size int) (model.SearchIndexPage, error)
+
+	// QueryFacets returns the number of documents matching the filters per value of the FACETS
+	// The page holds no documents but the total hits and a model.FacetAggregation with at most size buckets per facet
+	QueryFacets(ctx context.Context, f filter.Filter, size int) (model.SearchIndexPage, error)
+
+	// QuerySuggestions returns the number of documents matching the filters per value of the facet starting with the prefix
+	// The prefix is matched independent of case and accents; the page holds a model.FacetAggregation with at most size buckets
+	QuerySuggestions(ctx context.Context, f filter.Filter, facet Facet, prefix string, size int) (model.SearchIndexPage, error)
+}
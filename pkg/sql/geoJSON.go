@@ -42,3 +42,103 @@ LEFT JOIN (
 LEFT JOIN odm2.relatedfeatures r ON r.relatedfeatureid = s.samplingfeatureid
 GROUP BY s.latitude, s.longitude
 `
+
+// GeoJSONSitesPrefix and GeoJSONSitesPostfix wrap the GeoJSONQuery to filter and order the aggregated sites with coordinates
+const GeoJSONSitesPrefix = `SELECT * FROM (`
+const GeoJSONSitesPostfix = `) sites WHERE latitude IS NOT NULL AND longitude IS NOT NULL`
+
+// GeoJSONSitesCountPrefix wraps the GeoJSONQuery to count the aggregated sites
+const GeoJSONSitesCountPrefix = `SELECT count(*) AS numSites FROM (`
+
+// GeoJSONSitesBBoxFilter filters the wrapped sites by a bbox given as two longitude ranges to support bboxes crossing the antimeridian
+const GeoJSONSitesBBoxFilter = `AND latitude BETWEEN :south AND :north AND (longitude BETWEEN :west1 AND :east1 OR longitude BETWEEN :west2 AND :east2)`
+
+// GeoJSONSitesIDFilter filters the wrapped sites by their locationID
+const GeoJSONSitesIDFilter = `AND locationid = :locationid`
+
+// GeoJSONSitesOrder orders the wrapped sites by their location for stable pagination
+const GeoJSONSitesOrder = `ORDER BY latitude, longitude`
+
+// GeoJSONFilteredSitesPrefix wraps the filter query of the samples to aggregate the sites of the matching samples
+// The columns match the GeoJSONQuery plus the number of samples per material and the number of matching sites
+const GeoJSONFilteredSitesPrefix = `
+-- GeoJSON sites of the samples matching the filters
+select *, count(*) over () as numMatched from (
+with filtered as (
+`
+
+// GeoJSONFilteredSitesSamples selects the sites with coordinates of the filtered samples
+// Filters on the sites can be added with AND, e.g. GeoJSONFilteredSitesBBoxFilter
+const GeoJSONFilteredSitesSamples = `
+), site_samples as (
+	select s.samplingfeatureid as siteid,
+	s.latitude,
+	s.longitude,
+	s.sitedescription,
+	r.samplingfeatureid as sampleid
+	from odm2.sites s
+	join odm2.relatedfeatures r on r.relatedfeatureid = s.samplingfeatureid
+	join filtered on filtered.sampleid = r.samplingfeatureid
+	where s.latitude is not null and s.longitude is not null
+`
+
+// GeoJSONFilteredSitesBBoxFilter filters the site samples by a bbox given as two longitude ranges like GeoJSONSitesBBoxFilter
+const GeoJSONFilteredSitesBBoxFilter = `and s.latitude between :south and :north and (s.longitude between :west1 and :east1 or s.longitude between :west2 and :east2)`
+
+// GeoJSONFilteredSitesPostfix aggregates the site samples by their coordinates
+const GeoJSONFilteredSitesPostfix = `
+), site_materials as (
+	-- number of samples per material of each site
+	select m.latitude, m.longitude, jsonb_object_agg(m.material, m.numSamples) as materials
+	from (
+		select ss.latitude, ss.longitude, coalesce(mat.material, 'unknown') as material, count(distinct ss.sampleid) as numSamples
+		from site_samples ss
+		left join (
+			select sr.sampleid, ann_mat.annotationtext as material
+			from odm2.samplerelations sr
+			join odm2.annotations ann_mat on ann_mat.annotationid = sr.annotationid and ann_mat.annotationcode = 'g_batches.material'
+		) mat on mat.sampleid = ss.sampleid
+		group by ss.latitude, ss.longitude, coalesce(mat.material, 'unknown')
+	) m
+	group by m.latitude, m.longitude
+)
+select ss.latitude,
+ss.longitude,
+min(ss.siteid) as locationID,
+count(distinct ss.sampleid) as numSamplingFeatureIDs,
+array_agg(distinct ss.sampleid) as samplingFeatureIDs,
+(array_agg(distinct gs.settingname))[1] as setting,
+(array_agg(distinct toplevelloc.locationname))[1] as loc1,
+(array_agg(distinct secondlevelloc.locationname))[1] as loc2,
+(array_agg(distinct thirdlevelloc.locationname))[1] as loc3,
+(array_agg(distinct ss.sitedescription))[1] as landOrSea,
+(array_agg(sm.materials))[1] as materials
+from site_samples ss
+join site_materials sm on sm.latitude = ss.latitude and sm.longitude = ss.longitude
+left join odm2.sitegeologicalsettings sgs on sgs.samplingfeatureid = ss.siteid
+left join odm2.geologicalsettings gs on gs.settingid = sgs.settingid
+left join (
+	select sg.samplingfeatureid,
+	sg.locationname
+	from odm2.sitegeolocations sg
+	left join odm2.geolocations g on g.geolocationid = sg.geolocationid
+	where "right"(g.locationhierarchy::character varying::text, 3) = '100'::text
+) toplevelloc on toplevelloc.samplingfeatureid = ss.siteid
+left join (
+	select sg.samplingfeatureid,
+	sg.locationname
+	from odm2.sitegeolocations sg
+	left join odm2.geolocations g on g.geolocationid = sg.geolocationid
+	where "right"(g.locationhierarchy::character varying::text, 3) = '200'::text
+) secondlevelloc on secondlevelloc.samplingfeatureid = ss.siteid
+left join (
+	select sg.samplingfeatureid,
+	sg.locationname
+	from odm2.sitegeolocations sg
+	left join odm2.geolocations g on g.geolocationid = sg.geolocationid
+	where "right"(g.locationhierarchy::character varying::text, 3) = '300'::text
+) thirdlevelloc on thirdlevelloc.samplingfeatureid = ss.siteid
+group by ss.latitude, ss.longitude
+) sites
+order by latitude, longitude
+`
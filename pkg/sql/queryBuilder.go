@@ -39,13 +39,16 @@ const (
 	OpLike      FilterOperator = "LIKE"
 	OpBetween   FilterOperator = "BETWEEN"
 	OpInPolygon FilterOperator = "INPOLYGON"
+	OpNotNull   FilterOperator = "IS NOT NULL"
 
-	OpEqArray FilterOperator = "eq_array"
-	OpInArray FilterOperator = "in_array"
+	OpEqArray      FilterOperator = "eq_array"
+	OpInArray      FilterOperator = "in_array"
+	OpNotNullArray FilterOperator = "not_null_array"
 
 	OpAnd   FilterJunctor = "AND"
 	OpOr    FilterJunctor = "OR"
 	OpWhere FilterJunctor = "WHERE"
+	OpNone  FilterJunctor = ""
 
 	SEPARATOR string = ","
 
@@ -99,9 +102,35 @@ func (q *Query) AddFilter(key string, value string, operator FilterOperator, jun
 		q.AddEqArrayFilter(key, value, junctor)
 	case OpInArray:
 		q.AddInArrayFilter(key, value, junctor)
+	case OpNotNull:
+		q.AddNotNullFilter(key, junctor)
+	case OpNotNullArray:
+		q.AddNotEmptyArrayFilter(key, junctor)
 	}
 }
 
+// Open a parenthesized group of filters, e.g. for disjunctions
+// The first filter of the group has to be added with the junctor OpNone
+func (q *Query) OpenFilterGroup(junctor FilterJunctor) {
+	q.AddSQLBlock(fmt.Sprintf("%s (", junctor))
+}
+
+// Close a group of filters opened with OpenFilterGroup
+func (q *Query) CloseFilterGroup() {
+	q.AddSQLBlock(")")
+}
+
+// Add a filter with operator "IS NOT NULL" to the query
+func (q *Query) AddNotNullFilter(key string, junctor FilterJunctor) {
+	q.baseQuery = fmt.Sprintf("%s %s %s %s", q.baseQuery, junctor, key, OpNotNull)
+}
+
+// Add a filter to check if an array is not empty to the query
+// yields `junctor coalesce(cardinality(key), 0) > 0`
+func (q *Query) AddNotEmptyArrayFilter(key string, junctor FilterJunctor) {
+	q.baseQuery = fmt.Sprintf("%s %s coalesce(cardinality(%s), 0) > 0", q.baseQuery, junctor, key)
+}
+
 // Add a filter with operator "=", "<", ">", "<=", ">=" to the query
 func (q *Query) AddComparisonFilter(key string, value string, junctor FilterJunctor, comparator FilterOperator) {
 	q.filterValues = append(q.filterValues, value)
@@ -208,6 +237,23 @@ func (q *Query) AddInTranslatedPolygonFilter(key string, value string, junctor F
 	q.baseQuery = fmt.Sprintf("%s %s", q.baseQuery, filterString)
 }
 
+// Add a filter to check for geometries within the geometry given as WKT to the query, e.g. a MULTIPOLYGON with holes
+func (q *Query) AddInWKTFilter(key string, wkt string, junctor FilterJunctor) {
+	q.filterValues = append(q.filterValues, wkt)
+	placeholder := fmt.Sprintf("$%d", len(q.filterValues))
+	filterString := fmt.Sprintf("%s ST_WITHIN(%s, ST_GEOMETRYFROMTEXT(%s, 4326))", junctor, key, placeholder)
+	q.baseQuery = fmt.Sprintf("%s %s", q.baseQuery, filterString)
+}
+
+// Add a filter to check for geometries within the geodesic distance in meters from a point to the query
+// The distance is calculated on the geography, so it is not affected by the -180/+180 bounds
+func (q *Query) AddWithinDistanceFilter(key string, lon float64, lat float64, meters float64, junctor FilterJunctor) {
+	q.filterValues = append(q.filterValues, lon, lat, meters)
+	n := len(q.filterValues)
+	filterString := fmt.Sprintf("%s ST_DWITHIN(%s::geography, ST_SETSRID(ST_MAKEPOINT($%d, $%d), 4326)::geography, $%d)", junctor, key, n-2, n-1, n)
+	q.baseQuery = fmt.Sprintf("%s %s", q.baseQuery, filterString)
+}
+
 // Wraps the current query in an SQL prefix and postfix
 // Do not enter user-provided values here as they are not sanitized.
 func (q *Query) WrapInSQL(prefix string, postfix string) {
@@ -286,7 +332,9 @@ func MapArrayOperators(op FilterOperator) (FilterOperator, error) {
 		return OpEqArray, nil
 	case OpIn:
 		return OpInArray, nil
+	case OpNotNull:
+		return OpNotNullArray, nil
 	default:
-		return "", fmt.Errorf("Invalid operator for array use-case: '%s'! Use 'eq' or 'in'", op)
+		return "", fmt.Errorf("Invalid operator for array use-case: '%s'! Use 'eq', 'in' or 'exists'", op)
 	}
 }
@@ -82,8 +82,7 @@ from odm2.samplelistinformationextended spec
 //	Locationname lvl3
 //	Latitude
 //	Longitude
-const GetSamplingfeatureIdsByFilterLocationsStart = `
-join (
+const GetSamplingfeatureIdsByFilterLocationsSelect = `
 	-- location data
 	select r_sample.samplingfeatureid as sample
 	from odm2.sites s
@@ -115,6 +114,8 @@ join (
 	) thirdlevelloc on thirdlevelloc.samplingfeatureid = s.samplingfeatureid
 	left join odm2.relatedfeatures r_sample on r_sample.relatedfeatureid = s.samplingfeatureid -- samples for each location
 `
+const GetSamplingfeatureIdsByFilterLocationsStart = `
+join (` + GetSamplingfeatureIdsByFilterLocationsSelect
 const GetSamplingfeatureIdsByFilterLocationsEnd = `
 ) loc on loc.sample = spec.sampleid
 `
@@ -127,12 +128,13 @@ const GetSamplingfeatureIdsByFilterLocationsEnd = `
 //	Mineral
 //	HostMineral
 //	InclusionMineral
-const GetSamplingfeatureIdsByFilterTaxonomicClassifiersStart = `
-join (
+const GetSamplingfeatureIdsByFilterTaxonomicClassifiersSelect = `
 	-- taxonomic classifiers
 	select st.samplingfeatureid
 	from odm2.sampletaxonomicclassifiers st
 `
+const GetSamplingfeatureIdsByFilterTaxonomicClassifiersStart = `
+join (` + GetSamplingfeatureIdsByFilterTaxonomicClassifiersSelect
 const GetSamplingfeatureIdsByFilterTaxonomicClassifiersEnd = `
 ) tax on tax.samplingfeatureid = spec.sampleid
 `
@@ -143,12 +145,13 @@ const GetSamplingfeatureIdsByFilterTaxonomicClassifiersEnd = `
 //	Material
 //	InclusionType
 //	SamplingTechnique
-const GetSamplingfeatureIdsByFilterAnnotationsStart = `
-join (
+const GetSamplingfeatureIdsByFilterAnnotationsSelect = `
 	-- annotations
 	select sr.sampleid
 	from odm2.samplerelations sr
 `
+const GetSamplingfeatureIdsByFilterAnnotationsStart = `
+join (` + GetSamplingfeatureIdsByFilterAnnotationsSelect
 
 const GetSamplingfeatureIdsByFilterAnnotationsMaterial = `
 left join odm2.annotations ann_mat on ann_mat.annotationid = sr.annotationid and ann_mat.annotationcode = 'g_batches.material'
@@ -171,8 +174,8 @@ const GetSamplingfeatureIdsByFilterAnnotationsEnd = `
 `
 
 // Filter query-module Results
-// Filter options are defined by conjunctive filter tuples:
-// (TYPE, ELEMENT, MIN, MAX)
+// Filter options are defined by filter tuples connected by AND or OR:
+// (TYPE, ELEMENT[/DIVISOR], MIN, MAX[, UNIT[, METHOD]])
 const GetSamplingfeatureIdsByFilterResultsStartPre = `
 join (
 	-- results
@@ -188,6 +191,27 @@ select distinct n.batchid as samplingfeatureid, n.sampleid
 from odm2.normalizedchemistry n
 `
 
+// GetSamplingfeatureIdsByFilterResultsMeasuredExpression is used for expressions filtering on units or methods
+// which are only available for the measured values
+const GetSamplingfeatureIdsByFilterResultsMeasuredExpression = `
+select distinct n.samplingfeatureid, sr.sampleid
+from odm2.measuredvalues n
+join (
+	select distinct sr.batch, sr.sampleid
+	from odm2.samplerelations sr
+) sr on sr.batch = n.samplingfeatureid
+`
+
+// GetSamplingfeatureIdsByFilterResultsRatioJoin joins the divisor of ratio expressions measured in the same batch
+const GetSamplingfeatureIdsByFilterResultsRatioJoin = `
+join odm2.normalizedchemistry d on d.batchid = n.batchid and d.sampleid = n.sampleid
+`
+
+// GetSamplingfeatureIdsByFilterResultsMeasuredRatioJoin joins the divisor of measured ratio expressions
+const GetSamplingfeatureIdsByFilterResultsMeasuredRatioJoin = `
+join odm2.measuredvalues d on d.samplingfeatureid = n.samplingfeatureid
+`
+
 const GetSamplingfeatureIdsByFilterResultsEnd = `
 ) results on results.sampleid = spec.sampleid
 `
@@ -198,11 +222,12 @@ const GetSamplingfeatureIdsByFilterResultsEnd = `
 //	ExternalIdentifier
 //	Title
 //	PublicationYear
-const GetSamplingfeatureIdsByFilterCitationsStart = `
-join (
+const GetSamplingfeatureIdsByFilterCitationsSelect = `
 	select distinct scd.samplingfeatureid
 	from odm2.samplecitationdata scd
 `
+const GetSamplingfeatureIdsByFilterCitationsStart = `
+join (` + GetSamplingfeatureIdsByFilterCitationsSelect
 
 const GetSamplingfeatureIdsByFilterCitationsEnd = `
 ) citations on citations.samplingfeatureid = spec.sampleid
@@ -215,11 +240,12 @@ const GetSamplingfeatureIdsByFilterCitationsEnd = `
 //	AgeMax
 //	GeologicalAge
 //	GeologicalAgePrefix
-const GetSamplingfeatureIdsByFilterAgesStart = `
-join (
+const GetSamplingfeatureIdsByFilterAgesSelect = `
 	select sa.samplingfeatureid
 	from odm2.specimenages sa
 `
+const GetSamplingfeatureIdsByFilterAgesStart = `
+join (` + GetSamplingfeatureIdsByFilterAgesSelect
 
 const GetSamplingfeatureIdsByFilterAgesEnd = `
 ) ages on ages.samplingfeatureid = spec.sampleid
@@ -229,8 +255,7 @@ const GetSamplingfeatureIdsByFilterAgesEnd = `
 // Filter options are:
 //
 //	OrganizationName
-const GestSamplingfeatureIdsByFilterOrganizationsStart = `
-join (
+const GestSamplingfeatureIdsByFilterOrganizationsSelect = `
 	select 
 	s.samplingfeatureid as sid,
 	s.samplingfeaturedescription
@@ -240,15 +265,29 @@ join (
 	left join odm2.relatedfeatures r on r.samplingfeatureid = f.samplingfeatureid and r.relationshiptypecv != 'Is identical to'
 	left join odm2.samplingfeatures s on s.samplingfeatureid = r.relatedfeatureid
 `
+const GestSamplingfeatureIdsByFilterOrganizationsStart = `
+join (` + GestSamplingfeatureIdsByFilterOrganizationsSelect
 
 const GestSamplingfeatureIdsByFilterOrganizationsEnd = `
 ) organizations on spec.sampleid = organizations.sid
 `
 
+// Filter query-module Negations
+// Negated filters are evaluated per sample like must_not of the search index:
+// a sample is excluded if any row of the Select block of the module of the field matches the positive filter
+// The ids are selected from the samplingfeatures, so samples without rows in the module are kept
+const GetSamplingfeatureIdsByFilterNegationStart = `
+join (
+	-- samples not excluded by negated filters
+	select sf.samplingfeatureid
+	from odm2.samplingfeatures sf
+`
+
 // Filter query-module Geometry
 // Filter options are:
 //
 //	ST_WITHIN(geometry, st_wrapx(given-polygon))
+//	ST_DWITHIN(geography, given-point, given-radius)
 const GestSamplingfeatureIdsByFilterGeometryStart = `
 join (
 select r.samplingfeatureid as sampleid,